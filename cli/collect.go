@@ -0,0 +1,68 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+var collectCLICommand = cli.Command{
+	Name:  "collect",
+	Usage: "collect a diagnostics bundle of a sandbox",
+	ArgsUsage: `<sandbox-id>
+
+   <sandbox-id> is the ID of the sandbox to collect diagnostics of.`,
+
+	Description: `The collect command writes a diagnostics bundle of a sandbox to the
+       diagnostics_dir of the runtime configuration and prints its path. The
+       bundle holds the sandbox state, the network and cgroup statistics, the
+       hypervisor state, the tail of the guest log and the hypervisor and
+       virtiofsd logs.`,
+
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "guest-memory",
+			Usage: "add a dump of the guest memory to the bundle",
+		},
+	},
+
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		sandboxID := context.Args().First()
+		if sandboxID == "" {
+			return fmt.Errorf("Missing sandbox ID")
+		}
+
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("invalid runtime config")
+		}
+
+		kataLog = kataLog.WithField("sandbox", sandboxID)
+		setExternalLoggers(ctx, kataLog)
+
+		config := runtimeConfig.Diagnostics
+		if context.Bool("guest-memory") {
+			config.GuestMemory = true
+		}
+
+		dir, err := vci.CollectDiagnostics(ctx, sandboxID, config)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(defaultOutputFile, dir)
+		return nil
+	},
+}
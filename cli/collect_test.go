@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestCollectCliFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	fn, ok := collectCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	runtimeConfig := oci.RuntimeConfig{
+		Diagnostics: vc.DiagnosticsConfig{
+			Dir:        "/var/lib/kata-containers/diagnostics",
+			MaxBundles: 5,
+		},
+	}
+
+	// The sandbox ID is mandatory.
+	set := flag.NewFlagSet("", 0)
+	set.Bool("guest-memory", false, "")
+	ctx := createCLIContext(set)
+	ctx.App.Metadata["runtimeConfig"] = runtimeConfig
+	assert.Error(fn(ctx))
+
+	var collected vc.DiagnosticsConfig
+	testingImpl.CollectDiagnosticsFunc = func(ctx context.Context, sandboxID string, config vc.DiagnosticsConfig) (string, error) {
+		collected = config
+		return "/var/lib/kata-containers/diagnostics/" + sandboxID, nil
+	}
+	defer func() {
+		testingImpl.CollectDiagnosticsFunc = nil
+	}()
+
+	output, err := ioutil.TempFile("", "output")
+	assert.NoError(err)
+	defer os.Remove(output.Name())
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = output
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	// The guest memory dump is requested on the command line.
+	set.Parse([]string{"--guest-memory", testSandboxID})
+	ctx = createCLIContext(set)
+	ctx.App.Metadata["runtimeConfig"] = runtimeConfig
+	assert.NoError(fn(ctx))
+
+	assert.Equal(runtimeConfig.Diagnostics.Dir, collected.Dir)
+	assert.True(collected.GuestMemory)
+
+	data, err := ioutil.ReadFile(output.Name())
+	assert.NoError(err)
+	assert.Equal("/var/lib/kata-containers/diagnostics/"+testSandboxID+"\n", string(data))
+}
@@ -12,6 +12,8 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
@@ -19,13 +21,23 @@ import (
 	pb "github.com/kata-containers/runtime/protocols/cache"
 	vc "github.com/kata-containers/runtime/virtcontainers"
 	vf "github.com/kata-containers/runtime/virtcontainers/factory"
+	"github.com/kata-containers/runtime/virtcontainers/factory/grpccache"
+	"github.com/kata-containers/runtime/virtcontainers/factory/template"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"golang.org/x/sys/unix"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// listenFdsStart is the first file descriptor passed by systemd socket
+// activation.
+const listenFdsStart = 3
+
 var factorySubCmds = []cli.Command{
 	initFactoryCommand,
 	destroyFactoryCommand,
@@ -45,6 +57,15 @@ type cacheServer struct {
 	rpc     *grpc.Server
 	factory vc.Factory
 	done    chan struct{}
+
+	// token authenticates the clients, if not empty.
+	token string
+
+	sync.Mutex
+	// draining is set once the server is stopping, VMs not being handed
+	// out anymore.
+	draining bool
+	quitOnce sync.Once
 }
 
 var jsonVMConfig *pb.GrpcVMConfig
@@ -66,7 +87,36 @@ func (s *cacheServer) Config(ctx context.Context, empty *types.Empty) (*pb.GrpcV
 
 // GetBaseVM requests a paused VM and convert it to gRPC protocol.
 func (s *cacheServer) GetBaseVM(ctx context.Context, empty *types.Empty) (*pb.GrpcVM, error) {
+	return s.getVM(ctx, s.factory.Config())
+}
+
+// GetVM requests a paused VM of the requested shape and converts it to gRPC
+// protocol. The VM has the shape of the base factory config if no pool has
+// the requested one.
+func (s *cacheServer) GetVM(ctx context.Context, req *pb.GrpcVMRequest) (*pb.GrpcVM, error) {
+	if req.Version < 2 || req.Version > grpccache.ProtocolVersion {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported VM cache protocol version %d", req.Version)
+	}
+
 	config := s.factory.Config()
+	if req.Cpu > 0 {
+		config.HypervisorConfig.NumVCPUs = req.Cpu
+	}
+	if req.Memory > 0 {
+		config.HypervisorConfig.MemorySize = req.Memory
+	}
+
+	return s.getVM(ctx, config)
+}
+
+func (s *cacheServer) getVM(ctx context.Context, config vc.VMConfig) (*pb.GrpcVM, error) {
+	s.Lock()
+	draining := s.draining
+	s.Unlock()
+
+	if draining {
+		return nil, status.Error(codes.Unavailable, "VM cache server is stopping")
+	}
 
 	vm, err := s.factory.GetBaseVM(ctx, config)
 	if err != nil {
@@ -76,18 +126,45 @@ func (s *cacheServer) GetBaseVM(ctx context.Context, empty *types.Empty) (*pb.Gr
 	return vm.ToGrpc(config)
 }
 
+// Version returns the version of the VM cache protocol of the server.
+func (s *cacheServer) Version(ctx context.Context, empty *types.Empty) (*pb.GrpcVersion, error) {
+	return &pb.GrpcVersion{Version: grpccache.ProtocolVersion}, nil
+}
+
+// authorize rejects the requests not carrying the token of the server.
+func (s *cacheServer) authorize(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := grpccache.CheckToken(ctx, s.token); err != nil {
+		kataLog.WithField("method", info.FullMethod).Warn("reject unauthenticated VM cache request")
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// quit stops handing out VMs and stops the server once the requests being
+// served are done.
 func (s *cacheServer) quit() {
-	s.rpc.GracefulStop()
-	close(s.done)
+	s.quitOnce.Do(func() {
+		s.Lock()
+		s.draining = true
+		s.Unlock()
+
+		s.rpc.GracefulStop()
+		close(s.done)
+	})
 }
 
-// Quit will stop VMCache server after 1 second.
+// Quit drains and stops the VMCache server.
 func (s *cacheServer) Quit(ctx context.Context, empty *types.Empty) (*types.Empty, error) {
-	go func() {
-		kataLog.Info("VM cache server will stop after 1 second")
-		time.Sleep(time.Second)
-		s.quit()
-	}()
+	kataLog.Info("VM cache server is stopping")
+
+	s.Lock()
+	s.draining = true
+	s.Unlock()
+
+	// GracefulStop waits for this request to be done.
+	go s.quit()
+
 	return &types.Empty{}, nil
 }
 
@@ -95,6 +172,7 @@ func (s *cacheServer) Status(ctx context.Context, empty *types.Empty) (*pb.GrpcS
 	stat := pb.GrpcStatus{
 		Pid:      int64(os.Getpid()),
 		Vmstatus: s.factory.GetVMStatus(),
+		Pools:    s.factory.GetPoolStatus(),
 	}
 	return &stat, nil
 }
@@ -121,6 +199,164 @@ func getUnixListener(path string) (net.Listener, error) {
 	return l, nil
 }
 
+// getActivationListener returns the socket passed by systemd socket
+// activation, nil if the server was not socket activated.
+func getActivationListener() (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || fds != 1 {
+		return nil, fmt.Errorf("VM cache server expects a single activation socket, got LISTEN_FDS=%q", os.Getenv("LISTEN_FDS"))
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	unix.CloseOnExec(listenFdsStart)
+	f := os.NewFile(listenFdsStart, "vm-cache-socket")
+	defer f.Close()
+
+	return net.FileListener(f)
+}
+
+// peerCredListener only accepts the connections of root, the server user
+// and the allowed users and groups, checked with SO_PEERCRED.
+type peerCredListener struct {
+	net.Listener
+	uids map[uint32]bool
+	gids map[uint32]bool
+}
+
+func newPeerCredListener(l net.Listener, uids, gids []uint32) *peerCredListener {
+	pl := &peerCredListener{
+		Listener: l,
+		uids:     map[uint32]bool{0: true, uint32(os.Geteuid()): true},
+		gids:     map[uint32]bool{},
+	}
+
+	for _, uid := range uids {
+		pl.uids[uid] = true
+	}
+	for _, gid := range gids {
+		pl.gids[gid] = true
+	}
+
+	return pl
+}
+
+// Accept returns the next connection of an allowed peer, closing the other
+// ones.
+func (l *peerCredListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		cred, err := getPeerCred(conn)
+		if err != nil {
+			kataLog.WithError(err).Warn("reject VM cache connection")
+			conn.Close()
+			continue
+		}
+
+		if l.uids[cred.Uid] || l.gids[cred.Gid] {
+			return conn, nil
+		}
+
+		kataLog.WithFields(logrus.Fields{
+			"pid": cred.Pid,
+			"uid": cred.Uid,
+			"gid": cred.Gid,
+		}).Warn("reject VM cache connection")
+		conn.Close()
+	}
+}
+
+// getPeerCred returns the credentials of the peer of a unix socket
+// connection.
+func getPeerCred(conn net.Conn) (*unix.Ucred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("%s connection has no peer credentials", conn.LocalAddr().Network())
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cred, credErr
+}
+
+// getCacheListener returns the listener of the VM cache server: the socket
+// passed by systemd if socket activated, the endpoint otherwise. The
+// connections are restricted to the allowed peers.
+func getCacheListener(factoryConfig oci.FactoryConfig) (net.Listener, error) {
+	l, err := getActivationListener()
+	if err != nil {
+		return nil, err
+	}
+
+	if l == nil {
+		path, err := grpccache.ParseEndpoint(factoryConfig.VMCacheEndpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		if l, err = getUnixListener(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return newCacheListener(l, factoryConfig)
+}
+
+// newCacheListener restricts the connections of l to the allowed peers. l
+// must be a unix stream socket, the peers of which can be checked, the
+// socket passed by systemd being of any type.
+func newCacheListener(l net.Listener, factoryConfig oci.FactoryConfig) (net.Listener, error) {
+	if network := l.Addr().Network(); network != "unix" {
+		l.Close()
+		return nil, fmt.Errorf("VM cache server expects a unix stream socket, got a %s socket", network)
+	}
+
+	return newPeerCredListener(l, factoryConfig.VMCacheAllowedUIDs, factoryConfig.VMCacheAllowedGIDs), nil
+}
+
+// vmCacheToken returns the token authenticating the VMCache clients, if
+// any.
+func vmCacheToken(factoryConfig oci.FactoryConfig) (string, error) {
+	if factoryConfig.VMCacheTokenPath == "" {
+		return "", nil
+	}
+
+	return grpccache.ReadToken(factoryConfig.VMCacheTokenPath)
+}
+
+// dialVMCache connects to the VMCache server.
+func dialVMCache(factoryConfig oci.FactoryConfig) (*grpc.ClientConn, error) {
+	token, err := vmCacheToken(factoryConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return grpccache.Dial(factoryConfig.VMCacheEndpoint, token)
+}
+
 var handledSignals = []os.Signal{
 	syscall.SIGTERM,
 	syscall.SIGINT,
@@ -144,6 +380,38 @@ func handleSignals(s *cacheServer, signals chan os.Signal) {
 	}()
 }
 
+// factoryPools returns the configuration of the VM cache pools, the VMs of
+// a pool being the ones of vmConfig with the shape of the pool.
+func factoryPools(runtimeConfig oci.RuntimeConfig, vmConfig vc.VMConfig) []vf.PoolConfig {
+	var pools []vf.PoolConfig
+
+	for _, p := range runtimeConfig.FactoryConfig.VMCachePools {
+		config := vmConfig
+		if p.NumVCPUs > 0 {
+			config.HypervisorConfig.NumVCPUs = p.NumVCPUs
+		}
+		if p.MemorySize > 0 {
+			config.HypervisorConfig.MemorySize = p.MemorySize
+		}
+		if p.KernelPath != "" {
+			config.HypervisorConfig.KernelPath = p.KernelPath
+		}
+		if p.ImagePath != "" || p.InitrdPath != "" {
+			config.HypervisorConfig.ImagePath = p.ImagePath
+			config.HypervisorConfig.InitrdPath = p.InitrdPath
+		}
+
+		pools = append(pools, vf.PoolConfig{
+			Name:     p.Name,
+			Cache:    p.VMCacheNumber,
+			CacheMin: p.VMCacheMin,
+			VMConfig: config,
+		})
+	}
+
+	return pools
+}
+
 var initFactoryCommand = cli.Command{
 	Name:  "init",
 	Usage: "initialize a VM factory based on kata-runtime configuration",
@@ -163,6 +431,7 @@ var initFactoryCommand = cli.Command{
 			TemplatePath: runtimeConfig.FactoryConfig.TemplatePath,
 			Cache:        runtimeConfig.FactoryConfig.VMCacheNumber,
 			VMCache:      runtimeConfig.FactoryConfig.VMCacheNumber > 0,
+			CacheMin:     runtimeConfig.FactoryConfig.VMCacheMin,
 			VMConfig: vc.VMConfig{
 				HypervisorType:   runtimeConfig.HypervisorType,
 				HypervisorConfig: runtimeConfig.HypervisorConfig,
@@ -174,19 +443,31 @@ var initFactoryCommand = cli.Command{
 		}
 
 		if runtimeConfig.FactoryConfig.VMCacheNumber > 0 {
+			factoryConfig.CacheIdleTimeout = time.Duration(runtimeConfig.FactoryConfig.VMCacheIdleTimeout) * time.Second
+			factoryConfig.CacheMinFreeMemory = runtimeConfig.FactoryConfig.VMCacheMinFreeMemory
+			factoryConfig.CacheCheckInterval = time.Duration(runtimeConfig.FactoryConfig.VMCacheCheckInterval) * time.Second
+			factoryConfig.CacheMaxAge = time.Duration(runtimeConfig.FactoryConfig.VMCacheMaxAge) * time.Second
+			factoryConfig.Pools = factoryPools(runtimeConfig, factoryConfig.VMConfig)
+
 			f, err := vf.NewFactory(ctx, factoryConfig, false)
 			if err != nil {
 				return err
 			}
 			defer f.CloseFactory(ctx)
 
+			token, err := vmCacheToken(runtimeConfig.FactoryConfig)
+			if err != nil {
+				return err
+			}
+
 			s := &cacheServer{
-				rpc:     grpc.NewServer(),
 				factory: f,
+				token:   token,
 			}
+			s.rpc = grpc.NewServer(grpc.UnaryInterceptor(s.authorize))
 			pb.RegisterCacheServiceServer(s.rpc, s)
 
-			l, err := getUnixListener(runtimeConfig.FactoryConfig.VMCacheEndpoint)
+			l, err := getCacheListener(runtimeConfig.FactoryConfig)
 			if err != nil {
 				return err
 			}
@@ -238,9 +519,9 @@ var destroyFactoryCommand = cli.Command{
 		}
 
 		if runtimeConfig.FactoryConfig.VMCacheNumber > 0 {
-			conn, err := grpc.Dial(fmt.Sprintf("unix://%s", runtimeConfig.FactoryConfig.VMCacheEndpoint), grpc.WithInsecure())
+			conn, err := dialVMCache(runtimeConfig.FactoryConfig)
 			if err != nil {
-				return errors.Wrapf(err, "failed to connect %q", runtimeConfig.FactoryConfig.VMCacheEndpoint)
+				return err
 			}
 			defer conn.Close()
 			_, err = pb.NewCacheServiceClient(conn).Quit(ctx, &types.Empty{})
@@ -270,12 +551,94 @@ var destroyFactoryCommand = cli.Command{
 			} else {
 				f.CloseFactory(ctx)
 			}
+
+			// Destroy the templates of the other kernels, nested ones
+			// first.
+			templates := template.List(runtimeConfig.FactoryConfig.TemplatePath)
+			for i := len(templates) - 1; i >= 0; i-- {
+				template.Destroy(templates[i])
+			}
 		}
 		fmt.Fprintln(defaultOutputFile, "vm factory destroyed")
 		return nil
 	},
 }
 
+// printVMCacheStatus prints the sizing and the hits and misses of each
+// pool, then the cached VMs, with the memory they share with the templates
+// under templatePath if not empty.
+func printVMCacheStatus(status *pb.GrpcStatus, templatePath string) {
+	for _, p := range status.Pools {
+		fmt.Fprintf(defaultOutputFile, "VM pool %s: VMs = %d Target = %d Min = %d Max = %d Hits = %d Misses = %d\n",
+			p.Name, p.Vms, p.Target, p.Min, p.Max, p.Hits, p.Misses)
+	}
+
+	for _, vs := range status.Vmstatus {
+		line := fmt.Sprintf("VM pid = %d Cpu = %d Memory = %dMiB Pool = %s", vs.Pid, vs.Cpu, vs.Memory, vs.Pool)
+		if templatePath != "" {
+			if stats, err := utils.GetMappingStats(int(vs.Pid), templatePath); err == nil && len(stats) > 0 {
+				shared, privateDirty := sumMappingStats(stats)
+				line += fmt.Sprintf(" Shared = %dMiB Private = %dMiB", shared>>20, privateDirty>>20)
+			}
+		}
+		fmt.Fprintln(defaultOutputFile, line)
+	}
+}
+
+// sumMappingStats returns the template memory still shared and the one
+// privately dirtied by mappings.
+func sumMappingStats(stats []utils.MappingStats) (uint64, uint64) {
+	var shared, privateDirty uint64
+	for _, s := range stats {
+		shared += s.Shared()
+		privateDirty += s.PrivateDirty
+	}
+	return shared, privateDirty
+}
+
+// vmmPids returns the pids of the hypervisors of the sandboxes and of the
+// VMs cached by the VMCache server of status if not nil, which are the
+// processes VMs created from templates run in.
+func vmmPids(ctx context.Context, status *pb.GrpcStatus) []int {
+	var pids []int
+	if status != nil {
+		for _, vs := range status.Vmstatus {
+			pids = append(pids, int(vs.Pid))
+		}
+	}
+
+	sandboxes, err := vci.ListSandbox(ctx)
+	if err != nil {
+		kataLog.WithError(err).Warn("failed to list sandboxes")
+	}
+	for _, s := range sandboxes {
+		pids = append(pids, s.VMMPids...)
+	}
+
+	return pids
+}
+
+// printTemplateStatus prints the templates under templatePath, with the
+// memory each VM created from them, among the hypervisors pids, still
+// shares with them.
+func printTemplateStatus(templatePath string, pids []int) {
+	for _, path := range template.List(templatePath) {
+		stats, err := template.CloneStats(path, pids)
+		if err != nil {
+			fmt.Fprintln(defaultOutputFile, errors.Wrapf(err, "failed to get clones of VM template %s", path))
+			continue
+		}
+
+		shared, privateDirty := sumMappingStats(stats)
+		fmt.Fprintf(defaultOutputFile, "VM template %s: Clones = %d Shared = %dMiB Private = %dMiB\n",
+			path, len(stats), shared>>20, privateDirty>>20)
+		for _, s := range stats {
+			fmt.Fprintf(defaultOutputFile, "VM pid = %d Shared = %dMiB Private = %dMiB\n",
+				s.Pid, s.Shared()>>20, s.PrivateDirty>>20)
+		}
+	}
+}
+
 var statusFactoryCommand = cli.Command{
 	Name:  "status",
 	Usage: "query the status of VM factory",
@@ -290,20 +653,24 @@ var statusFactoryCommand = cli.Command{
 			return errors.New("invalid runtime config")
 		}
 
+		var cacheStatus *pb.GrpcStatus
 		if runtimeConfig.FactoryConfig.VMCacheNumber > 0 {
-			conn, err := grpc.Dial(fmt.Sprintf("unix://%s", runtimeConfig.FactoryConfig.VMCacheEndpoint), grpc.WithInsecure())
+			conn, err := dialVMCache(runtimeConfig.FactoryConfig)
 			if err != nil {
-				fmt.Fprintln(defaultOutputFile, errors.Wrapf(err, "failed to connect %q", runtimeConfig.FactoryConfig.VMCacheEndpoint))
+				fmt.Fprintln(defaultOutputFile, err)
 			} else {
 				defer conn.Close()
 				status, err := pb.NewCacheServiceClient(conn).Status(ctx, &types.Empty{})
+				cacheStatus = status
 				if err != nil {
 					fmt.Fprintln(defaultOutputFile, errors.Wrapf(err, "failed to call gRPC Status\n"))
 				} else {
 					fmt.Fprintf(defaultOutputFile, "VM cache server pid = %d\n", status.Pid)
-					for _, vs := range status.Vmstatus {
-						fmt.Fprintf(defaultOutputFile, "VM pid = %d Cpu = %d Memory = %dMiB\n", vs.Pid, vs.Cpu, vs.Memory)
+					var templatePath string
+					if runtimeConfig.FactoryConfig.Template {
+						templatePath = runtimeConfig.FactoryConfig.TemplatePath
 					}
+					printVMCacheStatus(status, templatePath)
 				}
 			}
 		}
@@ -327,6 +694,7 @@ var statusFactoryCommand = cli.Command{
 			} else {
 				fmt.Fprintln(defaultOutputFile, "vm factory is on")
 			}
+			printTemplateStatus(runtimeConfig.FactoryConfig.TemplatePath, vmmPids(ctx, cacheStatus))
 		} else {
 			fmt.Fprintln(defaultOutputFile, "vm factory not enabled")
 		}
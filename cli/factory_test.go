@@ -6,16 +6,28 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"io/ioutil"
+	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 
+	"github.com/gogo/protobuf/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/urfave/cli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	ktu "github.com/kata-containers/runtime/pkg/katatestutils"
+	pb "github.com/kata-containers/runtime/protocols/cache"
 	vc "github.com/kata-containers/runtime/virtcontainers"
+	vf "github.com/kata-containers/runtime/virtcontainers/factory"
+	"github.com/kata-containers/runtime/virtcontainers/factory/grpccache"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
 )
 
 const testDisabledAsNonRoot = "Test disabled as requires root privileges"
@@ -150,3 +162,162 @@ func TestFactoryCLIFunctionStatus(t *testing.T) {
 	err = fn(ctx)
 	assert.Nil(err)
 }
+
+func TestFactoryPools(t *testing.T) {
+	assert := assert.New(t)
+
+	runtimeConfig, err := newTestRuntimeConfig("", "", false)
+	assert.NoError(err)
+
+	runtimeConfig.FactoryConfig.VMCachePools = []oci.FactoryPoolConfig{
+		{Name: "small", VMCacheNumber: 2, NumVCPUs: 1, MemorySize: 512},
+		{Name: "initrd", VMCacheNumber: 1, InitrdPath: "/initrd"},
+	}
+
+	vmConfig := vc.VMConfig{
+		HypervisorConfig: vc.HypervisorConfig{
+			NumVCPUs:   2,
+			MemorySize: 2048,
+			KernelPath: "/kernel",
+			ImagePath:  "/image",
+		},
+	}
+
+	pools := factoryPools(runtimeConfig, vmConfig)
+	assert.Len(pools, 2)
+
+	assert.Equal("small", pools[0].Name)
+	assert.Equal(uint(2), pools[0].Cache)
+	assert.Equal(uint32(1), pools[0].VMConfig.HypervisorConfig.NumVCPUs)
+	assert.Equal(uint32(512), pools[0].VMConfig.HypervisorConfig.MemorySize)
+	assert.Equal("/image", pools[0].VMConfig.HypervisorConfig.ImagePath)
+
+	assert.Equal(uint32(2), pools[1].VMConfig.HypervisorConfig.NumVCPUs)
+	assert.Equal("/kernel", pools[1].VMConfig.HypervisorConfig.KernelPath)
+	assert.Equal("", pools[1].VMConfig.HypervisorConfig.ImagePath)
+	assert.Equal("/initrd", pools[1].VMConfig.HypervisorConfig.InitrdPath)
+}
+
+func TestGetActivationListener(t *testing.T) {
+	assert := assert.New(t)
+
+	// Not socket activated.
+	l, err := getActivationListener()
+	assert.NoError(err)
+	assert.Nil(l)
+
+	// Socket activation of another process.
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	l, err = getActivationListener()
+	assert.NoError(err)
+	assert.Nil(l)
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "2")
+	_, err = getActivationListener()
+	assert.Error(err)
+}
+
+func TestNewCacheListener(t *testing.T) {
+	assert := assert.New(t)
+
+	// A network socket passed by systemd is rejected, its peers
+	// cannot be checked.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(err)
+	defer l.Close()
+
+	_, err = newCacheListener(l, oci.FactoryConfig{})
+	assert.Error(err)
+
+	_, err = getCacheListener(oci.FactoryConfig{
+		VMCacheEndpoint: "tcp://127.0.0.1:5050",
+	})
+	assert.Error(err)
+}
+
+func TestPeerCredListener(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "vm-cache-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	l, err := getCacheListener(oci.FactoryConfig{
+		VMCacheEndpoint: filepath.Join(dir, "cache.sock"),
+	})
+	assert.NoError(err)
+	defer l.Close()
+
+	_, ok := l.(*peerCredListener)
+	assert.True(ok)
+
+	go func() {
+		conn, err := net.Dial("unix", filepath.Join(dir, "cache.sock"))
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	// The server user is allowed.
+	conn, err := l.Accept()
+	assert.NoError(err)
+
+	cred, err := getPeerCred(conn)
+	assert.NoError(err)
+	assert.Equal(uint32(os.Geteuid()), cred.Uid)
+	assert.Equal(int32(os.Getpid()), cred.Pid)
+	conn.Close()
+
+	pl := newPeerCredListener(l, []uint32{1000}, []uint32{100})
+	assert.True(pl.uids[0])
+	assert.True(pl.uids[1000])
+	assert.True(pl.gids[100])
+	assert.False(pl.gids[0])
+}
+
+func TestCacheServerDrain(t *testing.T) {
+	assert := assert.New(t)
+
+	runtimeConfig, err := newTestRuntimeConfig("", "", false)
+	assert.NoError(err)
+
+	ctx := context.Background()
+	f, err := vf.NewFactory(ctx, vf.Config{
+		VMConfig: vc.VMConfig{
+			HypervisorType:   vc.MockHypervisor,
+			HypervisorConfig: runtimeConfig.HypervisorConfig,
+			AgentType:        vc.NoopAgentType,
+			ProxyType:        vc.NoopProxyType,
+		},
+	}, false)
+	assert.NoError(err)
+	defer f.CloseFactory(ctx)
+
+	s := &cacheServer{
+		rpc:     grpc.NewServer(),
+		factory: f,
+		done:    make(chan struct{}),
+	}
+
+	version, err := s.Version(ctx, &types.Empty{})
+	assert.NoError(err)
+	assert.Equal(uint32(grpccache.ProtocolVersion), version.Version)
+
+	_, err = s.GetVM(ctx, &pb.GrpcVMRequest{Version: grpccache.ProtocolVersion + 1})
+	assert.Equal(codes.InvalidArgument, status.Code(err))
+
+	// No VM is handed out once the server is stopping.
+	_, err = s.Quit(ctx, &types.Empty{})
+	assert.NoError(err)
+	<-s.done
+
+	_, err = s.GetVM(ctx, &pb.GrpcVMRequest{Version: grpccache.ProtocolVersion})
+	assert.Equal(codes.Unavailable, status.Code(err))
+	_, err = s.GetBaseVM(ctx, &types.Empty{})
+	assert.Equal(codes.Unavailable, status.Code(err))
+}
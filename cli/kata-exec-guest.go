@@ -0,0 +1,81 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/containerd/console"
+	"github.com/urfave/cli"
+)
+
+var kataExecGuestCLICommand = cli.Command{
+	Name:  "kata-exec-guest",
+	Usage: "open a shell in the guest of a sandbox",
+	ArgsUsage: `<sandbox-id>
+
+   <sandbox-id> is the ID of the sandbox whose guest to enter.`,
+
+	Description: `The kata-exec-guest command connects to the debug console of the guest
+       of a running sandbox, outside of any container. The sandbox must have been
+       created with debug_console_enabled set in the agent configuration, and the
+       agent must be reachable over vsock or hybrid vsock.`,
+
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		sandboxID := context.Args().First()
+		if sandboxID == "" {
+			return fmt.Errorf("Missing sandbox ID")
+		}
+
+		return execGuest(ctx, sandboxID, os.Stdin, defaultOutputFile)
+	},
+}
+
+// execGuest attaches stdin and stdout to the debug console of the guest of
+// sandboxID, until the console is closed. A terminal stdin is switched to
+// raw mode meanwhile, the guest shell handling line editing and signals.
+func execGuest(ctx context.Context, sandboxID string, stdin *os.File, stdout io.Writer) error {
+	kataLog = kataLog.WithField("sandbox", sandboxID)
+	setExternalLoggers(ctx, kataLog)
+
+	conn, err := vci.DialDebugConsole(ctx, sandboxID)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if isTerminal(stdin.Fd()) {
+		current, err := console.ConsoleFromFile(stdin)
+		if err != nil {
+			return err
+		}
+
+		if err := current.SetRaw(); err != nil {
+			return err
+		}
+		defer current.Reset()
+	}
+
+	go func() {
+		io.Copy(conn, stdin)
+
+		// Let the guest shell see the end of a piped input.
+		if c, ok := conn.(interface{ CloseWrite() error }); ok {
+			c.CloseWrite()
+		}
+	}()
+
+	_, err = io.Copy(stdout, conn)
+	return err
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecGuestCliFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	// The sandbox ID is mandatory.
+	set := flag.NewFlagSet("", 0)
+	execCLICommandFunc(assert, kataExecGuestCLICommand, set, true)
+
+	// The debug console may not be reachable.
+	set.Parse([]string{testSandboxID})
+	execCLICommandFunc(assert, kataExecGuestCLICommand, set, true)
+}
+
+func TestExecGuest(t *testing.T) {
+	assert := assert.New(t)
+
+	stdin, err := ioutil.TempFile("", "stdin")
+	assert.NoError(err)
+	defer os.Remove(stdin.Name())
+
+	_, err = stdin.WriteString("uname\n")
+	assert.NoError(err)
+	_, err = stdin.Seek(0, io.SeekStart)
+	assert.NoError(err)
+
+	// The guest shell echoes its input.
+	testingImpl.DialDebugConsoleFunc = func(ctx context.Context, sandboxID string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			buf := make([]byte, len("uname\n"))
+			if _, err := io.ReadFull(server, buf); err == nil {
+				server.Write(buf)
+			}
+		}()
+		return client, nil
+	}
+	defer func() {
+		testingImpl.DialDebugConsoleFunc = nil
+	}()
+
+	var stdout bytes.Buffer
+	err = execGuest(context.Background(), testSandboxID, stdin, &stdout)
+	assert.NoError(err)
+	assert.Equal("uname\n", stdout.String())
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+var kataGuestLogCLICommand = cli.Command{
+	Name:  "kata-guest-log",
+	Usage: "show the guest log of a sandbox",
+	ArgsUsage: `<sandbox-id>
+
+   <sandbox-id> is the ID of the sandbox whose guest log to show.`,
+
+	Description: `The kata-guest-log command shows the guest console (kernel, agent and
+       systemd messages) collected on the host for a sandbox created with
+       guest_log_max_size set in the runtime configuration. The log is kept
+       after the sandbox is gone.`,
+
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		sandboxID := context.Args().First()
+		if sandboxID == "" {
+			return fmt.Errorf("Missing sandbox ID")
+		}
+
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("invalid runtime config")
+		}
+
+		kataLog = kataLog.WithField("sandbox", sandboxID)
+		setExternalLoggers(ctx, kataLog)
+
+		return vc.ReadGuestLog(runtimeConfig.GuestLogDir, sandboxID, defaultOutputFile)
+	},
+}
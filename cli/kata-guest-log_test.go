@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestGuestLogCliFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guest-log")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fn, ok := kataGuestLogCLICommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	// The sandbox ID is mandatory.
+	set := flag.NewFlagSet("", 0)
+	ctx := createCLIContext(set)
+	ctx.App.Metadata["runtimeConfig"] = oci.RuntimeConfig{GuestLogDir: dir}
+	assert.Error(fn(ctx))
+
+	// No guest log was collected for the sandbox.
+	set.Parse([]string{testSandboxID})
+	ctx = createCLIContext(set)
+	ctx.App.Metadata["runtimeConfig"] = oci.RuntimeConfig{GuestLogDir: dir}
+	assert.Error(fn(ctx))
+
+	log := "2020-04-01T10:00:00Z sandbox=" + testSandboxID + " source=kernel [    0.000000] Linux version 5.4.32\n"
+	err = ioutil.WriteFile(vc.GuestLogPath(dir, testSandboxID), []byte(log), 0640)
+	assert.NoError(err)
+
+	output, err := ioutil.TempFile("", "output")
+	assert.NoError(err)
+	defer os.Remove(output.Name())
+
+	savedOutputFile := defaultOutputFile
+	defaultOutputFile = output
+	defer func() {
+		defaultOutputFile = savedOutputFile
+	}()
+
+	assert.NoError(fn(ctx))
+
+	data, err := ioutil.ReadFile(output.Name())
+	assert.NoError(err)
+	assert.Equal(log, string(data))
+}
@@ -9,11 +9,14 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/kata-containers/runtime/pkg/katautils"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
 	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 )
@@ -40,8 +43,13 @@ var kataOverheadCLICommand = cli.Command{
 			return fmt.Errorf("Missing container ID, should at least provide one")
 		}
 
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("invalid runtime config")
+		}
+
 		for _, cID := range []string(args) {
-			if err := overhead(ctx, cID); err != nil {
+			if err := overhead(ctx, cID, runtimeConfig); err != nil {
 				return err
 			}
 		}
@@ -50,7 +58,7 @@ var kataOverheadCLICommand = cli.Command{
 	},
 }
 
-func overhead(ctx context.Context, containerID string) error {
+func overhead(ctx context.Context, containerID string, runtimeConfig oci.RuntimeConfig) error {
 	span, _ := katautils.Trace(ctx, "overhead")
 	defer span.Finish()
 
@@ -132,5 +140,21 @@ func overhead(ctx context.Context, containerID string) error {
 	fmt.Printf("memory_host_bytes=%d\n", hostMemoryUsage)
 	fmt.Printf("memory_guest_bytes=%d\n\n", guestMemoryUsage)
 
+	if runtimeConfig.FactoryConfig.Template && finishSandboxStats.VMMPid > 0 {
+		stats, err := utils.GetMappingStats(finishSandboxStats.VMMPid, runtimeConfig.FactoryConfig.TemplatePath)
+		if err != nil {
+			kataLog.WithError(err).Warn("failed to get template memory stats")
+		} else if len(stats) > 0 {
+			var shared, privateDirty uint64
+			for _, s := range stats {
+				shared += s.Shared()
+				privateDirty += s.PrivateDirty
+			}
+			fmt.Printf(" --Template memory details--\n")
+			fmt.Printf("template_shared_bytes=%d\n", shared)
+			fmt.Printf("template_private_dirty_bytes=%d\n\n", privateDirty)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,245 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	containerdshim "github.com/kata-containers/runtime/containerd-shim-v2"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
+	"github.com/urfave/cli"
+)
+
+var kataSandboxCLICommand = cli.Command{
+	Name:  "kata-sandbox",
+	Usage: "manage a sandbox through the management socket of its shim",
+	Subcommands: []cli.Command{
+		sandboxStatusCommand,
+		sandboxStatsCommand,
+		sandboxListIfacesCommand,
+		sandboxAddIfaceCommand,
+		sandboxDelIfaceCommand,
+		sandboxListRoutesCommand,
+		sandboxUpdateRoutesCommand,
+		sandboxAddDeviceCommand,
+		sandboxDumpCommand,
+		sandboxHealthCommand,
+		sandboxResizeCommand,
+		sandboxGuestLogCommand,
+	},
+	Action: func(context *cli.Context) error {
+		return cli.ShowSubcommandHelp(context)
+	},
+}
+
+var sandboxStatusCommand = cli.Command{
+	Name:      "status",
+	Usage:     "show the status of a sandbox",
+	ArgsUsage: `status <sandbox-id>`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, _ io.Reader) (interface{}, error) {
+			return c.Status()
+		})
+	},
+}
+
+var sandboxStatsCommand = cli.Command{
+	Name:      "stats",
+	Usage:     "show the stats of a sandbox",
+	ArgsUsage: `stats <sandbox-id>`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, _ io.Reader) (interface{}, error) {
+			return c.Stats()
+		})
+	},
+}
+
+var sandboxListIfacesCommand = cli.Command{
+	Name:      "list-ifaces",
+	Usage:     "list the network interfaces of a sandbox",
+	ArgsUsage: `list-ifaces <sandbox-id>`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, _ io.Reader) (interface{}, error) {
+			return c.ListInterfaces()
+		})
+	},
+}
+
+var sandboxAddIfaceCommand = cli.Command{
+	Name:      "add-iface",
+	Usage:     "add a network interface to a sandbox",
+	ArgsUsage: `add-iface <sandbox-id> file or - for stdin`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, input io.Reader) (interface{}, error) {
+			var inf *vcTypes.Interface
+			if err := json.NewDecoder(input).Decode(&inf); err != nil {
+				return nil, err
+			}
+			return c.AddInterface(inf)
+		})
+	},
+}
+
+var sandboxDelIfaceCommand = cli.Command{
+	Name:      "del-iface",
+	Usage:     "delete a network interface from a sandbox",
+	ArgsUsage: `del-iface <sandbox-id> file or - for stdin`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, input io.Reader) (interface{}, error) {
+			var inf *vcTypes.Interface
+			if err := json.NewDecoder(input).Decode(&inf); err != nil {
+				return nil, err
+			}
+			return c.RemoveInterface(inf)
+		})
+	},
+}
+
+var sandboxListRoutesCommand = cli.Command{
+	Name:      "list-routes",
+	Usage:     "list the network routes of a sandbox",
+	ArgsUsage: `list-routes <sandbox-id>`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, _ io.Reader) (interface{}, error) {
+			return c.ListRoutes()
+		})
+	},
+}
+
+var sandboxUpdateRoutesCommand = cli.Command{
+	Name:      "update-routes",
+	Usage:     "update the network routes of a sandbox",
+	ArgsUsage: `update-routes <sandbox-id> file or - for stdin`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, input io.Reader) (interface{}, error) {
+			var routes []*vcTypes.Route
+			if err := json.NewDecoder(input).Decode(&routes); err != nil {
+				return nil, err
+			}
+			return c.UpdateRoutes(routes)
+		})
+	},
+}
+
+var sandboxAddDeviceCommand = cli.Command{
+	Name:      "add-device",
+	Usage:     "add a device to a sandbox",
+	ArgsUsage: `add-device <sandbox-id> file or - for stdin`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, input io.Reader) (interface{}, error) {
+			var info config.DeviceInfo
+			if err := json.NewDecoder(input).Decode(&info); err != nil {
+				return nil, err
+			}
+			return c.AddDevice(info)
+		})
+	},
+}
+
+var sandboxDumpCommand = cli.Command{
+	Name:      "dump",
+	Usage:     "dump the persisted state of a sandbox and of its shim",
+	ArgsUsage: `dump <sandbox-id>`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, _ io.Reader) (interface{}, error) {
+			return c.Dump()
+		})
+	},
+}
+
+var sandboxHealthCommand = cli.Command{
+	Name:      "health",
+	Usage:     "show the last health decisions of the monitor of a sandbox",
+	ArgsUsage: `health <sandbox-id>`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, _ io.Reader) (interface{}, error) {
+			return c.Health()
+		})
+	},
+}
+
+var sandboxResizeCommand = cli.Command{
+	Name:      "resize",
+	Usage:     "resize the VM of a sandbox on top of what its containers need",
+	ArgsUsage: `resize <sandbox-id>`,
+	Flags: []cli.Flag{
+		cli.UintFlag{
+			Name:  "vcpus",
+			Usage: "number of vCPUs added to the VM",
+		},
+		cli.UintFlag{
+			Name:  "memory",
+			Usage: "memory added to the VM, in MiB",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, _ io.Reader) (interface{}, error) {
+			return c.Resize(containerdshim.VMResize{
+				ExtraVCPUs: uint32(context.Uint("vcpus")),
+				ExtraMemMB: uint32(context.Uint("memory")),
+			})
+		})
+	},
+}
+
+var sandboxGuestLogCommand = cli.Command{
+	Name:      "guest-log",
+	Usage:     "show the guest log of a sandbox",
+	ArgsUsage: `guest-log <sandbox-id>`,
+	Action: func(context *cli.Context) error {
+		return sandboxCommand(context, func(c *containerdshim.ManagementClient, _ io.Reader) (interface{}, error) {
+			return nil, c.GuestLog(defaultOutputFile)
+		})
+	},
+}
+
+// sandboxCommand runs a management request against the shim serving the
+// sandbox given as first argument, the second argument being the file the
+// request input is read from, stdin by default. The result is printed as
+// JSON, unless the request printed its own.
+func sandboxCommand(context *cli.Context, request func(*containerdshim.ManagementClient, io.Reader) (interface{}, error)) error {
+	ctx, err := cliContextToContext(context)
+	if err != nil {
+		return err
+	}
+
+	sandboxID := context.Args().First()
+	if sandboxID == "" {
+		return fmt.Errorf("Missing sandbox ID")
+	}
+
+	kataLog = kataLog.WithField("sandbox", sandboxID)
+	setExternalLoggers(ctx, kataLog)
+
+	var input io.Reader = os.Stdin
+	if file := context.Args().Get(1); file != "" && file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+
+	client, err := containerdshim.NewManagementClient(sandboxID)
+	if err != nil {
+		return err
+	}
+
+	result, err := request(client, input)
+	if err != nil || result == nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(defaultOutputFile)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(result)
+}
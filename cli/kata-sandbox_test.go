@@ -0,0 +1,30 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSandboxCliFunction(t *testing.T) {
+	assert := assert.New(t)
+
+	// The sandbox ID is mandatory.
+	set := flag.NewFlagSet("", 0)
+	for _, command := range kataSandboxCLICommand.Subcommands {
+		execCLICommandFunc(assert, command, set, true)
+	}
+
+	// No shim serves the sandbox.
+	set.Parse([]string{testSandboxID})
+	execCLICommandFunc(assert, sandboxStatusCommand, set, true)
+	execCLICommandFunc(assert, sandboxDumpCommand, set, true)
+	execCLICommandFunc(assert, sandboxResizeCommand, set, true)
+	execCLICommandFunc(assert, sandboxGuestLogCommand, set, true)
+}
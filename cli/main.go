@@ -139,8 +139,13 @@ var runtimeCommands = []cli.Command{
 	// Kata Containers specific extensions
 	kataCheckCLICommand,
 	kataEnvCLICommand,
+	kataExecGuestCLICommand,
+	kataGuestLogCLICommand,
+	collectCLICommand,
 	kataNetworkCLICommand,
+	kataSandboxCLICommand,
 	kataOverheadCLICommand,
+	overheadCLICommand,
 	factoryCLICommand,
 }
 
@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+	"github.com/urfave/cli"
+)
+
+// defaultOverheadMargin is the percentage added to the peak overhead when
+// recommending a pod overhead.
+const defaultOverheadMargin = 10
+
+var overheadSubCmds = []cli.Command{
+	reportOverheadCommand,
+}
+
+var overheadCLICommand = cli.Command{
+	Name:        "overhead",
+	Usage:       "manage the recorded sandbox overheads",
+	Subcommands: overheadSubCmds,
+	Action: func(context *cli.Context) {
+		cli.ShowSubcommandHelp(context)
+	},
+}
+
+var reportOverheadCommand = cli.Command{
+	Name:  "report",
+	Usage: "recommend pod overheads from the recorded sandbox overheads",
+	Description: `The report command reads the overhead records written to the overhead_dir
+       of the runtime configuration, and recommends for each hypervisor
+       configuration the overhead.podFixed values of a Kubernetes
+       RuntimeClass: the peak overhead seen across the sandboxes plus a
+       margin.`,
+
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Format output as JSON",
+		},
+		cli.UintFlag{
+			Name:  "margin",
+			Value: defaultOverheadMargin,
+			Usage: "percentage added to the peak overhead",
+		},
+	},
+
+	Action: func(context *cli.Context) error {
+		runtimeConfig, ok := context.App.Metadata["runtimeConfig"].(oci.RuntimeConfig)
+		if !ok {
+			return errors.New("invalid runtime config")
+		}
+
+		records, err := vc.ReadOverheadRecords(runtimeConfig.Overhead.Dir)
+		if err != nil {
+			return err
+		}
+
+		recommendations := vc.RecommendOverhead(records, uint32(context.Uint("margin")))
+
+		if context.Bool("json") {
+			encoder := json.NewEncoder(defaultOutputFile)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(recommendations)
+		}
+
+		writeOverheadReport(defaultOutputFile, recommendations)
+		return nil
+	},
+}
+
+func writeOverheadReport(w io.Writer, recommendations []vc.OverheadRecommendation) {
+	if len(recommendations) == 0 {
+		fmt.Fprintln(w, "No sandbox overhead recorded")
+		return
+	}
+
+	for _, rec := range recommendations {
+		h := rec.Hypervisor
+
+		fmt.Fprintf(w, "Hypervisor %s: %s\n", h.Type, h.Path)
+		fmt.Fprintf(w, "\tkernel=%s\n", h.KernelPath)
+		if h.ImagePath != "" {
+			fmt.Fprintf(w, "\timage=%s\n", h.ImagePath)
+		}
+		if h.InitrdPath != "" {
+			fmt.Fprintf(w, "\tinitrd=%s\n", h.InitrdPath)
+		}
+		fmt.Fprintf(w, "\tshared_fs=%s\n", h.SharedFS)
+		fmt.Fprintf(w, "\tvcpus=%d\n", h.NumVCPUs)
+		fmt.Fprintf(w, "\tmemory_mib=%d\n", h.MemorySize)
+		fmt.Fprintf(w, "\ttemplate=%t\n", h.Template)
+		fmt.Fprintf(w, "sandboxes=%d\n", rec.Sandboxes)
+		fmt.Fprintf(w, "samples=%d\n", rec.Samples)
+		fmt.Fprintf(w, " --Peak overhead--\n")
+		fmt.Fprintf(w, "memory_overhead_bytes=%d\n", rec.Peak.Memory)
+		fmt.Fprintf(w, "\tvmm_rss_bytes=%d\n", rec.Peak.VMMRss)
+		fmt.Fprintf(w, "\tvirtiofsd_rss_bytes=%d\n", rec.Peak.VirtiofsdRss)
+		fmt.Fprintf(w, "\ttemplate_shared_bytes=%d\n", rec.Peak.TemplateShared)
+		fmt.Fprintf(w, "\tguest_containers_bytes=%d\n", rec.Peak.GuestContainers)
+		fmt.Fprintf(w, "\tguest_bytes=%d\n", rec.Peak.Guest)
+		fmt.Fprintf(w, "cpu_overhead=%f\n", rec.Peak.CPU)
+		fmt.Fprintf(w, " --Recommended podFixed--\n")
+
+		var names []string
+		for name := range rec.PodFixed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "%s=%s\n", name, rec.PodFixed[name])
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -20,6 +20,7 @@ import (
 type container struct {
 	s           *service
 	ttyio       *ttyIO
+	log         *logConfig
 	spec        *specs.Spec
 	exitTime    time.Time
 	execs       map[string]*exec
@@ -49,8 +50,14 @@ func newContainer(s *service, r *taskAPI.CreateTaskRequest, containerType vc.Con
 		spec = &specs.Spec{}
 	}
 
+	log, err := newLogConfig(r.Stdout, spec.Annotations)
+	if err != nil {
+		return nil, errdefs.ToGRPCf(errdefs.ErrInvalidArgument, "%v", err)
+	}
+
 	c := &container{
 		s:           s,
+		log:         log,
 		spec:        spec,
 		id:          r.ID,
 		bundle:      r.Bundle,
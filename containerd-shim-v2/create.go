@@ -89,6 +89,10 @@ func create(ctx context.Context, s *service, r *taskAPI.CreateTaskRequest) (*con
 		}
 		s.sandbox = sandbox
 
+		if err := s.startManagementServer(); err != nil {
+			logrus.WithError(err).WithField("sandbox", r.ID).Warn("failed to start management server")
+		}
+
 	case vc.PodContainer:
 		if s.sandbox == nil {
 			return nil, fmt.Errorf("BUG: Cannot start the container, since the sandbox hasn't been created")
@@ -159,7 +163,7 @@ func loadRuntimeConfig(s *service, r *taskAPI.CreateTaskRequest, anno map[string
 		configPath = os.Getenv("KATA_CONF_FILE")
 	}
 
-	_, runtimeConfig, err := katautils.LoadConfiguration(configPath, false, true)
+	configPath, runtimeConfig, err := katautils.LoadConfiguration(configPath, false, true)
 	if err != nil {
 		return nil, err
 	}
@@ -167,6 +171,7 @@ func loadRuntimeConfig(s *service, r *taskAPI.CreateTaskRequest, anno map[string
 	// For the unit test, the config will be predefined
 	if s.config == nil {
 		s.config = &runtimeConfig
+		s.configPath = configPath
 	}
 
 	return &runtimeConfig, nil
@@ -23,13 +23,13 @@ func deleteContainer(ctx context.Context, s *service, c *container) error {
 	}
 	if !c.cType.IsSandbox() && err == nil {
 		if status.State.State != types.StateStopped {
-			_, err = s.sandbox.StopContainer(c.id, false)
+			_, err = s.sandbox.StopContainer(ctx, c.id, false)
 			if err != nil {
 				return err
 			}
 		}
 
-		if _, err = s.sandbox.DeleteContainer(c.id); err != nil {
+		if _, err = s.sandbox.DeleteContainer(ctx, c.id); err != nil {
 			return err
 		}
 	}
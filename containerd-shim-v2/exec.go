@@ -40,6 +40,7 @@ type exec struct {
 }
 
 type tty struct {
+	log      *logConfig
 	stdin    string
 	stdout   string
 	stderr   string
@@ -91,7 +92,13 @@ func newExec(c *container, stdin, stdout, stderr string, terminal bool, jspec *g
 		width = uint32(spec.ConsoleSize.Width)
 	}
 
+	log, err := newLogConfig(stdout, nil)
+	if err != nil {
+		return nil, errdefs.ToGRPCf(errdefs.ErrInvalidArgument, "%v", err)
+	}
+
 	tty := &tty{
+		log:      log,
 		stdin:    stdin,
 		stdout:   stdout,
 		stderr:   stderr,
@@ -0,0 +1,98 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+)
+
+// guestProcessListArgs are the ps(1) arguments used to list the processes
+// of a container: the agent keeps the lines of the processes of the
+// container, identified through the PID column.
+var guestProcessListArgs = []string{"-o", "pid"}
+
+// guestProcess is a process running in the guest.
+type guestProcess struct {
+	pid uint32
+}
+
+// parseGuestProcesses parses the table listing of the processes of a
+// container, as returned by the agent for guestProcessListArgs.
+func parseGuestProcesses(list vc.ProcessList) ([]guestProcess, error) {
+	var procs []guestProcess
+
+	scanner := bufio.NewScanner(bytes.NewReader(list))
+
+	// Skip the header.
+	if !scanner.Scan() {
+		return nil, scanner.Err()
+	}
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		pid, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid in process line %q: %v", scanner.Text(), err)
+		}
+
+		procs = append(procs, guestProcess{
+			pid: uint32(pid),
+		})
+	}
+
+	return procs, scanner.Err()
+}
+
+// guestProcesses lists the processes running in the guest for a container.
+func (s *service) guestProcesses(ctx context.Context, containerID string) ([]guestProcess, error) {
+	list, err := s.sandbox.ProcessListContainer(ctx, containerID, vc.ProcessListOptions{
+		Format: "table",
+		Args:   guestProcessListArgs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return parseGuestProcesses(list)
+}
+
+// guestExecIDs returns the ids of the execs of a container by guest pid,
+// from their sandbox process ids by exec id. The execs whose guest pid is
+// not known are left out, a failed lookup only leaving the process listed
+// without its exec id.
+func (s *service) guestExecIDs(ctx context.Context, containerID string, execs map[string]string) map[uint32]string {
+	execIDs := make(map[uint32]string)
+
+	for execID, processID := range execs {
+		pid, err := s.sandbox.ProcessGuestPid(ctx, containerID, processID)
+		if err == vc.ErrGuestPidUnsupported {
+			break
+		}
+		if err != nil {
+			logrus.WithError(err).WithFields(logrus.Fields{
+				"container": containerID,
+				"exec":      execID,
+			}).Warn("failed to get guest pid")
+			continue
+		}
+		execIDs[pid] = execID
+	}
+
+	return execIDs
+}
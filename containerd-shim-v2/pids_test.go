@@ -0,0 +1,152 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containerd/containerd/api/types/task"
+	"github.com/containerd/containerd/runtime/linux/runctypes"
+	taskAPI "github.com/containerd/containerd/runtime/v2/task"
+	"github.com/containerd/typeurl"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/vcmock"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+)
+
+const testProcessList = `  PID
+   71
+   80
+   92
+   97
+`
+
+// processListSandbox is a mock sandbox listing list as the processes of its
+// containers, and reporting the guest pids of pids.
+type processListSandbox struct {
+	*vcmock.Sandbox
+	list vc.ProcessList
+	pids map[string]uint32
+}
+
+func (s *processListSandbox) ProcessListContainer(ctx context.Context, containerID string, options vc.ProcessListOptions) (vc.ProcessList, error) {
+	return s.list, nil
+}
+
+func (s *processListSandbox) ProcessGuestPid(ctx context.Context, containerID, processID string) (uint32, error) {
+	if s.pids == nil {
+		return 0, vc.ErrGuestPidUnsupported
+	}
+	return s.pids[processID], nil
+}
+
+func TestParseGuestProcesses(t *testing.T) {
+	assert := assert.New(t)
+
+	procs, err := parseGuestProcesses(vc.ProcessList(testProcessList))
+	assert.NoError(err)
+	assert.Equal([]guestProcess{{pid: 71}, {pid: 80}, {pid: 92}, {pid: 97}}, procs)
+
+	procs, err = parseGuestProcesses(nil)
+	assert.NoError(err)
+	assert.Empty(procs)
+
+	_, err = parseGuestProcesses(vc.ProcessList("PID\nfoo\n"))
+	assert.Error(err)
+}
+
+func TestGuestPids(t *testing.T) {
+	assert := assert.New(t)
+
+	sandbox := &processListSandbox{
+		Sandbox: &vcmock.Sandbox{
+			MockID: testSandboxID,
+		},
+		list: vc.ProcessList(testProcessList),
+		pids: map[string]uint32{
+			"exec-token": 97,
+		},
+	}
+
+	s := &service{
+		id:         testSandboxID,
+		pid:        4242,
+		sandbox:    sandbox,
+		containers: make(map[string]*container),
+	}
+
+	spec := &specs.Spec{
+		Process: &specs.Process{
+			Args: []string{"/bin/sh", "-c", "sleep 1000"},
+		},
+	}
+
+	c, err := newContainer(s, &taskAPI.CreateTaskRequest{
+		ID: testContainerID,
+	}, vc.PodContainer, spec, false)
+	assert.NoError(err)
+	s.containers[testContainerID] = c
+	c.status = task.StatusRunning
+
+	c.execs["exec"] = &exec{
+		container: c,
+		id:        "exec-token",
+		cmds:      &types.Cmd{Args: []string{"top", "-b"}},
+		tty:       &tty{},
+		status:    task.StatusRunning,
+	}
+
+	ctx := context.Background()
+
+	// The task API reports the shim pid, the guest pids are only listed.
+	state, err := s.State(ctx, &taskAPI.StateRequest{ID: testContainerID})
+	assert.NoError(err)
+	assert.Equal(uint32(4242), state.Pid)
+
+	state, err = s.State(ctx, &taskAPI.StateRequest{ID: testContainerID, ExecID: "exec"})
+	assert.NoError(err)
+	assert.Equal(uint32(4242), state.Pid)
+
+	conn, err := s.Connect(ctx, &taskAPI.ConnectRequest{ID: testContainerID})
+	assert.NoError(err)
+	assert.Equal(uint32(4242), conn.ShimPid)
+	assert.Equal(uint32(4242), conn.TaskPid)
+
+	pids, err := s.Pids(ctx, &taskAPI.PidsRequest{ID: testContainerID})
+	assert.NoError(err)
+	assert.Len(pids.Processes, 4)
+
+	for _, p := range pids.Processes {
+		if p.Pid != 97 {
+			assert.Nil(p.Info)
+			continue
+		}
+		v, err := typeurl.UnmarshalAny(p.Info)
+		assert.NoError(err)
+		assert.Equal("exec", v.(*runctypes.ProcessDetails).ExecID)
+	}
+
+	// The execs are not identified when the agent does not report guest
+	// pids.
+	sandbox.pids = nil
+	pids, err = s.Pids(ctx, &taskAPI.PidsRequest{ID: testContainerID})
+	assert.NoError(err)
+	assert.Len(pids.Processes, 4)
+	for _, p := range pids.Processes {
+		assert.Nil(p.Info)
+	}
+
+	// Only the shim pid is reported when the processes cannot be listed.
+	sandbox.list = nil
+	pids, err = s.Pids(ctx, &taskAPI.PidsRequest{ID: testContainerID})
+	assert.NoError(err)
+	assert.Len(pids.Processes, 1)
+	assert.Equal(uint32(4242), pids.Processes[0].Pid)
+}
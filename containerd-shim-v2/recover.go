@@ -0,0 +1,362 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containerd/containerd/api/types/task"
+	"github.com/sirupsen/logrus"
+
+	"github.com/kata-containers/runtime/pkg/katautils"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/persist"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/compatoci"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+)
+
+// shimStateFile is the file the shim state is persisted to, in the
+// directory holding the sandbox state.
+const shimStateFile = "shim.json"
+
+// shimState is the state of the tasks served by the shim. It is persisted
+// alongside the sandbox state, so that a restarted shim can reattach to the
+// sandbox and serve its tasks again.
+type shimState struct {
+	// ConfigPath is the runtime configuration file the sandbox was
+	// created from.
+	ConfigPath string
+	Containers []containerState
+}
+
+type containerState struct {
+	ID       string
+	Bundle   string
+	Stdin    string
+	Stdout   string
+	Stderr   string
+	Type     vc.ContainerType
+	Status   task.Status
+	Exit     uint32
+	ExitTime time.Time
+	Terminal bool
+	Mounted  bool
+	Execs    map[string]execState
+}
+
+type execState struct {
+	// ProcessID is the id of the process in the sandbox.
+	ProcessID string
+	Cmd       types.Cmd
+	Stdin     string
+	Stdout    string
+	Stderr    string
+	Height    uint32
+	Width     uint32
+	Terminal  bool
+	Status    task.Status
+	ExitCode  int32
+	ExitTime  time.Time
+}
+
+// shimStatePath returns the path of the shim state of sandboxID.
+func shimStatePath(sandboxID string) (string, error) {
+	driver, err := persist.GetDriver()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(driver.RunStoragePath(), sandboxID, shimStateFile), nil
+}
+
+// saveState persists the state of the tasks of the shim. It must be called
+// with s.mu held, after each change of the tasks. Nothing is saved once the
+// sandbox state is gone, as nothing can be recovered anymore.
+func (s *service) saveState() {
+	if s.sandbox == nil {
+		return
+	}
+
+	if err := s.writeState(); err != nil {
+		logrus.WithError(err).WithField("sandbox", s.sandbox.ID()).Warn("failed to save shim state")
+	}
+}
+
+func (s *service) writeState() error {
+	path, err := shimStatePath(s.sandbox.ID())
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Dir(path)); os.IsNotExist(err) {
+		return nil
+	}
+
+	state := shimState{
+		ConfigPath: s.configPath,
+	}
+
+	for _, c := range s.containers {
+		cs := containerState{
+			ID:       c.id,
+			Bundle:   c.bundle,
+			Stdin:    c.stdin,
+			Stdout:   c.stdout,
+			Stderr:   c.stderr,
+			Type:     c.cType,
+			Status:   c.status,
+			Exit:     c.exit,
+			ExitTime: c.exitTime,
+			Terminal: c.terminal,
+			Mounted:  c.mounted,
+			Execs:    make(map[string]execState),
+		}
+
+		for id, e := range c.execs {
+			cs.Execs[id] = execState{
+				ProcessID: e.id,
+				Cmd:       *e.cmds,
+				Stdin:     e.tty.stdin,
+				Stdout:    e.tty.stdout,
+				Stderr:    e.tty.stderr,
+				Height:    e.tty.height,
+				Width:     e.tty.width,
+				Terminal:  e.tty.terminal,
+				Status:    e.status,
+				ExitCode:  e.exitCode,
+				ExitTime:  e.exitTime,
+			}
+		}
+
+		state.Containers = append(state.Containers, cs)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	// Write then rename, so that a crash never leaves a partial state.
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// loadState reads the persisted state of the shim serving sandboxID.
+func loadState(sandboxID string) (*shimState, error) {
+	path, err := shimStatePath(sandboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state shimState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// recover reattaches a restarted shim to the sandbox it was serving: the
+// containers and execs are rebuilt from the persisted state, the FIFOs of
+// the running processes are reopened, and their exits, the sandbox and its
+// OOM events are watched again. It does nothing if the shim never served
+// a sandbox.
+func (s *service) recover() error {
+	state, err := loadState(s.id)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state.ConfigPath != "" {
+		_, config, err := katautils.LoadConfiguration(state.ConfigPath, false, true)
+		if err != nil {
+			return err
+		}
+		s.config = &config
+		s.configPath = state.ConfigPath
+	}
+
+	sandbox, err := vci.FetchSandbox(s.ctx, s.id)
+	if err != nil {
+		return err
+	}
+	s.sandbox = sandbox
+
+	if err := s.startManagementServer(); err != nil {
+		logrus.WithError(err).WithField("sandbox", s.id).Warn("failed to start management server")
+	}
+
+	for _, cs := range state.Containers {
+		c, err := s.recoverContainer(cs)
+		if err != nil {
+			return err
+		}
+		s.containers[c.id] = c
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"sandbox":    s.id,
+		"containers": len(s.containers),
+	}).Info("shim reattached to sandbox")
+
+	return nil
+}
+
+func (s *service) recoverContainer(cs containerState) (*container, error) {
+	spec, err := compatoci.ParseConfigJSON(cs.Bundle)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &container{
+		s:           s,
+		spec:        &spec,
+		id:          cs.ID,
+		bundle:      cs.Bundle,
+		stdin:       cs.Stdin,
+		stdout:      cs.Stdout,
+		stderr:      cs.Stderr,
+		terminal:    cs.Terminal,
+		cType:       cs.Type,
+		execs:       make(map[string]*exec),
+		status:      cs.Status,
+		exit:        cs.Exit,
+		exitTime:    cs.ExitTime,
+		exitIOch:    make(chan struct{}),
+		exitCh:      make(chan uint32, 1),
+		stdinCloser: make(chan struct{}),
+		mounted:     cs.Mounted,
+	}
+
+	if c.log, err = newLogConfig(c.stdout, spec.Annotations); err != nil {
+		return nil, err
+	}
+
+	for id, es := range cs.Execs {
+		cmd := es.Cmd
+		log, err := newLogConfig(es.Stdout, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		c.execs[id] = &exec{
+			container: c,
+			cmds:      &cmd,
+			tty: &tty{
+				log:      log,
+				stdin:    es.Stdin,
+				stdout:   es.Stdout,
+				stderr:   es.Stderr,
+				height:   es.Height,
+				width:    es.Width,
+				terminal: es.Terminal,
+			},
+			id:          es.ProcessID,
+			exitCode:    es.ExitCode,
+			status:      es.Status,
+			exitIOch:    make(chan struct{}),
+			exitCh:      make(chan uint32, 1),
+			stdinCloser: make(chan struct{}),
+			exitTime:    es.ExitTime,
+		}
+	}
+
+	switch c.status {
+	case task.StatusCreated:
+		return c, nil
+	case task.StatusStopped:
+		close(c.exitIOch)
+		close(c.stdinCloser)
+		c.exitCh <- c.exit
+	default:
+		if c.cType.IsSandbox() {
+			if s.monitor, err = s.sandbox.Monitor(); err != nil {
+				return nil, err
+			}
+			go watchSandbox(s)
+			s.watchHealthEvents()
+			go watchOOMEvents(s.ctx, s)
+		}
+
+		if status, err := s.getContainerStatus(c.id); err == nil && status != task.StatusStopped {
+			c.status = status
+		}
+
+		t := &tty{
+			log:      c.log,
+			stdin:    c.stdin,
+			stdout:   c.stdout,
+			stderr:   c.stderr,
+			terminal: c.terminal,
+		}
+		if c.stdinPipe, c.ttyio, err = s.reattachIO(c.id, c.id, t, c.exitIOch, c.stdinCloser); err != nil {
+			return nil, err
+		}
+		go wait(s, c, "")
+	}
+
+	for id, e := range c.execs {
+		switch e.status {
+		case task.StatusCreated:
+		case task.StatusStopped:
+			close(e.exitIOch)
+			close(e.stdinCloser)
+			e.exitCh <- uint32(e.exitCode)
+		default:
+			if e.stdinPipe, e.ttyio, err = s.reattachIO(c.id, e.id, e.tty, e.exitIOch, e.stdinCloser); err != nil {
+				return nil, err
+			}
+			go wait(s, c, id)
+		}
+	}
+
+	return c, nil
+}
+
+// reattachIO reopens the FIFOs of a running process and copies its stdio
+// again. It returns the stdin of the process and its reopened FIFOs.
+func (s *service) reattachIO(containerID, processID string, t *tty, exitIOch, stdinCloser chan struct{}) (io.WriteCloser, *ttyIO, error) {
+	stdin, stdout, stderr, err := s.sandbox.IOStream(containerID, processID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot reattach to the stdio of process %s of container %s: %v", processID, containerID, err)
+	}
+
+	if t.stdin == "" && t.stdout == "" && t.stderr == "" && t.log == nil {
+		close(exitIOch)
+		close(stdinCloser)
+		return stdin, nil, nil
+	}
+
+	tty, err := newTtyIO(s.ctx, t.stdin, t.stdout, t.stderr, t.terminal, t.log)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	go ioCopy(exitIOch, stdinCloser, tty, stdin, stdout, stderr)
+
+	return stdin, tty, nil
+}
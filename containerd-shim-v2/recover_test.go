@@ -0,0 +1,166 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/api/types/task"
+	taskAPI "github.com/containerd/containerd/runtime/v2/task"
+	"github.com/stretchr/testify/assert"
+
+	ktu "github.com/kata-containers/runtime/pkg/katatestutils"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/persist"
+	vcAnnotations "github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/compatoci"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+)
+
+func TestRecoverSandbox(t *testing.T) {
+	if tc.NotValid(ktu.NeedRoot()) {
+		t.Skip(ktu.TestDisabledNeedRoot)
+	}
+
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// Run a real sandbox on the mock hypervisor and noop agent.
+	vci = &vc.VCImpl{}
+	defer func() {
+		vci = testingImpl
+	}()
+
+	sandboxID := "shim-recover-sandbox"
+
+	driver, err := persist.GetDriver()
+	assert.NoError(err)
+	defer driver.Destroy(sandboxID)
+
+	spec, err := compatoci.ParseConfigJSON(testBundleDir)
+	assert.NoError(err)
+
+	cmd := types.Cmd{
+		Args:    []string{"/bin/sh"},
+		WorkDir: "/",
+	}
+
+	sandbox, err := vci.CreateSandbox(ctx, vc.SandboxConfig{
+		ID:             sandboxID,
+		HypervisorType: vc.MockHypervisor,
+		HypervisorConfig: vc.HypervisorConfig{
+			KernelPath:     filepath.Join(testDir, "kernel"),
+			ImagePath:      filepath.Join(testDir, "image"),
+			HypervisorPath: filepath.Join(testDir, "hypervisor"),
+		},
+		AgentType: vc.NoopAgentType,
+		ProxyType: vc.NoopProxyType,
+		Containers: []vc.ContainerConfig{
+			{
+				ID:     sandboxID,
+				RootFs: vc.RootFs{Target: testBundleDir, Mounted: true},
+				Cmd:    cmd,
+				Annotations: map[string]string{
+					vcAnnotations.ContainerTypeKey: string(vc.PodSandbox),
+					vcAnnotations.BundlePathKey:    testBundleDir,
+				},
+				CustomSpec: &spec,
+			},
+		},
+	})
+	assert.NoError(err)
+	assert.NoError(sandbox.Start(context.Background()))
+
+	// The shim serving the sandbox persists its tasks.
+	s := &service{
+		id:         sandboxID,
+		ctx:        ctx,
+		sandbox:    sandbox,
+		containers: make(map[string]*container),
+	}
+
+	c, err := newContainer(s, &taskAPI.CreateTaskRequest{
+		ID:     sandboxID,
+		Bundle: testBundleDir,
+	}, vc.PodSandbox, &spec, false)
+	assert.NoError(err)
+	c.status = task.StatusRunning
+	c.execs["exec"] = &exec{
+		container: c,
+		cmds:      &cmd,
+		tty:       &tty{},
+		exitCode:  exitCode255,
+		status:    task.StatusCreated,
+	}
+	s.containers[sandboxID] = c
+
+	s.saveState()
+
+	statePath, err := shimStatePath(sandboxID)
+	assert.NoError(err)
+	_, err = os.Stat(statePath)
+	assert.NoError(err)
+
+	// The restarted shim reattaches to the sandbox.
+	s = &service{
+		id:         sandboxID,
+		ctx:        ctx,
+		containers: make(map[string]*container),
+		ec:         make(chan exit, bufferSize),
+	}
+	assert.NoError(s.recover())
+	assert.NotNil(s.sandbox)
+	assert.Equal(sandboxID, s.sandbox.ID())
+
+	s.mu.Lock()
+	c, err = s.getContainer(sandboxID)
+	assert.NoError(err)
+	assert.Equal(vc.PodSandbox, c.cType)
+	assert.Equal(testBundleDir, c.bundle)
+
+	e, err := c.getExec("exec")
+	assert.NoError(err)
+	assert.Equal(task.StatusCreated, e.status)
+	assert.Equal(cmd.Args, e.cmds.Args)
+	s.mu.Unlock()
+
+	// Exits are watched again: the processes of the noop agent exit right
+	// away, which tears the sandbox down.
+	select {
+	case code := <-c.exitCh:
+		assert.Equal(uint32(0), code)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the recovered container exit")
+	}
+
+	select {
+	case e := <-s.ec:
+		assert.Equal(sandboxID, e.id)
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the recovered container reap")
+	}
+
+	s.mu.Lock()
+	assert.Equal(task.StatusStopped, c.status)
+	s.mu.Unlock()
+
+	// The shim state went away with the sandbox.
+	_, err = os.Stat(statePath)
+	assert.True(os.IsNotExist(err))
+
+	// Nothing to recover anymore.
+	s = &service{
+		id:         sandboxID,
+		ctx:        ctx,
+		containers: make(map[string]*container),
+	}
+	assert.NoError(s.recover())
+	assert.Nil(s.sandbox)
+}
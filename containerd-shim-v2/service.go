@@ -7,6 +7,7 @@ package containerdshim
 
 import (
 	"context"
+	"flag"
 	"io/ioutil"
 	"os"
 	sysexec "os/exec"
@@ -20,6 +21,7 @@ import (
 	"github.com/containerd/containerd/events"
 	"github.com/containerd/containerd/namespaces"
 	cdruntime "github.com/containerd/containerd/runtime"
+	"github.com/containerd/containerd/runtime/linux/runctypes"
 	cdshim "github.com/containerd/containerd/runtime/v2/shim"
 	taskAPI "github.com/containerd/containerd/runtime/v2/task"
 	"github.com/containerd/typeurl"
@@ -88,6 +90,14 @@ func New(ctx context.Context, id string, publisher events.Publisher) (cdshim.Shi
 
 	go s.forward(publisher)
 
+	// Reattach to the sandbox if the shim serving it was restarted. The
+	// start and delete actions only run for the time of a single request.
+	if flag.NArg() == 0 {
+		if err := s.recover(); err != nil {
+			logger.WithError(err).Warn("failed to recover shim state")
+		}
+	}
+
 	return s, nil
 }
 
@@ -106,16 +116,22 @@ type service struct {
 
 	// pid Since this shimv2 cannot get the container processes pid from VM,
 	// thus for the returned values needed pid, just return this shim's
-	// pid directly.
+	// pid directly. The guest pids are only listed by Pids.
 	pid uint32
 
 	ctx        context.Context
 	sandbox    vc.VCSandbox
 	containers map[string]*container
 	config     *oci.RuntimeConfig
+	configPath string
 	events     chan interface{}
 	monitor    chan error
 
+	// healthEvents are the last health decisions of the sandbox
+	// monitor, served by the management server.
+	healthMu     sync.Mutex
+	healthEvents []vc.HealthEvent
+
 	cancel func()
 
 	ec chan exit
@@ -347,6 +363,7 @@ func (s *service) Create(ctx context.Context, r *taskAPI.CreateTaskRequest) (_ *
 	c.status = task.StatusCreated
 
 	s.containers[r.ID] = c
+	s.saveState()
 
 	s.send(&eventstypes.TaskCreate{
 		ContainerID: r.ID,
@@ -391,6 +408,7 @@ func (s *service) Start(ctx context.Context, r *taskAPI.StartRequest) (_ *taskAP
 		if err != nil {
 			return nil, errdefs.ToGRPC(err)
 		}
+		s.saveState()
 		s.send(&eventstypes.TaskStart{
 			ContainerID: c.id,
 			Pid:         s.pid,
@@ -401,6 +419,7 @@ func (s *service) Start(ctx context.Context, r *taskAPI.StartRequest) (_ *taskAP
 		if err != nil {
 			return nil, errdefs.ToGRPC(err)
 		}
+		s.saveState()
 		s.send(&eventstypes.TaskExecStarted{
 			ContainerID: c.id,
 			ExecID:      r.ExecID,
@@ -431,6 +450,7 @@ func (s *service) Delete(ctx context.Context, r *taskAPI.DeleteRequest) (_ *task
 		if err = deleteContainer(ctx, s, c); err != nil {
 			return nil, err
 		}
+		s.saveState()
 
 		s.send(&eventstypes.TaskDelete{
 			ContainerID: c.id,
@@ -452,6 +472,7 @@ func (s *service) Delete(ctx context.Context, r *taskAPI.DeleteRequest) (_ *task
 	}
 
 	delete(c.execs, r.ExecID)
+	s.saveState()
 
 	return &taskAPI.DeleteResponse{
 		ExitStatus: uint32(execs.exitCode),
@@ -484,6 +505,7 @@ func (s *service) Exec(ctx context.Context, r *taskAPI.ExecProcessRequest) (_ *p
 	}
 
 	c.execs[r.ExecID] = execs
+	s.saveState()
 
 	s.send(&eventstypes.TaskExecAdded{
 		ContainerID: c.id,
@@ -519,7 +541,7 @@ func (s *service) ResizePty(ctx context.Context, r *taskAPI.ResizePtyRequest) (_
 		processID = execs.id
 
 	}
-	err = s.sandbox.WinsizeProcess(c.id, processID, r.Height, r.Width)
+	err = s.sandbox.WinsizeProcess(ctx, c.id, processID, r.Height, r.Width)
 	if err != nil {
 		return nil, err
 	}
@@ -591,7 +613,7 @@ func (s *service) Pause(ctx context.Context, r *taskAPI.PauseRequest) (_ *ptypes
 
 	c.status = task.StatusPausing
 
-	err = s.sandbox.PauseContainer(r.ID)
+	err = s.sandbox.PauseContainer(ctx, r.ID)
 	if err == nil {
 		c.status = task.StatusPaused
 		s.send(&eventstypes.TaskPaused{
@@ -623,7 +645,7 @@ func (s *service) Resume(ctx context.Context, r *taskAPI.ResumeRequest) (_ *ptyp
 		return nil, err
 	}
 
-	err = s.sandbox.ResumeContainer(c.id)
+	err = s.sandbox.ResumeContainer(ctx, c.id)
 	if err == nil {
 		c.status = task.StatusRunning
 		s.send(&eventstypes.TaskResumed{
@@ -688,12 +710,12 @@ func (s *service) Kill(ctx context.Context, r *taskAPI.KillRequest) (_ *ptypes.E
 		}
 	}
 
-	return empty, s.sandbox.SignalProcess(c.id, processID, signum, r.All)
+	return empty, s.sandbox.SignalProcess(ctx, c.id, processID, signum, r.All)
 }
 
-// Pids returns all pids inside the container
-// Since for kata, it cannot get the process's pid from VM,
-// thus only return the Shim's pid directly.
+// Pids returns all guest pids inside the container, the pids of the execs
+// carrying the id of their exec. Only the shim's pid is returned if the
+// processes of the container cannot be listed.
 func (s *service) Pids(ctx context.Context, r *taskAPI.PidsRequest) (_ *taskAPI.PidsResponse, err error) {
 	var processes []*task.ProcessInfo
 
@@ -701,10 +723,51 @@ func (s *service) Pids(ctx context.Context, r *taskAPI.PidsRequest) (_ *taskAPI.
 		err = toGRPC(err)
 	}()
 
-	pInfo := task.ProcessInfo{
-		Pid: s.pid,
+	s.mu.Lock()
+	c, err := s.getContainer(r.ID)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	execs := make(map[string]string)
+	for id, e := range c.execs {
+		if e.status == task.StatusRunning {
+			execs[id] = e.id
+		}
+	}
+	s.mu.Unlock()
+
+	// The agent is asked without holding the service lock.
+	execIDs := s.guestExecIDs(ctx, c.id, execs)
+	procs, err := s.guestProcesses(ctx, c.id)
+	if err != nil || len(procs) == 0 {
+		if err != nil {
+			logrus.WithError(err).WithField("container", c.id).Warn("failed to list guest processes")
+		}
+		processes = append(processes, &task.ProcessInfo{
+			Pid: s.pid,
+		})
+		return &taskAPI.PidsResponse{
+			Processes: processes,
+		}, nil
+	}
+
+	for _, p := range procs {
+		pInfo := task.ProcessInfo{
+			Pid: p.pid,
+		}
+		if id, ok := execIDs[p.pid]; ok {
+			info, err := typeurl.MarshalAny(&runctypes.ProcessDetails{
+				ExecID: id,
+			})
+			if err != nil {
+				return nil, err
+			}
+			pInfo.Info = info
+		}
+		processes = append(processes, &pInfo)
 	}
-	processes = append(processes, &pInfo)
 
 	return &taskAPI.PidsResponse{
 		Processes: processes,
@@ -806,7 +869,7 @@ func (s *service) Stats(ctx context.Context, r *taskAPI.StatsRequest) (_ *taskAP
 		return nil, err
 	}
 
-	data, err := marshalMetrics(s, c.id)
+	data, err := marshalMetrics(ctx, s, c.id)
 	if err != nil {
 		return nil, err
 	}
@@ -835,7 +898,7 @@ func (s *service) Update(ctx context.Context, r *taskAPI.UpdateTaskRequest) (_ *
 		return nil, errdefs.ToGRPCf(errdefs.ErrInvalidArgument, "Invalid resources type for %s", s.id)
 	}
 
-	err = s.sandbox.UpdateContainer(r.ID, *resources)
+	err = s.sandbox.UpdateContainer(ctx, r.ID, *resources)
 	if err != nil {
 		return nil, errdefs.ToGRPC(err)
 	}
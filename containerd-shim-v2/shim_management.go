@@ -0,0 +1,442 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/persist"
+	persistapi "github.com/kata-containers/runtime/virtcontainers/persist/api"
+	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
+)
+
+// managementSocket is the socket the management server of a shim listens
+// on, in managementDir under the directory holding the sandbox state.
+const (
+	managementDir    = "management"
+	managementSocket = "shim-management.sock"
+)
+
+// URL paths served by the management server.
+const (
+	// StatusURL returns the sandbox status.
+	StatusURL = "/status"
+
+	// StatsURL returns the sandbox stats.
+	StatsURL = "/stats"
+
+	// InterfacesURL lists (GET), adds (PUT) or removes (DELETE) the
+	// guest network interfaces.
+	InterfacesURL = "/interfaces"
+
+	// RoutesURL lists (GET) or updates (PUT) the guest routes.
+	RoutesURL = "/routes"
+
+	// DevicesURL adds (PUT) a device to the sandbox.
+	DevicesURL = "/devices"
+
+	// DumpURL returns the persisted state of the sandbox and of the
+	// tasks of the shim.
+	DumpURL = "/dump"
+
+	// HealthURL returns the last health decisions of the sandbox
+	// monitor.
+	HealthURL = "/health"
+
+	// ResizeURL resizes (PUT) the VM on top of what the containers
+	// need.
+	ResizeURL = "/resize"
+
+	// GuestLogURL returns the guest log of the sandbox, as plain text.
+	GuestLogURL = "/guest-log"
+)
+
+// VMResize is the size of the VM on top of what the containers need.
+type VMResize struct {
+	ExtraVCPUs uint32
+	ExtraMemMB uint32
+}
+
+// AddedDevice describes a device added to the sandbox.
+type AddedDevice struct {
+	ID   string
+	Type config.DeviceType
+}
+
+// SandboxDump is the persisted state of a sandbox and of the shim serving
+// it, as returned by the management server.
+type SandboxDump struct {
+	Sandbox    persistapi.SandboxState
+	Containers map[string]persistapi.ContainerState
+	Shim       json.RawMessage
+}
+
+// SocketAddress returns the path of the management socket of the shim
+// serving sandboxID.
+func SocketAddress(sandboxID string) (string, error) {
+	driver, err := persist.GetDriver()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(driver.RunStoragePath(), sandboxID, managementDir, managementSocket), nil
+}
+
+// startManagementServer serves the management API of the sandbox on its
+// management socket. The socket goes away with the sandbox state.
+func (s *service) startManagementServer() error {
+	path, err := SocketAddress(s.sandbox.ID())
+	if err != nil {
+		return err
+	}
+
+	l, err := listenManagement(path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := http.Serve(l, s.managementHandler()); err != nil {
+			logrus.WithError(err).WithField("sandbox", s.id).Debug("management server stopped")
+		}
+	}()
+
+	return nil
+}
+
+// listenManagement listens on the management socket at path. The socket is
+// created in a directory only the shim user can enter, so that it is never
+// reachable by others, whatever its mode under the umask of the shim.
+func listenManagement(path string) (net.Listener, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	// The directory may be left by a previous shim, or created under a
+	// restrictive umask.
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	// A shim restarting on a sandbox finds the socket of its
+	// previous instance.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (s *service) managementHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(StatusURL, s.serveStatus)
+	mux.HandleFunc(StatsURL, s.serveStats)
+	mux.HandleFunc(InterfacesURL, s.serveInterfaces)
+	mux.HandleFunc(RoutesURL, s.serveRoutes)
+	mux.HandleFunc(DevicesURL, s.serveDevices)
+	mux.HandleFunc(DumpURL, s.serveDump)
+	mux.HandleFunc(HealthURL, s.serveHealth)
+	mux.HandleFunc(ResizeURL, s.serveResize)
+	mux.HandleFunc(GuestLogURL, s.serveGuestLog)
+
+	return mux
+}
+
+// managementError replies to a management request with err.
+func managementError(w http.ResponseWriter, err error, code int) {
+	http.Error(w, err.Error(), code)
+}
+
+// managementReply replies to a management request with the JSON encoding
+// of v, or with err if not nil.
+func managementReply(w http.ResponseWriter, v interface{}, err error) {
+	if err != nil {
+		managementError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.WithError(err).Warn("failed to reply to management request")
+	}
+}
+
+// managementSandbox returns the sandbox served by the shim, replying with
+// an error if there is none. It must be called with s.mu held.
+func (s *service) managementSandbox(w http.ResponseWriter) vc.VCSandbox {
+	if s.sandbox == nil {
+		managementError(w, fmt.Errorf("no sandbox served by shim %s", s.id), http.StatusNotFound)
+	}
+
+	return s.sandbox
+}
+
+func (s *service) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		managementError(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sandbox := s.managementSandbox(w)
+	if sandbox == nil {
+		return
+	}
+
+	managementReply(w, sandbox.Status(), nil)
+}
+
+func (s *service) serveStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		managementError(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sandbox := s.managementSandbox(w)
+	if sandbox == nil {
+		return
+	}
+
+	stats, err := sandbox.Stats()
+	managementReply(w, stats, err)
+}
+
+func (s *service) serveInterfaces(w http.ResponseWriter, r *http.Request) {
+	var inf *vcTypes.Interface
+
+	if r.Method == http.MethodPut || r.Method == http.MethodDelete {
+		if err := json.NewDecoder(r.Body).Decode(&inf); err != nil {
+			managementError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sandbox := s.managementSandbox(w)
+	if sandbox == nil {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		interfaces, err := sandbox.ListInterfaces(r.Context())
+		managementReply(w, interfaces, err)
+	case http.MethodPut:
+		inf, err := sandbox.AddInterface(r.Context(), inf)
+		managementReply(w, inf, err)
+	case http.MethodDelete:
+		inf, err := sandbox.RemoveInterface(r.Context(), inf)
+		managementReply(w, inf, err)
+	default:
+		managementError(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *service) serveRoutes(w http.ResponseWriter, r *http.Request) {
+	var routes []*vcTypes.Route
+
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&routes); err != nil {
+			managementError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sandbox := s.managementSandbox(w)
+	if sandbox == nil {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		routes, err := sandbox.ListRoutes(r.Context())
+		managementReply(w, routes, err)
+	case http.MethodPut:
+		routes, err := sandbox.UpdateRoutes(r.Context(), routes)
+		managementReply(w, routes, err)
+	default:
+		managementError(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *service) serveDevices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		managementError(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var info config.DeviceInfo
+	if err := json.NewDecoder(r.Body).Decode(&info); err != nil {
+		managementError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sandbox := s.managementSandbox(w)
+	if sandbox == nil {
+		return
+	}
+
+	device, err := sandbox.AddDevice(info)
+	if err != nil {
+		managementReply(w, nil, err)
+		return
+	}
+
+	managementReply(w, AddedDevice{
+		ID:   device.DeviceID(),
+		Type: device.DeviceType(),
+	}, nil)
+}
+
+func (s *service) serveDump(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		managementError(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sandbox := s.managementSandbox(w)
+	if sandbox == nil {
+		return
+	}
+
+	driver, err := persist.GetDriver()
+	if err != nil {
+		managementReply(w, nil, err)
+		return
+	}
+
+	ss, cs, err := driver.FromDisk(sandbox.ID())
+	if err != nil {
+		managementReply(w, nil, err)
+		return
+	}
+
+	dump := SandboxDump{
+		Sandbox:    ss,
+		Containers: cs,
+	}
+
+	if path, err := shimStatePath(sandbox.ID()); err == nil {
+		if data, err := ioutil.ReadFile(path); err == nil {
+			dump.Shim = data
+		}
+	}
+
+	managementReply(w, dump, nil)
+}
+
+func (s *service) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		managementError(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.healthMu.Lock()
+	events := append([]vc.HealthEvent{}, s.healthEvents...)
+	s.healthMu.Unlock()
+
+	managementReply(w, events, nil)
+}
+
+func (s *service) serveResize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		managementError(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var resize VMResize
+	if err := json.NewDecoder(r.Body).Decode(&resize); err != nil {
+		managementError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sandbox := s.managementSandbox(w)
+	if sandbox == nil {
+		return
+	}
+
+	err := sandbox.ResizeVM(r.Context(), resize.ExtraVCPUs, resize.ExtraMemMB)
+	managementReply(w, resize, err)
+}
+
+func (s *service) serveGuestLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		managementError(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mu.Lock()
+	sandbox := s.managementSandbox(w)
+	if sandbox == nil {
+		s.mu.Unlock()
+		return
+	}
+	sandboxID := sandbox.ID()
+	var dir string
+	if s.config != nil {
+		dir = s.config.GuestLogDir
+	}
+	s.mu.Unlock()
+
+	if dir == "" {
+		managementError(w, fmt.Errorf("guest log not enabled for sandbox %s", sandboxID), http.StatusNotFound)
+		return
+	}
+
+	// The log is read in full before replying, for a failure to read it
+	// to be reported as such.
+	var log bytes.Buffer
+	if err := vc.ReadGuestLog(dir, sandboxID, &log); err != nil {
+		managementError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := log.WriteTo(w); err != nil {
+		logrus.WithError(err).Warn("failed to reply to management request")
+	}
+}
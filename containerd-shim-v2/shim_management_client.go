@@ -0,0 +1,178 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
+)
+
+// managementTimeout bounds the management requests, device hotplug
+// included.
+const managementTimeout = 30 * time.Second
+
+// ManagementClient is a client of the management server of a shim.
+type ManagementClient struct {
+	client *http.Client
+}
+
+// NewManagementClient returns a client of the management server of the
+// shim serving sandboxID.
+func NewManagementClient(sandboxID string) (*ManagementClient, error) {
+	path, err := SocketAddress(sandboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	return newManagementClient(path), nil
+}
+
+func newManagementClient(path string) *ManagementClient {
+	return &ManagementClient{
+		client: &http.Client{
+			Timeout: managementTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			},
+		},
+	}
+}
+
+// do sends a management request, with the JSON encoding of in as body if
+// not nil, and decodes the JSON reply into out if not nil. The reply is
+// copied as is when out is an io.Writer.
+func (c *ManagementClient) do(method, url string, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, "http://shim"+url, &body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("%s %s failed: %s", method, url, strings.TrimSpace(string(msg)))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if w, ok := out.(io.Writer); ok {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Status returns the status of the sandbox.
+func (c *ManagementClient) Status() (vc.SandboxStatus, error) {
+	var status vc.SandboxStatus
+	err := c.do(http.MethodGet, StatusURL, nil, &status)
+	return status, err
+}
+
+// Stats returns the stats of the sandbox.
+func (c *ManagementClient) Stats() (vc.SandboxStats, error) {
+	var stats vc.SandboxStats
+	err := c.do(http.MethodGet, StatsURL, nil, &stats)
+	return stats, err
+}
+
+// ListInterfaces lists the network interfaces of the guest.
+func (c *ManagementClient) ListInterfaces() ([]*vcTypes.Interface, error) {
+	var interfaces []*vcTypes.Interface
+	err := c.do(http.MethodGet, InterfacesURL, nil, &interfaces)
+	return interfaces, err
+}
+
+// AddInterface adds a network interface to the guest.
+func (c *ManagementClient) AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	var added *vcTypes.Interface
+	err := c.do(http.MethodPut, InterfacesURL, inf, &added)
+	return added, err
+}
+
+// RemoveInterface removes a network interface from the guest.
+func (c *ManagementClient) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	var removed *vcTypes.Interface
+	err := c.do(http.MethodDelete, InterfacesURL, inf, &removed)
+	return removed, err
+}
+
+// ListRoutes lists the routes of the guest.
+func (c *ManagementClient) ListRoutes() ([]*vcTypes.Route, error) {
+	var routes []*vcTypes.Route
+	err := c.do(http.MethodGet, RoutesURL, nil, &routes)
+	return routes, err
+}
+
+// UpdateRoutes replaces the routes of the guest.
+func (c *ManagementClient) UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+	var updated []*vcTypes.Route
+	err := c.do(http.MethodPut, RoutesURL, routes, &updated)
+	return updated, err
+}
+
+// AddDevice adds a device to the sandbox.
+func (c *ManagementClient) AddDevice(info config.DeviceInfo) (AddedDevice, error) {
+	var device AddedDevice
+	err := c.do(http.MethodPut, DevicesURL, info, &device)
+	return device, err
+}
+
+// Dump returns the persisted state of the sandbox and of the shim.
+func (c *ManagementClient) Dump() (SandboxDump, error) {
+	var dump SandboxDump
+	err := c.do(http.MethodGet, DumpURL, nil, &dump)
+	return dump, err
+}
+
+// Health returns the last health decisions of the sandbox monitor.
+func (c *ManagementClient) Health() ([]vc.HealthEvent, error) {
+	var events []vc.HealthEvent
+	err := c.do(http.MethodGet, HealthURL, nil, &events)
+	return events, err
+}
+
+// Resize resizes the VM on top of what the containers need.
+func (c *ManagementClient) Resize(resize VMResize) (VMResize, error) {
+	var resized VMResize
+	err := c.do(http.MethodPut, ResizeURL, resize, &resized)
+	return resized, err
+}
+
+// GuestLog copies the guest log of the sandbox to w.
+func (c *ManagementClient) GuestLog(w io.Writer) error {
+	return c.do(http.MethodGet, GuestLogURL, nil, w)
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/vcmock"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+)
+
+// networkSandbox is a mock sandbox keeping track of its interfaces and
+// routes.
+type networkSandbox struct {
+	*vcmock.Sandbox
+	interfaces []*vcTypes.Interface
+	routes     []*vcTypes.Route
+	resize     VMResize
+}
+
+func (s *networkSandbox) Status() vc.SandboxStatus {
+	return vc.SandboxStatus{
+		ID:    s.MockID,
+		State: types.SandboxState{State: types.StateRunning},
+	}
+}
+
+func (s *networkSandbox) AddInterface(ctx context.Context, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	s.interfaces = append(s.interfaces, inf)
+	return inf, nil
+}
+
+func (s *networkSandbox) ListInterfaces(ctx context.Context) ([]*vcTypes.Interface, error) {
+	return s.interfaces, nil
+}
+
+func (s *networkSandbox) UpdateRoutes(ctx context.Context, routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+	s.routes = routes
+	return routes, nil
+}
+
+func (s *networkSandbox) ListRoutes(ctx context.Context) ([]*vcTypes.Route, error) {
+	return s.routes, nil
+}
+
+func (s *networkSandbox) ResizeVM(ctx context.Context, extraVCPUs, extraMemMB uint32) error {
+	s.resize = VMResize{ExtraVCPUs: extraVCPUs, ExtraMemMB: extraMemMB}
+	return nil
+}
+
+func TestListenManagement(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "shim-management")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, managementDir, managementSocket)
+
+	// The socket of a previous shim is replaced.
+	for i := 0; i < 2; i++ {
+		l, err := listenManagement(path)
+		assert.NoError(err)
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		l.Close()
+	}
+
+	st, err := os.Stat(filepath.Dir(path))
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0700), st.Mode().Perm())
+
+	st, err = os.Stat(path)
+	assert.NoError(err)
+	assert.Equal(os.FileMode(0600), st.Mode().Perm())
+}
+
+func TestManagementServer(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "shim-management")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, managementSocket)
+	l, err := net.Listen("unix", path)
+	assert.NoError(err)
+	defer l.Close()
+
+	s := &service{
+		id:         testSandboxID,
+		containers: make(map[string]*container),
+	}
+
+	go http.Serve(l, s.managementHandler())
+
+	client := newManagementClient(path)
+
+	// No sandbox is served yet.
+	_, err = client.Status()
+	assert.Error(err)
+
+	s.mu.Lock()
+	s.sandbox = &networkSandbox{
+		Sandbox: &vcmock.Sandbox{
+			MockID: testSandboxID,
+		},
+	}
+	s.mu.Unlock()
+
+	status, err := client.Status()
+	assert.NoError(err)
+	assert.Equal(testSandboxID, status.ID)
+	assert.Equal(types.StateRunning, status.State.State)
+
+	_, err = client.Stats()
+	assert.NoError(err)
+
+	inf := &vcTypes.Interface{
+		Device: "eth1",
+		Name:   "eth1",
+		HwAddr: "02:42:ac:11:00:02",
+		IPAddresses: []*vcTypes.IPAddress{
+			{Family: 0, Address: "172.17.0.2", Mask: "16"},
+		},
+	}
+
+	added, err := client.AddInterface(inf)
+	assert.NoError(err)
+	assert.Equal(inf, added)
+
+	interfaces, err := client.ListInterfaces()
+	assert.NoError(err)
+	assert.Equal([]*vcTypes.Interface{inf}, interfaces)
+
+	routes := []*vcTypes.Route{
+		{Dest: "default", Gateway: "172.17.0.1", Device: "eth1"},
+	}
+
+	updated, err := client.UpdateRoutes(routes)
+	assert.NoError(err)
+	assert.Equal(routes, updated)
+
+	listed, err := client.ListRoutes()
+	assert.NoError(err)
+	assert.Equal(routes, listed)
+
+	events, err := client.Health()
+	assert.NoError(err)
+	assert.Empty(events)
+
+	s.healthMu.Lock()
+	s.healthEvents = []vc.HealthEvent{
+		{Check: vc.HealthCheckAgent, Decision: vc.HealthDecisionTolerate, Failures: 1, Error: "agent unreachable"},
+	}
+	s.healthMu.Unlock()
+
+	events, err = client.Health()
+	assert.NoError(err)
+	assert.Equal(1, len(events))
+	assert.Equal(vc.HealthDecisionTolerate, events[0].Decision)
+
+	resize := VMResize{ExtraVCPUs: 2, ExtraMemMB: 512}
+	resized, err := client.Resize(resize)
+	assert.NoError(err)
+	assert.Equal(resize, resized)
+	assert.Equal(resize, s.sandbox.(*networkSandbox).resize)
+
+	// The guest log is not kept.
+	var guestLog bytes.Buffer
+	assert.Error(client.GuestLog(&guestLog))
+
+	s.mu.Lock()
+	s.config = &oci.RuntimeConfig{GuestLogDir: dir}
+	s.mu.Unlock()
+	assert.Error(client.GuestLog(&guestLog))
+
+	logPath := vc.GuestLogPath(dir, testSandboxID)
+	assert.NoError(os.MkdirAll(filepath.Dir(logPath), 0700))
+	assert.NoError(ioutil.WriteFile(logPath, []byte("[    0.000000] Linux version\n"), 0600))
+	assert.NoError(client.GuestLog(&guestLog))
+	assert.Equal("[    0.000000] Linux version\n", guestLog.String())
+
+	// Routes cannot be removed one by one.
+	err = client.do(http.MethodDelete, RoutesURL, routes, nil)
+	assert.Error(err)
+
+	// Malformed requests are rejected.
+	err = client.do(http.MethodPut, InterfacesURL, "eth1", nil)
+	assert.Error(err)
+}
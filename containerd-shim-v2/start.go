@@ -26,7 +26,7 @@ func startContainer(ctx context.Context, s *service, c *container) error {
 	}
 
 	if c.cType.IsSandbox() {
-		err := s.sandbox.Start()
+		err := s.sandbox.Start(ctx)
 		if err != nil {
 			return err
 		}
@@ -36,12 +36,13 @@ func startContainer(ctx context.Context, s *service, c *container) error {
 			return err
 		}
 		go watchSandbox(s)
+		s.watchHealthEvents()
 
 		// We don't rely on the context passed to startContainer as it can be cancelled after
 		// this rpc call.
 		go watchOOMEvents(s.ctx, s)
 	} else {
-		_, err := s.sandbox.StartContainer(c.id)
+		_, err := s.sandbox.StartContainer(ctx, c.id)
 		if err != nil {
 			return err
 		}
@@ -64,8 +65,8 @@ func startContainer(ctx context.Context, s *service, c *container) error {
 
 	c.stdinPipe = stdin
 
-	if c.stdin != "" || c.stdout != "" || c.stderr != "" {
-		tty, err := newTtyIO(ctx, c.stdin, c.stdout, c.stderr, c.terminal)
+	if c.stdin != "" || c.stdout != "" || c.stderr != "" || c.log != nil {
+		tty, err := newTtyIO(ctx, c.stdin, c.stdout, c.stderr, c.terminal, c.log)
 		if err != nil {
 			return err
 		}
@@ -97,7 +98,7 @@ func startExec(ctx context.Context, s *service, containerID, execID string) (*ex
 		return nil, err
 	}
 
-	_, proc, err := s.sandbox.EnterContainer(containerID, *execs.cmds)
+	_, proc, err := s.sandbox.EnterContainer(ctx, containerID, *execs.cmds)
 	if err != nil {
 		err := fmt.Errorf("cannot enter container %s, with err %s", containerID, err)
 		return nil, err
@@ -106,7 +107,7 @@ func startExec(ctx context.Context, s *service, containerID, execID string) (*ex
 
 	execs.status = task.StatusRunning
 	if execs.tty.height != 0 && execs.tty.width != 0 {
-		err = s.sandbox.WinsizeProcess(c.id, execs.id, execs.tty.height, execs.tty.width)
+		err = s.sandbox.WinsizeProcess(ctx, c.id, execs.id, execs.tty.height, execs.tty.width)
 		if err != nil {
 			return nil, err
 		}
@@ -119,7 +120,7 @@ func startExec(ctx context.Context, s *service, containerID, execID string) (*ex
 
 	execs.stdinPipe = stdin
 
-	tty, err := newTtyIO(ctx, execs.tty.stdin, execs.tty.stdout, execs.tty.stderr, execs.tty.terminal)
+	tty, err := newTtyIO(ctx, execs.tty.stdin, execs.tty.stdout, execs.tty.stderr, execs.tty.terminal, execs.tty.log)
 	if err != nil {
 		return nil, err
 	}
@@ -6,17 +6,52 @@
 package containerdshim
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/containerd/fifo"
+	"github.com/docker/go-units"
+
+	vcAnnotations "github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
 )
 
 // The buffer size used to specify the buffer for IO streams copy
 const bufSize = 32 << 10
 
+const (
+	// logURIScheme is the scheme of the stdio URIs selecting the shim log
+	// driver, e.g. "file:///var/log/ctr.log?max-size=10Mi&max-files=3".
+	logURIScheme = "file"
+
+	logMaxSizeOption  = "max-size"
+	logMaxFilesOption = "max-files"
+	logMaxAgeOption   = "max-age"
+
+	// defaultLogMaxFiles is the number of rotated log files kept when
+	// not specified.
+	defaultLogMaxFiles = 1
+
+	// maxLogMaxFiles bounds the number of rotated log files kept, which
+	// pods can set through annotations.
+	maxLogMaxFiles = 100
+
+	// CRI log format tags, for lines split by the writer and full lines.
+	logTagPartial = "P"
+	logTagFull    = "F"
+
+	logStdout = "stdout"
+	logStderr = "stderr"
+)
+
 var (
 	bufPool = sync.Pool{
 		New: func() interface{} {
@@ -49,7 +84,334 @@ func (tty *ttyIO) close() {
 	cf(tty.Stderr)
 }
 
-func newTtyIO(ctx context.Context, stdin, stdout, stderr string, console bool) (*ttyIO, error) {
+// logConfig configures the shim log driver, writing the container stdout
+// and stderr to a file in CRI log format instead of forwarding them to
+// FIFOs.
+type logConfig struct {
+	path string
+
+	// maxSize is the size above which the log file is rotated, 0 for
+	// no limit.
+	maxSize int64
+
+	// maxFiles is the number of rotated log files kept.
+	maxFiles int
+
+	// maxAge is the age above which the log file is rotated, 0 for no
+	// limit.
+	maxAge time.Duration
+}
+
+// setOption sets the log driver option name to value.
+func (cfg *logConfig) setOption(name, value string) error {
+	var err error
+
+	switch name {
+	case logMaxSizeOption:
+		cfg.maxSize, err = units.RAMInBytes(value)
+		if err == nil && cfg.maxSize < 0 {
+			err = fmt.Errorf("negative size")
+		}
+	case logMaxFilesOption:
+		cfg.maxFiles, err = strconv.Atoi(value)
+		if err == nil && (cfg.maxFiles < 0 || cfg.maxFiles > maxLogMaxFiles) {
+			err = fmt.Errorf("number of files not between 0 and %d", maxLogMaxFiles)
+		}
+	case logMaxAgeOption:
+		cfg.maxAge, err = time.ParseDuration(value)
+		if err == nil && cfg.maxAge < 0 {
+			err = fmt.Errorf("negative age")
+		}
+	default:
+		return fmt.Errorf("unknown log option %q", name)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid log option %s=%q: %v", name, value, err)
+	}
+
+	return nil
+}
+
+// newLogConfig returns the log driver configuration selected by the stdout
+// URI, or nil if the output should be forwarded to FIFOs. The log path only
+// ever comes from the URI set by the container manager, never from the pod.
+// Options of the URI query take precedence over the ones set through
+// annotations.
+func newLogConfig(stdout string, annotations map[string]string) (*logConfig, error) {
+	cfg := &logConfig{
+		maxFiles: defaultLogMaxFiles,
+	}
+
+	for option, annotation := range map[string]string{
+		logMaxSizeOption:  vcAnnotations.ShimLogMaxSize,
+		logMaxFilesOption: vcAnnotations.ShimLogMaxFiles,
+		logMaxAgeOption:   vcAnnotations.ShimLogMaxAge,
+	} {
+		if value, ok := annotations[annotation]; ok {
+			if err := cfg.setOption(option, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	u, err := url.Parse(stdout)
+	if err == nil && u.Scheme == logURIScheme {
+		if u.Host != "" || u.Path == "" {
+			return nil, fmt.Errorf("invalid log URI %q", stdout)
+		}
+
+		cfg.path = u.Path
+		for option, values := range u.Query() {
+			for _, value := range values {
+				if err := cfg.setOption(option, value); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if cfg.path == "" {
+		return nil, nil
+	}
+
+	if !filepath.IsAbs(cfg.path) || filepath.Clean(cfg.path) != cfg.path {
+		return nil, fmt.Errorf("log path %q is not absolute and clean", cfg.path)
+	}
+
+	return cfg, nil
+}
+
+// rotatingLog is a log file shared by the stdout and stderr writers of a
+// process, rotated according to its configuration.
+type rotatingLog struct {
+	sync.Mutex
+	cfg     logConfig
+	file    *os.File
+	size    int64
+	opened  time.Time
+	writers int
+}
+
+func openRotatingLog(cfg logConfig) (*rotatingLog, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.path), 0755); err != nil {
+		return nil, err
+	}
+
+	l := &rotatingLog{cfg: cfg}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *rotatingLog) open() error {
+	f, err := os.OpenFile(l.cfg.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|syscall.O_NOFOLLOW, 0640)
+	if err != nil {
+		return err
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = st.Size()
+	l.opened = time.Now()
+
+	return nil
+}
+
+// rotatedPath returns the path of the i-th most recent rotated log file.
+func (l *rotatingLog) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", l.cfg.path, i)
+}
+
+// rotate shifts the rotated log files, dropping the oldest one, and starts
+// a new log file.
+func (l *rotatingLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	if l.cfg.maxFiles == 0 {
+		if err := os.Remove(l.cfg.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return l.open()
+	}
+
+	if err := os.Remove(l.rotatedPath(l.cfg.maxFiles)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for i := l.cfg.maxFiles - 1; i > 0; i-- {
+		if err := os.Rename(l.rotatedPath(i), l.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(l.cfg.path, l.rotatedPath(1)); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+// needsRotation tells if the log file should be rotated before writing n
+// more bytes to it. An empty file is never rotated, so that entries larger
+// than the maximum size are still logged.
+func (l *rotatingLog) needsRotation(n int) bool {
+	if l.size == 0 {
+		return false
+	}
+
+	if l.cfg.maxSize > 0 && l.size+int64(n) > l.cfg.maxSize {
+		return true
+	}
+
+	return l.cfg.maxAge > 0 && time.Since(l.opened) > l.cfg.maxAge
+}
+
+// writeEntry writes a CRI log entry for content read from stream.
+func (l *rotatingLog) writeEntry(stream, tag string, content []byte) error {
+	entry := make([]byte, 0, len(content)+64)
+	entry = append(entry, time.Now().Format(time.RFC3339Nano)...)
+	entry = append(entry, ' ')
+	entry = append(entry, stream...)
+	entry = append(entry, ' ')
+	entry = append(entry, tag...)
+	entry = append(entry, ' ')
+	entry = append(entry, content...)
+	entry = append(entry, '\n')
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return os.ErrClosed
+	}
+
+	if l.needsRotation(len(entry)) {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(entry)
+	l.size += int64(n)
+
+	return err
+}
+
+// newWriter returns a writer logging the data read from stream.
+func (l *rotatingLog) newWriter(stream string) io.WriteCloser {
+	l.Lock()
+	defer l.Unlock()
+
+	l.writers++
+
+	return &logWriter{
+		log:    l,
+		stream: stream,
+	}
+}
+
+// release closes the log file once all its writers are closed.
+func (l *rotatingLog) release() error {
+	l.Lock()
+	defer l.Unlock()
+
+	l.writers--
+	if l.writers > 0 || l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+// logWriter splits the data read from a process stream into lines, and
+// logs each of them as a CRI log entry. Lines longer than bufSize are
+// split into partial entries.
+type logWriter struct {
+	sync.Mutex
+	log    *rotatingLog
+	stream string
+	line   []byte
+	closed bool
+}
+
+func (w *logWriter) Write(data []byte) (int, error) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+
+	written := len(data)
+
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			w.line = append(w.line, data...)
+			break
+		}
+
+		w.line = append(w.line, data[:i]...)
+		data = data[i+1:]
+
+		if err := w.log.writeEntry(w.stream, logTagFull, w.line); err != nil {
+			return 0, err
+		}
+		w.line = w.line[:0]
+	}
+
+	for len(w.line) >= bufSize {
+		if err := w.log.writeEntry(w.stream, logTagPartial, w.line[:bufSize]); err != nil {
+			return 0, err
+		}
+		w.line = append(w.line[:0], w.line[bufSize:]...)
+	}
+
+	return written, nil
+}
+
+// Close logs the last line, even if it was not terminated.
+func (w *logWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	w.closed = true
+
+	var err error
+	if len(w.line) > 0 {
+		err = w.log.writeEntry(w.stream, logTagFull, w.line)
+		w.line = nil
+	}
+
+	if releaseErr := w.log.release(); err == nil {
+		err = releaseErr
+	}
+
+	return err
+}
+
+// newTtyIO opens the stdio of a process. Its output is written by the log
+// driver when log is set, and forwarded to the stdout and stderr FIFOs
+// otherwise. As the log driver never blocks, the process keeps running
+// when nobody consumes its output.
+func newTtyIO(ctx context.Context, stdin, stdout, stderr string, console bool, log *logConfig) (*ttyIO, error) {
 	var in io.ReadCloser
 	var outw io.Writer
 	var errw io.Writer
@@ -62,6 +424,27 @@ func newTtyIO(ctx context.Context, stdin, stdout, stderr string, console bool) (
 		}
 	}
 
+	if log != nil {
+		l, err := openRotatingLog(*log)
+		if err != nil {
+			if in != nil {
+				in.Close()
+			}
+			return nil, err
+		}
+
+		outw = l.newWriter(logStdout)
+		if !console {
+			errw = l.newWriter(logStderr)
+		}
+
+		return &ttyIO{
+			Stdin:  in,
+			Stdout: outw,
+			Stderr: errw,
+		}, nil
+	}
+
 	if stdout != "" {
 		outw, err = fifo.OpenFifo(ctx, stdout, syscall.O_RDWR, 0)
 		if err != nil {
@@ -7,15 +7,20 @@ package containerdshim
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
 
 	"github.com/containerd/fifo"
 	"github.com/stretchr/testify/assert"
+
+	vcAnnotations "github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
 )
 
 func TestNewTtyIOFifoReopen(t *testing.T) {
@@ -41,7 +46,7 @@ func TestNewTtyIOFifoReopen(t *testing.T) {
 	defer outr.Close()
 	errr = createReadFifo(stderr)
 	defer errr.Close()
-	tty, err = newTtyIO(ctx, "", stdout, stderr, false)
+	tty, err = newTtyIO(ctx, "", stdout, stderr, false, nil)
 	assert.NoError(err)
 	defer tty.close()
 
@@ -89,3 +94,242 @@ func TestNewTtyIOFifoReopen(t *testing.T) {
 	checkFifoRead(outr)
 	checkFifoRead(errr)
 }
+
+func TestNewLogConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	// FIFOs
+	cfg, err := newLogConfig("/run/containerd/fifo/stdout", nil)
+	assert.NoError(err)
+	assert.Nil(cfg)
+
+	cfg, err = newLogConfig("file:///var/log/ctr.log?max-size=1Ki&max-files=3&max-age=1h", nil)
+	assert.NoError(err)
+	assert.Equal(&logConfig{
+		path:     "/var/log/ctr.log",
+		maxSize:  1024,
+		maxFiles: 3,
+		maxAge:   time.Hour,
+	}, cfg)
+
+	annotations := map[string]string{
+		vcAnnotations.ShimLogMaxSize:  "2Ki",
+		vcAnnotations.ShimLogMaxFiles: "0",
+	}
+	cfg, err = newLogConfig("file:///var/log/ctr.log", annotations)
+	assert.NoError(err)
+	assert.Equal(&logConfig{
+		path:    "/var/log/ctr.log",
+		maxSize: 2048,
+	}, cfg)
+
+	// Annotations alone never select the log driver.
+	cfg, err = newLogConfig("", annotations)
+	assert.NoError(err)
+	assert.Nil(cfg)
+
+	// The URI takes precedence over annotations.
+	cfg, err = newLogConfig("file:///var/log/ctr.log?max-size=1Ki", annotations)
+	assert.NoError(err)
+	assert.Equal(&logConfig{
+		path:    "/var/log/ctr.log",
+		maxSize: 1024,
+	}, cfg)
+
+	for _, uri := range []string{
+		"file:///var/log/ctr.log?max-size=foo",
+		"file:///var/log/ctr.log?max-files=-1",
+		"file:///var/log/ctr.log?max-files=1000000",
+		"file:///var/log/ctr.log?max-age=1",
+		"file:///var/log/ctr.log?compress=true",
+		"file://ctr.log",
+		"file:///var/log/../../etc/ctr.log",
+	} {
+		_, err = newLogConfig(uri, nil)
+		assert.Error(err, uri)
+	}
+
+	_, err = newLogConfig("file:///var/log/ctr.log", map[string]string{
+		vcAnnotations.ShimLogMaxAge: "forever",
+	})
+	assert.Error(err)
+}
+
+// readLogEntries returns the streams, tags and contents of the CRI log
+// entries of path.
+func readLogEntries(t *testing.T, path string) [][]string {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+
+	var entries [][]string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 4)
+		assert.Len(t, fields, 4)
+
+		_, err := time.Parse(time.RFC3339Nano, fields[0])
+		assert.NoError(t, err)
+
+		entries = append(entries, fields[1:])
+	}
+
+	return entries
+}
+
+func TestLogWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "log-")
+	assert.NoError(err)
+	path := filepath.Join(dir, "ctr", "0.log")
+
+	l, err := openRotatingLog(logConfig{path: path})
+	assert.NoError(err)
+
+	stdout := l.newWriter(logStdout)
+	stderr := l.newWriter(logStderr)
+
+	_, err = stdout.Write([]byte("hello\nwor"))
+	assert.NoError(err)
+	_, err = stderr.Write([]byte("oops\n"))
+	assert.NoError(err)
+	_, err = stdout.Write([]byte("ld\n\nlast"))
+	assert.NoError(err)
+
+	long := strings.Repeat("x", bufSize+10)
+	_, err = stderr.Write([]byte(long))
+	assert.NoError(err)
+
+	assert.NoError(stdout.Close())
+	assert.NoError(stderr.Close())
+	assert.Error(stdout.Close())
+
+	_, err = stdout.Write([]byte("closed\n"))
+	assert.Error(err)
+
+	assert.Equal([][]string{
+		{logStdout, logTagFull, "hello"},
+		{logStderr, logTagFull, "oops"},
+		{logStdout, logTagFull, "world"},
+		{logStdout, logTagFull, ""},
+		{logStderr, logTagPartial, long[:bufSize]},
+		{logStdout, logTagFull, "last"},
+		{logStderr, logTagFull, long[bufSize:]},
+	}, readLogEntries(t, path))
+}
+
+func TestRotatingLog(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "log-")
+	assert.NoError(err)
+	path := filepath.Join(dir, "0.log")
+
+	// Entries are 42 bytes long: a 35 bytes timestamp at most, the
+	// stream, the tag and the content.
+	l, err := openRotatingLog(logConfig{
+		path:     path,
+		maxSize:  100,
+		maxFiles: 2,
+	})
+	assert.NoError(err)
+
+	w := l.newWriter(logStdout)
+	for i := 0; i < 8; i++ {
+		_, err = fmt.Fprintf(w, "%d\n", i)
+		assert.NoError(err)
+	}
+	assert.NoError(w.Close())
+
+	for path, contents := range map[string][]string{
+		path + ".2": {"2", "3"},
+		path + ".1": {"4", "5"},
+		path:        {"6", "7"},
+	} {
+		entries := readLogEntries(t, path)
+		assert.Len(entries, len(contents), path)
+		for i, entry := range entries {
+			assert.Equal(contents[i], entry[2])
+		}
+
+		st, err := os.Stat(path)
+		assert.NoError(err)
+		assert.True(st.Size() <= 100)
+	}
+
+	_, err = os.Stat(path + ".3")
+	assert.True(os.IsNotExist(err))
+
+	// Without rotated files, the log file is truncated.
+	l, err = openRotatingLog(logConfig{
+		path:    path,
+		maxSize: 1,
+	})
+	assert.NoError(err)
+
+	w = l.newWriter(logStdout)
+	_, err = w.Write([]byte("new\n"))
+	assert.NoError(err)
+	assert.NoError(w.Close())
+
+	assert.Equal([][]string{{logStdout, logTagFull, "new"}}, readLogEntries(t, path))
+
+	// Age based rotation
+	l, err = openRotatingLog(logConfig{
+		path:     path,
+		maxFiles: 1,
+		maxAge:   time.Millisecond,
+	})
+	assert.NoError(err)
+
+	w = l.newWriter(logStdout)
+	time.Sleep(2 * time.Millisecond)
+	_, err = w.Write([]byte("newer\n"))
+	assert.NoError(err)
+	assert.NoError(w.Close())
+
+	assert.Equal([][]string{{logStdout, logTagFull, "new"}}, readLogEntries(t, path+".1"))
+	assert.Equal([][]string{{logStdout, logTagFull, "newer"}}, readLogEntries(t, path))
+}
+
+func TestIOCopyLogDriver(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "log-")
+	assert.NoError(err)
+	path := filepath.Join(dir, "0.log")
+
+	log, err := newLogConfig("file://"+path, nil)
+	assert.NoError(err)
+
+	// Nobody consumes the output of the process.
+	tty, err := newTtyIO(context.TODO(), "", "file://"+path, "file://"+path, false, log)
+	assert.NoError(err)
+
+	output := strings.Repeat("line\n", 1024)
+	exitch := make(chan struct{})
+	go ioCopy(exitch, make(chan struct{}), tty, nil, strings.NewReader(output), strings.NewReader("error\n"))
+
+	select {
+	case <-exitch:
+	case <-time.After(5 * time.Second):
+		t.Fatal("io copy timeout")
+	}
+
+	var stdout, stderr int
+	for _, entry := range readLogEntries(t, path) {
+		switch entry[0] {
+		case logStdout:
+			assert.Equal("line", entry[2])
+			stdout++
+		case logStderr:
+			assert.Equal("error", entry[2])
+			stderr++
+		}
+	}
+	assert.Equal(1024, stdout)
+	assert.True(stderr <= 1)
+}
@@ -38,7 +38,7 @@ func wait(s *service, c *container, execID string) (int32, error) {
 		processID = execs.id
 	}
 
-	ret, err := s.sandbox.WaitProcess(c.id, processID)
+	ret, err := s.sandbox.WaitProcess(s.ctx, c.id, processID)
 	if err != nil {
 		logrus.WithError(err).WithFields(logrus.Fields{
 			"container": c.id,
@@ -60,15 +60,15 @@ func wait(s *service, c *container, execID string) (int32, error) {
 			if s.monitor != nil {
 				s.monitor <- nil
 			}
-			if err = s.sandbox.Stop(true); err != nil {
+			if err = s.sandbox.Stop(s.ctx, true); err != nil {
 				logrus.WithField("sandbox", s.sandbox.ID()).Error("failed to stop sandbox")
 			}
 
-			if err = s.sandbox.Delete(); err != nil {
+			if err = s.sandbox.Delete(s.ctx); err != nil {
 				logrus.WithField("sandbox", s.sandbox.ID()).Error("failed to delete sandbox")
 			}
 		} else {
-			if _, err = s.sandbox.StopContainer(c.id, false); err != nil {
+			if _, err = s.sandbox.StopContainer(s.ctx, c.id, false); err != nil {
 				logrus.WithError(err).WithField("container", c.id).Warn("stop container failed")
 			}
 		}
@@ -85,6 +85,7 @@ func wait(s *service, c *container, execID string) (int32, error) {
 
 		execs.exitCh <- uint32(ret)
 	}
+	s.saveState()
 	s.mu.Unlock()
 
 	go cReap(s, int(ret), c.id, execID, timeStamp)
@@ -106,11 +107,11 @@ func watchSandbox(s *service) {
 	defer s.mu.Unlock()
 	// sandbox malfunctioning, cleanup as much as we can
 	logrus.WithError(err).Warn("sandbox stopped unexpectedly")
-	err = s.sandbox.Stop(true)
+	err = s.sandbox.Stop(s.ctx, true)
 	if err != nil {
 		logrus.WithError(err).Warn("stop sandbox failed")
 	}
-	err = s.sandbox.Delete()
+	err = s.sandbox.Delete(s.ctx)
 	if err != nil {
 		logrus.WithError(err).Warn("delete sandbox failed")
 	}
@@ -130,6 +131,35 @@ func watchSandbox(s *service) {
 	// No need to send async events here.
 }
 
+// healthEventsKept is the number of health decisions of the sandbox
+// monitor kept by the shim.
+const healthEventsKept = 64
+
+// watchHealthEvents keeps the last health decisions of the sandbox monitor
+// until it stops.
+func (s *service) watchHealthEvents() {
+	events, err := s.sandbox.HealthEvents()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to watch sandbox health events")
+		return
+	}
+
+	if events == nil {
+		return
+	}
+
+	go func() {
+		for e := range events {
+			s.healthMu.Lock()
+			s.healthEvents = append(s.healthEvents, e)
+			if len(s.healthEvents) > healthEventsKept {
+				s.healthEvents = s.healthEvents[len(s.healthEvents)-healthEventsKept:]
+			}
+			s.healthMu.Unlock()
+		}
+	}()
+}
+
 func watchOOMEvents(ctx context.Context, s *service) {
 	if s.sandbox == nil {
 		return
@@ -140,7 +170,7 @@ func watchOOMEvents(ctx context.Context, s *service) {
 		case <-ctx.Done():
 			return
 		default:
-			containerID, err := s.sandbox.GetOOMEvent()
+			containerID, err := s.sandbox.GetOOMEvent(ctx)
 			if err != nil {
 				logrus.WithField("sandbox", s.sandbox.ID()).WithError(err).Warn("failed to get OOM event from sandbox")
 				// If the GetOOMEvent call is not implemented, then the agent is most likely an older version,
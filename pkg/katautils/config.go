@@ -12,12 +12,15 @@ import (
 	"io/ioutil"
 	goruntime "runtime"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	govmmQemu "github.com/intel/govmm/qemu"
 	vc "github.com/kata-containers/runtime/virtcontainers"
 	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	exp "github.com/kata-containers/runtime/virtcontainers/experimental"
+	vf "github.com/kata-containers/runtime/virtcontainers/factory"
+	"github.com/kata-containers/runtime/virtcontainers/factory/grpccache"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
 	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/sirupsen/logrus"
@@ -82,6 +85,29 @@ type factory struct {
 	TemplatePath    string `toml:"template_path"`
 	VMCacheNumber   uint   `toml:"vm_cache_number"`
 	VMCacheEndpoint string `toml:"vm_cache_endpoint"`
+
+	VMCacheTokenPath   string   `toml:"vm_cache_token_path"`
+	VMCacheAllowedUIDs []uint32 `toml:"vm_cache_allowed_uids"`
+	VMCacheAllowedGIDs []uint32 `toml:"vm_cache_allowed_gids"`
+
+	VMCacheMin           uint   `toml:"vm_cache_min"`
+	VMCacheIdleTimeout   uint32 `toml:"vm_cache_idle_timeout"`
+	VMCacheMinFreeMemory uint32 `toml:"vm_cache_min_free_memory"`
+	VMCacheCheckInterval uint32 `toml:"vm_cache_check_interval"`
+	VMCacheMaxAge        uint32 `toml:"vm_cache_max_age"`
+
+	VMCachePools []vmCachePool `toml:"vm_cache_pool"`
+}
+
+type vmCachePool struct {
+	Name          string `toml:"name"`
+	VMCacheNumber uint   `toml:"vm_cache_number"`
+	VMCacheMin    uint   `toml:"vm_cache_min"`
+	NumVCPUs      uint32 `toml:"default_vcpus"`
+	MemorySize    uint32 `toml:"default_memory"`
+	KernelPath    string `toml:"kernel"`
+	ImagePath     string `toml:"image"`
+	InitrdPath    string `toml:"initrd"`
 }
 
 type hypervisor struct {
@@ -101,6 +127,7 @@ type hypervisor struct {
 	SharedFS                string   `toml:"shared_fs"`
 	VirtioFSDaemon          string   `toml:"virtio_fs_daemon"`
 	VirtioFSCache           string   `toml:"virtio_fs_cache"`
+	VirtioFSVolumeCache     string   `toml:"virtio_fs_volume_cache"`
 	VirtioFSExtraArgs       []string `toml:"virtio_fs_extra_args"`
 	VirtioFSCacheSize       uint32   `toml:"virtio_fs_cache_size"`
 	BlockDeviceCacheSet     bool     `toml:"block_device_cache_set"`
@@ -119,6 +146,7 @@ type hypervisor struct {
 	DisableBlockDeviceUse   bool     `toml:"disable_block_device_use"`
 	MemPrealloc             bool     `toml:"enable_mem_prealloc"`
 	HugePages               bool     `toml:"enable_hugepages"`
+	EnableNUMA              bool     `toml:"enable_numa"`
 	VirtioMem               bool     `toml:"enable_virtio_mem"`
 	IOMMU                   bool     `toml:"enable_iommu"`
 	FileBackedMemRootDir    string   `toml:"file_mem_backend"`
@@ -139,14 +167,34 @@ type proxy struct {
 }
 
 type runtime struct {
-	Debug               bool     `toml:"enable_debug"`
-	Tracing             bool     `toml:"enable_tracing"`
-	DisableNewNetNs     bool     `toml:"disable_new_netns"`
-	DisableGuestSeccomp bool     `toml:"disable_guest_seccomp"`
-	SandboxCgroupOnly   bool     `toml:"sandbox_cgroup_only"`
-	EnableAgentPidNs    bool     `toml:"enable_agent_pidns"`
-	Experimental        []string `toml:"experimental"`
-	InterNetworkModel   string   `toml:"internetworking_model"`
+	Debug                         bool     `toml:"enable_debug"`
+	Tracing                       bool     `toml:"enable_tracing"`
+	DisableNewNetNs               bool     `toml:"disable_new_netns"`
+	DisableGuestSeccomp           bool     `toml:"disable_guest_seccomp"`
+	SandboxCgroupOnly             bool     `toml:"sandbox_cgroup_only"`
+	EnableVCPUsPinning            bool     `toml:"enable_vcpus_pinning"`
+	EnableAgentPidNs              bool     `toml:"enable_agent_pidns"`
+	Experimental                  []string `toml:"experimental"`
+	InterNetworkModel             string   `toml:"internetworking_model"`
+	EncryptedScratchSize          uint32   `toml:"encrypted_scratch_size"`
+	EncryptedScratchDir           string   `toml:"encrypted_scratch_dir"`
+	RootfsImageFsType             string   `toml:"rootfs_image_fstype"`
+	RootfsImageCacheDir           string   `toml:"rootfs_image_cache_dir"`
+	RootfsImageCacheSize          uint32   `toml:"rootfs_image_cache_size"`
+	DirectBlockVolumes            bool     `toml:"direct_block_volumes"`
+	GuestLogMaxSize               uint32   `toml:"guest_log_max_size"`
+	GuestLogDir                   string   `toml:"guest_log_dir"`
+	HealthFailureThreshold        uint32   `toml:"health_failure_threshold"`
+	HealthAgentReconnectAttempts  uint32   `toml:"health_agent_reconnect_attempts"`
+	HealthMemoryPressureThreshold uint32   `toml:"health_memory_pressure_threshold"`
+	HealthActions                 []string `toml:"health_actions"`
+	DiagnosticsDir                string   `toml:"diagnostics_dir"`
+	DiagnosticsMaxBundles         uint32   `toml:"diagnostics_max_bundles"`
+	DiagnosticsGuestMemory        bool     `toml:"diagnostics_guest_memory"`
+	OverheadInterval              uint32   `toml:"overhead_interval"`
+	OverheadDir                   string   `toml:"overhead_dir"`
+	OverheadMaxRecords            uint32   `toml:"overhead_max_records"`
+	OverheadMaxAge                uint32   `toml:"overhead_max_age"`
 }
 
 type shim struct {
@@ -161,6 +209,14 @@ type agent struct {
 	TraceMode     string   `toml:"trace_mode"`
 	TraceType     string   `toml:"trace_type"`
 	KernelModules []string `toml:"kernel_modules"`
+	DebugConsole  bool     `toml:"debug_console_enabled"`
+
+	// Timeouts of the requests to the agent, in seconds.
+	CheckTimeout   uint32 `toml:"check_timeout"`
+	RequestTimeout uint32 `toml:"request_timeout"`
+	QueryTimeout   uint32 `toml:"query_timeout"`
+	WaitTimeout    uint32 `toml:"wait_timeout"`
+	RequestRetries uint32 `toml:"request_retries"`
 }
 
 type netmon struct {
@@ -483,6 +539,19 @@ func (a agent) trace() bool {
 	return a.Tracing
 }
 
+func (a agent) debugConsoleEnabled() bool {
+	return a.DebugConsole
+}
+
+func (a agent) requestTimeouts() vc.AgentRequestTimeouts {
+	return vc.AgentRequestTimeouts{
+		Check:   time.Duration(a.CheckTimeout) * time.Second,
+		Request: time.Duration(a.RequestTimeout) * time.Second,
+		Query:   time.Duration(a.QueryTimeout) * time.Second,
+		Wait:    time.Duration(a.WaitTimeout) * time.Second,
+	}
+}
+
 func (a agent) traceMode() string {
 	return a.TraceMode
 }
@@ -670,6 +739,7 @@ func newQemuHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 		VirtioFSExtraArgs:       h.VirtioFSExtraArgs,
 		MemPrealloc:             h.MemPrealloc,
 		HugePages:               h.HugePages,
+		EnableNUMA:              h.EnableNUMA,
 		IOMMU:                   h.IOMMU,
 		FileBackedMemRootDir:    h.FileBackedMemRootDir,
 		Mlock:                   !h.Swap,
@@ -800,6 +870,12 @@ func newClhHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 			errors.New("virtio-fs daemon path is missing in configuration file")
 	}
 
+	if h.VirtioFSVolumeCache != "" {
+		if err := vc.CheckVirtioFSCacheMode(h.VirtioFSVolumeCache); err != nil {
+			return vc.HypervisorConfig{}, err
+		}
+	}
+
 	return vc.HypervisorConfig{
 		HypervisorPath:          hypervisor,
 		KernelPath:              kernel,
@@ -822,6 +898,7 @@ func newClhHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 		VirtioFSDaemon:          h.VirtioFSDaemon,
 		VirtioFSCacheSize:       h.VirtioFSCacheSize,
 		VirtioFSCache:           h.VirtioFSCache,
+		VirtioFSVolumeCache:     h.VirtioFSVolumeCache,
 		MemPrealloc:             h.MemPrealloc,
 		HugePages:               h.HugePages,
 		FileBackedMemRootDir:    h.FileBackedMemRootDir,
@@ -849,11 +926,53 @@ func newFactoryConfig(f factory) (oci.FactoryConfig, error) {
 	if f.VMCacheEndpoint == "" {
 		f.VMCacheEndpoint = defaultVMCacheEndpoint
 	}
+
+	var pools []oci.FactoryPoolConfig
+	for _, p := range f.VMCachePools {
+		pool := oci.FactoryPoolConfig{
+			Name:          p.Name,
+			VMCacheNumber: p.VMCacheNumber,
+			VMCacheMin:    p.VMCacheMin,
+			NumVCPUs:      p.NumVCPUs,
+			MemorySize:    p.MemorySize,
+		}
+
+		for _, path := range []struct {
+			src string
+			dst *string
+		}{
+			{p.KernelPath, &pool.KernelPath},
+			{p.ImagePath, &pool.ImagePath},
+			{p.InitrdPath, &pool.InitrdPath},
+		} {
+			if path.src == "" {
+				continue
+			}
+
+			resolved, err := ResolvePath(path.src)
+			if err != nil {
+				return oci.FactoryConfig{}, err
+			}
+			*path.dst = resolved
+		}
+
+		pools = append(pools, pool)
+	}
+
 	return oci.FactoryConfig{
-		Template:        f.Template,
-		TemplatePath:    f.TemplatePath,
-		VMCacheNumber:   f.VMCacheNumber,
-		VMCacheEndpoint: f.VMCacheEndpoint,
+		Template:             f.Template,
+		TemplatePath:         f.TemplatePath,
+		VMCacheNumber:        f.VMCacheNumber,
+		VMCacheEndpoint:      f.VMCacheEndpoint,
+		VMCacheTokenPath:     f.VMCacheTokenPath,
+		VMCacheAllowedUIDs:   f.VMCacheAllowedUIDs,
+		VMCacheAllowedGIDs:   f.VMCacheAllowedGIDs,
+		VMCacheMin:           f.VMCacheMin,
+		VMCacheIdleTimeout:   f.VMCacheIdleTimeout,
+		VMCacheMinFreeMemory: f.VMCacheMinFreeMemory,
+		VMCacheCheckInterval: f.VMCacheCheckInterval,
+		VMCacheMaxAge:        f.VMCacheMaxAge,
+		VMCachePools:         pools,
 	}, nil
 }
 
@@ -941,10 +1060,13 @@ func updateRuntimeConfigAgent(configPath string, tomlConf tomlConfig, config *oc
 
 		config.AgentType = vc.KataContainersAgent
 		config.AgentConfig = vc.KataAgentConfig{
-			LongLiveConn:  true,
-			UseVSock:      config.HypervisorConfig.UseVSock,
-			Debug:         agentConfig.Debug,
-			KernelModules: agentConfig.KernelModules,
+			LongLiveConn:        true,
+			UseVSock:            config.HypervisorConfig.UseVSock,
+			Debug:               agentConfig.Debug,
+			KernelModules:       agentConfig.KernelModules,
+			DebugConsoleEnabled: agentConfig.DebugConsoleEnabled,
+			RequestTimeouts:     agentConfig.RequestTimeouts,
+			RequestRetries:      agentConfig.RequestRetries,
 		}
 
 		return nil
@@ -955,12 +1077,15 @@ func updateRuntimeConfigAgent(configPath string, tomlConf tomlConfig, config *oc
 		case kataAgentTableType:
 			config.AgentType = vc.KataContainersAgent
 			config.AgentConfig = vc.KataAgentConfig{
-				UseVSock:      config.HypervisorConfig.UseVSock,
-				Debug:         agent.debug(),
-				Trace:         agent.trace(),
-				TraceMode:     agent.traceMode(),
-				TraceType:     agent.traceType(),
-				KernelModules: agent.kernelModules(),
+				UseVSock:            config.HypervisorConfig.UseVSock,
+				Debug:               agent.debug(),
+				Trace:               agent.trace(),
+				TraceMode:           agent.traceMode(),
+				TraceType:           agent.traceType(),
+				KernelModules:       agent.kernelModules(),
+				DebugConsoleEnabled: agent.debugConsoleEnabled(),
+				RequestTimeouts:     agent.requestTimeouts(),
+				RequestRetries:      agent.RequestRetries,
 			}
 		default:
 			return fmt.Errorf("%s agent type is not supported", k)
@@ -1220,8 +1345,63 @@ func LoadConfiguration(configPath string, ignoreLogging, builtIn bool) (resolved
 	}
 
 	config.SandboxCgroupOnly = tomlConf.Runtime.SandboxCgroupOnly
+	config.EnableVCPUsPinning = tomlConf.Runtime.EnableVCPUsPinning
 	config.DisableNewNetNs = tomlConf.Runtime.DisableNewNetNs
 	config.EnableAgentPidNs = tomlConf.Runtime.EnableAgentPidNs
+	config.EncryptedScratchSize = tomlConf.Runtime.EncryptedScratchSize
+	config.EncryptedScratchDir = tomlConf.Runtime.EncryptedScratchDir
+	if config.EncryptedScratchDir == "" {
+		config.EncryptedScratchDir = defaultEncryptedScratchDir
+	}
+	config.RootfsImageFsType = tomlConf.Runtime.RootfsImageFsType
+	config.RootfsImageCacheDir = tomlConf.Runtime.RootfsImageCacheDir
+	if config.RootfsImageCacheDir == "" {
+		config.RootfsImageCacheDir = defaultRootfsImageCacheDir
+	}
+	config.RootfsImageCacheSize = tomlConf.Runtime.RootfsImageCacheSize
+	if config.RootfsImageCacheSize == 0 {
+		config.RootfsImageCacheSize = defaultRootfsImageCacheSize
+	}
+	config.DirectBlockVolumes = tomlConf.Runtime.DirectBlockVolumes
+	config.GuestLogMaxSize = tomlConf.Runtime.GuestLogMaxSize
+	config.GuestLogDir = tomlConf.Runtime.GuestLogDir
+	if config.GuestLogDir == "" {
+		config.GuestLogDir = defaultGuestLogDir
+	}
+	config.HealthPolicy = vc.HealthPolicy{
+		FailureThreshold:        tomlConf.Runtime.HealthFailureThreshold,
+		AgentReconnectAttempts:  tomlConf.Runtime.HealthAgentReconnectAttempts,
+		MemoryPressureThreshold: tomlConf.Runtime.HealthMemoryPressureThreshold,
+	}
+	for _, a := range tomlConf.Runtime.HealthActions {
+		config.HealthPolicy.Actions = append(config.HealthPolicy.Actions, vc.HealthAction(a))
+	}
+	if err := config.HealthPolicy.Valid(); err != nil {
+		return "", config, err
+	}
+	config.Diagnostics = vc.DiagnosticsConfig{
+		Dir:         tomlConf.Runtime.DiagnosticsDir,
+		MaxBundles:  tomlConf.Runtime.DiagnosticsMaxBundles,
+		GuestMemory: tomlConf.Runtime.DiagnosticsGuestMemory,
+	}
+	if config.Diagnostics.Dir == "" {
+		config.Diagnostics.Dir = defaultDiagnosticsDir
+	}
+	config.Overhead = vc.OverheadConfig{
+		Dir:        tomlConf.Runtime.OverheadDir,
+		Interval:   time.Duration(tomlConf.Runtime.OverheadInterval) * time.Second,
+		MaxRecords: tomlConf.Runtime.OverheadMaxRecords,
+		MaxAge:     time.Duration(tomlConf.Runtime.OverheadMaxAge) * time.Hour,
+	}
+	if config.Overhead.Dir == "" {
+		config.Overhead.Dir = defaultOverheadDir
+	}
+	if config.Overhead.MaxRecords == 0 {
+		config.Overhead.MaxRecords = defaultOverheadMaxRecords
+	}
+	if config.Overhead.MaxAge == 0 {
+		config.Overhead.MaxAge = time.Duration(defaultOverheadMaxAge) * time.Hour
+	}
 	if config.EnableAgentPidNs {
 		kataUtilsLogger.Warn("Feature to allow containers to share PID namespace with the agent has been enabled. Please understand this has security implications and should only be used for debug purposes")
 	}
@@ -1285,6 +1465,14 @@ func checkConfig(config oci.RuntimeConfig) error {
 		return err
 	}
 
+	if err := checkEncryptedScratchConfig(config); err != nil {
+		return err
+	}
+
+	if err := checkRootfsImageConfig(config); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -1323,6 +1511,78 @@ func checkFactoryConfig(config oci.RuntimeConfig) error {
 		if config.AgentType != vc.KataContainersAgent {
 			return errors.New("VM cache just support kata agent")
 		}
+
+		if _, err := grpccache.ParseEndpoint(config.FactoryConfig.VMCacheEndpoint); err != nil {
+			return err
+		}
+	}
+
+	if config.FactoryConfig.VMCacheMin > config.FactoryConfig.VMCacheNumber {
+		return errors.New("Factory option vm_cache_min is above vm_cache_number")
+	}
+
+	if len(config.FactoryConfig.VMCachePools) > 0 && config.FactoryConfig.VMCacheNumber == 0 {
+		return errors.New("Factory option vm_cache_pool requires vm_cache_number")
+	}
+
+	names := make(map[string]bool)
+	for _, p := range config.FactoryConfig.VMCachePools {
+		if p.Name == "" || p.Name == vf.DefaultPool || names[p.Name] {
+			return fmt.Errorf("Invalid or duplicate VM cache pool name %q", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.VMCacheNumber == 0 {
+			return fmt.Errorf("VM cache pool %s requires vm_cache_number", p.Name)
+		}
+
+		if p.VMCacheMin > p.VMCacheNumber {
+			return fmt.Errorf("VM cache pool %s vm_cache_min is above vm_cache_number", p.Name)
+		}
+
+		if p.ImagePath != "" && p.InitrdPath != "" {
+			return fmt.Errorf("VM cache pool %s cannot have both an image and an initrd", p.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkEncryptedScratchConfig ensures the encrypted scratch disk can be
+// handed to the guest as a block device.
+func checkEncryptedScratchConfig(config oci.RuntimeConfig) error {
+	if config.EncryptedScratchSize == 0 {
+		return nil
+	}
+
+	if config.HypervisorConfig.DisableBlockDeviceUse {
+		return errors.New("encrypted_scratch_size requires block device use, disable_block_device_use must be false")
+	}
+
+	if config.AgentType != vc.KataContainersAgent {
+		return errors.New("encrypted_scratch_size is only supported with the kata agent")
+	}
+
+	return nil
+}
+
+// checkRootfsImageConfig ensures container root filesystems can be handed
+// to the guest as block device images.
+func checkRootfsImageConfig(config oci.RuntimeConfig) error {
+	if config.RootfsImageFsType == "" {
+		return nil
+	}
+
+	if err := vc.CheckRootfsImageFsType(config.RootfsImageFsType); err != nil {
+		return err
+	}
+
+	if config.HypervisorConfig.DisableBlockDeviceUse {
+		return errors.New("rootfs_image_fstype requires block device use, disable_block_device_use must be false")
+	}
+
+	if config.AgentType != vc.KataContainersAgent {
+		return errors.New("rootfs_image_fstype is only supported with the kata agent")
 	}
 
 	return nil
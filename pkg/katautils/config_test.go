@@ -18,9 +18,11 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	ktu "github.com/kata-containers/runtime/pkg/katatestutils"
 	vc "github.com/kata-containers/runtime/virtcontainers"
+	vf "github.com/kata-containers/runtime/virtcontainers/factory"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
 	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/stretchr/testify/assert"
@@ -1321,6 +1323,17 @@ func TestAgentDefaults(t *testing.T) {
 
 	assert.Equal(a.traceMode(), a.TraceMode)
 	assert.Equal(a.traceType(), a.TraceType)
+
+	assert.False(a.debugConsoleEnabled())
+
+	a.DebugConsole = true
+	assert.True(a.debugConsoleEnabled())
+
+	assert.Equal(vc.AgentRequestTimeouts{}, a.requestTimeouts())
+
+	a.CheckTimeout = 5
+	a.WaitTimeout = 600
+	assert.Equal(vc.AgentRequestTimeouts{Check: 5 * time.Second, Wait: 10 * time.Minute}, a.requestTimeouts())
 }
 
 func TestGetDefaultConfigFilePaths(t *testing.T) {
@@ -1805,6 +1818,66 @@ func TestCheckFactoryConfig(t *testing.T) {
 	}
 }
 
+func TestCheckFactoryConfigPools(t *testing.T) {
+	assert := assert.New(t)
+
+	config := oci.RuntimeConfig{
+		HypervisorType: vc.QemuHypervisor,
+		AgentType:      vc.KataContainersAgent,
+		FactoryConfig: oci.FactoryConfig{
+			VMCacheEndpoint: defaultVMCacheEndpoint,
+			VMCachePools: []oci.FactoryPoolConfig{
+				{Name: "small", VMCacheNumber: 1, MemorySize: 512},
+			},
+		},
+	}
+
+	// Pools are part of VMCache.
+	assert.Error(checkFactoryConfig(config))
+
+	config.FactoryConfig.VMCacheNumber = 2
+	assert.NoError(checkFactoryConfig(config))
+
+	config.FactoryConfig.VMCacheMin = 3
+	assert.Error(checkFactoryConfig(config))
+	config.FactoryConfig.VMCacheMin = 1
+	assert.NoError(checkFactoryConfig(config))
+
+	for _, pool := range []oci.FactoryPoolConfig{
+		{Name: "small", VMCacheNumber: 1},
+		{Name: vf.DefaultPool, VMCacheNumber: 1},
+		{Name: "", VMCacheNumber: 1},
+		{Name: "empty"},
+		{Name: "assets", VMCacheNumber: 1, ImagePath: "image", InitrdPath: "initrd"},
+		{Name: "min", VMCacheNumber: 1, VMCacheMin: 2},
+	} {
+		invalid := config
+		invalid.FactoryConfig.VMCachePools = append([]oci.FactoryPoolConfig{}, config.FactoryConfig.VMCachePools...)
+		invalid.FactoryConfig.VMCachePools = append(invalid.FactoryConfig.VMCachePools, pool)
+		assert.Error(checkFactoryConfig(invalid), "pool %+v", pool)
+	}
+}
+
+func TestCheckFactoryConfigEndpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	config := oci.RuntimeConfig{
+		HypervisorType: vc.QemuHypervisor,
+		AgentType:      vc.KataContainersAgent,
+		FactoryConfig: oci.FactoryConfig{
+			VMCacheNumber: 1,
+		},
+	}
+
+	for _, endpoint := range []string{"", "cache.sock", "tcp://127.0.0.1:5050"} {
+		config.FactoryConfig.VMCacheEndpoint = endpoint
+		assert.Error(checkFactoryConfig(config), "endpoint %q", endpoint)
+	}
+
+	config.FactoryConfig.VMCacheEndpoint = "unix:///run/kata-containers/cache.sock"
+	assert.NoError(checkFactoryConfig(config))
+}
+
 func TestCheckNetNsConfigShimTrace(t *testing.T) {
 	assert := assert.New(t)
 
@@ -57,10 +57,11 @@ func HandleFactory(ctx context.Context, vci vc.VC, runtimeConfig *oci.RuntimeCon
 		return
 	}
 	factoryConfig := vf.Config{
-		Template:        runtimeConfig.FactoryConfig.Template,
-		TemplatePath:    runtimeConfig.FactoryConfig.TemplatePath,
-		VMCache:         runtimeConfig.FactoryConfig.VMCacheNumber > 0,
-		VMCacheEndpoint: runtimeConfig.FactoryConfig.VMCacheEndpoint,
+		Template:         runtimeConfig.FactoryConfig.Template,
+		TemplatePath:     runtimeConfig.FactoryConfig.TemplatePath,
+		VMCache:          runtimeConfig.FactoryConfig.VMCacheNumber > 0,
+		VMCacheEndpoint:  runtimeConfig.FactoryConfig.VMCacheEndpoint,
+		VMCacheTokenPath: runtimeConfig.FactoryConfig.VMCacheTokenPath,
 		VMConfig: vc.VMConfig{
 			HypervisorType:   runtimeConfig.HypervisorType,
 			HypervisorConfig: runtimeConfig.HypervisorConfig,
@@ -244,7 +245,7 @@ func CreateContainer(ctx context.Context, vci vc.VC, sandbox vc.VCSandbox, ociSp
 	span.SetTag("sandbox", sandboxID)
 
 	if builtIn {
-		c, err = sandbox.CreateContainer(contConfig)
+		c, err = sandbox.CreateContainer(ctx, contConfig)
 		if err != nil {
 			return vc.Process{}, err
 		}
@@ -12,6 +12,9 @@
 		GrpcVM
 		GrpcStatus
 		GrpcVMStatus
+		GrpcPoolStatus
+		GrpcVersion
+		GrpcVMRequest
 */
 package cache
 
@@ -127,8 +130,9 @@ func (m *GrpcVM) GetCpuDelta() uint32 {
 }
 
 type GrpcStatus struct {
-	Pid      int64           `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
-	Vmstatus []*GrpcVMStatus `protobuf:"bytes,2,rep,name=vmstatus" json:"vmstatus,omitempty"`
+	Pid      int64             `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
+	Vmstatus []*GrpcVMStatus   `protobuf:"bytes,2,rep,name=vmstatus" json:"vmstatus,omitempty"`
+	Pools    []*GrpcPoolStatus `protobuf:"bytes,3,rep,name=pools" json:"pools,omitempty"`
 }
 
 func (m *GrpcStatus) Reset()                    { *m = GrpcStatus{} }
@@ -150,10 +154,18 @@ func (m *GrpcStatus) GetVmstatus() []*GrpcVMStatus {
 	return nil
 }
 
+func (m *GrpcStatus) GetPools() []*GrpcPoolStatus {
+	if m != nil {
+		return m.Pools
+	}
+	return nil
+}
+
 type GrpcVMStatus struct {
 	Pid    int64  `protobuf:"varint,1,opt,name=pid,proto3" json:"pid,omitempty"`
 	Cpu    uint32 `protobuf:"varint,2,opt,name=cpu,proto3" json:"cpu,omitempty"`
 	Memory uint32 `protobuf:"varint,3,opt,name=memory,proto3" json:"memory,omitempty"`
+	Pool   string `protobuf:"bytes,4,opt,name=pool,proto3" json:"pool,omitempty"`
 }
 
 func (m *GrpcVMStatus) Reset()                    { *m = GrpcVMStatus{} }
@@ -182,11 +194,133 @@ func (m *GrpcVMStatus) GetMemory() uint32 {
 	return 0
 }
 
+func (m *GrpcVMStatus) GetPool() string {
+	if m != nil {
+		return m.Pool
+	}
+	return ""
+}
+
+type GrpcPoolStatus struct {
+	Name   string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Vms    uint32 `protobuf:"varint,2,opt,name=vms,proto3" json:"vms,omitempty"`
+	Target uint32 `protobuf:"varint,3,opt,name=target,proto3" json:"target,omitempty"`
+	Min    uint32 `protobuf:"varint,4,opt,name=min,proto3" json:"min,omitempty"`
+	Max    uint32 `protobuf:"varint,5,opt,name=max,proto3" json:"max,omitempty"`
+	Hits   uint64 `protobuf:"varint,6,opt,name=hits,proto3" json:"hits,omitempty"`
+	Misses uint64 `protobuf:"varint,7,opt,name=misses,proto3" json:"misses,omitempty"`
+}
+
+func (m *GrpcPoolStatus) Reset()                    { *m = GrpcPoolStatus{} }
+func (m *GrpcPoolStatus) String() string            { return proto.CompactTextString(m) }
+func (*GrpcPoolStatus) ProtoMessage()               {}
+func (*GrpcPoolStatus) Descriptor() ([]byte, []int) { return fileDescriptorCache, []int{4} }
+
+func (m *GrpcPoolStatus) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *GrpcPoolStatus) GetVms() uint32 {
+	if m != nil {
+		return m.Vms
+	}
+	return 0
+}
+
+func (m *GrpcPoolStatus) GetTarget() uint32 {
+	if m != nil {
+		return m.Target
+	}
+	return 0
+}
+
+func (m *GrpcPoolStatus) GetMin() uint32 {
+	if m != nil {
+		return m.Min
+	}
+	return 0
+}
+
+func (m *GrpcPoolStatus) GetMax() uint32 {
+	if m != nil {
+		return m.Max
+	}
+	return 0
+}
+
+func (m *GrpcPoolStatus) GetHits() uint64 {
+	if m != nil {
+		return m.Hits
+	}
+	return 0
+}
+
+func (m *GrpcPoolStatus) GetMisses() uint64 {
+	if m != nil {
+		return m.Misses
+	}
+	return 0
+}
+
+type GrpcVersion struct {
+	Version uint32 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+}
+
+func (m *GrpcVersion) Reset()                    { *m = GrpcVersion{} }
+func (m *GrpcVersion) String() string            { return proto.CompactTextString(m) }
+func (*GrpcVersion) ProtoMessage()               {}
+func (*GrpcVersion) Descriptor() ([]byte, []int) { return fileDescriptorCache, []int{5} }
+
+func (m *GrpcVersion) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+type GrpcVMRequest struct {
+	Version uint32 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Cpu     uint32 `protobuf:"varint,2,opt,name=cpu,proto3" json:"cpu,omitempty"`
+	Memory  uint32 `protobuf:"varint,3,opt,name=memory,proto3" json:"memory,omitempty"`
+}
+
+func (m *GrpcVMRequest) Reset()                    { *m = GrpcVMRequest{} }
+func (m *GrpcVMRequest) String() string            { return proto.CompactTextString(m) }
+func (*GrpcVMRequest) ProtoMessage()               {}
+func (*GrpcVMRequest) Descriptor() ([]byte, []int) { return fileDescriptorCache, []int{6} }
+
+func (m *GrpcVMRequest) GetVersion() uint32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *GrpcVMRequest) GetCpu() uint32 {
+	if m != nil {
+		return m.Cpu
+	}
+	return 0
+}
+
+func (m *GrpcVMRequest) GetMemory() uint32 {
+	if m != nil {
+		return m.Memory
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*GrpcVMConfig)(nil), "cache.GrpcVMConfig")
 	proto.RegisterType((*GrpcVM)(nil), "cache.GrpcVM")
 	proto.RegisterType((*GrpcStatus)(nil), "cache.GrpcStatus")
 	proto.RegisterType((*GrpcVMStatus)(nil), "cache.GrpcVMStatus")
+	proto.RegisterType((*GrpcPoolStatus)(nil), "cache.GrpcPoolStatus")
+	proto.RegisterType((*GrpcVersion)(nil), "cache.GrpcVersion")
+	proto.RegisterType((*GrpcVMRequest)(nil), "cache.GrpcVMRequest")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -204,6 +338,8 @@ type CacheServiceClient interface {
 	GetBaseVM(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*GrpcVM, error)
 	Status(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*GrpcStatus, error)
 	Quit(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*google_protobuf.Empty, error)
+	Version(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*GrpcVersion, error)
+	GetVM(ctx context.Context, in *GrpcVMRequest, opts ...grpc.CallOption) (*GrpcVM, error)
 }
 
 type cacheServiceClient struct {
@@ -250,6 +386,24 @@ func (c *cacheServiceClient) Quit(ctx context.Context, in *google_protobuf.Empty
 	return out, nil
 }
 
+func (c *cacheServiceClient) Version(ctx context.Context, in *google_protobuf.Empty, opts ...grpc.CallOption) (*GrpcVersion, error) {
+	out := new(GrpcVersion)
+	err := grpc.Invoke(ctx, "/cache.CacheService/Version", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) GetVM(ctx context.Context, in *GrpcVMRequest, opts ...grpc.CallOption) (*GrpcVM, error) {
+	out := new(GrpcVM)
+	err := grpc.Invoke(ctx, "/cache.CacheService/GetVM", in, out, c.cc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for CacheService service
 
 type CacheServiceServer interface {
@@ -257,6 +411,8 @@ type CacheServiceServer interface {
 	GetBaseVM(context.Context, *google_protobuf.Empty) (*GrpcVM, error)
 	Status(context.Context, *google_protobuf.Empty) (*GrpcStatus, error)
 	Quit(context.Context, *google_protobuf.Empty) (*google_protobuf.Empty, error)
+	Version(context.Context, *google_protobuf.Empty) (*GrpcVersion, error)
+	GetVM(context.Context, *GrpcVMRequest) (*GrpcVM, error)
 }
 
 func RegisterCacheServiceServer(s *grpc.Server, srv CacheServiceServer) {
@@ -335,6 +491,42 @@ func _CacheService_Quit_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CacheService_Version_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(google_protobuf.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).Version(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cache.CacheService/Version",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).Version(ctx, req.(*google_protobuf.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_GetVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GrpcVMRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).GetVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cache.CacheService/GetVM",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).GetVM(ctx, req.(*GrpcVMRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _CacheService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "cache.CacheService",
 	HandlerType: (*CacheServiceServer)(nil),
@@ -355,6 +547,14 @@ var _CacheService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Quit",
 			Handler:    _CacheService_Quit_Handler,
 		},
+		{
+			MethodName: "Version",
+			Handler:    _CacheService_Version_Handler,
+		},
+		{
+			MethodName: "GetVM",
+			Handler:    _CacheService_GetVM_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "cache.proto",
@@ -478,6 +678,18 @@ func (m *GrpcStatus) MarshalTo(dAtA []byte) (int, error) {
 			i += n
 		}
 	}
+	if len(m.Pools) > 0 {
+		for _, msg := range m.Pools {
+			dAtA[i] = 0x1a
+			i++
+			i = encodeVarintCache(dAtA, i, uint64(msg.Size()))
+			n, err := msg.MarshalTo(dAtA[i:])
+			if err != nil {
+				return 0, err
+			}
+			i += n
+		}
+	}
 	return i, nil
 }
 
@@ -511,6 +723,122 @@ func (m *GrpcVMStatus) MarshalTo(dAtA []byte) (int, error) {
 		i++
 		i = encodeVarintCache(dAtA, i, uint64(m.Memory))
 	}
+	if len(m.Pool) > 0 {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(len(m.Pool)))
+		i += copy(dAtA[i:], m.Pool)
+	}
+	return i, nil
+}
+
+func (m *GrpcPoolStatus) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *GrpcPoolStatus) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if len(m.Name) > 0 {
+		dAtA[i] = 0xa
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(len(m.Name)))
+		i += copy(dAtA[i:], m.Name)
+	}
+	if m.Vms != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Vms))
+	}
+	if m.Target != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Target))
+	}
+	if m.Min != 0 {
+		dAtA[i] = 0x20
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Min))
+	}
+	if m.Max != 0 {
+		dAtA[i] = 0x28
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Max))
+	}
+	if m.Hits != 0 {
+		dAtA[i] = 0x30
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Hits))
+	}
+	if m.Misses != 0 {
+		dAtA[i] = 0x38
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Misses))
+	}
+	return i, nil
+}
+
+func (m *GrpcVersion) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *GrpcVersion) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Version != 0 {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Version))
+	}
+	return i, nil
+}
+
+func (m *GrpcVMRequest) Marshal() (dAtA []byte, err error) {
+	size := m.Size()
+	dAtA = make([]byte, size)
+	n, err := m.MarshalTo(dAtA)
+	if err != nil {
+		return nil, err
+	}
+	return dAtA[:n], nil
+}
+
+func (m *GrpcVMRequest) MarshalTo(dAtA []byte) (int, error) {
+	var i int
+	_ = i
+	var l int
+	_ = l
+	if m.Version != 0 {
+		dAtA[i] = 0x8
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Version))
+	}
+	if m.Cpu != 0 {
+		dAtA[i] = 0x10
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Cpu))
+	}
+	if m.Memory != 0 {
+		dAtA[i] = 0x18
+		i++
+		i = encodeVarintCache(dAtA, i, uint64(m.Memory))
+	}
 	return i, nil
 }
 
@@ -579,6 +907,12 @@ func (m *GrpcStatus) Size() (n int) {
 			n += 1 + l + sovCache(uint64(l))
 		}
 	}
+	if len(m.Pools) > 0 {
+		for _, e := range m.Pools {
+			l = e.Size()
+			n += 1 + l + sovCache(uint64(l))
+		}
+	}
 	return n
 }
 
@@ -594,6 +928,62 @@ func (m *GrpcVMStatus) Size() (n int) {
 	if m.Memory != 0 {
 		n += 1 + sovCache(uint64(m.Memory))
 	}
+	l = len(m.Pool)
+	if l > 0 {
+		n += 1 + l + sovCache(uint64(l))
+	}
+	return n
+}
+
+func (m *GrpcPoolStatus) Size() (n int) {
+	var l int
+	_ = l
+	l = len(m.Name)
+	if l > 0 {
+		n += 1 + l + sovCache(uint64(l))
+	}
+	if m.Vms != 0 {
+		n += 1 + sovCache(uint64(m.Vms))
+	}
+	if m.Target != 0 {
+		n += 1 + sovCache(uint64(m.Target))
+	}
+	if m.Min != 0 {
+		n += 1 + sovCache(uint64(m.Min))
+	}
+	if m.Max != 0 {
+		n += 1 + sovCache(uint64(m.Max))
+	}
+	if m.Hits != 0 {
+		n += 1 + sovCache(uint64(m.Hits))
+	}
+	if m.Misses != 0 {
+		n += 1 + sovCache(uint64(m.Misses))
+	}
+	return n
+}
+
+func (m *GrpcVersion) Size() (n int) {
+	var l int
+	_ = l
+	if m.Version != 0 {
+		n += 1 + sovCache(uint64(m.Version))
+	}
+	return n
+}
+
+func (m *GrpcVMRequest) Size() (n int) {
+	var l int
+	_ = l
+	if m.Version != 0 {
+		n += 1 + sovCache(uint64(m.Version))
+	}
+	if m.Cpu != 0 {
+		n += 1 + sovCache(uint64(m.Cpu))
+	}
+	if m.Memory != 0 {
+		n += 1 + sovCache(uint64(m.Memory))
+	}
 	return n
 }
 
@@ -1016,7 +1406,38 @@ func (m *GrpcStatus) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
-		default:
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Pools", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return ErrInvalidLengthCache
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Pools = append(m.Pools, &GrpcPoolStatus{})
+			if err := m.Pools[len(m.Pools)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		default:
 			iNdEx = preIndex
 			skippy, err := skipCache(dAtA[iNdEx:])
 			if err != nil {
@@ -1123,6 +1544,404 @@ func (m *GrpcVMStatus) Unmarshal(dAtA []byte) error {
 					break
 				}
 			}
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Pool", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCache
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Pool = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCache(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCache
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *GrpcPoolStatus) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCache
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: GrpcPoolStatus: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: GrpcPoolStatus: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Name", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthCache
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Name = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Vms", wireType)
+			}
+			m.Vms = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Vms |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Target", wireType)
+			}
+			m.Target = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Target |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 4:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Min", wireType)
+			}
+			m.Min = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Min |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 5:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Max", wireType)
+			}
+			m.Max = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Max |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 6:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Hits", wireType)
+			}
+			m.Hits = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Hits |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Misses", wireType)
+			}
+			m.Misses = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Misses |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCache(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCache
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *GrpcVersion) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCache
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: GrpcVersion: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: GrpcVersion: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			m.Version = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Version |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipCache(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return ErrInvalidLengthCache
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+func (m *GrpcVMRequest) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return ErrIntOverflowCache
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= (uint64(b) & 0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: GrpcVMRequest: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: GrpcVMRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Version", wireType)
+			}
+			m.Version = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Version |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Cpu", wireType)
+			}
+			m.Cpu = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Cpu |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Memory", wireType)
+			}
+			m.Memory = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowCache
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Memory |= (uint32(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipCache(dAtA[iNdEx:])
@@ -1252,29 +2071,38 @@ var (
 func init() { proto.RegisterFile("cache.proto", fileDescriptorCache) }
 
 var fileDescriptorCache = []byte{
-	// 374 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x51, 0xcd, 0x0a, 0xda, 0x40,
-	0x10, 0x66, 0x13, 0x4d, 0x75, 0x8c, 0xa5, 0xdd, 0x82, 0x2c, 0x16, 0x42, 0xc8, 0x29, 0xa7, 0x08,
-	0x4a, 0x7b, 0xaf, 0x5a, 0x84, 0x52, 0x69, 0x1b, 0xa9, 0xf7, 0x18, 0xd7, 0x18, 0x30, 0xee, 0x92,
-	0x6c, 0xa4, 0x79, 0xb1, 0x3e, 0x43, 0x8f, 0x7d, 0x84, 0xe2, 0xa1, 0xcf, 0x51, 0x76, 0xb3, 0x86,
-	0x08, 0xcd, 0x6d, 0x66, 0xbe, 0x9f, 0xfd, 0x76, 0x06, 0x46, 0x71, 0x14, 0x9f, 0x69, 0xc0, 0x73,
-	0x26, 0x18, 0xee, 0xab, 0x66, 0xfa, 0x36, 0x61, 0x2c, 0xb9, 0xd0, 0x99, 0x1a, 0x1e, 0xca, 0xd3,
-	0x8c, 0x66, 0x5c, 0x54, 0x35, 0xc7, 0x5b, 0x83, 0xbd, 0xc9, 0x79, 0xbc, 0xdf, 0xae, 0xd8, 0xf5,
-	0x94, 0x26, 0x18, 0x43, 0x6f, 0x1d, 0x89, 0x88, 0x20, 0x17, 0xf9, 0x76, 0xa8, 0x6a, 0xec, 0xc2,
-	0xe8, 0x43, 0x42, 0xaf, 0xa2, 0xa6, 0x10, 0x43, 0x41, 0xed, 0x91, 0xf7, 0x13, 0x81, 0x55, 0xdb,
-	0xe0, 0x97, 0x60, 0xa4, 0x47, 0x25, 0x1f, 0x86, 0x46, 0x7a, 0xc4, 0x0e, 0xc0, 0xb9, 0xe2, 0x34,
-	0xbf, 0xa5, 0x05, 0xcb, 0xb5, 0xb6, 0x35, 0xc1, 0x53, 0x18, 0xf0, 0x9c, 0xfd, 0xa8, 0xbe, 0xa6,
-	0x47, 0x62, 0xba, 0xc8, 0x37, 0xc3, 0xa6, 0x6f, 0xb0, 0xef, 0xe1, 0x67, 0xd2, 0x53, 0x8e, 0x4d,
-	0x8f, 0x5f, 0x81, 0x19, 0xf3, 0x92, 0xf4, 0x5d, 0xe4, 0x8f, 0x43, 0x59, 0xe2, 0x09, 0x58, 0x19,
-	0xcd, 0x58, 0x5e, 0x11, 0x4b, 0x0d, 0x75, 0x27, 0x5d, 0x62, 0x5e, 0xae, 0xe9, 0x45, 0x44, 0xe4,
-	0x85, 0x42, 0x9a, 0xde, 0xfb, 0x02, 0x20, 0x73, 0xef, 0x44, 0x24, 0xca, 0x42, 0x7a, 0x72, 0x1d,
-	0xde, 0x0c, 0x65, 0x89, 0x67, 0x30, 0xb8, 0x65, 0x85, 0x42, 0x89, 0xe1, 0x9a, 0xfe, 0x68, 0xfe,
-	0x26, 0xa8, 0x57, 0x5c, 0x7f, 0xb7, 0x16, 0x86, 0x0d, 0xc9, 0xfb, 0xf4, 0xd8, 0x67, 0xa7, 0xa5,
-	0x0e, 0x6e, 0xfc, 0x2f, 0xb8, 0xd9, 0x0e, 0x3e, 0xff, 0x8b, 0xc0, 0x5e, 0xc9, 0xc7, 0x76, 0x72,
-	0x59, 0x31, 0xc5, 0xef, 0xc0, 0xd2, 0x67, 0x9a, 0x04, 0xf5, 0x51, 0x83, 0xc7, 0x51, 0x83, 0x8f,
-	0xf2, 0xa8, 0xd3, 0xe7, 0x74, 0x9a, 0x3c, 0x87, 0xe1, 0x86, 0x8a, 0x65, 0x54, 0xd0, 0xfd, 0xb6,
-	0x53, 0x39, 0x7e, 0x52, 0xe2, 0x05, 0x58, 0xfa, 0x07, 0x5d, 0x82, 0xd7, 0x2d, 0x81, 0xa6, 0xbe,
-	0x87, 0xde, 0xb7, 0x32, 0x15, 0x9d, 0x92, 0x8e, 0xf9, 0xd2, 0xfe, 0x75, 0x77, 0xd0, 0xef, 0xbb,
-	0x83, 0xfe, 0xdc, 0x1d, 0x74, 0xb0, 0x14, 0xba, 0xf8, 0x17, 0x00, 0x00, 0xff, 0xff, 0x40, 0x5e,
-	0x19, 0x6e, 0xcc, 0x02, 0x00, 0x00,
+	// 523 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x53, 0xdd, 0x8a, 0x1a, 0x4d,
+	0x10, 0xfd, 0xe6, 0xc7, 0x71, 0xb7, 0xd4, 0xe5, 0x4b, 0x27, 0x59, 0x06, 0x03, 0x41, 0xe6, 0x26,
+	0x42, 0x82, 0x82, 0xcb, 0xe6, 0x3e, 0xbb, 0x06, 0x6f, 0x22, 0x6c, 0x5a, 0xe2, 0x65, 0xa0, 0x77,
+	0xec, 0xd5, 0x06, 0xc7, 0x9e, 0x4c, 0xf7, 0x88, 0x42, 0x9e, 0x25, 0x8f, 0x91, 0x97, 0xc8, 0x4b,
+	0x85, 0xae, 0xee, 0x11, 0x27, 0x64, 0x20, 0x77, 0x55, 0xd5, 0xe7, 0xd4, 0xdf, 0xe9, 0x82, 0x4e,
+	0xca, 0xd2, 0x0d, 0x1f, 0xe5, 0x85, 0xd4, 0x92, 0xb4, 0xd0, 0xe9, 0xbf, 0x5a, 0x4b, 0xb9, 0xde,
+	0xf2, 0x31, 0x06, 0x1f, 0xcb, 0xa7, 0x31, 0xcf, 0x72, 0x7d, 0xb4, 0x98, 0x64, 0x0a, 0xdd, 0x59,
+	0x91, 0xa7, 0xcb, 0xf9, 0xbd, 0xdc, 0x3d, 0x89, 0x35, 0x21, 0x10, 0x4e, 0x99, 0x66, 0xb1, 0x37,
+	0xf0, 0x86, 0x5d, 0x8a, 0x36, 0x19, 0x40, 0xe7, 0xc3, 0x9a, 0xef, 0xb4, 0x85, 0xc4, 0x3e, 0x3e,
+	0x9d, 0x87, 0x92, 0x9f, 0x1e, 0x44, 0x36, 0x0d, 0xb9, 0x02, 0x5f, 0xac, 0x90, 0x7e, 0x49, 0x7d,
+	0xb1, 0x22, 0xaf, 0x01, 0x36, 0xc7, 0x9c, 0x17, 0x7b, 0xa1, 0x64, 0xe1, 0xb8, 0x67, 0x11, 0xd2,
+	0x87, 0x8b, 0xbc, 0x90, 0x87, 0xe3, 0x83, 0x58, 0xc5, 0xc1, 0xc0, 0x1b, 0x06, 0xf4, 0xe4, 0x9f,
+	0xde, 0xbe, 0xd0, 0x4f, 0x71, 0x88, 0x19, 0x4f, 0x3e, 0xf9, 0x1f, 0x82, 0x34, 0x2f, 0xe3, 0xd6,
+	0xc0, 0x1b, 0xf6, 0xa8, 0x31, 0xc9, 0x35, 0x44, 0x19, 0xcf, 0x64, 0x71, 0x8c, 0x23, 0x0c, 0x3a,
+	0xcf, 0x64, 0x49, 0xf3, 0x72, 0xca, 0xb7, 0x9a, 0xc5, 0x6d, 0x7c, 0x39, 0xf9, 0xc9, 0x77, 0x00,
+	0xd3, 0xf7, 0x42, 0x33, 0x5d, 0x2a, 0x93, 0x33, 0x77, 0xcd, 0x07, 0xd4, 0x98, 0x64, 0x0c, 0x17,
+	0xfb, 0x4c, 0xe1, 0x6b, 0xec, 0x0f, 0x82, 0x61, 0x67, 0xf2, 0x7c, 0x64, 0x57, 0x6c, 0xc7, 0xb5,
+	0x44, 0x7a, 0x02, 0x91, 0xb7, 0xd0, 0xca, 0xa5, 0xdc, 0xaa, 0x38, 0x40, 0xf4, 0xcb, 0x33, 0xf4,
+	0x83, 0x94, 0x5b, 0x87, 0xb7, 0x98, 0xe4, 0x6b, 0xb5, 0xfc, 0xc6, 0xfa, 0x6e, 0x4a, 0xff, 0x6f,
+	0x53, 0x06, 0xb5, 0x29, 0x09, 0x84, 0x26, 0xa9, 0xdb, 0x13, 0xda, 0xc9, 0x0f, 0x0f, 0xae, 0xea,
+	0x95, 0x0d, 0x6c, 0xc7, 0x32, 0xee, 0x04, 0x42, 0xdb, 0x14, 0xd9, 0x67, 0xaa, 0x2a, 0xb2, 0xcf,
+	0x94, 0x29, 0xa2, 0x59, 0xb1, 0xe6, 0xba, 0x2a, 0x62, 0x3d, 0x83, 0xcc, 0xc4, 0x0e, 0x6b, 0xf4,
+	0xa8, 0x31, 0x31, 0xc2, 0x0e, 0x95, 0x0c, 0x19, 0x3b, 0x98, 0x0a, 0x1b, 0xa1, 0x15, 0x8a, 0x10,
+	0x52, 0xb4, 0xb1, 0x69, 0xa1, 0x14, 0x57, 0x28, 0x40, 0x48, 0x9d, 0x97, 0xbc, 0x81, 0x0e, 0x2e,
+	0x80, 0x17, 0x4a, 0xc8, 0x1d, 0x89, 0xa1, 0xbd, 0xb7, 0x26, 0xf6, 0xd7, 0xa3, 0x95, 0x9b, 0x2c,
+	0xa0, 0x67, 0x37, 0x45, 0xf9, 0xb7, 0x92, 0x2b, 0xdd, 0x0c, 0xfd, 0xf7, 0x95, 0x4d, 0x7e, 0xf9,
+	0xd0, 0xbd, 0x37, 0xf2, 0x2c, 0xcc, 0x67, 0x4c, 0x39, 0xb9, 0x85, 0xc8, 0x9d, 0xc1, 0xf5, 0xc8,
+	0x1e, 0xcd, 0xa8, 0x3a, 0x9a, 0xd1, 0x47, 0x73, 0x34, 0xfd, 0xba, 0xfa, 0x0e, 0x3c, 0x81, 0xcb,
+	0x19, 0xd7, 0x77, 0x4c, 0xf1, 0xe5, 0xbc, 0x91, 0xd9, 0xab, 0x31, 0xc9, 0x0d, 0x44, 0x4e, 0x91,
+	0x26, 0xc2, 0xb3, 0x33, 0x82, 0x83, 0xbe, 0x87, 0xf0, 0x73, 0x29, 0x74, 0x23, 0xa5, 0x21, 0x4e,
+	0x6e, 0xa1, 0x5d, 0xad, 0xb8, 0x89, 0x4a, 0xce, 0xdb, 0x73, 0xd8, 0x77, 0xd0, 0x9a, 0x71, 0xbd,
+	0x9c, 0x93, 0x17, 0xb5, 0xde, 0x9d, 0x04, 0x7f, 0x4c, 0x74, 0xf7, 0xdf, 0x63, 0x84, 0x39, 0x6f,
+	0x7e, 0x0f, 0x00, 0x94, 0x46, 0x89, 0x72, 0x85, 0x04, 0x00, 0x00,
 }
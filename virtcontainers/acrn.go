@@ -722,6 +722,14 @@ func (a *Acrn) check() error {
 	return nil
 }
 
+func (a *Acrn) saveDiagnostics(dir string, guestMemory bool) error {
+	if guestMemory {
+		return errGuestMemoryDumpUnsupported
+	}
+
+	return nil
+}
+
 func (a *Acrn) generateSocket(id string, useVsock bool) (interface{}, error) {
 	return generateVMSocket(id, useVsock, a.store.RunVMStoragePath())
 }
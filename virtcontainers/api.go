@@ -7,9 +7,12 @@ package virtcontainers
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"os"
 	"runtime"
 	"syscall"
+	"time"
 
 	deviceApi "github.com/kata-containers/runtime/virtcontainers/device/api"
 	deviceConfig "github.com/kata-containers/runtime/virtcontainers/device/config"
@@ -84,7 +87,7 @@ func createSandboxFromConfig(ctx context.Context, sandboxConfig SandboxConfig, f
 	// cleanup sandbox resources in case of any failure
 	defer func() {
 		if err != nil {
-			s.Delete()
+			s.Delete(ctx)
 		}
 	}()
 
@@ -112,25 +115,29 @@ func createSandboxFromConfig(ctx context.Context, sandboxConfig SandboxConfig, f
 	}
 
 	// Start the VM
-	if err = s.startVM(); err != nil {
+	if err = s.startVM(ctx); err != nil {
 		return nil, err
 	}
 
 	// rollback to stop VM if error occurs
 	defer func() {
 		if err != nil {
-			s.stopVM()
+			s.stopVM(ctx)
+
+			if err := s.removeScratchStorage(); err != nil {
+				s.Logger().WithError(err).Warn("Could not remove scratch storage")
+			}
 		}
 	}()
 
 	s.postCreatedNetwork()
 
-	if err = s.getAndStoreGuestDetails(); err != nil {
+	if err = s.getAndStoreGuestDetails(ctx); err != nil {
 		return nil, err
 	}
 
 	// Create Containers
-	if err = s.createContainers(); err != nil {
+	if err = s.createContainers(ctx); err != nil {
 		return nil, err
 	}
 
@@ -166,7 +173,7 @@ func DeleteSandbox(ctx context.Context, sandboxID string) (VCSandbox, error) {
 	defer s.releaseStatelessSandbox()
 
 	// Delete it.
-	if err := s.Delete(); err != nil {
+	if err := s.Delete(ctx); err != nil {
 		return nil, err
 	}
 
@@ -236,7 +243,7 @@ func StartSandbox(ctx context.Context, sandboxID string) (VCSandbox, error) {
 	defer s.releaseStatelessSandbox()
 
 	// Start it
-	err = s.Start()
+	err = s.Start(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -272,7 +279,7 @@ func StopSandbox(ctx context.Context, sandboxID string, force bool) (VCSandbox,
 	defer s.releaseStatelessSandbox()
 
 	// Stop it.
-	err = s.Stop(force)
+	err = s.Stop(ctx, force)
 	if err != nil {
 		return nil, err
 	}
@@ -304,7 +311,7 @@ func RunSandbox(ctx context.Context, sandboxConfig SandboxConfig, factory Factor
 	defer unlock()
 
 	// Start the sandbox
-	err = s.Start()
+	err = s.Start(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -390,6 +397,7 @@ func StatusSandbox(ctx context.Context, sandboxID string) (SandboxStatus, error)
 		HypervisorConfig: s.config.HypervisorConfig,
 		Agent:            s.config.AgentType,
 		ContainersStatus: contStatusList,
+		VMMPids:          s.vmmPids(),
 		Annotations:      s.config.Annotations,
 	}
 
@@ -418,7 +426,7 @@ func CreateContainer(ctx context.Context, sandboxID string, containerConfig Cont
 	}
 	defer s.releaseStatelessSandbox()
 
-	c, err := s.CreateContainer(containerConfig)
+	c, err := s.CreateContainer(ctx, containerConfig)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -457,7 +465,7 @@ func DeleteContainer(ctx context.Context, sandboxID, containerID string) (VCCont
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.DeleteContainer(containerID)
+	return s.DeleteContainer(ctx, containerID)
 }
 
 // StartContainer is the virtcontainers container starting entry point.
@@ -486,7 +494,7 @@ func StartContainer(ctx context.Context, sandboxID, containerID string) (VCConta
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.StartContainer(containerID)
+	return s.StartContainer(ctx, containerID)
 }
 
 // StopContainer is the virtcontainers container stopping entry point.
@@ -515,7 +523,7 @@ func StopContainer(ctx context.Context, sandboxID, containerID string) (VCContai
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.StopContainer(containerID, false)
+	return s.StopContainer(ctx, containerID, false)
 }
 
 // EnterContainer is the virtcontainers container command execution entry point.
@@ -544,7 +552,7 @@ func EnterContainer(ctx context.Context, sandboxID, containerID string, cmd type
 	}
 	defer s.releaseStatelessSandbox()
 
-	c, process, err := s.EnterContainer(containerID, cmd)
+	c, process, err := s.EnterContainer(ctx, containerID, cmd)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -613,7 +621,7 @@ func statusContainer(sandbox *Sandbox, containerID string) (ContainerStatus, err
 					"state": container.state.State,
 					"pid":   container.process.Pid}).
 					Info("container isn't running")
-				if err := container.stop(true); err != nil {
+				if err := container.stop(sandbox.ctx, true); err != nil {
 					return ContainerStatus{}, err
 				}
 			}
@@ -661,7 +669,7 @@ func KillContainer(ctx context.Context, sandboxID, containerID string, signal sy
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.KillContainer(containerID, signal, all)
+	return s.KillContainer(ctx, containerID, signal, all)
 }
 
 // ProcessListContainer is the virtcontainers entry point to list
@@ -690,7 +698,7 @@ func ProcessListContainer(ctx context.Context, sandboxID, containerID string, op
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.ProcessListContainer(containerID, options)
+	return s.ProcessListContainer(ctx, containerID, options)
 }
 
 // UpdateContainer is the virtcontainers entry point to update
@@ -719,7 +727,7 @@ func UpdateContainer(ctx context.Context, sandboxID, containerID string, resourc
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.UpdateContainer(containerID, resources)
+	return s.UpdateContainer(ctx, containerID, resources)
 }
 
 // StatsContainer is the virtcontainers container stats entry point.
@@ -748,7 +756,7 @@ func StatsContainer(ctx context.Context, sandboxID, containerID string) (Contain
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.StatsContainer(containerID)
+	return s.StatsContainer(ctx, containerID)
 }
 
 // StatsSandbox is the virtcontainers sandbox stats entry point.
@@ -780,7 +788,7 @@ func StatsSandbox(ctx context.Context, sandboxID string) (SandboxStats, []Contai
 
 	containerStats := []ContainerStats{}
 	for _, c := range s.containers {
-		cstats, err := s.StatsContainer(c.id)
+		cstats, err := s.StatsContainer(ctx, c.id)
 		if err != nil {
 			return SandboxStats{}, []ContainerStats{}, err
 		}
@@ -812,10 +820,10 @@ func togglePauseContainer(ctx context.Context, sandboxID, containerID string, pa
 	defer s.releaseStatelessSandbox()
 
 	if pause {
-		return s.PauseContainer(containerID)
+		return s.PauseContainer(ctx, containerID)
 	}
 
-	return s.ResumeContainer(containerID)
+	return s.ResumeContainer(ctx, containerID)
 }
 
 // PauseContainer is the virtcontainers container pause entry point.
@@ -876,10 +884,10 @@ func toggleInterface(ctx context.Context, sandboxID string, inf *vcTypes.Interfa
 	defer s.releaseStatelessSandbox()
 
 	if add {
-		return s.AddInterface(inf)
+		return s.AddInterface(ctx, inf)
 	}
 
-	return s.RemoveInterface(inf)
+	return s.RemoveInterface(ctx, inf)
 }
 
 // AddInterface is the virtcontainers add interface entry point.
@@ -919,7 +927,7 @@ func ListInterfaces(ctx context.Context, sandboxID string) ([]*vcTypes.Interface
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.ListInterfaces()
+	return s.ListInterfaces(ctx)
 }
 
 // UpdateRoutes is the virtcontainers update routes entry point.
@@ -943,7 +951,7 @@ func UpdateRoutes(ctx context.Context, sandboxID string, routes []*vcTypes.Route
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.UpdateRoutes(routes)
+	return s.UpdateRoutes(ctx, routes)
 }
 
 // ListRoutes is the virtcontainers list routes entry point.
@@ -967,7 +975,87 @@ func ListRoutes(ctx context.Context, sandboxID string) ([]*vcTypes.Route, error)
 	}
 	defer s.releaseStatelessSandbox()
 
-	return s.ListRoutes()
+	return s.ListRoutes(ctx)
+}
+
+// DialDebugConsole connects to the debug console of the guest of a running
+// sandbox, which must have been created with the debug console enabled.
+// The agent is reached through the VSock or HybridVSock socket recorded in
+// the sandbox state.
+func DialDebugConsole(ctx context.Context, sandboxID string) (net.Conn, error) {
+	span, _ := trace(ctx, "DialDebugConsole")
+	defer span.Finish()
+
+	if sandboxID == "" {
+		return nil, vcTypes.ErrNeedSandboxID
+	}
+
+	unlock, err := rLockSandbox(sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	store, err := persist.GetDriver()
+	if err != nil {
+		return nil, err
+	}
+
+	ss, _, err := store.FromDisk(sandboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ss.Config.KataAgentConfig == nil || !ss.Config.KataAgentConfig.DebugConsoleEnabled {
+		return nil, fmt.Errorf("debug console not enabled for sandbox %s", sandboxID)
+	}
+
+	if ss.State != string(types.StateRunning) && ss.State != string(types.StatePaused) {
+		return nil, fmt.Errorf("sandbox %s is not running", sandboxID)
+	}
+
+	conn, err := dialAgentPort(ss.AgentState.URL, kataDebugConsolePort)
+	if err == errAgentPortUnreachable {
+		return nil, fmt.Errorf("debug console of sandbox %s needs vsock, unreachable through %s", sandboxID, ss.AgentState.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The dialer bounds the handshake only.
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// CollectDiagnostics writes a diagnostics bundle of a sandbox to the
+// directory given by config and returns its path. It works on a sandbox
+// whose VM is gone, the parts that could not be collected being listed in
+// the bundle.
+func CollectDiagnostics(ctx context.Context, sandboxID string, config DiagnosticsConfig) (string, error) {
+	span, ctx := trace(ctx, "CollectDiagnostics")
+	defer span.Finish()
+
+	if sandboxID == "" {
+		return "", vcTypes.ErrNeedSandboxID
+	}
+
+	unlock, err := rLockSandbox(sandboxID)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	s, err := fetchSandbox(ctx, sandboxID)
+	if err != nil {
+		return "", err
+	}
+	defer s.releaseStatelessSandbox()
+
+	return s.collectDiagnostics(config, "collected on demand")
 }
 
 // CleanupContaienr is used by shimv2 to stop and delete a container exclusively, once there is no container
@@ -998,12 +1086,12 @@ func CleanupContainer(ctx context.Context, sandboxID, containerID string, force
 
 	defer s.Release()
 
-	_, err = s.StopContainer(containerID, force)
+	_, err = s.StopContainer(ctx, containerID, force)
 	if err != nil && !force {
 		return err
 	}
 
-	_, err = s.DeleteContainer(containerID)
+	_, err = s.DeleteContainer(ctx, containerID)
 	if err != nil && !force {
 		return err
 	}
@@ -1012,11 +1100,11 @@ func CleanupContainer(ctx context.Context, sandboxID, containerID string, force
 		return nil
 	}
 
-	if err = s.Stop(force); err != nil && !force {
+	if err = s.Stop(ctx, force); err != nil && !force {
 		return err
 	}
 
-	if err = s.Delete(); err != nil {
+	if err = s.Delete(ctx); err != nil {
 		return err
 	}
 
@@ -6,17 +6,23 @@
 package virtcontainers
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"syscall"
 	"testing"
 
+	kataclient "github.com/kata-containers/agent/protocols/client"
 	ktu "github.com/kata-containers/runtime/pkg/katatestutils"
 	"github.com/kata-containers/runtime/virtcontainers/persist"
+	persistapi "github.com/kata-containers/runtime/virtcontainers/persist/api"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
 	vccgroups "github.com/kata-containers/runtime/virtcontainers/pkg/cgroups"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/mock"
@@ -1721,12 +1727,12 @@ func TestCleanupContainer(t *testing.T) {
 	for _, contID := range contIDs {
 		contConfig := newTestContainerConfigNoop(contID)
 
-		c, err := p.CreateContainer(contConfig)
+		c, err := p.CreateContainer(context.Background(), contConfig)
 		if c == nil || err != nil {
 			t.Fatal(err)
 		}
 
-		c, err = p.StartContainer(c.ID())
+		c, err = p.StartContainer(context.Background(), c.ID())
 		if c == nil || err != nil {
 			t.Fatal(err)
 		}
@@ -1745,3 +1751,91 @@ func TestCleanupContainer(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestDialDebugConsole(t *testing.T) {
+	defer cleanUp()
+
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := DialDebugConsole(ctx, "")
+	assert.Equal(vcTypes.ErrNeedSandboxID, err)
+
+	// The guest shell echoes its input, behind the unix socket of a
+	// hybrid vsock.
+	dir, err := ioutil.TempDir("", "debug-console")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	udsPath := filepath.Join(dir, "kata.hvsock")
+	l, err := net.Listen("unix", udsPath)
+	assert.NoError(err)
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				connect, err := reader.ReadString('\n')
+				if err != nil || connect != fmt.Sprintf("CONNECT %d\n", kataDebugConsolePort) {
+					return
+				}
+				fmt.Fprintf(conn, "OK %d\n", kataDebugConsolePort)
+				io.Copy(conn, reader)
+			}()
+		}
+	}()
+
+	driver, err := persist.GetDriver()
+	assert.NoError(err)
+
+	ss := persistapi.SandboxState{
+		SandboxContainer: testSandboxID,
+		State:            string(types.StateRunning),
+		AgentState: persistapi.AgentState{
+			URL: fmt.Sprintf("%s://%s:%d", kataclient.HybridVSockScheme, udsPath, vSockPort),
+		},
+		Config: persistapi.SandboxConfig{
+			KataAgentConfig: &persistapi.KataAgentConfig{},
+		},
+	}
+	assert.NoError(driver.ToDisk(ss, nil))
+	defer driver.Destroy(testSandboxID)
+
+	// The debug console must be enabled.
+	_, err = DialDebugConsole(ctx, testSandboxID)
+	assert.Error(err)
+
+	ss.Config.KataAgentConfig.DebugConsoleEnabled = true
+	assert.NoError(driver.ToDisk(ss, nil))
+
+	conn, err := DialDebugConsole(ctx, testSandboxID)
+	assert.NoError(err)
+
+	_, err = conn.Write([]byte("uname\n"))
+	assert.NoError(err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("uname\n", line)
+	conn.Close()
+
+	// Agents behind a proxy cannot be reached.
+	ss.AgentState.URL = "unix:///run/kata/proxy.sock"
+	assert.NoError(driver.ToDisk(ss, nil))
+
+	_, err = DialDebugConsole(ctx, testSandboxID)
+	assert.Error(err)
+
+	// Nor stopped sandboxes.
+	ss.AgentState.URL = fmt.Sprintf("%s://%s:%d", kataclient.HybridVSockScheme, udsPath, vSockPort)
+	ss.State = string(types.StateStopped)
+	assert.NoError(driver.ToDisk(ss, nil))
+
+	_, err = DialDebugConsole(ctx, testSandboxID)
+	assert.Error(err)
+}
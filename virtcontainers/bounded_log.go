@@ -0,0 +1,152 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// boundedLogRotated is the suffix of the rotated file of a bounded log.
+const boundedLogRotated = ".1"
+
+// boundedLog is a log file rotated once it exceeds maxSize bytes, the
+// previously rotated file being dropped.
+type boundedLog struct {
+	sync.Mutex
+
+	path    string
+	maxSize int64
+	size    int64
+	file    *os.File
+}
+
+// openBoundedLog opens the bounded log at path for appending.
+func openBoundedLog(path string, maxSize int64) (*boundedLog, error) {
+	l := &boundedLog{
+		path:    path,
+		maxSize: maxSize,
+	}
+
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *boundedLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = fi.Size()
+
+	return nil
+}
+
+// rotate moves the current log aside, replacing the previously rotated
+// one, and starts a new one.
+func (l *boundedLog) rotate() error {
+	l.file.Close()
+	l.file = nil
+
+	if err := os.Rename(l.path, l.path+boundedLogRotated); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+// Write appends p to the log, rotating it first if it would exceed its
+// maximum size.
+func (l *boundedLog) Write(p []byte) (int, error) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return 0, fmt.Errorf("log %s is closed", l.path)
+	}
+
+	if l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the log, its files being left behind.
+func (l *boundedLog) Close() error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+// readBoundedLog copies the bounded log at path to w, oldest content
+// first. It returns false if there is no such log.
+func readBoundedLog(path string, w io.Writer) (bool, error) {
+	found := false
+	for _, p := range []string{path + boundedLogRotated, path} {
+		f, err := os.Open(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return found, err
+		}
+
+		found = true
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return found, err
+		}
+	}
+
+	return found, nil
+}
+
+// loggedReader is a reader whose content is also written to a bounded
+// log, closed once the reader is exhausted.
+type loggedReader struct {
+	io.ReadCloser
+	log *boundedLog
+}
+
+func (r *loggedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.log.Write(p[:n])
+	}
+	if err != nil {
+		r.log.Close()
+	}
+
+	return n, err
+}
@@ -60,6 +60,7 @@ const (
 	clhStopSandboxTimeout = 3
 	clhSocket             = "clh.sock"
 	clhAPISocket          = "clh-api.sock"
+	clhLog                = "clh.log"
 	virtioFsSocket        = "virtiofsd.sock"
 	supportedMajorVersion = 0
 	supportedMinorVersion = 5
@@ -89,6 +90,8 @@ type clhClient interface {
 	VmAddDevicePut(ctx context.Context, vmAddDevice chclient.VmAddDevice) (*http.Response, error)
 	// Add a new disk device to the VM
 	VmAddDiskPut(ctx context.Context, diskConfig chclient.DiskConfig) (*http.Response, error)
+	// Add a new virtio-fs device to the VM
+	VmAddFsPut(ctx context.Context, fsConfig chclient.FsConfig) (*http.Response, error)
 }
 
 type CloudHypervisorVersion struct {
@@ -448,6 +451,33 @@ func (clh *cloudHypervisor) hotPlugVFIODevice(device config.VFIODev) error {
 	return err
 }
 
+func (clh *cloudHypervisor) hotplugFsDevice(fs *config.VhostUserDeviceAttrs) error {
+	cl := clh.client()
+	ctx, cancel := context.WithTimeout(context.Background(), clhHotPlugAPITimeout*time.Second)
+	defer cancel()
+
+	_, _, err := cl.VmmPingGet(ctx)
+	if err != nil {
+		return openAPIClientError(err)
+	}
+
+	fsConfig := chclient.FsConfig{
+		Tag:    fs.Tag,
+		Socket: fs.SocketPath,
+		Id:     fs.DevID,
+	}
+	if virtiofsDaxEnabled(fs.Cache, fs.CacheSize) {
+		fsConfig.Dax = true
+		fsConfig.CacheSize = int64(fs.CacheSize) << 20
+	}
+
+	_, err = cl.VmAddFsPut(ctx, fsConfig)
+	if err != nil {
+		err = fmt.Errorf("failed to hotplug virtio-fs device %+v %s", fs, openAPIClientError(err))
+	}
+	return err
+}
+
 func (clh *cloudHypervisor) hotplugAddDevice(devInfo interface{}, devType deviceType) (interface{}, error) {
 	span, _ := clh.trace("hotplugAddDevice")
 	defer span.Finish()
@@ -459,6 +489,9 @@ func (clh *cloudHypervisor) hotplugAddDevice(devInfo interface{}, devType device
 	case vfioDev:
 		device := devInfo.(*config.VFIODev)
 		return nil, clh.hotPlugVFIODevice(*device)
+	case fsDev:
+		fs := devInfo.(*config.VhostUserDeviceAttrs)
+		return nil, clh.hotplugFsDevice(fs)
 	default:
 		return nil, fmt.Errorf("cannot hotplug device: unsupported device type '%v'", devType)
 	}
@@ -634,8 +667,32 @@ func (clh *cloudHypervisor) check() error {
 	ctx, cancel := context.WithTimeout(context.Background(), clhAPITimeout*time.Second)
 	defer cancel()
 
-	_, _, err := cl.VmmPingGet(ctx)
-	return err
+	if _, _, err := cl.VmmPingGet(ctx); err != nil {
+		return err
+	}
+
+	if clh.virtiofsd != nil {
+		return clh.virtiofsd.Check()
+	}
+
+	return nil
+}
+
+func (clh *cloudHypervisor) saveDiagnostics(dir string, guestMemory bool) error {
+	if guestMemory {
+		return errGuestMemoryDumpUnsupported
+	}
+
+	cl := clh.client()
+	ctx, cancel := context.WithTimeout(context.Background(), clhAPITimeout*time.Second)
+	defer cancel()
+
+	info, _, err := cl.VmInfoGet(ctx)
+	if err != nil {
+		return openAPIClientError(err)
+	}
+
+	return writeDiagnostics(filepath.Join(dir, "clh-vm-info.json"), info)
 }
 
 func (clh *cloudHypervisor) getPids() []int {
@@ -643,6 +700,10 @@ func (clh *cloudHypervisor) getPids() []int {
 	var pids []int
 	pids = append(pids, clh.state.PID)
 
+	if clh.state.VirtiofsdPID != 0 {
+		pids = append(pids, clh.state.VirtiofsdPID)
+	}
+
 	return pids
 }
 
@@ -688,6 +749,8 @@ func (clh *cloudHypervisor) capabilities() types.Capabilities {
 	var caps types.Capabilities
 	caps.SetFsSharingSupport()
 	caps.SetBlockDeviceHotplugSupport()
+	caps.SetReadOnlyBlockDeviceHotplugSupport()
+	caps.SetFsSharingHotplugSupport()
 	return caps
 }
 
@@ -929,6 +992,16 @@ func (clh *cloudHypervisor) LaunchClh() (string, int, error) {
 
 	cmdHypervisor.Stderr = cmdHypervisor.Stdout
 
+	// Keep the hypervisor output for the diagnostics bundles.
+	if l, err := openBoundedLog(filepath.Join(clh.store.RunVMStoragePath(), clh.id, clhLog), diagnosticsLogSize); err != nil {
+		clh.Logger().WithError(err).Warn("failed to open hypervisor log")
+	} else if hypervisorOutput != nil {
+		hypervisorOutput = &loggedReader{ReadCloser: hypervisorOutput, log: l}
+	} else {
+		cmdHypervisor.Stdout = l
+		cmdHypervisor.Stderr = l
+	}
+
 	err = utils.StartCmd(cmdHypervisor)
 	if err != nil {
 		return "", -1, err
@@ -1171,23 +1244,17 @@ func (clh *cloudHypervisor) addVolume(volume types.Volume) error {
 		return err
 	}
 
-	if clh.config.VirtioFSCache == virtioFsCacheAlways {
-		clh.vmconfig.Fs = []chclient.FsConfig{
-			{
-				Tag:       volume.MountTag,
-				CacheSize: int64(clh.config.VirtioFSCacheSize << 20),
-				Socket:    vfsdSockPath,
-			},
-		}
-	} else {
-		clh.vmconfig.Fs = []chclient.FsConfig{
-			{
-				Tag:    volume.MountTag,
-				Socket: vfsdSockPath,
-			},
-		}
-
+	fs := chclient.FsConfig{
+		Tag:    volume.MountTag,
+		Socket: vfsdSockPath,
+	}
+	// The DAX window is sized after virtio_fs_cache_size whenever the
+	// guest is going to mount the share with dax.
+	if virtiofsDaxEnabled(clh.config.VirtioFSCache, clh.config.VirtioFSCacheSize) {
+		fs.Dax = true
+		fs.CacheSize = int64(clh.config.VirtioFSCacheSize) << 20
 	}
+	clh.vmconfig.Fs = []chclient.FsConfig{fs}
 
 	clh.Logger().Debug("Adding share volume to hypervisor: ", volume.MountTag)
 	return nil
@@ -17,6 +17,7 @@ import (
 	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	"github.com/kata-containers/runtime/virtcontainers/persist"
 	chclient "github.com/kata-containers/runtime/virtcontainers/pkg/cloud-hypervisor/client"
+	"github.com/kata-containers/runtime/virtcontainers/types"
 	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -63,7 +64,8 @@ func newClhConfig() (HypervisorConfig, error) {
 }
 
 type clhClientMock struct {
-	vmInfo chclient.VmInfo
+	vmInfo    chclient.VmInfo
+	fsConfigs []chclient.FsConfig
 }
 
 func (c *clhClientMock) VmmPingGet(ctx context.Context) (chclient.VmmPingResponse, *http.Response, error) {
@@ -104,6 +106,12 @@ func (c *clhClientMock) VmAddDiskPut(ctx context.Context, diskConfig chclient.Di
 	return nil, nil
 }
 
+//nolint:golint
+func (c *clhClientMock) VmAddFsPut(ctx context.Context, fsConfig chclient.FsConfig) (*http.Response, error) {
+	c.fsConfigs = append(c.fsConfigs, fsConfig)
+	return nil, nil
+}
+
 func TestCloudHypervisorAddVSock(t *testing.T) {
 	assert := assert.New(t)
 	clh := cloudHypervisor{}
@@ -384,3 +392,107 @@ func TestCloudHypervisorHotplugBlockDevice(t *testing.T) {
 	err = clh.hotplugBlockDevice(&config.BlockDrive{Pmem: false})
 	assert.Error(err, "Hotplug block device not using 'virtio-blk' expected error")
 }
+
+func TestCloudHypervisorHotplugFsDevice(t *testing.T) {
+	assert := assert.New(t)
+
+	clhConfig, err := newClhConfig()
+	assert.NoError(err)
+
+	mock := &clhClientMock{}
+	clh := &cloudHypervisor{
+		config:    clhConfig,
+		APIClient: mock,
+	}
+
+	fs := &config.VhostUserDeviceAttrs{
+		DevID:      "kataVolume-foo",
+		SocketPath: "/run/vc/vm/foo/kataVolume-foo.sock",
+		Type:       config.VhostUserFS,
+		Tag:        "kataVolume-foo",
+		Cache:      "auto",
+		CacheSize:  1024,
+	}
+	_, err = clh.hotplugAddDevice(fs, fsDev)
+	assert.NoError(err)
+	assert.Len(mock.fsConfigs, 1)
+	assert.Equal(fs.Tag, mock.fsConfigs[0].Tag)
+	assert.Equal(fs.SocketPath, mock.fsConfigs[0].Socket)
+	assert.True(mock.fsConfigs[0].Dax)
+	assert.Equal(int64(1024)<<20, mock.fsConfigs[0].CacheSize)
+
+	fs.Cache = "none"
+	_, err = clh.hotplugAddDevice(fs, fsDev)
+	assert.NoError(err)
+	assert.False(mock.fsConfigs[1].Dax)
+
+	caps := clh.capabilities()
+	assert.True(caps.IsFsSharingHotplugSupported())
+}
+
+func TestCloudHypervisorGetPidsAndCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	clh := &cloudHypervisor{
+		APIClient: &clhClientMock{},
+	}
+	clh.state.PID = 100
+	assert.Equal([]int{100}, clh.getPids())
+
+	clh.state.VirtiofsdPID = 200
+	assert.Equal([]int{100, 200}, clh.getPids())
+
+	clh.virtiofsd = &virtiofsd{}
+	assert.Error(clh.check())
+
+	clh.virtiofsd = &virtiofsdMock{}
+	assert.NoError(clh.check())
+}
+
+func TestCloudHypervisorAddVolumeDax(t *testing.T) {
+	assert := assert.New(t)
+
+	clhConfig, err := newClhConfig()
+	assert.NoError(err)
+
+	store, err := persist.GetDriver()
+	assert.NoError(err)
+
+	clh := &cloudHypervisor{
+		id:     "foo",
+		config: clhConfig,
+		store:  store,
+	}
+
+	volume := types.Volume{MountTag: "kataShared"}
+
+	tests := []struct {
+		cache     string
+		cacheSize uint32
+		dax       bool
+	}{
+		{"always", 1024, true},
+		{"auto", 512, true},
+		{"none", 1024, false},
+		{"always", 0, false},
+	}
+
+	for _, tt := range tests {
+		clh.config.VirtioFSCache = tt.cache
+		clh.config.VirtioFSCacheSize = tt.cacheSize
+
+		assert.NoError(clh.addVolume(volume))
+		assert.Len(clh.vmconfig.Fs, 1)
+		fs := clh.vmconfig.Fs[0]
+		assert.Equal(volume.MountTag, fs.Tag)
+		assert.Equal(tt.dax, fs.Dax, "cache %s size %d", tt.cache, tt.cacheSize)
+		if tt.dax {
+			assert.Equal(int64(tt.cacheSize)<<20, fs.CacheSize)
+		} else {
+			assert.Zero(fs.CacheSize)
+		}
+	}
+
+	clh.config.SharedFS = config.Virtio9P
+	assert.Error(clh.addVolume(volume))
+}
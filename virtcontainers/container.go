@@ -427,8 +427,10 @@ func (c *Container) setContainerState(state types.StateString) error {
 	}
 
 	c.Logger().Debugf("Setting container state from %v to %v", c.state.State, state)
-	// update in-memory state
+	// update in-memory state, which the monitor reads concurrently
+	c.sandbox.containersLock.Lock()
 	c.state.State = state
+	c.sandbox.containersLock.Unlock()
 
 	if useOldStore(c.sandbox.ctx) {
 		// experimental runtime use "persist.json" which doesn't need "state.json" anymore
@@ -446,7 +448,7 @@ func (c *Container) setContainerState(state types.StateString) error {
 	return nil
 }
 
-func (c *Container) shareFiles(m Mount, idx int, hostSharedDir, guestSharedDir string) (string, bool, error) {
+func (c *Container) shareFiles(ctx context.Context, m Mount, idx int, hostSharedDir, guestSharedDir string) (string, bool, error) {
 	randBytes, err := utils.GenerateRandomBytes(8)
 	if err != nil {
 		return "", false, err
@@ -475,7 +477,7 @@ func (c *Container) shareFiles(m Mount, idx int, hostSharedDir, guestSharedDir s
 			return "", true, nil
 		}
 
-		if err := c.sandbox.agent.copyFile(m.Source, guestDest); err != nil {
+		if err := c.sandbox.agent.copyFile(ctx, m.Source, guestDest); err != nil {
 			return "", false, err
 		}
 	} else {
@@ -496,7 +498,7 @@ func (c *Container) shareFiles(m Mount, idx int, hostSharedDir, guestSharedDir s
 // It also updates the container mount list with the HostPath info, and store
 // container mounts to the storage. This way, we will have the HostPath info
 // available when we will need to unmount those mounts.
-func (c *Container) mountSharedDirMounts(hostSharedDir, guestSharedDir string) (sharedDirMounts map[string]Mount, ignoredMounts map[string]Mount, err error) {
+func (c *Container) mountSharedDirMounts(ctx context.Context, hostSharedDir, guestSharedDir string) (sharedDirMounts map[string]Mount, ignoredMounts map[string]Mount, err error) {
 	sharedDirMounts = make(map[string]Mount)
 	ignoredMounts = make(map[string]Mount)
 	var devicesToDetach []string
@@ -544,9 +546,22 @@ func (c *Container) mountSharedDirMounts(hostSharedDir, guestSharedDir string) (
 			continue
 		}
 
+		// Share directories through their own virtiofsd when configured
+		// to, falling back to the sandbox shared directory otherwise.
+		if cache := c.sandbox.virtiofsVolumeCache(m); cache != "" {
+			if fi, statErr := os.Stat(m.Source); statErr == nil && fi.IsDir() {
+				tag, vErr := c.sandbox.addVirtiofsVolume(m.Source, cache)
+				if vErr == nil {
+					c.mounts[idx].VirtiofsTag = tag
+					continue
+				}
+				c.Logger().WithError(vErr).WithField("mount-source", m.Source).Warn("Could not share volume through a dedicated virtiofsd")
+			}
+		}
+
 		var ignore bool
 		var guestDest string
-		guestDest, ignore, err = c.shareFiles(m, idx, hostSharedDir, guestSharedDir)
+		guestDest, ignore, err = c.shareFiles(ctx, m, idx, hostSharedDir, guestSharedDir)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -642,6 +657,38 @@ func filterDevices(c *Container, devices []ContainerDevice) (ret []ContainerDevi
 	return
 }
 
+// directBlockVolumesEnabled checks whether read-only volumes mounted on the
+// host from a block device can be directly assigned to the guest.
+func (c *Container) directBlockVolumesEnabled() bool {
+	return c.sandbox.config.DirectBlockVolumes && c.checkReadOnlyBlockDeviceSupport()
+}
+
+// directBlockVolumeDeviceInfo binds the block device of bm to a read-only
+// loop device and returns the guest device backed by it. The host keeps its
+// own mount untouched, the loop device ensures the guest can never write to
+// a device the host, or other pods, may have mounted.
+func directBlockVolumeDeviceInfo(bm *hostBlockMount, containerPath string) (*config.DeviceInfo, error) {
+	loopPath, err := utils.AttachReadOnlyLoopDevice(bm.device)
+	if err != nil {
+		return nil, err
+	}
+
+	var stat unix.Stat_t
+	if err := unix.Stat(loopPath, &stat); err != nil {
+		utils.DetachLoopDevice(loopPath)
+		return nil, fmt.Errorf("stat %q failed: %v", loopPath, err)
+	}
+
+	return &config.DeviceInfo{
+		HostPath:      loopPath,
+		ContainerPath: containerPath,
+		DevType:       "b",
+		Major:         int64(unix.Major(stat.Rdev)),
+		Minor:         int64(unix.Minor(stat.Rdev)),
+		ReadOnly:      true,
+	}, nil
+}
+
 func (c *Container) createBlockDevices() error {
 	if !c.checkBlockDeviceSupport() {
 		c.Logger().Warn("Block device not supported")
@@ -663,6 +710,7 @@ func (c *Container) createBlockDevices() error {
 		}
 
 		var di *config.DeviceInfo
+		var bm *hostBlockMount
 		var err error
 
 		// Check if mount is a block device file. If it is, the block device will be attached to the host
@@ -675,6 +723,17 @@ func (c *Container) createBlockDevices() error {
 				Major:         int64(unix.Major(stat.Rdev)),
 				Minor:         int64(unix.Minor(stat.Rdev)),
 			}
+			// check whether source is a read-only file system mounted from a block device
+		} else if m.ReadOnly && stat.Mode&unix.S_IFMT == unix.S_IFDIR && c.directBlockVolumesEnabled() {
+			if bm, err = getBlockDeviceForMount(m.Source); err != nil {
+				c.Logger().WithError(err).WithField("mount-source", m.Source).
+					Warn("Could not check for a block device, sharing the volume")
+			} else if bm != nil {
+				if di, err = directBlockVolumeDeviceInfo(bm, m.Destination); err != nil {
+					c.Logger().WithError(err).WithField("mount-source", m.Source).
+						Warn("Could not attach a read-only loop device, sharing the volume")
+				}
+			}
 			// check whether source can be used as a pmem device
 		} else if di, err = config.PmemDeviceInfo(m.Source, m.Destination); err != nil {
 			c.Logger().WithError(err).
@@ -690,11 +749,26 @@ func (c *Container) createBlockDevices() error {
 				// devices for other mounts
 				c.Logger().WithError(err).WithField("mount-source", m.Source).
 					Error("device manager failed to create new device")
+				if bm != nil {
+					utils.DetachLoopDevice(di.HostPath)
+				}
 				continue
 
 			}
 
 			c.mounts[i].BlockDeviceID = b.DeviceID()
+
+			if bm != nil {
+				c.mounts[i].BlockDeviceFsType = bm.fsType
+				c.mounts[i].BlockDeviceOptions = bm.options
+
+				c.Logger().WithFields(logrus.Fields{
+					"mount-source": m.Source,
+					"device":       bm.device,
+					"loop-device":  di.HostPath,
+					"fstype":       bm.fsType,
+				}).Info("Volume will be directly assigned to the guest")
+			}
 		}
 	}
 
@@ -847,6 +921,9 @@ func (c *Container) rollbackFailingContainerCreation() {
 	if err := c.removeDrive(); err != nil {
 		c.Logger().WithError(err).Error("rollback failed removeDrive()")
 	}
+	if err := c.removeRootfsLayers(); err != nil {
+		c.Logger().WithError(err).Error("rollback failed removeRootfsLayers()")
+	}
 	if err := c.unmountHostMounts(); err != nil {
 		c.Logger().WithError(err).Error("rollback failed unmountHostMounts()")
 	}
@@ -868,9 +945,20 @@ func (c *Container) checkBlockDeviceSupport() bool {
 	return false
 }
 
+// checkReadOnlyBlockDeviceSupport checks whether block devices can be
+// hotplugged read-only, which NVDIMM devices can not be.
+func (c *Container) checkReadOnlyBlockDeviceSupport() bool {
+	if c.sandbox.config.HypervisorConfig.BlockDeviceDriver == config.Nvdimm {
+		return false
+	}
+
+	caps := c.sandbox.hypervisor.capabilities()
+	return caps.IsReadOnlyBlockDeviceHotplugSupported()
+}
+
 // createContainer creates and start a container inside a Sandbox. It has to be
 // called only when a new container, not known by the sandbox, has to be created.
-func (c *Container) create() (err error) {
+func (c *Container) create(ctx context.Context) (err error) {
 	// In case the container creation fails, the following takes care
 	// of rolling back all the actions previously performed.
 	defer func() {
@@ -880,7 +968,14 @@ func (c *Container) create() (err error) {
 		}
 	}()
 
-	if c.checkBlockDeviceSupport() {
+	var layered bool
+	if c.rootfsImageEnabled() {
+		if layered, err = c.hotplugRootfsLayers(); err != nil {
+			return
+		}
+	}
+
+	if !layered && c.checkBlockDeviceSupport() {
 		if err = c.hotplugDrive(); err != nil {
 			return
 		}
@@ -924,7 +1019,7 @@ func (c *Container) create() (err error) {
 	// inside the VM
 	c.getSystemMountInfo()
 
-	process, err := c.sandbox.agent.createContainer(c.sandbox, c)
+	process, err := c.sandbox.agent.createContainer(ctx, c.sandbox, c)
 	if err != nil {
 		return err
 	}
@@ -1005,7 +1100,7 @@ func (c *Container) getSystemMountInfo() {
 	// TODO Deduce /dev/shm size. See https://github.com/clearcontainers/runtime/issues/138
 }
 
-func (c *Container) start() error {
+func (c *Container) start(ctx context.Context) error {
 	if err := c.checkSandboxRunning("start"); err != nil {
 		return err
 	}
@@ -1019,10 +1114,10 @@ func (c *Container) start() error {
 		return err
 	}
 
-	if err := c.sandbox.agent.startContainer(c.sandbox, c); err != nil {
+	if err := c.sandbox.agent.startContainer(ctx, c.sandbox, c); err != nil {
 		c.Logger().WithError(err).Error("Failed to start container")
 
-		if err := c.stop(true); err != nil {
+		if err := c.stop(ctx, true); err != nil {
 			c.Logger().WithError(err).Warn("Failed to stop container")
 		}
 		return err
@@ -1031,7 +1126,7 @@ func (c *Container) start() error {
 	return c.setContainerState(types.StateRunning)
 }
 
-func (c *Container) stop(force bool) error {
+func (c *Container) stop(ctx context.Context, force bool) error {
 	span, _ := c.trace("stop")
 	defer span.Finish()
 
@@ -1075,7 +1170,7 @@ func (c *Container) stop(force bool) error {
 	// return an error, but instead try to kill it forcefully.
 	if err := waitForShim(c.process.Pid); err != nil {
 		// Force the container to be killed.
-		if err := c.kill(syscall.SIGKILL, true); err != nil && !force {
+		if err := c.kill(ctx, syscall.SIGKILL, true); err != nil && !force {
 			return err
 		}
 
@@ -1096,13 +1191,13 @@ func (c *Container) stop(force bool) error {
 	// this signal will ensure the container will get killed to match
 	// the state of the shim. This will allow the following call to
 	// stopContainer() to succeed in such particular case.
-	c.kill(syscall.SIGKILL, true)
+	c.kill(ctx, syscall.SIGKILL, true)
 
 	// Since the agent has supported the MultiWaitProcess, it's better to
 	// wait the process here to make sure the process has exited before to
 	// issue stopContainer, otherwise the RemoveContainerRequest in it will
 	// get failed if the process hasn't exited.
-	c.sandbox.agent.waitProcess(c, c.id)
+	c.sandbox.agent.waitProcess(ctx, c, c.id)
 
 	defer func() {
 		// Save device and drive data.
@@ -1112,7 +1207,7 @@ func (c *Container) stop(force bool) error {
 		}
 	}()
 
-	if err := c.sandbox.agent.stopContainer(c.sandbox, *c); err != nil && !force {
+	if err := c.sandbox.agent.stopContainer(ctx, c.sandbox, *c); err != nil && !force {
 		return err
 	}
 
@@ -1132,6 +1227,10 @@ func (c *Container) stop(force bool) error {
 		return err
 	}
 
+	if err := c.removeRootfsLayers(); err != nil && !force {
+		return err
+	}
+
 	shareDir := filepath.Join(kataHostSharedDir(), c.sandbox.id, c.id)
 	if err := syscall.Rmdir(shareDir); err != nil {
 		c.Logger().WithError(err).WithField("share-dir", shareDir).Warn("Could not remove container share dir")
@@ -1147,7 +1246,7 @@ func (c *Container) stop(force bool) error {
 	return nil
 }
 
-func (c *Container) enter(cmd types.Cmd) (*Process, error) {
+func (c *Container) enter(ctx context.Context, cmd types.Cmd) (*Process, error) {
 	if err := c.checkSandboxRunning("enter"); err != nil {
 		return nil, err
 	}
@@ -1158,7 +1257,7 @@ func (c *Container) enter(cmd types.Cmd) (*Process, error) {
 			"impossible to enter")
 	}
 
-	process, err := c.sandbox.agent.exec(c.sandbox, *c, cmd)
+	process, err := c.sandbox.agent.exec(ctx, c.sandbox, *c, cmd)
 	if err != nil {
 		return nil, err
 	}
@@ -1166,21 +1265,21 @@ func (c *Container) enter(cmd types.Cmd) (*Process, error) {
 	return process, nil
 }
 
-func (c *Container) wait(processID string) (int32, error) {
+func (c *Container) wait(ctx context.Context, processID string) (int32, error) {
 	if c.state.State != types.StateReady &&
 		c.state.State != types.StateRunning {
 		return 0, fmt.Errorf("Container not ready or running, " +
 			"impossible to wait")
 	}
 
-	return c.sandbox.agent.waitProcess(c, processID)
+	return c.sandbox.agent.waitProcess(ctx, c, processID)
 }
 
-func (c *Container) kill(signal syscall.Signal, all bool) error {
-	return c.signalProcess(c.process.Token, signal, all)
+func (c *Container) kill(ctx context.Context, signal syscall.Signal, all bool) error {
+	return c.signalProcess(ctx, c.process.Token, signal, all)
 }
 
-func (c *Container) signalProcess(processID string, signal syscall.Signal, all bool) error {
+func (c *Container) signalProcess(ctx context.Context, processID string, signal syscall.Signal, all bool) error {
 	if c.sandbox.state.State != types.StateReady && c.sandbox.state.State != types.StateRunning {
 		return fmt.Errorf("Sandbox not ready or running, impossible to signal the container")
 	}
@@ -1189,15 +1288,15 @@ func (c *Container) signalProcess(processID string, signal syscall.Signal, all b
 		return fmt.Errorf("Container not ready, running or paused, impossible to signal the container")
 	}
 
-	return c.sandbox.agent.signalProcess(c, processID, signal, all)
+	return c.sandbox.agent.signalProcess(ctx, c, processID, signal, all)
 }
 
-func (c *Container) winsizeProcess(processID string, height, width uint32) error {
+func (c *Container) winsizeProcess(ctx context.Context, processID string, height, width uint32) error {
 	if c.state.State != types.StateReady && c.state.State != types.StateRunning {
 		return fmt.Errorf("Container not ready or running, impossible to signal the container")
 	}
 
-	return c.sandbox.agent.winsizeProcess(c, processID, height, width)
+	return c.sandbox.agent.winsizeProcess(ctx, c, processID, height, width)
 }
 
 func (c *Container) ioStream(processID string) (io.WriteCloser, io.Reader, io.Reader, error) {
@@ -1210,7 +1309,7 @@ func (c *Container) ioStream(processID string) (io.WriteCloser, io.Reader, io.Re
 	return stream.stdin(), stream.stdout(), stream.stderr(), nil
 }
 
-func (c *Container) processList(options ProcessListOptions) (ProcessList, error) {
+func (c *Container) processList(ctx context.Context, options ProcessListOptions) (ProcessList, error) {
 	if err := c.checkSandboxRunning("ps"); err != nil {
 		return nil, err
 	}
@@ -1219,17 +1318,17 @@ func (c *Container) processList(options ProcessListOptions) (ProcessList, error)
 		return nil, fmt.Errorf("Container not running, impossible to list processes")
 	}
 
-	return c.sandbox.agent.processListContainer(c.sandbox, *c, options)
+	return c.sandbox.agent.processListContainer(ctx, c.sandbox, *c, options)
 }
 
-func (c *Container) stats() (*ContainerStats, error) {
+func (c *Container) stats(ctx context.Context) (*ContainerStats, error) {
 	if err := c.checkSandboxRunning("stats"); err != nil {
 		return nil, err
 	}
-	return c.sandbox.agent.statsContainer(c.sandbox, *c)
+	return c.sandbox.agent.statsContainer(ctx, c.sandbox, *c)
 }
 
-func (c *Container) update(resources specs.LinuxResources) error {
+func (c *Container) update(ctx context.Context, resources specs.LinuxResources) error {
 	if err := c.checkSandboxRunning("update"); err != nil {
 		return err
 	}
@@ -1265,7 +1364,7 @@ func (c *Container) update(resources specs.LinuxResources) error {
 		c.config.Resources.Memory.Limit = mem.Limit
 	}
 
-	if err := c.sandbox.updateResources(); err != nil {
+	if err := c.sandbox.updateResources(ctx); err != nil {
 		return err
 	}
 
@@ -1275,10 +1374,10 @@ func (c *Container) update(resources specs.LinuxResources) error {
 		}
 	}
 
-	return c.sandbox.agent.updateContainer(c.sandbox, *c, resources)
+	return c.sandbox.agent.updateContainer(ctx, c.sandbox, *c, resources)
 }
 
-func (c *Container) pause() error {
+func (c *Container) pause(ctx context.Context) error {
 	if err := c.checkSandboxRunning("pause"); err != nil {
 		return err
 	}
@@ -1287,14 +1386,14 @@ func (c *Container) pause() error {
 		return fmt.Errorf("Container not running, impossible to pause")
 	}
 
-	if err := c.sandbox.agent.pauseContainer(c.sandbox, *c); err != nil {
+	if err := c.sandbox.agent.pauseContainer(ctx, c.sandbox, *c); err != nil {
 		return err
 	}
 
 	return c.setContainerState(types.StatePaused)
 }
 
-func (c *Container) resume() error {
+func (c *Container) resume(ctx context.Context) error {
 	if err := c.checkSandboxRunning("resume"); err != nil {
 		return err
 	}
@@ -1303,7 +1402,7 @@ func (c *Container) resume() error {
 		return fmt.Errorf("Container not paused, impossible to resume")
 	}
 
-	if err := c.sandbox.agent.resumeContainer(c.sandbox, *c); err != nil {
+	if err := c.sandbox.agent.resumeContainer(ctx, c.sandbox, *c); err != nil {
 		return err
 	}
 
@@ -1453,6 +1552,15 @@ func (c *Container) attachDevices(devices []ContainerDevice) error {
 
 func (c *Container) detachDevices() error {
 	for _, dev := range c.devices {
+		// The loop devices of directly assigned volumes are released
+		// along with their last device reference.
+		var loopPath string
+		if c.isDirectBlockVolumeDevice(dev.ID) {
+			if d := c.sandbox.devManager.GetDeviceByID(dev.ID); d != nil {
+				loopPath = d.GetHostPath()
+			}
+		}
+
 		err := c.sandbox.devManager.DetachDevice(dev.ID, c.sandbox)
 		if err != nil && err != manager.ErrDeviceNotAttached {
 			return err
@@ -1469,10 +1577,28 @@ func (c *Container) detachDevices() error {
 				return err
 			}
 		}
+
+		if loopPath != "" && c.sandbox.devManager.GetDeviceByID(dev.ID) == nil {
+			if err := utils.DetachLoopDevice(loopPath); err != nil {
+				c.Logger().WithError(err).WithField("loop-device", loopPath).Warn("Could not detach loop device")
+			}
+		}
 	}
 	return nil
 }
 
+// isDirectBlockVolumeDevice checks whether devID is the device of a directly
+// assigned volume.
+func (c *Container) isDirectBlockVolumeDevice(devID string) bool {
+	for _, m := range c.mounts {
+		if m.BlockDeviceID == devID && m.BlockDeviceFsType != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
 // cgroupsCreate creates cgroups on the host for the associated container
 func (c *Container) cgroupsCreate() (err error) {
 	spec := c.GetPatchedOCISpec()
@@ -429,17 +429,17 @@ func TestContainerEnterErrorsOnContainerStates(t *testing.T) {
 	cmd := types.Cmd{}
 
 	// Container state undefined
-	_, err := c.enter(cmd)
+	_, err := c.enter(context.Background(), cmd)
 	assert.Error(err)
 
 	// Container paused
 	c.state.State = types.StatePaused
-	_, err = c.enter(cmd)
+	_, err = c.enter(context.Background(), cmd)
 	assert.Error(err)
 
 	// Container stopped
 	c.state.State = types.StateStopped
-	_, err = c.enter(cmd)
+	_, err = c.enter(context.Background(), cmd)
 	assert.Error(err)
 }
 
@@ -455,17 +455,17 @@ func TestContainerWaitErrorState(t *testing.T) {
 	processID := "foobar"
 
 	// Container state undefined
-	_, err := c.wait(processID)
+	_, err := c.wait(context.Background(), processID)
 	assert.Error(err)
 
 	// Container paused
 	c.state.State = types.StatePaused
-	_, err = c.wait(processID)
+	_, err = c.wait(context.Background(), processID)
 	assert.Error(err)
 
 	// Container stopped
 	c.state.State = types.StateStopped
-	_, err = c.wait(processID)
+	_, err = c.wait(context.Background(), processID)
 	assert.Error(err)
 }
 
@@ -479,12 +479,12 @@ func TestKillContainerErrorState(t *testing.T) {
 		},
 	}
 	// Container state undefined
-	err := c.kill(syscall.SIGKILL, true)
+	err := c.kill(context.Background(), syscall.SIGKILL, true)
 	assert.Error(err)
 
 	// Container stopped
 	c.state.State = types.StateStopped
-	err = c.kill(syscall.SIGKILL, true)
+	err = c.kill(context.Background(), syscall.SIGKILL, true)
 	assert.Error(err)
 }
 
@@ -500,17 +500,17 @@ func TestWinsizeProcessErrorState(t *testing.T) {
 	processID := "foobar"
 
 	// Container state undefined
-	err := c.winsizeProcess(processID, 100, 200)
+	err := c.winsizeProcess(context.Background(), processID, 100, 200)
 	assert.Error(err)
 
 	// Container paused
 	c.state.State = types.StatePaused
-	err = c.winsizeProcess(processID, 100, 200)
+	err = c.winsizeProcess(context.Background(), processID, 100, 200)
 	assert.Error(err)
 
 	// Container stopped
 	c.state.State = types.StateStopped
-	err = c.winsizeProcess(processID, 100, 200)
+	err = c.winsizeProcess(context.Background(), processID, 100, 200)
 	assert.Error(err)
 }
 
@@ -61,11 +61,12 @@ func (device *BlockDevice) Attach(devReceiver api.DeviceReceiver) (err error) {
 	}
 
 	drive := &config.BlockDrive{
-		File:   device.DeviceInfo.HostPath,
-		Format: "raw",
-		ID:     utils.MakeNameID("drive", device.DeviceInfo.ID, maxDevIDSize),
-		Index:  index,
-		Pmem:   device.DeviceInfo.Pmem,
+		File:     device.DeviceInfo.HostPath,
+		Format:   "raw",
+		ID:       utils.MakeNameID("drive", device.DeviceInfo.ID, maxDevIDSize),
+		Index:    index,
+		Pmem:     device.DeviceInfo.Pmem,
+		ReadOnly: device.DeviceInfo.ReadOnly,
 	}
 
 	if fs, ok := device.DeviceInfo.DriverOptions["fstype"]; ok {
@@ -175,6 +176,7 @@ func (device *BlockDevice) Save() persistapi.DeviceState {
 			VirtPath: drive.VirtPath,
 			DevNo:    drive.DevNo,
 			Pmem:     drive.Pmem,
+			ReadOnly: drive.ReadOnly,
 		}
 	}
 	return ds
@@ -201,6 +203,7 @@ func (device *BlockDevice) Load(ds persistapi.DeviceState) {
 		VirtPath: bd.VirtPath,
 		DevNo:    bd.DevNo,
 		Pmem:     bd.Pmem,
+		ReadOnly: bd.ReadOnly,
 	}
 }
 
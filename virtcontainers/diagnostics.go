@@ -0,0 +1,274 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	persistapi "github.com/kata-containers/runtime/virtcontainers/persist/api"
+)
+
+// DiagnosticsConfig configures the diagnostics bundles of a sandbox.
+type DiagnosticsConfig struct {
+	// Dir is the host directory the bundles are written to.
+	Dir string
+
+	// MaxBundles is the number of bundles kept in Dir, the oldest ones
+	// being removed. Bundles are only captured on failures if it is not
+	// 0.
+	MaxBundles uint32
+
+	// GuestMemory adds a dump of the guest memory to the bundles.
+	GuestMemory bool
+}
+
+// Files of a diagnostics bundle.
+const (
+	diagnosticsReason       = "reason.txt"
+	diagnosticsErrors       = "errors.txt"
+	diagnosticsState        = "sandbox-state.json"
+	diagnosticsNetwork      = "network.json"
+	diagnosticsCgroupStats  = "cgroup-stats.json"
+	diagnosticsHypervisor   = "hypervisor-check.txt"
+	diagnosticsGuestConsole = "guest-console.log"
+	diagnosticsGuestMemory  = "guest-memory.elf"
+	diagnosticsLogs         = "logs"
+)
+
+// diagnosticsLogSize is the size above which the hypervisor and virtiofsd
+// logs kept for the bundles are rotated.
+const diagnosticsLogSize = 1 << 20
+
+// diagnosticsGuestConsoleTail is the size of the tail of the guest log
+// added to a bundle.
+const diagnosticsGuestConsoleTail = 256 << 10
+
+// diagnosticsHypervisorTimeout bounds the hypervisor diagnostics of a
+// bundle, which are collected from the monitor goroutine.
+const diagnosticsHypervisorTimeout = 2 * time.Minute
+
+var errGuestMemoryDumpUnsupported = errors.New("guest memory dump is not supported by the hypervisor")
+
+// diagnosticsSandboxState is the persisted state of a sandbox in a bundle.
+type diagnosticsSandboxState struct {
+	Sandbox    persistapi.SandboxState
+	Containers map[string]persistapi.ContainerState
+}
+
+// writeDiagnostics writes the JSON encoding of v to path.
+func writeDiagnostics(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0640)
+}
+
+// collectDiagnostics writes a diagnostics bundle of the sandbox, recording
+// why it is collected, and returns its path. Collecting is best effort,
+// the parts of the bundle that could not be collected being listed in it.
+func (s *Sandbox) collectDiagnostics(config DiagnosticsConfig, reason string) (string, error) {
+	if config.Dir == "" {
+		return "", errors.New("no diagnostics directory")
+	}
+
+	dir := filepath.Join(config.Dir, fmt.Sprintf("%s-%s", s.id, time.Now().UTC().Format("20060102T150405.000000000")))
+	if err := os.MkdirAll(dir, DirMode); err != nil {
+		return "", err
+	}
+
+	var failures []string
+	collect := func(part string, f func() error) {
+		if err := f(); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", part, err))
+		}
+	}
+
+	collect(diagnosticsReason, func() error {
+		return ioutil.WriteFile(filepath.Join(dir, diagnosticsReason), []byte(reason+"\n"), 0640)
+	})
+	collect(diagnosticsState, func() error {
+		return s.saveDiagnosticsState(dir)
+	})
+	collect(diagnosticsCgroupStats, func() error {
+		stats, err := s.Stats()
+		if err != nil {
+			return err
+		}
+		return writeDiagnostics(filepath.Join(dir, diagnosticsCgroupStats), stats)
+	})
+	collect(diagnosticsHypervisor, func() error {
+		result := "ok"
+		if err := s.hypervisor.check(); err != nil {
+			result = err.Error()
+		}
+		return ioutil.WriteFile(filepath.Join(dir, diagnosticsHypervisor), []byte(result+"\n"), 0640)
+	})
+	collect("hypervisor", func() error {
+		return s.hypervisor.saveDiagnostics(dir, config.GuestMemory)
+	})
+	collect(diagnosticsGuestConsole, func() error {
+		return s.saveDiagnosticsGuestConsole(dir)
+	})
+	collect(diagnosticsLogs, func() error {
+		return s.saveDiagnosticsLogs(dir)
+	})
+
+	if len(failures) > 0 {
+		data := []byte(strings.Join(failures, "\n") + "\n")
+		if err := ioutil.WriteFile(filepath.Join(dir, diagnosticsErrors), data, 0640); err != nil {
+			return "", err
+		}
+	}
+
+	if err := pruneDiagnostics(config.Dir, config.MaxBundles); err != nil {
+		s.Logger().WithError(err).Warn("failed to remove old diagnostics bundles")
+	}
+
+	return dir, nil
+}
+
+// saveDiagnosticsState adds the persisted state of the sandbox and of its
+// containers to a bundle, and its network endpoints.
+func (s *Sandbox) saveDiagnosticsState(dir string) error {
+	ss, cs, err := s.newStore.FromDisk(s.id)
+	if err != nil {
+		return err
+	}
+
+	state := diagnosticsSandboxState{
+		Sandbox:    ss,
+		Containers: cs,
+	}
+
+	if err := writeDiagnostics(filepath.Join(dir, diagnosticsState), state); err != nil {
+		return err
+	}
+
+	return writeDiagnostics(filepath.Join(dir, diagnosticsNetwork), ss.Network)
+}
+
+// saveDiagnosticsGuestConsole adds the tail of the guest log to a bundle.
+func (s *Sandbox) saveDiagnosticsGuestConsole(dir string) error {
+	if s.config.GuestLogMaxSize == 0 {
+		return nil
+	}
+
+	var log bytes.Buffer
+	if err := ReadGuestLog(s.config.GuestLogDir, s.id, &log); err != nil {
+		return err
+	}
+
+	data := log.Bytes()
+	if len(data) > diagnosticsGuestConsoleTail {
+		data = data[len(data)-diagnosticsGuestConsoleTail:]
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, diagnosticsGuestConsole), data, 0640)
+}
+
+// saveDiagnosticsLogs adds the logs kept next to the VM, the hypervisor
+// and virtiofsd ones, to a bundle.
+func (s *Sandbox) saveDiagnosticsLogs(dir string) error {
+	logs, err := filepath.Glob(filepath.Join(s.newStore.RunVMStoragePath(), s.id, "*.log*"))
+	if err != nil || len(logs) == 0 {
+		return err
+	}
+
+	logsDir := filepath.Join(dir, diagnosticsLogs)
+	if err := os.MkdirAll(logsDir, DirMode); err != nil {
+		return err
+	}
+
+	for _, log := range logs {
+		if err := copyDiagnosticsFile(log, filepath.Join(logsDir, filepath.Base(log))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyDiagnosticsFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// pruneDiagnostics removes the oldest bundles of dir beyond the maxBundles
+// most recent ones, 0 keeping all of them.
+func pruneDiagnostics(dir string, maxBundles uint32) error {
+	if maxBundles == 0 {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var bundles []os.FileInfo
+	for _, e := range entries {
+		if e.IsDir() {
+			bundles = append(bundles, e)
+		}
+	}
+
+	if len(bundles) <= int(maxBundles) {
+		return nil
+	}
+
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].ModTime().Before(bundles[j].ModTime())
+	})
+
+	for _, b := range bundles[:len(bundles)-int(maxBundles)] {
+		if err := os.RemoveAll(filepath.Join(dir, b.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// captureDiagnostics captures a diagnostics bundle of a sandbox failing
+// check, if enabled.
+func (s *Sandbox) captureDiagnostics(check string, failure error) {
+	config := s.config.Diagnostics
+	if config.MaxBundles == 0 {
+		return
+	}
+
+	dir, err := s.collectDiagnostics(config, fmt.Sprintf("%s check failed: %v", check, failure))
+	if err != nil {
+		s.Logger().WithError(err).Warn("failed to capture diagnostics bundle")
+		return
+	}
+
+	s.Logger().WithField("bundle", dir).Info("captured diagnostics bundle")
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanUp()
+
+	dir, err := ioutil.TempDir("", "diagnostics")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s, err := testCreateSandbox(t, testSandboxID, MockHypervisor, newHypervisorConfig(nil, nil), NoopAgentType, NetworkConfig{}, nil, nil)
+	assert.NoError(err)
+
+	s.config.GuestLogDir = filepath.Join(dir, "guest-logs")
+	s.config.GuestLogMaxSize = 1
+	l, err := openGuestLog(s.config.GuestLogDir, s.id, 1<<20)
+	assert.NoError(err)
+	assert.NoError(l.write("[    0.000000] Linux version 5.4.32"))
+	assert.NoError(l.close())
+
+	vmPath := filepath.Join(s.newStore.RunVMStoragePath(), s.id)
+	assert.NoError(os.MkdirAll(vmPath, DirMode))
+	assert.NoError(ioutil.WriteFile(filepath.Join(vmPath, "qemu.log"), []byte("qemu: terminating on signal 15\n"), 0640))
+
+	_, err = s.collectDiagnostics(DiagnosticsConfig{}, "on demand")
+	assert.Error(err)
+
+	bundle, err := s.collectDiagnostics(DiagnosticsConfig{Dir: filepath.Join(dir, "bundles")}, "on demand")
+	assert.NoError(err)
+	assert.Equal(filepath.Join(dir, "bundles"), filepath.Dir(bundle))
+
+	data, err := ioutil.ReadFile(filepath.Join(bundle, diagnosticsReason))
+	assert.NoError(err)
+	assert.Equal("on demand\n", string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(bundle, diagnosticsHypervisor))
+	assert.NoError(err)
+	assert.Equal("ok\n", string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(bundle, diagnosticsState))
+	assert.NoError(err)
+	assert.Contains(string(data), `"State": "ready"`)
+
+	_, err = os.Stat(filepath.Join(bundle, diagnosticsNetwork))
+	assert.NoError(err)
+
+	data, err = ioutil.ReadFile(filepath.Join(bundle, diagnosticsGuestConsole))
+	assert.NoError(err)
+	assert.Contains(string(data), "source=kernel [    0.000000] Linux version 5.4.32")
+
+	data, err = ioutil.ReadFile(filepath.Join(bundle, diagnosticsLogs, "qemu.log"))
+	assert.NoError(err)
+	assert.Equal("qemu: terminating on signal 15\n", string(data))
+}
+
+func TestPruneDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "diagnostics")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for i, name := range []string{"oldest", "older", "newest"} {
+		bundle := filepath.Join(dir, name)
+		assert.NoError(os.Mkdir(bundle, DirMode))
+		mtime := now.Add(time.Duration(i) * time.Minute)
+		assert.NoError(os.Chtimes(bundle, mtime, mtime))
+	}
+
+	// 0 keeps all the bundles.
+	assert.NoError(pruneDiagnostics(dir, 0))
+	entries, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(entries, 3)
+
+	assert.NoError(pruneDiagnostics(dir, 2))
+	entries, err = ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(entries, 2)
+	for _, e := range entries {
+		assert.NotEqual("oldest", e.Name())
+	}
+}
+
+func TestMonitorCaptureDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanUp()
+
+	dir, err := ioutil.TempDir("", "diagnostics")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	m, ch, events := newTestHealthMonitor(t, HealthPolicy{
+		Actions: []HealthAction{HealthActionDump, HealthActionKill},
+	})
+	defer m.stop()
+
+	m.sandbox.hypervisor = &failingHypervisor{err: errors.New("qmp unreachable")}
+
+	// No bundle is captured unless enabled.
+	m.sandbox.config.Diagnostics = DiagnosticsConfig{Dir: dir}
+	m.watchHypervisor()
+	assertHealthEvents(t, events, HealthCheckHypervisor, HealthDecisionDump, HealthDecisionKill)
+	<-ch
+
+	entries, err := ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Empty(entries)
+
+	// A single bundle is captured per failure, dumping and killing.
+	m.sandbox.config.Diagnostics.MaxBundles = 5
+	m.watchHypervisor()
+	assertHealthEvents(t, events, HealthCheckHypervisor, HealthDecisionDump, HealthDecisionKill)
+	<-ch
+
+	entries, err = ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(entries, 1)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, entries[0].Name(), diagnosticsReason))
+	assert.NoError(err)
+	assert.Equal("hypervisor check failed: failed to ping hypervisor process: qmp unreachable\n", string(data))
+
+	// Killing captures a bundle when not dumping.
+	m.sandbox.config.HealthPolicy.Actions = []HealthAction{HealthActionKill}
+	m.policy = m.sandbox.config.HealthPolicy
+	m.watchHypervisor()
+	assertHealthEvents(t, events, HealthCheckHypervisor, HealthDecisionKill)
+	<-ch
+
+	entries, err = ioutil.ReadDir(dir)
+	assert.NoError(err)
+	assert.Len(entries, 2)
+}
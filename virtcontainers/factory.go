@@ -19,6 +19,9 @@ type Factory interface {
 	// GetVMStatus returns the status of the paused VM created by the base factory.
 	GetVMStatus() []*pb.GrpcVMStatus
 
+	// GetPoolStatus returns the status of the pools of VMs of the factory.
+	GetPoolStatus() []*pb.GrpcPoolStatus
+
 	// GetVM gets a new VM from the factory.
 	GetVM(ctx context.Context, config VMConfig) (*VM, error)
 
@@ -30,3 +30,11 @@ type FactoryBase interface {
 	// CloseFactory closes the base factory.
 	CloseFactory(ctx context.Context)
 }
+
+// PoolFactoryBase is a base factory keeping a pool of VMs.
+type PoolFactoryBase interface {
+	FactoryBase
+
+	// GetPoolStatus returns the status of the pool of VMs.
+	GetPoolStatus() *pb.GrpcPoolStatus
+}
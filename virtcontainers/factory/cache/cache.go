@@ -7,84 +7,378 @@
 package cache
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	pb "github.com/kata-containers/runtime/protocols/cache"
 	vc "github.com/kata-containers/runtime/virtcontainers"
 	"github.com/kata-containers/runtime/virtcontainers/factory/base"
+	"github.com/sirupsen/logrus"
 )
 
+var cacheLogger = logrus.FieldLogger(logrus.New())
+
+var (
+	// cacheRateWindow is the period the requests of VMs are counted
+	// over to size the cache.
+	cacheRateWindow = time.Minute
+
+	// cacheCheckInterval is the period the cache is resized at.
+	cacheCheckInterval = time.Second
+
+	// cacheBootBackoff is the time the cache waits for before booting
+	// VMs again once the base factory failed to boot one, doubled on
+	// each consecutive failure up to cacheMaxBootBackoff.
+	cacheBootBackoff    = time.Second
+	cacheMaxBootBackoff = 5 * time.Minute
+
+	// hostAvailableMemory returns the memory available on the host for
+	// new VMs, in MiB.
+	hostAvailableMemory = procAvailableMemory
+
+	// checkVM checks the health of a cached VM.
+	checkVM = func(ctx context.Context, vm *vc.VM) error {
+		return vm.Check(ctx)
+	}
+)
+
+// Config configures the number of VMs of a cache factory. A VM requested
+// while the cache is empty is booted by the base factory, the request
+// waiting for the whole boot.
+type Config struct {
+	// Min is the number of VMs kept in the cache.
+	Min uint
+
+	// Max is the number of VMs the cache grows to when VMs are
+	// requested often enough.
+	Max uint
+
+	// IdleTimeout is the time the VMs above the number of recently
+	// requested ones are kept in the cache, 0 removing them at once.
+	IdleTimeout time.Duration
+
+	// MinFreeMemory is the host memory, in MiB, the cache does not grow
+	// above Min into.
+	MinFreeMemory uint32
+
+	// CheckInterval is the period the health of the cached VMs is checked
+	// at, the unhealthy ones being replaced. 0 disables the checks.
+	CheckInterval time.Duration
+
+	// MaxAge is the time VMs are kept in the cache before being replaced
+	// by new ones. 0 keeps them as long as they are not requested.
+	MaxAge time.Duration
+}
+
+// cachedVM is a VM of the cache, with the time it was added.
+type cachedVM struct {
+	vm    *vc.VM
+	since time.Time
+}
+
 type cache struct {
-	base base.FactoryBase
+	base   base.FactoryBase
+	config Config
+
+	sync.Mutex
+	// vms are the VMs of the cache, the oldest first.
+	vms      []cachedVM
+	booting  uint
+	checking uint
+	requests []time.Time
+	hits     uint64
+	misses   uint64
+	closed   bool
 
-	cacheCh   chan *vc.VM
-	closed    chan<- int
+	// failures is the number of consecutive failures of the base
+	// factory, no VM being booted before retryAt.
+	failures uint
+	retryAt  time.Time
+
+	wakeCh    chan struct{}
+	stopCh    chan struct{}
 	wg        sync.WaitGroup
 	closeOnce sync.Once
+}
 
-	vmm     map[*vc.VM]interface{}
-	vmmLock sync.RWMutex
+// SetLogger sets the logger for the cache factories.
+func SetLogger(logger logrus.FieldLogger) {
+	cacheLogger = logger.WithField("subsystem", "factory-cache")
 }
 
-// New creates a new cached vm factory.
+// New creates a new cached vm factory keeping count VMs.
 func New(ctx context.Context, count uint, b base.FactoryBase) base.FactoryBase {
-	if count < 1 {
+	return NewAdaptive(ctx, Config{Min: count, Max: count}, b)
+}
+
+// NewAdaptive creates a new cached vm factory, keeping between config.Min
+// and config.Max VMs depending on how often VMs are requested.
+func NewAdaptive(ctx context.Context, config Config, b base.FactoryBase) base.FactoryBase {
+	if config.Max < config.Min {
+		config.Max = config.Min
+	}
+
+	if config.Max < 1 {
 		return b
 	}
 
-	cacheCh := make(chan *vc.VM)
-	closed := make(chan int, count)
-	c := cache{
-		base:    b,
-		cacheCh: cacheCh,
-		closed:  closed,
-		vmm:     make(map[*vc.VM]interface{}),
+	c := &cache{
+		base:   b,
+		config: config,
+		wakeCh: make(chan struct{}, 1),
+		stopCh: make(chan struct{}),
 	}
-	for i := 0; i < int(count); i++ {
+
+	c.wg.Add(1)
+	go c.run(ctx)
+
+	if config.CheckInterval > 0 {
 		c.wg.Add(1)
-		go func() {
-			for {
-				vm, err := b.GetBaseVM(ctx, c.Config())
-				if err != nil {
-					c.wg.Done()
-					c.CloseFactory(ctx)
-					return
-				}
-				c.addToVmm(vm)
+		go c.runChecks(ctx)
+	}
+
+	return c
+}
+
+// run resizes the cache until it is closed.
+func (c *cache) run(ctx context.Context) {
+	defer c.wg.Done()
+
+	tick := time.NewTicker(cacheCheckInterval)
+	defer tick.Stop()
+
+	for {
+		c.resize(ctx)
+
+		select {
+		case <-c.stopCh:
+			return
+		case <-c.wakeCh:
+		case <-tick.C:
+		}
+	}
+}
+
+// runChecks checks the health of the cached VMs until the cache is closed.
+func (c *cache) runChecks(ctx context.Context) {
+	defer c.wg.Done()
+
+	tick := time.NewTicker(c.config.CheckInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-tick.C:
+			c.check(ctx)
+		}
+	}
+}
+
+// wake makes the cache resize itself.
+func (c *cache) wake() {
+	select {
+	case c.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+// target returns the number of VMs the cache should keep: the number of
+// VMs requested during the last rate window, within the configured
+// bounds. It must be called with the cache lock held.
+func (c *cache) target(now time.Time) uint {
+	recent := 0
+	for recent < len(c.requests) && now.Sub(c.requests[recent]) > cacheRateWindow {
+		recent++
+	}
+	c.requests = c.requests[recent:]
+
+	target := uint(len(c.requests))
+	if target < c.config.Min {
+		target = c.config.Min
+	}
+	if target > c.config.Max {
+		target = c.config.Max
+	}
+
+	return target
+}
+
+// canGrow tells whether the host has the memory for one more VM above the
+// minimum number of VMs.
+func (c *cache) canGrow() bool {
+	if c.config.MinFreeMemory == 0 {
+		return true
+	}
+
+	available, err := hostAvailableMemory()
+	if err != nil {
+		cacheLogger.WithError(err).Warn("failed to get host available memory")
+		return false
+	}
+
+	return available >= uint64(c.config.MinFreeMemory)+uint64(c.base.Config().HypervisorConfig.MemorySize)
+}
+
+// resize boots the missing VMs of the cache and removes the VMs idle for
+// too long or older than the maximum age.
+func (c *cache) resize(ctx context.Context) {
+	now := time.Now()
+
+	c.Lock()
+	if c.closed {
+		c.Unlock()
+		return
+	}
+
+	target := c.target(now)
+
+	var expired []*vc.VM
+	for c.config.MaxAge > 0 && len(c.vms) > 0 && now.Sub(c.vms[0].since) >= c.config.MaxAge {
+		expired = append(expired, c.vms[0].vm)
+		c.vms = c.vms[1:]
+	}
+	for uint(len(c.vms)) > target && now.Sub(c.vms[0].since) >= c.config.IdleTimeout {
+		expired = append(expired, c.vms[0].vm)
+		c.vms = c.vms[1:]
+	}
+
+	// No VM is booted while the base factory is backed off.
+	var missing uint
+	for size := uint(len(c.vms)) + c.booting + c.checking; size < target && !now.Before(c.retryAt); size++ {
+		if size >= c.config.Min && !c.canGrow() {
+			break
+		}
+		missing++
+	}
+	c.booting += missing
+	c.wg.Add(int(missing))
+	c.Unlock()
+
+	for _, vm := range expired {
+		cacheLogger.WithField("vm", vm.GetVMStatus().Pid).Debug("remove expired cached VM")
+		vm.Stop()
+		vm.Disconnect()
+	}
+
+	for i := uint(0); i < missing; i++ {
+		go c.boot(ctx)
+	}
+}
+
+// boot adds a new VM to the cache.
+func (c *cache) boot(ctx context.Context) {
+	defer c.wg.Done()
+
+	vm, err := c.base.GetBaseVM(ctx, c.base.Config())
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.booting--
+
+	if err != nil {
+		c.failures++
+		backoff := c.backoff()
+		c.retryAt = time.Now().Add(backoff)
+		cacheLogger.WithError(err).WithField("retry-in", backoff).Error("failed to create cached VM")
+		return
+	}
+
+	c.failures = 0
+
+	if c.closed {
+		vm.Stop()
+		vm.Disconnect()
+		return
+	}
+
+	c.vms = append(c.vms, cachedVM{vm: vm, since: time.Now()})
+}
+
+// backoff returns the time no VM is booted for after the last failure of
+// the base factory. It must be called with the cache lock held.
+func (c *cache) backoff() time.Duration {
+	backoff := cacheBootBackoff
+	for i := uint(1); i < c.failures && backoff < cacheMaxBootBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > cacheMaxBootBackoff {
+		backoff = cacheMaxBootBackoff
+	}
+
+	return backoff
+}
+
+// check checks the health of the cached VMs one after the other, replacing
+// the unhealthy ones. A VM is out of the cache while it is checked.
+func (c *cache) check(ctx context.Context) {
+	c.Lock()
+	vms := append([]cachedVM{}, c.vms...)
+	c.Unlock()
+
+	for _, v := range vms {
+		if !c.take(v.vm) {
+			// The VM was requested or expired meanwhile.
+			continue
+		}
+
+		err := checkVM(ctx, v.vm)
+
+		c.Lock()
+		c.checking--
+		if err == nil && !c.closed {
+			c.put(v)
+			c.Unlock()
+			continue
+		}
+		c.Unlock()
 
-				select {
-				case cacheCh <- vm:
-					// Because vm will not be relased or changed
-					// by cacheServer.GetBaseVM or removeFromVmm.
-					// So removeFromVmm can be called after vm send to cacheCh.
-					c.removeFromVmm(vm)
-				case <-closed:
-					c.removeFromVmm(vm)
-					vm.Stop()
-					vm.Disconnect()
-					c.wg.Done()
-					return
-				}
-			}
-		}()
+		if err != nil {
+			cacheLogger.WithError(err).WithField("vm", v.vm.GetVMStatus().Pid).Warn("remove unhealthy cached VM")
+		}
+		v.vm.Stop()
+		v.vm.Disconnect()
+		c.wake()
 	}
-	return &c
 }
 
-func (c *cache) addToVmm(vm *vc.VM) {
-	c.vmmLock.Lock()
-	defer c.vmmLock.Unlock()
+// take removes vm from the cache for it to be checked, telling whether it
+// was still cached.
+func (c *cache) take(vm *vc.VM) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	for i, v := range c.vms {
+		if v.vm == vm {
+			c.vms = append(c.vms[:i], c.vms[i+1:]...)
+			c.checking++
+			return true
+		}
+	}
 
-	c.vmm[vm] = nil
+	return false
 }
 
-func (c *cache) removeFromVmm(vm *vc.VM) {
-	c.vmmLock.Lock()
-	defer c.vmmLock.Unlock()
+// put adds back a checked VM to the cache, keeping the oldest VMs first. It
+// must be called with the cache lock held.
+func (c *cache) put(v cachedVM) {
+	i := 0
+	for i < len(c.vms) && !c.vms[i].since.After(v.since) {
+		i++
+	}
 
-	delete(c.vmm, vm)
+	c.vms = append(c.vms, cachedVM{})
+	copy(c.vms[i+1:], c.vms[i:])
+	c.vms[i] = v
 }
 
 // Config returns cache vm factory's base factory config.
@@ -96,33 +390,107 @@ func (c *cache) Config() vc.VMConfig {
 func (c *cache) GetVMStatus() []*pb.GrpcVMStatus {
 	vs := []*pb.GrpcVMStatus{}
 
-	c.vmmLock.RLock()
-	defer c.vmmLock.RUnlock()
+	c.Lock()
+	defer c.Unlock()
 
-	for vm := range c.vmm {
-		vs = append(vs, vm.GetVMStatus())
+	for _, v := range c.vms {
+		vs = append(vs, v.vm.GetVMStatus())
 	}
 
 	return vs
 }
 
-// GetBaseVM returns a base VM from cache factory's base factory.
+// GetPoolStatus returns the sizing and the hits and misses of the cache.
+func (c *cache) GetPoolStatus() *pb.GrpcPoolStatus {
+	c.Lock()
+	defer c.Unlock()
+
+	return &pb.GrpcPoolStatus{
+		Vms:    uint32(len(c.vms)),
+		Target: uint32(c.target(time.Now())),
+		Min:    uint32(c.config.Min),
+		Max:    uint32(c.config.Max),
+		Hits:   c.hits,
+		Misses: c.misses,
+	}
+}
+
+// GetBaseVM returns a cached VM, or a VM from cache factory's base factory
+// if the cache is empty: a miss waits for a cold boot, even while the base
+// factory is backed off.
 func (c *cache) GetBaseVM(ctx context.Context, config vc.VMConfig) (*vc.VM, error) {
-	vm, ok := <-c.cacheCh
-	if ok {
+	c.Lock()
+
+	if c.closed {
+		c.Unlock()
+		return nil, fmt.Errorf("cache factory is closed")
+	}
+
+	c.requests = append(c.requests, time.Now())
+
+	if len(c.vms) > 0 {
+		vm := c.vms[0].vm
+		c.vms = c.vms[1:]
+		c.hits++
+		c.Unlock()
+
+		c.wake()
 		return vm, nil
 	}
-	return nil, fmt.Errorf("cache factory is closed")
+
+	c.misses++
+	c.Unlock()
+
+	c.wake()
+	return c.base.GetBaseVM(ctx, config)
 }
 
 // CloseFactory closes the cache factory.
 func (c *cache) CloseFactory(ctx context.Context) {
 	c.closeOnce.Do(func() {
-		for len(c.closed) < cap(c.closed) { // send sufficient closed signal
-			c.closed <- 0
-		}
+		c.Lock()
+		c.closed = true
+		vms := c.vms
+		c.vms = nil
+		c.Unlock()
+
+		close(c.stopCh)
 		c.wg.Wait()
-		close(c.cacheCh)
+
+		for _, v := range vms {
+			v.vm.Stop()
+			v.vm.Disconnect()
+		}
+
 		c.base.CloseFactory(ctx)
 	})
 }
+
+// procAvailableMemory returns the memory available on the host, in MiB.
+func procAvailableMemory() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb >> 10, nil
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, fmt.Errorf("no MemAvailable in /proc/meminfo")
+}
@@ -7,11 +7,15 @@ package cache
 
 import (
 	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/factory/base"
 	"github.com/kata-containers/runtime/virtcontainers/factory/direct"
 	"github.com/kata-containers/runtime/virtcontainers/persist/fs"
 )
@@ -51,3 +55,240 @@ func TestTemplateFactory(t *testing.T) {
 	// CloseFactory
 	f.CloseFactory(ctx)
 }
+
+func newTestVMConfig() vc.VMConfig {
+	testDir := fs.MockStorageRootPath()
+
+	return vc.VMConfig{
+		HypervisorType: vc.MockHypervisor,
+		AgentType:      vc.NoopAgentType,
+		ProxyType:      vc.NoopProxyType,
+		HypervisorConfig: vc.HypervisorConfig{
+			KernelPath: testDir,
+			ImagePath:  testDir,
+		},
+	}
+}
+
+// waitForVMs waits for the cache to hold vms VMs.
+func waitForVMs(t *testing.T, f base.FactoryBase, vms uint32) {
+	for i := 0; i < 200; i++ {
+		if f.(*cache).GetPoolStatus().Vms == vms {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("cache did not reach %d VMs", vms)
+}
+
+func TestCacheAdaptive(t *testing.T) {
+	assert := assert.New(t)
+	defer fs.MockStorageDestroy()
+
+	savedInterval, savedWindow := cacheCheckInterval, cacheRateWindow
+	cacheCheckInterval = 10 * time.Millisecond
+	cacheRateWindow = 200 * time.Millisecond
+	defer func() {
+		cacheCheckInterval, cacheRateWindow = savedInterval, savedWindow
+	}()
+
+	vmConfig := newTestVMConfig()
+	ctx := context.Background()
+
+	f := NewAdaptive(ctx, Config{Max: 2}, direct.New(ctx, vmConfig))
+	defer f.CloseFactory(ctx)
+
+	// An empty cache misses, and grows with the requests.
+	vm, err := f.GetBaseVM(ctx, vmConfig)
+	assert.NoError(err)
+	assert.NoError(vm.Stop())
+
+	waitForVMs(t, f, 1)
+
+	vm, err = f.GetBaseVM(ctx, vmConfig)
+	assert.NoError(err)
+	assert.NoError(vm.Stop())
+
+	status := f.(*cache).GetPoolStatus()
+	assert.Equal(uint64(1), status.Hits)
+	assert.Equal(uint64(1), status.Misses)
+	assert.Equal(uint32(2), status.Max)
+
+	// The cache shrinks once VMs are not requested anymore.
+	waitForVMs(t, f, 2)
+	waitForVMs(t, f, 0)
+	assert.Equal(uint32(0), f.(*cache).GetPoolStatus().Target)
+}
+
+func TestCacheMinFreeMemory(t *testing.T) {
+	assert := assert.New(t)
+	defer fs.MockStorageDestroy()
+
+	savedInterval, savedMemory := cacheCheckInterval, hostAvailableMemory
+	cacheCheckInterval = 10 * time.Millisecond
+	hostAvailableMemory = func() (uint64, error) {
+		return 1024, nil
+	}
+	defer func() {
+		cacheCheckInterval, hostAvailableMemory = savedInterval, savedMemory
+	}()
+
+	vmConfig := newTestVMConfig()
+	vmConfig.HypervisorConfig.MemorySize = 512
+	ctx := context.Background()
+
+	f := NewAdaptive(ctx, Config{Min: 1, Max: 3, MinFreeMemory: 1024}, direct.New(ctx, vmConfig))
+	defer f.CloseFactory(ctx)
+
+	// The minimum number of VMs is kept whatever the host memory, the
+	// cache only growing above it if the memory is available.
+	waitForVMs(t, f, 1)
+
+	for i := 0; i < 3; i++ {
+		vm, err := f.GetBaseVM(ctx, vmConfig)
+		assert.NoError(err)
+		assert.NoError(vm.Stop())
+	}
+
+	waitForVMs(t, f, 1)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(uint32(1), f.(*cache).GetPoolStatus().Vms)
+}
+
+func TestCacheCheck(t *testing.T) {
+	assert := assert.New(t)
+	defer fs.MockStorageDestroy()
+
+	vmConfig := newTestVMConfig()
+	ctx := context.Background()
+
+	f := NewAdaptive(ctx, Config{Min: 2, Max: 2}, direct.New(ctx, vmConfig))
+	defer f.CloseFactory(ctx)
+
+	waitForVMs(t, f, 2)
+
+	c := f.(*cache)
+	c.Lock()
+	unhealthy := c.vms[0].vm
+	healthy := c.vms[1].vm
+	c.Unlock()
+
+	savedCheck := checkVM
+	checkVM = func(ctx context.Context, vm *vc.VM) error {
+		if vm == unhealthy {
+			return errors.New("agent is dead")
+		}
+		return nil
+	}
+	defer func() {
+		checkVM = savedCheck
+	}()
+
+	// The unhealthy VM is replaced, the healthy one kept.
+	c.check(ctx)
+	waitForVMs(t, f, 2)
+
+	c.Lock()
+	assert.Equal(healthy, c.vms[0].vm)
+	assert.NotEqual(unhealthy, c.vms[1].vm)
+	c.Unlock()
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	assert := assert.New(t)
+	defer fs.MockStorageDestroy()
+
+	savedInterval := cacheCheckInterval
+	cacheCheckInterval = 10 * time.Millisecond
+	defer func() {
+		cacheCheckInterval = savedInterval
+	}()
+
+	vmConfig := newTestVMConfig()
+	ctx := context.Background()
+
+	f := NewAdaptive(ctx, Config{Min: 1, Max: 1, MaxAge: 50 * time.Millisecond}, direct.New(ctx, vmConfig))
+	defer f.CloseFactory(ctx)
+
+	waitForVMs(t, f, 1)
+
+	c := f.(*cache)
+	c.Lock()
+	old := c.vms[0].vm
+	c.Unlock()
+
+	// The VM is replaced once too old.
+	for i := 0; i < 100; i++ {
+		c.Lock()
+		replaced := len(c.vms) == 1 && c.vms[0].vm != old
+		c.Unlock()
+		if replaced {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Fail("cached VM was not replaced")
+}
+
+// failingFactory is a base factory failing to boot VMs, counting the
+// attempts.
+type failingFactory struct {
+	base.FactoryBase
+
+	sync.Mutex
+	attempts int
+}
+
+func (f *failingFactory) GetBaseVM(ctx context.Context, config vc.VMConfig) (*vc.VM, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.attempts++
+	return nil, errors.New("hypervisor failed to start")
+}
+
+func (f *failingFactory) getAttempts() int {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.attempts
+}
+
+func TestCacheBootBackoff(t *testing.T) {
+	assert := assert.New(t)
+	defer fs.MockStorageDestroy()
+
+	savedInterval, savedBackoff, savedMaxBackoff := cacheCheckInterval, cacheBootBackoff, cacheMaxBootBackoff
+	cacheCheckInterval = time.Millisecond
+	cacheBootBackoff = 20 * time.Millisecond
+	cacheMaxBootBackoff = time.Second
+	defer func() {
+		cacheCheckInterval, cacheBootBackoff, cacheMaxBootBackoff = savedInterval, savedBackoff, savedMaxBackoff
+	}()
+
+	ctx := context.Background()
+	b := &failingFactory{FactoryBase: direct.New(ctx, newTestVMConfig())}
+
+	f := NewAdaptive(ctx, Config{Min: 1, Max: 1}, b)
+	defer f.CloseFactory(ctx)
+
+	// Booting is retried after 20, 40, 80 and 160ms rather than every
+	// resize.
+	time.Sleep(200 * time.Millisecond)
+	attempts := b.getAttempts()
+	assert.True(attempts >= 2 && attempts <= 5, "%d boot attempts", attempts)
+
+	c := f.(*cache)
+	c.Lock()
+	c.failures = 7
+	assert.Equal(time.Second, c.backoff())
+	c.failures = 1
+	assert.Equal(20*time.Millisecond, c.backoff())
+	c.Unlock()
+}
+
+func TestProcAvailableMemory(t *testing.T) {
+	available, err := procAvailableMemory()
+	assert.NoError(t, err)
+	assert.NotZero(t, available)
+}
@@ -8,6 +8,9 @@ package factory
 import (
 	"context"
 	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
 
 	pb "github.com/kata-containers/runtime/protocols/cache"
 	vc "github.com/kata-containers/runtime/virtcontainers"
@@ -23,6 +26,10 @@ import (
 
 var factoryLogger = logrus.FieldLogger(logrus.New())
 
+// DefaultPool is the name of the pool of the VMs of the base config of a
+// factory.
+const DefaultPool = "default"
+
 // Config is a collection of VM factory configurations.
 type Config struct {
 	Template        bool
@@ -31,11 +38,74 @@ type Config struct {
 	TemplatePath    string
 	VMCacheEndpoint string
 
+	// VMCacheTokenPath is the file holding the token authenticating the
+	// VMCache client, if any.
+	VMCacheTokenPath string
+
 	VMConfig vc.VMConfig
+
+	// CacheMin is the number of VMs the cache keeps when VMs are not
+	// requested, Cache being the number it grows to. The cache keeps
+	// Cache VMs if 0.
+	CacheMin uint
+
+	// CacheIdleTimeout is the time the VMs above the number of recently
+	// requested ones are kept in the cache.
+	CacheIdleTimeout time.Duration
+
+	// CacheMinFreeMemory is the host memory, in MiB, the cache does not
+	// grow above CacheMin into.
+	CacheMinFreeMemory uint32
+
+	// CacheCheckInterval is the period the health of the cached VMs is
+	// checked at, the unhealthy ones being replaced. 0 disables the checks.
+	CacheCheckInterval time.Duration
+
+	// CacheMaxAge is the time VMs are kept in the cache before being
+	// replaced. 0 does not limit it.
+	CacheMaxAge time.Duration
+
+	// Pools are the pools of cached VMs of other shapes than VMConfig.
+	Pools []PoolConfig
+}
+
+// PoolConfig is the configuration of a pool of cached VMs of the same
+// shape.
+type PoolConfig struct {
+	// Name identifies the pool.
+	Name string
+
+	// Cache is the number of VMs of the pool, and CacheMin the number
+	// it keeps when VMs are not requested, as for the factory cache.
+	Cache    uint
+	CacheMin uint
+
+	// VMConfig is the base config of the VMs of the pool.
+	VMConfig vc.VMConfig
+}
+
+// pool is a base factory of VMs of the same shape.
+type pool struct {
+	name string
+	base base.FactoryBase
 }
 
 type factory struct {
 	base base.FactoryBase
+
+	// pools are the pools of other shapes than the base factory.
+	pools []pool
+
+	// templatePath is the path of the templates of the VMs booting other
+	// assets than the base factory ones, if created on demand.
+	templatePath string
+
+	// templates are the templates of other assets, created on demand
+	// if not nil. creating holds the templates being created, closed
+	// once they are.
+	sync.Mutex
+	templates map[string]base.FactoryBase
+	creating  map[string]chan struct{}
 }
 
 func trace(parent context.Context, name string) (opentracing.Span, context.Context) {
@@ -60,22 +130,27 @@ func NewFactory(ctx context.Context, config Config, fetchOnly bool) (vc.Factory,
 		return nil, fmt.Errorf("cache factory does not support fetch")
 	}
 
+	if len(config.Pools) > 0 && (fetchOnly || config.Cache == 0) {
+		return nil, fmt.Errorf("VM pools are only supported by cache factory")
+	}
+
 	var b base.FactoryBase
 	if config.VMCache && config.Cache == 0 {
 		// For VMCache client
-		b, err = grpccache.New(ctx, config.VMCacheEndpoint)
+		b, err = grpccache.New(ctx, config.VMCacheEndpoint, config.VMCacheTokenPath)
 		if err != nil {
 			return nil, err
 		}
 	} else {
 		if config.Template {
+			path := template.Path(config.TemplatePath, config.VMConfig)
 			if fetchOnly {
-				b, err = template.Fetch(config.VMConfig, config.TemplatePath)
+				b, err = template.Fetch(config.VMConfig, path)
 				if err != nil {
 					return nil, err
 				}
 			} else {
-				b, err = template.New(ctx, config.VMConfig, config.TemplatePath)
+				b, err = template.New(ctx, config.VMConfig, path)
 				if err != nil {
 					return nil, err
 				}
@@ -85,11 +160,82 @@ func NewFactory(ctx context.Context, config Config, fetchOnly bool) (vc.Factory,
 		}
 
 		if config.Cache > 0 {
-			b = cache.New(ctx, config.Cache, b)
+			b = cache.NewAdaptive(ctx, cacheConfig(config, config.Cache, config.CacheMin), b)
+		}
+	}
+
+	f := &factory{base: b}
+	if config.Template && !config.VMCache && config.Cache == 0 {
+		f.templatePath = config.TemplatePath
+		f.templates = make(map[string]base.FactoryBase)
+		f.creating = make(map[string]chan struct{})
+	}
+
+	if len(config.Pools) > 0 {
+		names := make(map[string]bool)
+		for _, p := range config.Pools {
+			if names[p.Name] {
+				f.CloseFactory(ctx)
+				return nil, fmt.Errorf("duplicate VM pool %s", p.Name)
+			}
+			names[p.Name] = true
+
+			poolBase, err := newPool(ctx, config, p)
+			if err != nil {
+				f.CloseFactory(ctx)
+				return nil, err
+			}
+			f.pools = append(f.pools, pool{name: p.Name, base: poolBase})
 		}
 	}
 
-	return &factory{b}, nil
+	return f, nil
+}
+
+// newPool returns a cache factory of the VMs of a pool, created from a
+// template of the pool if the factory uses templates.
+func newPool(ctx context.Context, config Config, p PoolConfig) (base.FactoryBase, error) {
+	if p.Name == "" || p.Name == DefaultPool {
+		return nil, fmt.Errorf("invalid VM pool name %q", p.Name)
+	}
+
+	if p.Cache == 0 {
+		return nil, fmt.Errorf("VM pool %s is empty", p.Name)
+	}
+
+	if err := p.VMConfig.Valid(); err != nil {
+		return nil, err
+	}
+
+	var b base.FactoryBase
+	if config.Template {
+		var err error
+		b, err = template.New(ctx, p.VMConfig, filepath.Join(config.TemplatePath, p.Name))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		b = direct.New(ctx, p.VMConfig)
+	}
+
+	return cache.NewAdaptive(ctx, cacheConfig(config, p.Cache, p.CacheMin), b), nil
+}
+
+// cacheConfig returns the config of a cache of the factory growing to max
+// VMs, from min ones.
+func cacheConfig(config Config, max, min uint) cache.Config {
+	if min == 0 || min > max {
+		min = max
+	}
+
+	return cache.Config{
+		Min:           min,
+		Max:           max,
+		IdleTimeout:   config.CacheIdleTimeout,
+		MinFreeMemory: config.CacheMinFreeMemory,
+		CheckInterval: config.CacheCheckInterval,
+		MaxAge:        config.CacheMaxAge,
+	}
 }
 
 // SetLogger sets the logger for the factory.
@@ -99,6 +245,8 @@ func SetLogger(ctx context.Context, logger logrus.FieldLogger) {
 	}
 
 	factoryLogger = logger.WithFields(fields)
+	cache.SetLogger(factoryLogger)
+	template.SetLogger(factoryLogger)
 }
 
 func (f *factory) log() *logrus.Entry {
@@ -142,6 +290,132 @@ func (f *factory) checkConfig(config vc.VMConfig) error {
 	return checkVMConfig(baseConfig, config)
 }
 
+// allPools returns the pools of the factory, the default one first.
+func (f *factory) allPools() []pool {
+	return append([]pool{{name: DefaultPool, base: f.base}}, f.pools...)
+}
+
+// fitsVMConfig tells whether a VM of baseConfig can be grown to config.
+func fitsVMConfig(baseConfig, config vc.HypervisorConfig) bool {
+	return baseConfig.NumVCPUs <= config.NumVCPUs && baseConfig.MemorySize <= config.MemorySize
+}
+
+// smallerVMConfig tells whether the VMs of config1 are smaller than the
+// ones of config2, comparing their memory first.
+func smallerVMConfig(config1, config2 vc.HypervisorConfig) bool {
+	if config1.MemorySize != config2.MemorySize {
+		return config1.MemorySize < config2.MemorySize
+	}
+	return config1.NumVCPUs < config2.NumVCPUs
+}
+
+// selectPool returns the pool to get a VM of config from. Among the pools
+// of VMs which can be grown to config, it selects the one of the largest
+// VMs, needing the least hotplug. If all VMs are larger than config, it
+// selects the pool of the smallest ones.
+func (f *factory) selectPool(config vc.VMConfig) (pool, error) {
+	var best pool
+	var bestFits bool
+
+	for _, p := range f.allPools() {
+		baseConfig := p.base.Config()
+		if checkVMConfig(baseConfig, config) != nil {
+			continue
+		}
+
+		fits := fitsVMConfig(baseConfig.HypervisorConfig, config.HypervisorConfig)
+		if best.base == nil || (fits && !bestFits) ||
+			(fits == bestFits && fits == smallerVMConfig(best.base.Config().HypervisorConfig, baseConfig.HypervisorConfig)) {
+			best = p
+			bestFits = fits
+		}
+	}
+
+	if best.base == nil {
+		return pool{}, f.checkConfig(config)
+	}
+
+	return best, nil
+}
+
+// assetTemplate returns the template of the VMs of config if they only
+// differ from the base factory ones by the assets they boot, fetching or
+// creating it next to the base factory template. A template is created
+// once, without holding the factory lock, the requests of the same
+// template waiting for it.
+func (f *factory) assetTemplate(ctx context.Context, config vc.VMConfig) (pool, error) {
+	f.Lock()
+	enabled := f.templates != nil
+	f.Unlock()
+	if !enabled {
+		return pool{}, fmt.Errorf("factory does not create templates on demand")
+	}
+
+	baseConfig := f.base.Config()
+	baseConfig.HypervisorConfig.KernelPath = config.HypervisorConfig.KernelPath
+	baseConfig.HypervisorConfig.ImagePath = config.HypervisorConfig.ImagePath
+	baseConfig.HypervisorConfig.InitrdPath = config.HypervisorConfig.InitrdPath
+	if err := checkVMConfig(baseConfig, config); err != nil {
+		return pool{}, err
+	}
+
+	path := template.Path(f.templatePath, baseConfig)
+	name := filepath.Base(path)
+
+	var created chan struct{}
+	for created == nil {
+		f.Lock()
+		if f.templates == nil {
+			f.Unlock()
+			return pool{}, fmt.Errorf("factory is closed")
+		}
+
+		if b, ok := f.templates[name]; ok {
+			f.Unlock()
+			return pool{name: name, base: b}, nil
+		}
+
+		creating, ok := f.creating[name]
+		if !ok {
+			created = make(chan struct{})
+			f.creating[name] = created
+		}
+		f.Unlock()
+
+		if ok {
+			select {
+			case <-creating:
+			case <-ctx.Done():
+				return pool{}, ctx.Err()
+			}
+		}
+	}
+
+	b, err := template.Fetch(baseConfig, path)
+	if err != nil {
+		f.log().WithError(err).WithField("template", path).Info("create template")
+		b, err = template.New(ctx, baseConfig, path)
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	delete(f.creating, name)
+	close(created)
+
+	if err != nil {
+		return pool{}, err
+	}
+
+	if f.templates == nil {
+		b.CloseFactory(ctx)
+		return pool{}, fmt.Errorf("factory is closed")
+	}
+	f.templates[name] = b
+
+	return pool{name: name, base: b}, nil
+}
+
 func (f *factory) validateNewVMConfig(config vc.VMConfig) error {
 	if len(config.AgentType.String()) == 0 {
 		return fmt.Errorf("Missing agent type")
@@ -166,14 +440,21 @@ func (f *factory) GetVM(ctx context.Context, config vc.VMConfig) (*vc.VM, error)
 		return nil, err
 	}
 
-	err = f.checkConfig(config)
+	// Compare the assets booted by the VMs rather than how they are
+	// requested.
+	config.HypervisorConfig.ResolveAssets()
+
+	p, err := f.selectPool(config)
 	if err != nil {
-		f.log().WithError(err).Info("fallback to direct factory vm")
-		return direct.New(ctx, config).GetBaseVM(ctx, config)
+		var tErr error
+		if p, tErr = f.assetTemplate(ctx, config); tErr != nil {
+			f.log().WithError(err).Info("fallback to direct factory vm")
+			return direct.New(ctx, config).GetBaseVM(ctx, config)
+		}
 	}
 
-	f.log().Info("get base VM")
-	vm, err := f.base.GetBaseVM(ctx, config)
+	f.log().WithField("pool", p.name).Info("get base VM")
+	vm, err := p.base.GetBaseVM(ctx, config)
 	if err != nil {
 		f.log().WithError(err).Error("failed to get base VM")
 		return nil, err
@@ -193,29 +474,31 @@ func (f *factory) GetVM(ctx context.Context, config vc.VMConfig) (*vc.VM, error)
 	}
 
 	// reseed RNG so that shared memory VMs do not generate same random numbers.
-	err = vm.ReseedRNG()
+	err = vm.ReseedRNG(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// sync guest time since we might have paused it for a long time.
-	err = vm.SyncTime()
+	err = vm.SyncTime(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	// The VM may not have the shape of the base config of the pool when
+	// it comes from a VMCache server.
 	online := false
-	baseConfig := f.base.Config().HypervisorConfig
-	if baseConfig.NumVCPUs < hypervisorConfig.NumVCPUs {
-		err = vm.AddCPUs(hypervisorConfig.NumVCPUs - baseConfig.NumVCPUs)
+	vmStatus := vm.GetVMStatus()
+	if vmStatus.Cpu < hypervisorConfig.NumVCPUs {
+		err = vm.AddCPUs(hypervisorConfig.NumVCPUs - vmStatus.Cpu)
 		if err != nil {
 			return nil, err
 		}
 		online = true
 	}
 
-	if baseConfig.MemorySize < hypervisorConfig.MemorySize {
-		err = vm.AddMemory(hypervisorConfig.MemorySize - baseConfig.MemorySize)
+	if vmStatus.Memory < hypervisorConfig.MemorySize {
+		err = vm.AddMemory(hypervisorConfig.MemorySize - vmStatus.Memory)
 		if err != nil {
 			return nil, err
 		}
@@ -223,7 +506,7 @@ func (f *factory) GetVM(ctx context.Context, config vc.VMConfig) (*vc.VM, error)
 	}
 
 	if online {
-		err = vm.OnlineCPUMemory()
+		err = vm.OnlineCPUMemory(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -237,17 +520,63 @@ func (f *factory) Config() vc.VMConfig {
 	return f.base.Config()
 }
 
-// GetVMStatus returns the status of the paused VM created by the base factory.
+// GetVMStatus returns the status of the paused VMs created by the base
+// factory and by the pools.
 func (f *factory) GetVMStatus() []*pb.GrpcVMStatus {
-	return f.base.GetVMStatus()
+	var vs []*pb.GrpcVMStatus
+
+	for _, p := range f.allPools() {
+		for _, s := range p.base.GetVMStatus() {
+			s.Pool = p.name
+			vs = append(vs, s)
+		}
+	}
+
+	return vs
+}
+
+// GetPoolStatus returns the status of the pools of cached VMs.
+func (f *factory) GetPoolStatus() []*pb.GrpcPoolStatus {
+	var ps []*pb.GrpcPoolStatus
+
+	for _, p := range f.allPools() {
+		if b, ok := p.base.(base.PoolFactoryBase); ok {
+			s := b.GetPoolStatus()
+			s.Name = p.name
+			ps = append(ps, s)
+		}
+	}
+
+	return ps
 }
 
-// GetBaseVM returns a paused VM created by the base factory.
+// GetBaseVM returns a paused VM created by the pool of the VMs of config,
+// the base factory if none.
 func (f *factory) GetBaseVM(ctx context.Context, config vc.VMConfig) (*vc.VM, error) {
+	for _, p := range f.pools {
+		baseConfig := p.base.Config()
+		if checkVMConfig(baseConfig, config) == nil &&
+			baseConfig.HypervisorConfig.NumVCPUs == config.HypervisorConfig.NumVCPUs &&
+			baseConfig.HypervisorConfig.MemorySize == config.HypervisorConfig.MemorySize {
+			return p.base.GetBaseVM(ctx, config)
+		}
+	}
+
 	return f.base.GetBaseVM(ctx, config)
 }
 
 // CloseFactory closes the factory.
 func (f *factory) CloseFactory(ctx context.Context) {
+	for i := len(f.pools) - 1; i >= 0; i-- {
+		f.pools[i].base.CloseFactory(ctx)
+	}
+
+	f.Lock()
+	for _, b := range f.templates {
+		b.CloseFactory(ctx)
+	}
+	f.templates = nil
+	f.Unlock()
+
 	f.base.CloseFactory(ctx)
 }
@@ -7,11 +7,18 @@ package factory
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	pb "github.com/kata-containers/runtime/protocols/cache"
 	vc "github.com/kata-containers/runtime/virtcontainers"
 	"github.com/kata-containers/runtime/virtcontainers/factory/base"
+	"github.com/kata-containers/runtime/virtcontainers/factory/direct"
+	"github.com/kata-containers/runtime/virtcontainers/factory/template"
 	"github.com/kata-containers/runtime/virtcontainers/persist/fs"
 	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/sirupsen/logrus"
@@ -288,6 +295,119 @@ func TestFactoryGetVM(t *testing.T) {
 	f.CloseFactory(ctx)
 }
 
+func TestFactoryAssetTemplate(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip(testDisabledAsNonRoot)
+	}
+
+	assert := assert.New(t)
+
+	testDir := fs.MockStorageRootPath()
+	defer fs.MockStorageDestroy()
+
+	kernel := filepath.Join(testDir, "kernel")
+	assert.NoError(os.MkdirAll(testDir, 0700))
+	assert.NoError(ioutil.WriteFile(kernel, nil, 0600))
+
+	vmConfig := vc.VMConfig{
+		HypervisorType: vc.MockHypervisor,
+		HypervisorConfig: vc.HypervisorConfig{
+			KernelPath: testDir,
+			ImagePath:  testDir,
+		},
+		AgentType: vc.NoopAgentType,
+		ProxyType: vc.NoopProxyType,
+	}
+	assert.NoError(vmConfig.Valid())
+
+	ctx := context.Background()
+	f, err := NewFactory(ctx, Config{Template: true, TemplatePath: testDir, VMConfig: vmConfig}, false)
+	assert.NoError(err)
+	defer f.CloseFactory(ctx)
+
+	// VMs of another kernel get a template of their own.
+	config := vmConfig
+	config.HypervisorConfig.KernelPath = kernel
+
+	vm, err := f.GetVM(ctx, config)
+	assert.NoError(err)
+	assert.NoError(vm.Stop())
+
+	ff := f.(*factory)
+	assert.Len(ff.templates, 1)
+	assert.Contains(ff.templates, filepath.Base(template.Path(testDir, config)))
+
+	vm, err = f.GetVM(ctx, config)
+	assert.NoError(err)
+	assert.NoError(vm.Stop())
+	assert.Len(ff.templates, 1)
+
+	// VMs differing by more than their assets are not templated.
+	config.HypervisorConfig.Mlock = true
+	vm, err = f.GetVM(ctx, config)
+	assert.NoError(err)
+	assert.NoError(vm.Stop())
+	assert.Len(ff.templates, 1)
+}
+
+func TestFactoryAssetTemplateInFlight(t *testing.T) {
+	assert := assert.New(t)
+
+	testDir := fs.MockStorageRootPath()
+	defer fs.MockStorageDestroy()
+
+	vmConfig := vc.VMConfig{
+		HypervisorType: vc.MockHypervisor,
+		HypervisorConfig: vc.HypervisorConfig{
+			KernelPath: testDir,
+			ImagePath:  testDir,
+		},
+		AgentType: vc.NoopAgentType,
+		ProxyType: vc.NoopProxyType,
+	}
+
+	ctx := context.Background()
+	f := &factory{
+		base:         direct.New(ctx, vmConfig),
+		templatePath: testDir,
+		templates:    make(map[string]base.FactoryBase),
+		creating:     make(map[string]chan struct{}),
+	}
+
+	config := vmConfig
+	config.HypervisorConfig.KernelPath = filepath.Join(testDir, "kernel")
+	name := filepath.Base(template.Path(testDir, config))
+
+	// The template is being created by another request.
+	creating := make(chan struct{})
+	f.creating[name] = creating
+
+	done := make(chan pool)
+	go func() {
+		p, err := f.assetTemplate(ctx, config)
+		assert.NoError(err)
+		done <- p
+	}()
+
+	select {
+	case <-done:
+		assert.Fail("template created twice")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// The factory is not locked meanwhile.
+	f.Lock()
+	b := direct.New(ctx, config)
+	f.templates[name] = b
+	delete(f.creating, name)
+	close(creating)
+	f.Unlock()
+
+	p := <-done
+	assert.Equal(name, p.name)
+	assert.Equal(b, p.base)
+}
+
 func TestDeepCompare(t *testing.T) {
 	assert := assert.New(t)
 
@@ -352,3 +472,141 @@ func TestDeepCompare(t *testing.T) {
 	assert.Nil(err)
 	assert.False(utils.DeepCompare(f1, f2))
 }
+
+// fakeBase is a base factory of VMs of a config, which it does not create.
+type fakeBase struct {
+	config vc.VMConfig
+	closed bool
+}
+
+func (b *fakeBase) Config() vc.VMConfig {
+	return b.config
+}
+
+func (b *fakeBase) GetVMStatus() []*pb.GrpcVMStatus {
+	return []*pb.GrpcVMStatus{{Cpu: b.config.HypervisorConfig.NumVCPUs, Memory: b.config.HypervisorConfig.MemorySize}}
+}
+
+func (b *fakeBase) GetBaseVM(ctx context.Context, config vc.VMConfig) (*vc.VM, error) {
+	return nil, fmt.Errorf("no VM")
+}
+
+func (b *fakeBase) CloseFactory(ctx context.Context) {
+	b.closed = true
+}
+
+// fakePoolBase is a fake base factory keeping a pool of VMs.
+type fakePoolBase struct {
+	fakeBase
+}
+
+func (b *fakePoolBase) GetPoolStatus() *pb.GrpcPoolStatus {
+	return &pb.GrpcPoolStatus{Hits: 1}
+}
+
+func TestFactorySelectPool(t *testing.T) {
+	assert := assert.New(t)
+
+	newConfig := func(cpus, memory uint32, kernel string) vc.VMConfig {
+		return vc.VMConfig{
+			HypervisorType: vc.MockHypervisor,
+			HypervisorConfig: vc.HypervisorConfig{
+				NumVCPUs:   cpus,
+				MemorySize: memory,
+				KernelPath: kernel,
+			},
+		}
+	}
+
+	f := &factory{
+		base: &fakeBase{config: newConfig(1, 512, "kernel")},
+		pools: []pool{
+			{name: "medium", base: &fakeBase{config: newConfig(2, 2048, "kernel")}},
+			{name: "large", base: &fakeBase{config: newConfig(4, 4096, "kernel")}},
+			{name: "other", base: &fakePoolBase{fakeBase{config: newConfig(1, 512, "other-kernel")}}},
+		},
+	}
+
+	for _, d := range []struct {
+		config vc.VMConfig
+		pool   string
+	}{
+		// The largest VMs which can be grown are selected.
+		{newConfig(1, 512, "kernel"), DefaultPool},
+		{newConfig(2, 1024, "kernel"), DefaultPool},
+		{newConfig(2, 2048, "kernel"), "medium"},
+		{newConfig(8, 3072, "kernel"), "medium"},
+		{newConfig(8, 8192, "kernel"), "large"},
+		{newConfig(1, 8192, "kernel"), DefaultPool},
+		{newConfig(2, 512, "other-kernel"), "other"},
+		// The smallest VMs are selected if all are too large.
+		{newConfig(1, 256, "kernel"), DefaultPool},
+	} {
+		p, err := f.selectPool(d.config)
+		assert.NoError(err)
+		assert.Equal(d.pool, p.name, "config %+v", d.config.HypervisorConfig)
+	}
+
+	_, err := f.selectPool(newConfig(1, 512, "unknown-kernel"))
+	assert.Error(err)
+
+	status := f.GetVMStatus()
+	assert.Len(status, 4)
+	assert.Equal(DefaultPool, status[0].Pool)
+	assert.Equal("large", status[2].Pool)
+	assert.Equal(uint32(4096), status[2].Memory)
+
+	// Only the pools keeping VMs have a status.
+	pools := f.GetPoolStatus()
+	assert.Len(pools, 1)
+	assert.Equal("other", pools[0].Name)
+	assert.Equal(uint64(1), pools[0].Hits)
+
+	f.CloseFactory(context.Background())
+	for _, p := range f.pools[:2] {
+		assert.True(p.base.(*fakeBase).closed)
+	}
+	assert.True(f.base.(*fakeBase).closed)
+	assert.True(f.pools[2].base.(*fakePoolBase).closed)
+}
+
+func TestNewFactoryPools(t *testing.T) {
+	assert := assert.New(t)
+
+	defer fs.MockStorageDestroy()
+	vmConfig := vc.VMConfig{
+		HypervisorType: vc.MockHypervisor,
+		AgentType:      vc.NoopAgentType,
+		ProxyType:      vc.NoopProxyType,
+		HypervisorConfig: vc.HypervisorConfig{
+			KernelPath: fs.MockStorageRootPath(),
+			ImagePath:  fs.MockStorageRootPath(),
+		},
+	}
+
+	ctx := context.Background()
+	config := Config{
+		VMConfig: vmConfig,
+		Pools:    []PoolConfig{{Name: "small", Cache: 1, VMConfig: vmConfig}},
+	}
+
+	// Pools are pools of cached VMs.
+	_, err := NewFactory(ctx, config, false)
+	assert.Error(err)
+
+	config.Cache = 1
+	_, err = NewFactory(ctx, config, true)
+	assert.Error(err)
+
+	for _, pools := range [][]PoolConfig{
+		{{Name: "", Cache: 1, VMConfig: vmConfig}},
+		{{Name: DefaultPool, Cache: 1, VMConfig: vmConfig}},
+		{{Name: "small", VMConfig: vmConfig}},
+		{{Name: "small", Cache: 1}},
+		{{Name: "small", Cache: 1, VMConfig: vmConfig}, {Name: "small", Cache: 1, VMConfig: vmConfig}},
+	} {
+		config.Pools = pools
+		_, err = NewFactory(ctx, config, false)
+		assert.Error(err, "pools %+v", pools)
+	}
+}
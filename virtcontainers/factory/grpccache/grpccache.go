@@ -8,7 +8,10 @@ package grpccache
 
 import (
 	"context"
+	"crypto/subtle"
 	"fmt"
+	"io/ioutil"
+	"strings"
 
 	types "github.com/gogo/protobuf/types"
 	pb "github.com/kata-containers/runtime/protocols/cache"
@@ -16,21 +19,133 @@ import (
 	"github.com/kata-containers/runtime/virtcontainers/factory/base"
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
+// ProtocolVersion is the version of the CacheService implemented by the VM
+// cache server and client. Version 1 servers only hand out VMs of their base
+// config, version 2 ones the VMs of the shape requested by GetVM.
+const ProtocolVersion = 2
+
+// tokenMetadataKey is the request metadata carrying the token of the
+// client.
+const tokenMetadataKey = "authorization"
+
 type grpccache struct {
-	conn   *grpc.ClientConn
-	config *vc.VMConfig
+	conn    *grpc.ClientConn
+	config  *vc.VMConfig
+	version uint32
+}
+
+// tokenCredentials authenticates the requests of a client with a token.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{tokenMetadataKey: string(t)}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// ParseEndpoint returns the path of the unix socket of a VM cache endpoint,
+// optionally prefixed by unix://. The VMs are handed out to the clients on
+// the host of the server only, and the unix socket restricts the clients
+// to the allowed users, which a network socket does not.
+func ParseEndpoint(endpoint string) (string, error) {
+	endpoint = strings.TrimPrefix(endpoint, "unix://")
+
+	if !strings.HasPrefix(endpoint, "/") {
+		return "", fmt.Errorf("invalid VM cache endpoint %q: not an absolute unix socket path", endpoint)
+	}
+
+	return endpoint, nil
+}
+
+// ReadToken returns the token authenticating the VM cache clients stored in
+// the file at path.
+func ReadToken(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("empty VM cache token in %s", path)
+	}
+
+	return token, nil
 }
 
-// New returns a new direct vm factory.
-func New(ctx context.Context, endpoint string) (base.FactoryBase, error) {
-	conn, err := grpc.Dial(fmt.Sprintf("unix://%s", endpoint), grpc.WithInsecure())
+// CheckToken checks that the request of ctx carries token, if not empty.
+func CheckToken(ctx context.Context, token string) error {
+	if token == "" {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, t := range md[tokenMetadataKey] {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "invalid VM cache token")
+}
+
+// Dial connects to the VM cache server at endpoint, authenticating with
+// token if not empty.
+func Dial(endpoint, token string) (*grpc.ClientConn, error) {
+	path, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []grpc.DialOption{grpc.WithInsecure()}
+	if token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials(token)))
+	}
+
+	conn, err := grpc.Dial("unix://"+path, opts...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to connect %q", endpoint)
 	}
 
-	jConfig, err := pb.NewCacheServiceClient(conn).Config(ctx, &types.Empty{})
+	return conn, nil
+}
+
+// New returns a new grpc vm factory, authenticating with the token stored
+// at tokenPath if not empty.
+func New(ctx context.Context, endpoint, tokenPath string) (base.FactoryBase, error) {
+	var token string
+	if tokenPath != "" {
+		var err error
+		if token, err = ReadToken(tokenPath); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := Dial(endpoint, token)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := newGrpcCache(ctx, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return g, nil
+}
+
+func newGrpcCache(ctx context.Context, conn *grpc.ClientConn) (*grpccache, error) {
+	client := pb.NewCacheServiceClient(conn)
+
+	jConfig, err := client.Config(ctx, &types.Empty{})
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to Config")
 	}
@@ -40,25 +155,56 @@ func New(ctx context.Context, endpoint string) (base.FactoryBase, error) {
 		return nil, errors.Wrapf(err, "failed to convert JSON to VMConfig")
 	}
 
-	return &grpccache{conn: conn, config: config}, nil
+	// Servers predating versioning do not implement Version.
+	version := uint32(1)
+	v, err := client.Version(ctx, &types.Empty{})
+	if err == nil {
+		version = v.Version
+	} else if status.Code(err) != codes.Unimplemented {
+		return nil, errors.Wrapf(err, "failed to Version")
+	}
+	if version > ProtocolVersion {
+		version = ProtocolVersion
+	}
+
+	return &grpccache{conn: conn, config: config, version: version}, nil
 }
 
-// Config returns the direct factory's configuration.
+// Config returns the grpc factory's configuration.
 func (g *grpccache) Config() vc.VMConfig {
 	return *g.config
 }
 
-// GetBaseVM create a new VM directly.
+// GetBaseVM requests a VM of the shape of config from the VM cache server,
+// or of the server base config if it does not support it.
 func (g *grpccache) GetBaseVM(ctx context.Context, config vc.VMConfig) (*vc.VM, error) {
 	defer g.conn.Close()
-	gVM, err := pb.NewCacheServiceClient(g.conn).GetBaseVM(ctx, &types.Empty{})
+
+	client := pb.NewCacheServiceClient(g.conn)
+
+	var gVM *pb.GrpcVM
+	var err error
+	if g.version >= 2 {
+		gVM, err = client.GetVM(ctx, &pb.GrpcVMRequest{
+			Version: ProtocolVersion,
+			Cpu:     config.HypervisorConfig.NumVCPUs,
+			Memory:  config.HypervisorConfig.MemorySize,
+		})
+	} else {
+		gVM, err = client.GetBaseVM(ctx, &types.Empty{})
+	}
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to GetBaseVM")
 	}
-	return vc.NewVMFromGrpc(ctx, gVM, *g.config)
+
+	vmConfig := *g.config
+	vmConfig.HypervisorConfig.NumVCPUs = gVM.Cpu
+	vmConfig.HypervisorConfig.MemorySize = gVM.Memory
+
+	return vc.NewVMFromGrpc(ctx, gVM, vmConfig)
 }
 
-// CloseFactory closes the direct vm factory.
+// CloseFactory closes the grpc vm factory.
 func (g *grpccache) CloseFactory(ctx context.Context) {
 }
 
@@ -0,0 +1,190 @@
+// Copyright (c) 2019 HyperHQ Inc.
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package grpccache
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	types "github.com/gogo/protobuf/types"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/kata-containers/runtime/protocols/cache"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		endpoint string
+		path     string
+		valid    bool
+	}
+
+	data := []testData{
+		{"/run/cache.sock", "/run/cache.sock", true},
+		{"unix:///run/cache.sock", "/run/cache.sock", true},
+		{"tcp://127.0.0.1:5050", "", false},
+		{"", "", false},
+		{"cache.sock", "", false},
+		{"unix://cache.sock", "", false},
+	}
+
+	for _, d := range data {
+		path, err := ParseEndpoint(d.endpoint)
+		if !d.valid {
+			assert.Error(err, "endpoint %q", d.endpoint)
+			continue
+		}
+
+		assert.NoError(err, "endpoint %q", d.endpoint)
+		assert.Equal(d.path, path)
+	}
+}
+
+func TestToken(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "grpccache-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	assert.NoError(ioutil.WriteFile(path, []byte("\n"), 0600))
+	_, err = ReadToken(path)
+	assert.Error(err)
+
+	assert.NoError(ioutil.WriteFile(path, []byte("secret\n"), 0600))
+	token, err := ReadToken(path)
+	assert.NoError(err)
+	assert.Equal("secret", token)
+
+	ctx := context.Background()
+	assert.NoError(CheckToken(ctx, ""))
+	assert.Error(CheckToken(ctx, token))
+
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(tokenMetadataKey, "wrong"))
+	assert.Equal(codes.Unauthenticated, status.Code(CheckToken(ctx, token)))
+
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(tokenMetadataKey, token))
+	assert.NoError(CheckToken(ctx, token))
+}
+
+// fakeServer is a VM cache server of a given protocol version, recording
+// the VM requests.
+type fakeServer struct {
+	version uint32
+	config  *pb.GrpcVMConfig
+	request *pb.GrpcVMRequest
+	baseVMs int
+}
+
+func (s *fakeServer) Config(ctx context.Context, empty *types.Empty) (*pb.GrpcVMConfig, error) {
+	return s.config, nil
+}
+
+func (s *fakeServer) GetBaseVM(ctx context.Context, empty *types.Empty) (*pb.GrpcVM, error) {
+	s.baseVMs++
+	return &pb.GrpcVM{Cpu: 1, Memory: 512}, nil
+}
+
+func (s *fakeServer) Status(ctx context.Context, empty *types.Empty) (*pb.GrpcStatus, error) {
+	return &pb.GrpcStatus{}, nil
+}
+
+func (s *fakeServer) Quit(ctx context.Context, empty *types.Empty) (*types.Empty, error) {
+	return &types.Empty{}, nil
+}
+
+func (s *fakeServer) Version(ctx context.Context, empty *types.Empty) (*pb.GrpcVersion, error) {
+	if s.version < 2 {
+		return nil, status.Error(codes.Unimplemented, "unknown method Version")
+	}
+	return &pb.GrpcVersion{Version: s.version}, nil
+}
+
+func (s *fakeServer) GetVM(ctx context.Context, req *pb.GrpcVMRequest) (*pb.GrpcVM, error) {
+	s.request = req
+	return &pb.GrpcVM{Cpu: req.Cpu, Memory: req.Memory}, nil
+}
+
+func TestGrpcCacheVersions(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "grpccache-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	tokenPath := filepath.Join(dir, "token")
+	assert.NoError(ioutil.WriteFile(tokenPath, []byte("secret"), 0600))
+
+	vmConfig := vc.VMConfig{
+		HypervisorType: vc.MockHypervisor,
+		AgentType:      vc.KataContainersAgent,
+		AgentConfig:    vc.KataAgentConfig{},
+		ProxyType:      vc.NoopProxyType,
+		HypervisorConfig: vc.HypervisorConfig{
+			NumVCPUs:   1,
+			MemorySize: 512,
+		},
+	}
+	jConfig, err := vmConfig.ToGrpc()
+	assert.NoError(err)
+
+	ctx := context.Background()
+
+	for _, version := range []uint32{1, 2, 3} {
+		fake := &fakeServer{version: version, config: jConfig}
+
+		endpoint := filepath.Join(dir, "cache.sock")
+		l, err := net.Listen("unix", endpoint)
+		assert.NoError(err)
+
+		server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := CheckToken(ctx, "secret"); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}))
+		pb.RegisterCacheServiceServer(server, fake)
+		go server.Serve(l)
+
+		// Clients without the token are rejected.
+		_, err = New(ctx, endpoint, "")
+		assert.Error(err)
+
+		f, err := New(ctx, "unix://"+endpoint, tokenPath)
+		assert.NoError(err)
+
+		config := vmConfig
+		config.HypervisorConfig.NumVCPUs = 2
+		config.HypervisorConfig.MemorySize = 1024
+
+		// The mock hypervisor cannot be handed over, the requests are
+		// checked instead of the VM.
+		_, err = f.GetBaseVM(ctx, config)
+		assert.Error(err)
+
+		if version < 2 {
+			assert.Equal(1, fake.baseVMs)
+			assert.Nil(fake.request)
+		} else {
+			assert.Equal(0, fake.baseVMs)
+			assert.Equal(&pb.GrpcVMRequest{Version: ProtocolVersion, Cpu: 2, Memory: 1024}, fake.request)
+		}
+
+		server.Stop()
+	}
+}
@@ -8,43 +8,171 @@ package template
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
 	pb "github.com/kata-containers/runtime/protocols/cache"
 	vc "github.com/kata-containers/runtime/virtcontainers"
 	"github.com/kata-containers/runtime/virtcontainers/factory/base"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
+	"github.com/sirupsen/logrus"
 )
 
 type template struct {
 	statePath string
 	config    vc.VMConfig
+
+	// mu serializes the refreshes of the template VM, which are
+	// exclusive of the creations of VMs from it.
+	mu sync.RWMutex
 }
 
 var templateWaitForAgent = 2 * time.Second
 
+var templateLogger = logrus.FieldLogger(logrus.New())
+
+// SetLogger sets the logger for the template factories.
+func SetLogger(logger logrus.FieldLogger) {
+	templateLogger = logger.WithField("subsystem", "factory-template")
+}
+
+// Path returns the path of the template of the VMs of config under
+// templatePath. It is named after the assets the VMs boot, for templates of
+// different kernels to live side by side.
+func Path(templatePath string, config vc.VMConfig) string {
+	h := sha256.New()
+	for _, asset := range []string{
+		config.HypervisorConfig.KernelPath,
+		config.HypervisorConfig.ImagePath,
+		config.HypervisorConfig.InitrdPath,
+	} {
+		io.WriteString(h, asset)
+		h.Write([]byte{0})
+	}
+
+	return filepath.Join(templatePath, fmt.Sprintf("assets-%x", h.Sum(nil)[:8]))
+}
+
+// List returns the paths of the templates in templatePath and in its
+// sub directories.
+func List(templatePath string) []string {
+	paths := []string{templatePath}
+
+	infos, _ := ioutil.ReadDir(templatePath)
+	for _, info := range infos {
+		if info.IsDir() {
+			paths = append(paths, filepath.Join(templatePath, info.Name()))
+		}
+	}
+
+	var templates []string
+	for _, path := range paths {
+		t := &template{statePath: path}
+		if t.checkTemplateVM() == nil {
+			templates = append(templates, path)
+		}
+	}
+
+	return templates
+}
+
+// CloneStats returns the memory usage of the template in path by each of
+// the VMs created from it, among the hypervisor processes pids.
+func CloneStats(path string, pids []int) ([]utils.MappingStats, error) {
+	return utils.FindMappingStats(filepath.Join(path, "memory"), pids)
+}
+
+// Destroy removes the template in path.
+func Destroy(path string) {
+	unlock, err := lockTemplate(path, true)
+	if err != nil {
+		templateLogger.WithError(err).WithField("template", path).Warn("failed to lock VM template")
+		return
+	}
+	defer unlock()
+
+	t := &template{statePath: path}
+	t.close()
+}
+
+// lockTemplate locks the template in path against the other processes,
+// exclusively to create or remove it, shared to create VMs from it. The
+// lock file sits next to the template, which is a mount point.
+func lockTemplate(path string, exclusive bool) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path+".lock", os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
 // Fetch finds and returns a pre-built template factory.
 // TODO: save template metadata and fetch from storage.
 func Fetch(config vc.VMConfig, templatePath string) (base.FactoryBase, error) {
-	t := &template{templatePath, config}
+	t := &template{statePath: templatePath, config: config}
+
+	unlock, err := lockTemplate(templatePath, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
-	err := t.checkTemplateVM()
+	err = t.checkTemplateVM()
 	if err != nil {
 		return nil, err
 	}
 
+	if stale := t.staleAssets(); len(stale) > 0 {
+		return nil, fmt.Errorf("VM template in %s is stale: %v changed", templatePath, stale)
+	}
+
 	return t, nil
 }
 
 // New creates a new VM template factory.
 func New(ctx context.Context, config vc.VMConfig, templatePath string) (base.FactoryBase, error) {
-	t := &template{templatePath, config}
+	t := &template{statePath: templatePath, config: config}
+
+	unlock, err := lockTemplate(templatePath, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
-	err := t.checkTemplateVM()
+	err = t.checkTemplateVM()
 	if err == nil {
-		return nil, fmt.Errorf("There is already a VM template in %s", templatePath)
+		stale := t.staleAssets()
+		if len(stale) == 0 {
+			return nil, fmt.Errorf("There is already a VM template in %s", templatePath)
+		}
+
+		templateLogger.WithField("stale-assets", stale).Info("replace stale VM template")
+		t.detach()
 	}
 
 	err = t.prepareTemplateFiles()
@@ -70,13 +198,41 @@ func (t *template) Config() vc.VMConfig {
 	return t.config
 }
 
-// GetBaseVM creates a new paused VM from the template VM.
+// GetBaseVM creates a new paused VM from the template VM, recreating the
+// template VM first if it is stale. The template VM is not refreshed nor
+// removed while VMs are created from it.
 func (t *template) GetBaseVM(ctx context.Context, config vc.VMConfig) (*vc.VM, error) {
+	t.mu.RLock()
+	if len(t.staleAssets()) > 0 {
+		t.mu.RUnlock()
+		if err := t.refresh(ctx); err != nil {
+			return nil, err
+		}
+		t.mu.RLock()
+	}
+	defer t.mu.RUnlock()
+
+	unlock, err := lockTemplate(t.statePath, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	return t.createFromTemplateVM(ctx, config)
 }
 
 // CloseFactory cleans up the template VM.
 func (t *template) CloseFactory(ctx context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	unlock, err := lockTemplate(t.statePath, true)
+	if err != nil {
+		templateLogger.WithError(err).WithField("template", t.statePath).Warn("failed to lock VM template")
+		return
+	}
+	defer unlock()
+
 	t.close()
 }
 
@@ -90,6 +246,78 @@ func (t *template) close() {
 	os.RemoveAll(t.statePath)
 }
 
+// detach removes the template files, leaving the memory file mapped by the
+// VMs created from the template to them.
+func (t *template) detach() {
+	syscall.Unmount(t.statePath, syscall.MNT_DETACH)
+	os.RemoveAll(t.statePath)
+}
+
+// refresh recreates the template VM if the assets it was booted from
+// changed since, unless another process or goroutine already did.
+func (t *template) refresh(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	unlock, err := lockTemplate(t.statePath, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stale := t.staleAssets()
+	if len(stale) == 0 {
+		return nil
+	}
+
+	templateLogger.WithField("stale-assets", stale).Info("refresh VM template")
+
+	t.detach()
+
+	if err := t.prepareTemplateFiles(); err != nil {
+		return err
+	}
+
+	if err := t.createTemplateVM(ctx); err != nil {
+		t.close()
+		return err
+	}
+
+	return nil
+}
+
+// staleAssets returns the assets of the template VM config that changed
+// since the template VM was saved, or that no longer exist.
+func (t *template) staleAssets() []string {
+	state, err := os.Stat(t.statePath + "/state")
+	if err != nil {
+		return nil
+	}
+
+	assets := []struct {
+		name string
+		path string
+	}{
+		{"kernel", t.config.HypervisorConfig.KernelPath},
+		{"image", t.config.HypervisorConfig.ImagePath},
+		{"initrd", t.config.HypervisorConfig.InitrdPath},
+	}
+
+	var stale []string
+	for _, a := range assets {
+		if a.path == "" {
+			continue
+		}
+
+		info, err := os.Stat(a.path)
+		if err != nil || info.ModTime().After(state.ModTime()) {
+			stale = append(stale, a.name)
+		}
+	}
+
+	return stale
+}
+
 func (t *template) prepareTemplateFiles() error {
 	// create and mount tmpfs for the shared memory file
 	err := os.MkdirAll(t.statePath, 0700)
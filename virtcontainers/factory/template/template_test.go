@@ -7,7 +7,9 @@ package template
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -116,3 +118,143 @@ func TestTemplateFactory(t *testing.T) {
 	f.CloseFactory(ctx)
 	tt.CloseFactory(ctx)
 }
+
+func TestTemplateStaleAssets(t *testing.T) {
+	assert := assert.New(t)
+
+	testDir, err := ioutil.TempDir("", "template-stale-")
+	assert.NoError(err)
+	defer os.RemoveAll(testDir)
+
+	kernel := filepath.Join(testDir, "kernel")
+	initrd := filepath.Join(testDir, "initrd")
+	for _, path := range []string{kernel, initrd} {
+		assert.NoError(ioutil.WriteFile(path, nil, 0600))
+	}
+
+	tt := template{
+		statePath: filepath.Join(testDir, "template"),
+		config: vc.VMConfig{
+			HypervisorConfig: vc.HypervisorConfig{
+				KernelPath: kernel,
+				InitrdPath: initrd,
+			},
+		},
+	}
+
+	// No template VM yet.
+	assert.Empty(tt.staleAssets())
+
+	assert.NoError(os.MkdirAll(tt.statePath, 0700))
+	assert.NoError(ioutil.WriteFile(tt.statePath+"/memory", nil, 0600))
+	assert.NoError(ioutil.WriteFile(tt.statePath+"/state", nil, 0600))
+	saved := time.Now().Add(-time.Hour)
+	assert.NoError(os.Chtimes(tt.statePath+"/state", saved, saved))
+	assert.NoError(os.Chtimes(kernel, saved, saved))
+	assert.NoError(os.Chtimes(initrd, saved, saved))
+	assert.Empty(tt.staleAssets())
+
+	_, err = Fetch(tt.config, tt.statePath)
+	assert.NoError(err)
+
+	// An asset updated after the template VM was saved is stale, as is a
+	// removed one.
+	assert.NoError(os.Chtimes(kernel, time.Now(), time.Now()))
+	assert.Equal([]string{"kernel"}, tt.staleAssets())
+
+	assert.NoError(os.Remove(initrd))
+	assert.Equal([]string{"kernel", "initrd"}, tt.staleAssets())
+
+	_, err = Fetch(tt.config, tt.statePath)
+	assert.Error(err)
+}
+
+func TestTemplatePaths(t *testing.T) {
+	assert := assert.New(t)
+
+	testDir, err := ioutil.TempDir("", "template-paths-")
+	assert.NoError(err)
+	defer os.RemoveAll(testDir)
+
+	config1 := vc.VMConfig{
+		HypervisorConfig: vc.HypervisorConfig{
+			KernelPath: "/kernel1",
+			ImagePath:  "/image",
+		},
+	}
+	config2 := config1
+	config2.HypervisorConfig.KernelPath = "/kernel2"
+
+	// Templates of different assets are side by side, the ones of the
+	// same assets share a path.
+	path1 := Path(testDir, config1)
+	path2 := Path(testDir, config2)
+	assert.Equal(testDir, filepath.Dir(path1))
+	assert.Equal(testDir, filepath.Dir(path2))
+	assert.NotEqual(path1, path2)
+
+	config1.HypervisorConfig.MemorySize = 1024
+	assert.Equal(path1, Path(testDir, config1))
+
+	assert.Empty(List(testDir))
+
+	for _, path := range []string{testDir, path1, path2} {
+		assert.NoError(os.MkdirAll(path, 0700))
+		assert.NoError(ioutil.WriteFile(path+"/memory", nil, 0600))
+	}
+	assert.NoError(ioutil.WriteFile(path1+"/state", nil, 0600))
+	assert.Equal([]string{path1}, List(testDir))
+
+	assert.NoError(ioutil.WriteFile(testDir+"/state", nil, 0600))
+	assert.NoError(ioutil.WriteFile(path2+"/state", nil, 0600))
+	templates := List(testDir)
+	assert.Len(templates, 3)
+	assert.Equal(testDir, templates[0])
+	assert.Contains(templates, path1)
+	assert.Contains(templates, path2)
+
+	// No VM was created from the templates.
+	stats, err := CloneStats(path1, []int{os.Getpid()})
+	assert.NoError(err)
+	assert.Empty(stats)
+
+	Destroy(path1)
+	_, err = os.Stat(path1)
+	assert.True(os.IsNotExist(err))
+	assert.Equal([]string{testDir, path2}, List(testDir))
+}
+
+func TestLockTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "template-lock")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "template")
+
+	// VMs are created from the template concurrently.
+	unlockShared, err := lockTemplate(path, false)
+	assert.NoError(err)
+	unlock, err := lockTemplate(path, false)
+	assert.NoError(err)
+	unlock()
+
+	// The template is not removed while VMs are created from it.
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := lockTemplate(path, true)
+		assert.NoError(err)
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		assert.Fail("template locked exclusively while shared")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockShared()
+	<-locked
+}
@@ -1165,6 +1165,14 @@ func (fc *firecracker) check() error {
 	return nil
 }
 
+func (fc *firecracker) saveDiagnostics(dir string, guestMemory bool) error {
+	if guestMemory {
+		return errGuestMemoryDumpUnsupported
+	}
+
+	return nil
+}
+
 func (fc *firecracker) generateSocket(id string, useVsock bool) (interface{}, error) {
 	if !useVsock {
 		return nil, fmt.Errorf("Can't start firecracker: vsocks is disabled")
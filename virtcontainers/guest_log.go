@@ -0,0 +1,102 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Sources the lines of a guest log are tagged with.
+const (
+	guestLogKernel  = "kernel"
+	guestLogAgent   = "agent"
+	guestLogSystemd = "systemd"
+	guestLogConsole = "console"
+)
+
+// kernelLogLine matches the printk timestamp of the kernel messages.
+var kernelLogLine = regexp.MustCompile(`^\[\s*\d+\.\d+\]`)
+
+// guestLog collects the guest console of a sandbox into a bounded log.
+type guestLog struct {
+	*boundedLog
+
+	sandboxID string
+}
+
+// GuestLogPath returns the path of the guest log of sandboxID in dir.
+func GuestLogPath(dir, sandboxID string) string {
+	return filepath.Join(dir, sandboxID+".log")
+}
+
+// openGuestLog opens the guest log of sandboxID for appending, a sandbox
+// restarted on the same ID continuing its previous log.
+func openGuestLog(dir, sandboxID string, maxSize int64) (*guestLog, error) {
+	if err := os.MkdirAll(dir, DirMode); err != nil {
+		return nil, err
+	}
+
+	l, err := openBoundedLog(GuestLogPath(dir, sandboxID), maxSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return &guestLog{
+		boundedLog: l,
+		sandboxID:  sandboxID,
+	}, nil
+}
+
+// write appends a console line to the log, tagged with the sandbox ID and
+// the source of the line.
+func (l *guestLog) write(line string) error {
+	entry := fmt.Sprintf("%s sandbox=%s source=%s %s\n",
+		time.Now().UTC().Format(time.RFC3339Nano), l.sandboxID, guestLogSource(line), line)
+
+	_, err := l.Write([]byte(entry))
+	return err
+}
+
+func (l *guestLog) close() error {
+	return l.Close()
+}
+
+// guestLogSource tells which guest component a console line comes from.
+// systemd messages are checked before the kernel ones, systemd logging to
+// the kernel ring buffer before the journal is up.
+func guestLogSource(line string) string {
+	switch {
+	case strings.Contains(line, "name=kata-agent"), strings.Contains(line, `"name":"kata-agent"`):
+		return guestLogAgent
+	case strings.Contains(line, "systemd["), strings.HasPrefix(line, "[  OK  ]"), strings.HasPrefix(line, "[FAILED]"):
+		return guestLogSystemd
+	case kernelLogLine.MatchString(line):
+		return guestLogKernel
+	default:
+		return guestLogConsole
+	}
+}
+
+// ReadGuestLog copies the guest log of sandboxID in dir to w, oldest lines
+// first. The log outlives the sandbox.
+func ReadGuestLog(dir, sandboxID string, w io.Writer) error {
+	found, err := readBoundedLog(GuestLogPath(dir, sandboxID), w)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("no guest log for sandbox %s in %s", sandboxID, dir)
+	}
+
+	return nil
+}
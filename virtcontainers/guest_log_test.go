@@ -0,0 +1,137 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuestLogSource(t *testing.T) {
+	assert := assert.New(t)
+
+	for line, source := range map[string]string{
+		"[    0.000000] Linux version 5.4.32":                                            guestLogKernel,
+		"[    1.234567] systemd[1]: Started Kata Containers Agent.":                      guestLogSystemd,
+		"[  OK  ] Reached target Basic System.":                                          guestLogSystemd,
+		`time="2020-04-01T10:00:00Z" level=info msg="announce" name=kata-agent pid=1`:    guestLogAgent,
+		`{"level":"info","msg":"announce","name":"kata-agent","pid":1,"source":"agent"}`: guestLogAgent,
+		"bash-4.4#": guestLogConsole,
+		"":          guestLogConsole,
+	} {
+		assert.Equal(source, guestLogSource(line), line)
+	}
+}
+
+func TestGuestLog(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guest-log")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var out bytes.Buffer
+	assert.Error(ReadGuestLog(dir, testSandboxID, &out))
+
+	l, err := openGuestLog(dir, testSandboxID, 128)
+	assert.NoError(err)
+
+	assert.NoError(l.write("[    0.000000] Linux version 5.4.32"))
+
+	data, err := ioutil.ReadFile(GuestLogPath(dir, testSandboxID))
+	assert.NoError(err)
+	assert.Contains(string(data), "sandbox="+testSandboxID+" source=kernel [    0.000000] Linux version 5.4.32\n")
+
+	// The log is rotated once it would exceed its maximum size, the
+	// previously rotated log being dropped.
+	for _, line := range []string{"first", "second", "third"} {
+		assert.NoError(l.write(strings.Repeat("x", 40) + line))
+	}
+
+	rotated, err := ioutil.ReadFile(GuestLogPath(dir, testSandboxID) + boundedLogRotated)
+	assert.NoError(err)
+	assert.Contains(string(rotated), "second")
+	assert.NotContains(string(rotated), "Linux version")
+
+	current, err := ioutil.ReadFile(GuestLogPath(dir, testSandboxID))
+	assert.NoError(err)
+	assert.Contains(string(current), "third")
+
+	assert.NoError(l.close())
+	assert.Error(l.write("closed"))
+
+	// The log is retrievable after the sandbox is gone, oldest lines
+	// first.
+	assert.NoError(ReadGuestLog(dir, testSandboxID, &out))
+	assert.Equal(string(rotated)+string(current), out.String())
+}
+
+func TestProxyBuiltinGuestLog(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "guest-log")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	console := filepath.Join(dir, "console.sock")
+	l, err := net.Listen("unix", console)
+	assert.NoError(err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("[    0.000000] Linux version 5.4.32\nbash-4.4#\n"))
+	}()
+
+	savedProto := buildinProxyConsoleProto
+	buildinProxyConsoleProto = consoleProtoUnix
+	defer func() {
+		buildinProxyConsoleProto = savedProto
+	}()
+
+	p := proxyBuiltin{}
+	_, _, err = p.start(proxyParams{
+		id:              testSandboxID,
+		consoleURL:      console,
+		logger:          logrus.WithField("proxy", testSandboxID),
+		guestLogDir:     filepath.Join(dir, "logs"),
+		guestLogMaxSize: 1,
+	})
+	assert.NoError(err)
+	assert.True(p.consoleWatched())
+
+	path := GuestLogPath(filepath.Join(dir, "logs"), testSandboxID)
+	var data []byte
+	for i := 0; i < 500; i++ {
+		data, _ = ioutil.ReadFile(path)
+		if strings.Contains(string(data), "source=console bash-4.4#") {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Contains(string(data), "source=kernel [    0.000000] Linux version 5.4.32\n")
+	assert.Contains(string(data), "source=console bash-4.4#\n")
+
+	assert.NoError(p.stop(0))
+	assert.False(p.consoleWatched())
+
+	// The log is kept once the proxy is stopped.
+	_, err = os.Stat(path)
+	assert.NoError(err)
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
+)
+
+// HealthAction is an action the monitor takes once a check of the sandbox
+// failed too many times in a row.
+type HealthAction string
+
+const (
+	// HealthActionReconnect reconnects to the agent. It only applies to
+	// the agent check, the following actions being taken only if the
+	// agent cannot be reached again.
+	HealthActionReconnect HealthAction = "reconnect"
+
+	// HealthActionDump dumps diagnostics of the sandbox, capturing a
+	// diagnostics bundle if enabled.
+	HealthActionDump HealthAction = "dump"
+
+	// HealthActionKill reports the sandbox as failed to the watchers of
+	// the monitor, which tear it down, after capturing a diagnostics
+	// bundle if enabled and not done yet.
+	HealthActionKill HealthAction = "kill"
+)
+
+// Checks of the sandbox run by the monitor.
+const (
+	HealthCheckHypervisor = "hypervisor"
+	HealthCheckAgent      = "agent"
+	HealthCheckVirtiofs   = "virtiofs"
+	HealthCheckMemory     = "memory"
+)
+
+// HealthDecision is a decision of the monitor on the result of a check.
+type HealthDecision string
+
+const (
+	// HealthDecisionTolerate ignores a failure below the threshold.
+	HealthDecisionTolerate HealthDecision = "tolerate"
+
+	// HealthDecisionRecovered reports a check passing again.
+	HealthDecisionRecovered HealthDecision = "recovered"
+
+	// HealthDecisionReconnected reports the agent reachable again.
+	HealthDecisionReconnected HealthDecision = "reconnected"
+
+	// HealthDecisionReconnectFailed reports the agent still unreachable.
+	HealthDecisionReconnectFailed HealthDecision = "reconnect-failed"
+
+	// HealthDecisionDump reports diagnostics being dumped.
+	HealthDecisionDump HealthDecision = "dump"
+
+	// HealthDecisionKill reports the sandbox being killed.
+	HealthDecisionKill HealthDecision = "kill"
+
+	// HealthDecisionMemoryPressure reports the guest memory use crossing
+	// the memory pressure threshold.
+	HealthDecisionMemoryPressure HealthDecision = "memory-pressure"
+)
+
+// HealthPolicy configures how the monitor reacts to failed checks.
+type HealthPolicy struct {
+	// FailureThreshold is the number of consecutive failures of a check
+	// after which the actions are taken, 0 meaning 1.
+	FailureThreshold uint32
+
+	// AgentReconnectAttempts is the number of reconnections to the agent
+	// tried by the reconnect action, 0 meaning 1.
+	AgentReconnectAttempts uint32
+
+	// MemoryPressureThreshold is the percentage of the guest memory used
+	// by the containers above which a memory pressure event is published,
+	// 0 disabling the check.
+	MemoryPressureThreshold uint32
+
+	// Actions are the actions taken in order once the failure threshold
+	// is reached, the sandbox being killed if empty.
+	Actions []HealthAction
+}
+
+// Valid checks the actions of the policy are known.
+func (p HealthPolicy) Valid() error {
+	for _, a := range p.Actions {
+		switch a {
+		case HealthActionReconnect, HealthActionDump, HealthActionKill:
+		default:
+			return fmt.Errorf("unknown health action %q", a)
+		}
+	}
+
+	if p.MemoryPressureThreshold > 100 {
+		return fmt.Errorf("invalid memory pressure threshold %d%%", p.MemoryPressureThreshold)
+	}
+
+	return nil
+}
+
+func (p HealthPolicy) failureThreshold() uint32 {
+	if p.FailureThreshold == 0 {
+		return 1
+	}
+	return p.FailureThreshold
+}
+
+func (p HealthPolicy) agentReconnectAttempts() uint32 {
+	if p.AgentReconnectAttempts == 0 {
+		return 1
+	}
+	return p.AgentReconnectAttempts
+}
+
+func (p HealthPolicy) actions() []HealthAction {
+	if len(p.Actions) == 0 {
+		return []HealthAction{HealthActionKill}
+	}
+	return p.Actions
+}
+
+// HealthEvent is a decision of the monitor on a check of the sandbox.
+type HealthEvent struct {
+	Time     time.Time
+	Check    string
+	Decision HealthDecision
+
+	// Failures is the number of consecutive failures of the check.
+	Failures uint32
+
+	// Error is the failure of the check, if any.
+	Error string `json:",omitempty"`
+}
+
+func (e HealthEvent) logFields() logrus.Fields {
+	fields := logrus.Fields{
+		"check":    e.Check,
+		"decision": e.Decision,
+		"failures": e.Failures,
+	}
+
+	if e.Error != "" {
+		fields["error"] = e.Error
+	}
+
+	return fields
+}
+
+// guestMemoryUse returns the percentage of the guest memory used by the
+// containers of the sandbox.
+func (s *Sandbox) guestMemoryUse() (uint32, error) {
+	memory := uint64(s.hypervisor.hypervisorConfig().MemorySize) << utils.MibToBytesShift
+
+	var used uint64
+	for _, c := range s.runningContainers() {
+		if m := c.config.Resources.Memory; m != nil && m.Limit != nil && *m.Limit > 0 {
+			memory += uint64(*m.Limit)
+		}
+
+		stats, err := s.agent.statsContainer(s.ctx, s, c)
+		if err != nil {
+			return 0, err
+		}
+
+		if stats.CgroupStats != nil {
+			used += stats.CgroupStats.MemoryStats.Usage.Usage
+		}
+	}
+
+	if memory == 0 {
+		return 0, nil
+	}
+
+	return uint32(used * 100 / memory), nil
+}
+
+// runningContainers returns a copy of the running containers of the
+// sandbox. It is safe to call concurrently with containers being added,
+// removed or changing state.
+func (s *Sandbox) runningContainers() []Container {
+	s.containersLock.RLock()
+	defer s.containersLock.RUnlock()
+
+	var containers []Container
+	for _, c := range s.containers {
+		if c.state.State == types.StateRunning {
+			containers = append(containers, *c)
+		}
+	}
+
+	return containers
+}
+
+// dumpDiagnostics logs the state of a sandbox failing check, and captures
+// a diagnostics bundle if enabled.
+func (s *Sandbox) dumpDiagnostics(check string, failure error) {
+	s.containersLock.RLock()
+	containers := make(map[string]types.StateString)
+	for id, c := range s.containers {
+		containers[id] = c.state.State
+	}
+	s.containersLock.RUnlock()
+
+	s.Logger().WithError(failure).WithFields(logrus.Fields{
+		"check":           check,
+		"state":           s.state.State,
+		"hypervisor-pids": s.hypervisor.getPids(),
+		"virtiofs-pids":   s.virtiofsVolumePids(),
+		"containers":      containers,
+	}).Error("sandbox health diagnostics")
+
+	s.captureDiagnostics(check, failure)
+}
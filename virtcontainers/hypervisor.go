@@ -20,6 +20,7 @@ import (
 	persistapi "github.com/kata-containers/runtime/virtcontainers/persist/api"
 	"github.com/kata-containers/runtime/virtcontainers/types"
 	"github.com/kata-containers/runtime/virtcontainers/utils"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 )
 
 // HypervisorType describes an hypervisor type.
@@ -318,6 +319,11 @@ type HypervisorConfig struct {
 	// VirtioFSCache cache mode for fs version cache or "none"
 	VirtioFSCache string
 
+	// VirtioFSVolumeCache is the cache mode of the dedicated virtiofsd
+	// started for each shared volume. Volumes share the sandbox
+	// virtiofsd when it is empty.
+	VirtioFSVolumeCache string
+
 	// VirtioFSExtraArgs passes options to virtiofsd daemon
 	VirtioFSExtraArgs []string
 
@@ -358,6 +364,10 @@ type HypervisorConfig struct {
 	// HugePages specifies if the memory should be pre-allocated from huge pages
 	HugePages bool
 
+	// EnableNUMA mirrors the host NUMA nodes the sandbox runs on into the
+	// guest, binding each guest node memory and vCPUs to its host node.
+	EnableNUMA bool
+
 	// VirtioMem is used to enable/disable virtio-mem
 	VirtioMem bool
 
@@ -415,11 +425,18 @@ type HypervisorConfig struct {
 
 	// SELinux label for the VM
 	SELinuxProcessLabel string
+
+	// SandboxCPUSet is the cpuset of the sandbox containers, the host NUMA
+	// nodes of which are mirrored into the guest when EnableNUMA is set.
+	SandboxCPUSet string
 }
 
 // vcpu mapping from vcpu number to thread number
 type vcpuThreadIDs struct {
 	vcpus map[int]int
+	// affinity maps a vcpu number to the host CPUs its thread should
+	// be pinned to, if any.
+	affinity map[int]cpuset.CPUSet
 }
 
 func (conf *HypervisorConfig) checkTemplateConfig() error {
@@ -607,6 +624,31 @@ func (conf *HypervisorConfig) CustomFirmwareAsset() bool {
 	return conf.isCustomAsset(types.FirmwareAsset)
 }
 
+// ResolveAssets sets the asset paths of the config to its custom assets,
+// and drops them, for the config to be compared with other ones.
+func (conf *HypervisorConfig) ResolveAssets() {
+	for t, a := range conf.customAssets {
+		switch t {
+		case types.KernelAsset:
+			conf.KernelPath = a.Path()
+		case types.ImageAsset:
+			conf.ImagePath = a.Path()
+		case types.InitrdAsset:
+			conf.InitrdPath = a.Path()
+		case types.HypervisorAsset:
+			conf.HypervisorPath = a.Path()
+		case types.HypervisorCtlAsset:
+			conf.HypervisorCtlPath = a.Path()
+		case types.JailerAsset:
+			conf.JailerPath = a.Path()
+		case types.FirmwareAsset:
+			conf.FirmwarePath = a.Path()
+		}
+	}
+
+	conf.customAssets = nil
+}
+
 func appendParam(params []Param, parameter string, value string) []Param {
 	return append(params, Param{parameter, value})
 }
@@ -652,6 +694,18 @@ func DeserializeParams(parameters []string) []Param {
 	return params
 }
 
+// MaxMemoryMB returns the maximum memory in MiB a VM can be given: the
+// memory of the host, which the hypervisors set the maximum memory of their
+// VMs to.
+func MaxMemoryMB() (uint32, error) {
+	hostMemKb, err := getHostMemorySizeKb(procMemInfo)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to read memory info: %s", err)
+	}
+
+	return uint32(hostMemKb >> 10), nil
+}
+
 func getHostMemorySizeKb(memInfoPath string) (uint64, error) {
 	f, err := os.Open(memInfoPath)
 	if err != nil {
@@ -794,6 +848,11 @@ type hypervisor interface {
 	toGrpc() ([]byte, error)
 	check() error
 
+	// saveDiagnostics writes the hypervisor specific diagnostics of the
+	// sandbox to dir, with a dump of the guest memory if guestMemory is
+	// set.
+	saveDiagnostics(dir string, guestMemory bool) error
+
 	save() persistapi.HypervisorState
 	load(persistapi.HypervisorState)
 
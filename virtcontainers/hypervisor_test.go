@@ -13,6 +13,7 @@ import (
 	"testing"
 
 	ktu "github.com/kata-containers/runtime/pkg/katatestutils"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
 	"github.com/kata-containers/runtime/virtcontainers/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -456,3 +457,24 @@ func TestGenerateVMSocket(t *testing.T) {
 	assert.NotZero(vsock.ContextID)
 	assert.NotZero(vsock.Port)
 }
+
+func TestHypervisorConfigResolveAssets(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &HypervisorConfig{
+		KernelPath: "/usr/share/kata-containers/vmlinuz",
+		ImagePath:  "/usr/share/kata-containers/kata-containers.img",
+	}
+
+	kernel, err := types.NewAsset(map[string]string{
+		annotations.KernelPath: "/opt/kata/vmlinuz-debug",
+	}, types.KernelAsset)
+	assert.NoError(err)
+	assert.NoError(conf.addCustomAsset(kernel))
+	assert.True(conf.CustomKernelAsset())
+
+	conf.ResolveAssets()
+	assert.False(conf.CustomKernelAsset())
+	assert.Equal("/opt/kata/vmlinuz-debug", conf.KernelPath)
+	assert.Equal("/usr/share/kata-containers/kata-containers.img", conf.ImagePath)
+}
@@ -11,6 +11,7 @@ package virtcontainers
 
 import (
 	"context"
+	"net"
 	"syscall"
 
 	"github.com/kata-containers/runtime/virtcontainers/device/api"
@@ -178,3 +179,13 @@ func (impl *VCImpl) ListRoutes(ctx context.Context, sandboxID string) ([]*vcType
 func (impl *VCImpl) CleanupContainer(ctx context.Context, sandboxID, containerID string, force bool) error {
 	return CleanupContainer(ctx, sandboxID, containerID, force)
 }
+
+// DialDebugConsole implements the VC function of the same name.
+func (impl *VCImpl) DialDebugConsole(ctx context.Context, sandboxID string) (net.Conn, error) {
+	return DialDebugConsole(ctx, sandboxID)
+}
+
+// CollectDiagnostics implements the VC function of the same name.
+func (impl *VCImpl) CollectDiagnostics(ctx context.Context, sandboxID string, config DiagnosticsConfig) (string, error) {
+	return CollectDiagnostics(ctx, sandboxID, config)
+}
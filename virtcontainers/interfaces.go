@@ -8,6 +8,7 @@ package virtcontainers
 import (
 	"context"
 	"io"
+	"net"
 	"syscall"
 
 	"github.com/kata-containers/runtime/virtcontainers/device/api"
@@ -55,6 +56,10 @@ type VC interface {
 	ListRoutes(ctx context.Context, sandboxID string) ([]*vcTypes.Route, error)
 
 	CleanupContainer(ctx context.Context, sandboxID, containerID string, force bool) error
+
+	DialDebugConsole(ctx context.Context, sandboxID string) (net.Conn, error)
+
+	CollectDiagnostics(ctx context.Context, sandboxID string, config DiagnosticsConfig) (string, error)
 }
 
 // VCSandbox is the Sandbox interface
@@ -68,38 +73,42 @@ type VCSandbox interface {
 	ID() string
 	SetAnnotations(annotations map[string]string) error
 
-	Start() error
-	Stop(force bool) error
+	Start(ctx context.Context) error
+	Stop(ctx context.Context, force bool) error
 	Release() error
 	Monitor() (chan error, error)
-	Delete() error
+	HealthEvents() (chan HealthEvent, error)
+	Delete(ctx context.Context) error
 	Status() SandboxStatus
-	CreateContainer(contConfig ContainerConfig) (VCContainer, error)
-	DeleteContainer(contID string) (VCContainer, error)
-	StartContainer(containerID string) (VCContainer, error)
-	StopContainer(containerID string, force bool) (VCContainer, error)
-	KillContainer(containerID string, signal syscall.Signal, all bool) error
+	Stats() (SandboxStats, error)
+	ResizeVM(ctx context.Context, extraVCPUs, extraMemMB uint32) error
+	CreateContainer(ctx context.Context, contConfig ContainerConfig) (VCContainer, error)
+	DeleteContainer(ctx context.Context, contID string) (VCContainer, error)
+	StartContainer(ctx context.Context, containerID string) (VCContainer, error)
+	StopContainer(ctx context.Context, containerID string, force bool) (VCContainer, error)
+	KillContainer(ctx context.Context, containerID string, signal syscall.Signal, all bool) error
 	StatusContainer(containerID string) (ContainerStatus, error)
-	StatsContainer(containerID string) (ContainerStats, error)
-	PauseContainer(containerID string) error
-	ResumeContainer(containerID string) error
-	EnterContainer(containerID string, cmd types.Cmd) (VCContainer, *Process, error)
-	UpdateContainer(containerID string, resources specs.LinuxResources) error
-	ProcessListContainer(containerID string, options ProcessListOptions) (ProcessList, error)
-	WaitProcess(containerID, processID string) (int32, error)
-	SignalProcess(containerID, processID string, signal syscall.Signal, all bool) error
-	WinsizeProcess(containerID, processID string, height, width uint32) error
+	StatsContainer(ctx context.Context, containerID string) (ContainerStats, error)
+	PauseContainer(ctx context.Context, containerID string) error
+	ResumeContainer(ctx context.Context, containerID string) error
+	EnterContainer(ctx context.Context, containerID string, cmd types.Cmd) (VCContainer, *Process, error)
+	UpdateContainer(ctx context.Context, containerID string, resources specs.LinuxResources) error
+	ProcessListContainer(ctx context.Context, containerID string, options ProcessListOptions) (ProcessList, error)
+	ProcessGuestPid(ctx context.Context, containerID, processID string) (uint32, error)
+	WaitProcess(ctx context.Context, containerID, processID string) (int32, error)
+	SignalProcess(ctx context.Context, containerID, processID string, signal syscall.Signal, all bool) error
+	WinsizeProcess(ctx context.Context, containerID, processID string, height, width uint32) error
 	IOStream(containerID, processID string) (io.WriteCloser, io.Reader, io.Reader, error)
 
 	AddDevice(info config.DeviceInfo) (api.Device, error)
 
-	AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error)
-	RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error)
-	ListInterfaces() ([]*vcTypes.Interface, error)
-	UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error)
-	ListRoutes() ([]*vcTypes.Route, error)
+	AddInterface(ctx context.Context, inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	RemoveInterface(ctx context.Context, inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	ListInterfaces(ctx context.Context) ([]*vcTypes.Interface, error)
+	UpdateRoutes(ctx context.Context, routes []*vcTypes.Route) ([]*vcTypes.Route, error)
+	ListRoutes(ctx context.Context) ([]*vcTypes.Route, error)
 
-	GetOOMEvent() (string, error)
+	GetOOMEvent(ctx context.Context) (string, error)
 }
 
 // VCContainer is the Container interface
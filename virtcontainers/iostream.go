@@ -58,7 +58,7 @@ func (s *stdinStream) Write(data []byte) (n int, err error) {
 		return 0, errors.New("stream closed")
 	}
 
-	return s.sandbox.agent.writeProcessStdin(s.container, s.process, data)
+	return s.sandbox.agent.writeProcessStdin(s.sandbox.ctx, s.container, s.process, data)
 }
 
 func (s *stdinStream) Close() error {
@@ -66,7 +66,7 @@ func (s *stdinStream) Close() error {
 		return errors.New("stream closed")
 	}
 
-	err := s.sandbox.agent.closeProcessStdin(s.container, s.process)
+	err := s.sandbox.agent.closeProcessStdin(s.sandbox.ctx, s.container, s.process)
 	if err == nil {
 		s.closed = true
 	}
@@ -79,7 +79,7 @@ func (s *stdoutStream) Read(data []byte) (n int, err error) {
 		return 0, errors.New("stream closed")
 	}
 
-	return s.sandbox.agent.readProcessStdout(s.container, s.process, data)
+	return s.sandbox.agent.readProcessStdout(s.sandbox.ctx, s.container, s.process, data)
 }
 
 func (s *stderrStream) Read(data []byte) (n int, err error) {
@@ -87,5 +87,5 @@ func (s *stderrStream) Read(data []byte) (n int, err error) {
 		return 0, errors.New("stream closed")
 	}
 
-	return s.sandbox.agent.readProcessStderr(s.container, s.process, data)
+	return s.sandbox.agent.readProcessStderr(s.sandbox.ctx, s.container, s.process, data)
 }
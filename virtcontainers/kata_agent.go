@@ -10,6 +10,8 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -33,6 +35,7 @@ import (
 	"github.com/kata-containers/runtime/virtcontainers/pkg/uuid"
 	"github.com/kata-containers/runtime/virtcontainers/store"
 	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/mdlayher/vsock"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/sirupsen/logrus"
@@ -56,11 +59,72 @@ const (
 	vfioPath = "/dev/vfio/"
 
 	agentPidEnv = "KATA_AGENT_PIDNS"
+
+	// kataGuestPidFeature is advertised by the agents answering a
+	// process list request in kataGuestPidFormat with the guest pid of
+	// the process given as only argument, as a build metadata identifier
+	// of the version in their guest details, e.g. "1.12.0+pid-v1".
+	kataGuestPidFeature = "pid-v1"
+	kataGuestPidFormat  = "pid"
+
+	// kataDebugConsolePort is the vsock port the agent serves its debug
+	// console on, when enabled.
+	kataDebugConsolePort = 1026
+)
+
+// Classes of the requests to the agent.
+const (
+	agentRequestCheck   = "check"
+	agentRequestQuery   = "query"
+	agentRequestWait    = "wait"
+	agentRequestDefault = "request"
 )
 
+// AgentRequestTimeouts are the timeouts of the requests to the agent by
+// class, a zero timeout selecting the default timeout of the class.
+type AgentRequestTimeouts struct {
+	// Check bounds the liveness checks of the agent.
+	Check time.Duration
+
+	// Request bounds the requests changing the sandbox, its containers
+	// and their processes.
+	Request time.Duration
+
+	// Query bounds the requests reading the state of the sandbox, its
+	// containers and their processes.
+	Query time.Duration
+
+	// Wait bounds the requests waiting for a process to exit or for an
+	// OOM event, which do not time out by default.
+	Wait time.Duration
+}
+
+func (t AgentRequestTimeouts) timeout(class string) time.Duration {
+	switch class {
+	case agentRequestCheck:
+		if t.Check != 0 {
+			return t.Check
+		}
+		return checkRequestTimeout
+	case agentRequestQuery:
+		if t.Query != 0 {
+			return t.Query
+		}
+		return defaultRequestTimeout
+	case agentRequestWait:
+		return t.Wait
+	default:
+		if t.Request != 0 {
+			return t.Request
+		}
+		return defaultRequestTimeout
+	}
+}
+
 var (
 	checkRequestTimeout         = 30 * time.Second
 	defaultRequestTimeout       = 60 * time.Second
+	agentRequestRetryDelay      = 500 * time.Millisecond
 	errorMissingProxy           = errors.New("Missing proxy pointer")
 	errorMissingOCISpec         = errors.New("Missing OCI specification")
 	defaultKataHostSharedDir    = "/run/kata-containers/shared/sandboxes/"
@@ -77,6 +141,7 @@ var (
 	kataSCSIDevType             = "scsi"
 	kataNvdimmDevType           = "nvdimm"
 	kataVirtioFSDevType         = "virtio-fs"
+	kataOverlayDevType          = "overlayfs"
 	sharedDir9pOptions          = []string{"trans=virtio,version=9p2000.L,cache=mmap", "nodev"}
 	sharedDirVirtioFSOptions    = []string{}
 	sharedDirVirtioFSDaxOptions = "dax"
@@ -202,6 +267,17 @@ type KataAgentConfig struct {
 	TraceMode         string
 	TraceType         string
 	KernelModules     []string
+
+	// DebugConsoleEnabled makes the agent serve a shell over vsock, to
+	// debug the guest through DialDebugConsole.
+	DebugConsoleEnabled bool
+
+	// RequestTimeouts bound the requests to the agent by class.
+	RequestTimeouts AgentRequestTimeouts
+
+	// RequestRetries is the number of times an idempotent request which
+	// timed out or did not reach the agent is sent again.
+	RequestRetries uint32
 }
 
 // KataAgentState is the structure describing the data stored from this
@@ -209,6 +285,8 @@ type KataAgentConfig struct {
 type KataAgentState struct {
 	ProxyPid int
 	URL      string
+	// GuestPid is set when the agent advertised kataGuestPidFeature
+	GuestPid bool
 }
 
 type kataAgent struct {
@@ -227,6 +305,9 @@ type kataAgent struct {
 	dead           bool
 	kmodules       []string
 
+	reqTimeouts AgentRequestTimeouts
+	reqRetries  uint32
+
 	vmSocket interface{}
 	ctx      context.Context
 }
@@ -299,6 +380,11 @@ func KataAgentKernelParams(config KataAgentConfig) []Param {
 		params = append(params, Param{Key: vcAnnotations.ContainerPipeSizeKernelParam, Value: containerPipeSize})
 	}
 
+	if config.DebugConsoleEnabled {
+		params = append(params, Param{Key: "agent.debug_console", Value: ""})
+		params = append(params, Param{Key: "agent.debug_console_vport", Value: strconv.Itoa(kataDebugConsolePort)})
+	}
+
 	return params
 }
 
@@ -387,6 +473,8 @@ func (k *kataAgent) internalConfigure(h hypervisor, id string, builtin bool, con
 				return err
 			}
 			k.keepConn = c.LongLiveConn
+			k.reqTimeouts = c.RequestTimeouts
+			k.reqRetries = c.RequestRetries
 		default:
 			return vcTypes.ErrInvalidConfigType
 		}
@@ -468,7 +556,7 @@ func (k *kataAgent) setupSharedPath(sandbox *Sandbox) error {
 	return nil
 }
 
-func (k *kataAgent) createSandbox(sandbox *Sandbox) error {
+func (k *kataAgent) createSandbox(ctx context.Context, sandbox *Sandbox) error {
 	span, _ := k.trace("createSandbox")
 	defer span.Finish()
 
@@ -555,7 +643,7 @@ func cmdEnvsToStringSlice(ev []types.EnvVar) []string {
 	return env
 }
 
-func (k *kataAgent) exec(sandbox *Sandbox, c Container, cmd types.Cmd) (*Process, error) {
+func (k *kataAgent) exec(ctx context.Context, sandbox *Sandbox, c Container, cmd types.Cmd) (*Process, error) {
 	span, _ := k.trace("exec")
 	defer span.Finish()
 
@@ -572,7 +660,7 @@ func (k *kataAgent) exec(sandbox *Sandbox, c Container, cmd types.Cmd) (*Process
 		Process:     kataProcess,
 	}
 
-	if _, err := k.sendReq(req); err != nil {
+	if _, err := k.sendReq(ctx, req); err != nil {
 		return nil, err
 	}
 
@@ -591,12 +679,12 @@ func (k *kataAgent) exec(sandbox *Sandbox, c Container, cmd types.Cmd) (*Process
 		k.state.URL, "", cmd, []ns.NSType{}, enterNSList)
 }
 
-func (k *kataAgent) updateInterface(ifc *vcTypes.Interface) (*vcTypes.Interface, error) {
+func (k *kataAgent) updateInterface(ctx context.Context, ifc *vcTypes.Interface) (*vcTypes.Interface, error) {
 	// send update interface request
 	ifcReq := &grpc.UpdateInterfaceRequest{
 		Interface: k.convertToKataAgentInterface(ifc),
 	}
-	resultingInterface, err := k.sendReq(ifcReq)
+	resultingInterface, err := k.sendReq(ctx, ifcReq)
 	if err != nil {
 		k.Logger().WithFields(logrus.Fields{
 			"interface-requested": fmt.Sprintf("%+v", ifc),
@@ -609,23 +697,23 @@ func (k *kataAgent) updateInterface(ifc *vcTypes.Interface) (*vcTypes.Interface,
 	return nil, err
 }
 
-func (k *kataAgent) updateInterfaces(interfaces []*vcTypes.Interface) error {
+func (k *kataAgent) updateInterfaces(ctx context.Context, interfaces []*vcTypes.Interface) error {
 	for _, ifc := range interfaces {
-		if _, err := k.updateInterface(ifc); err != nil {
+		if _, err := k.updateInterface(ctx, ifc); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (k *kataAgent) updateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+func (k *kataAgent) updateRoutes(ctx context.Context, routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
 	if routes != nil {
 		routesReq := &grpc.UpdateRoutesRequest{
 			Routes: &grpc.Routes{
 				Routes: k.convertToKataAgentRoutes(routes),
 			},
 		}
-		resultingRoutes, err := k.sendReq(routesReq)
+		resultingRoutes, err := k.sendReq(ctx, routesReq)
 		if err != nil {
 			k.Logger().WithFields(logrus.Fields{
 				"routes-requested": fmt.Sprintf("%+v", routes),
@@ -641,14 +729,14 @@ func (k *kataAgent) updateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, err
 	return nil, nil
 }
 
-func (k *kataAgent) addARPNeighbors(neighs []*vcTypes.ARPNeighbor) error {
+func (k *kataAgent) addARPNeighbors(ctx context.Context, neighs []*vcTypes.ARPNeighbor) error {
 	if neighs != nil {
 		neighsReq := &grpc.AddARPNeighborsRequest{
 			Neighbors: &grpc.ARPNeighbors{
 				ARPNeighbors: k.convertToKataAgentNeighbors(neighs),
 			},
 		}
-		_, err := k.sendReq(neighsReq)
+		_, err := k.sendReq(ctx, neighsReq)
 		if err != nil {
 			if grpcStatus.Convert(err).Code() == codes.Unimplemented {
 				k.Logger().WithFields(logrus.Fields{
@@ -665,9 +753,9 @@ func (k *kataAgent) addARPNeighbors(neighs []*vcTypes.ARPNeighbor) error {
 	return nil
 }
 
-func (k *kataAgent) listInterfaces() ([]*vcTypes.Interface, error) {
+func (k *kataAgent) listInterfaces(ctx context.Context) ([]*vcTypes.Interface, error) {
 	req := &grpc.ListInterfacesRequest{}
-	resultingInterfaces, err := k.sendReq(req)
+	resultingInterfaces, err := k.sendReq(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -678,9 +766,9 @@ func (k *kataAgent) listInterfaces() ([]*vcTypes.Interface, error) {
 	return nil, err
 }
 
-func (k *kataAgent) listRoutes() ([]*vcTypes.Route, error) {
+func (k *kataAgent) listRoutes(ctx context.Context) ([]*vcTypes.Route, error) {
 	req := &grpc.ListRoutesRequest{}
-	resultingRoutes, err := k.sendReq(req)
+	resultingRoutes, err := k.sendReq(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -744,6 +832,8 @@ func (k *kataAgent) startProxy(sandbox *Sandbox) error {
 		// debug the agent console ourselves.
 		debug: sandbox.config.ProxyConfig.Debug &&
 			!k.hasAgentDebugConsole(sandbox),
+		guestLogDir:     sandbox.config.GuestLogDir,
+		guestLogMaxSize: sandbox.config.GuestLogMaxSize,
 	}
 
 	// Start the proxy here
@@ -838,7 +928,7 @@ func (k *kataAgent) getDNS(sandbox *Sandbox) ([]string, error) {
 	return nil, nil
 }
 
-func (k *kataAgent) startSandbox(sandbox *Sandbox) error {
+func (k *kataAgent) startSandbox(ctx context.Context, sandbox *Sandbox) error {
 	span, _ := k.trace("startSandbox")
 	defer span.Finish()
 
@@ -863,7 +953,7 @@ func (k *kataAgent) startSandbox(sandbox *Sandbox) error {
 	}
 
 	// check grpc server is serving
-	if err = k.check(); err != nil {
+	if err = k.check(ctx); err != nil {
 		return err
 	}
 
@@ -874,18 +964,26 @@ func (k *kataAgent) startSandbox(sandbox *Sandbox) error {
 	if err != nil {
 		return err
 	}
-	if err = k.updateInterfaces(interfaces); err != nil {
+	if err = k.updateInterfaces(ctx, interfaces); err != nil {
 		return err
 	}
-	if _, err = k.updateRoutes(routes); err != nil {
+	if _, err = k.updateRoutes(ctx, routes); err != nil {
 		return err
 	}
-	if err = k.addARPNeighbors(neighs); err != nil {
+	if err = k.addARPNeighbors(ctx, neighs); err != nil {
 		return err
 	}
 
 	storages := setupStorages(sandbox)
 
+	scratch, err := k.scratchStorage(sandbox)
+	if err != nil {
+		return err
+	}
+	if scratch != nil {
+		storages = append(storages, scratch)
+	}
+
 	kmodules := setupKernelModules(k.kmodules)
 
 	req := &grpc.CreateSandboxRequest{
@@ -898,13 +996,13 @@ func (k *kataAgent) startSandbox(sandbox *Sandbox) error {
 		KernelModules: kmodules,
 	}
 
-	_, err = k.sendReq(req)
+	_, err = k.sendReq(ctx, req)
 	if err != nil {
 		return err
 	}
 
 	if k.dynamicTracing {
-		_, err = k.sendReq(&grpc.StartTracingRequest{})
+		_, err = k.sendReq(ctx, &grpc.StartTracingRequest{})
 		if err != nil {
 			return err
 		}
@@ -951,11 +1049,9 @@ func setupStorages(sandbox *Sandbox) []*grpc.Storage {
 			// directly map contents from the host. When set to 'none', the mount
 			// options should not contain 'dax' lest the virtio-fs daemon crashing
 			// with an invalid address reference.
-			if sandbox.config.HypervisorConfig.VirtioFSCache != typeVirtioFSNoCache {
-				// If virtio_fs_cache_size = 0, dax should not be used.
-				if sandbox.config.HypervisorConfig.VirtioFSCacheSize != 0 {
-					sharedDirVirtioFSOptions = append(sharedDirVirtioFSOptions, sharedDirVirtioFSDaxOptions)
-				}
+			// If virtio_fs_cache_size = 0, dax should not be used.
+			if virtiofsDaxEnabled(sandbox.config.HypervisorConfig.VirtioFSCache, sandbox.config.HypervisorConfig.VirtioFSCacheSize) {
+				sharedDirVirtioFSOptions = append(sharedDirVirtioFSOptions, sharedDirVirtioFSDaxOptions)
 			}
 			sharedVolume := &grpc.Storage{
 				Driver:     kataVirtioFSDevType,
@@ -999,7 +1095,7 @@ func setupStorages(sandbox *Sandbox) []*grpc.Storage {
 	return storages
 }
 
-func (k *kataAgent) stopSandbox(sandbox *Sandbox) error {
+func (k *kataAgent) stopSandbox(ctx context.Context, sandbox *Sandbox) error {
 	span, _ := k.trace("stopSandbox")
 	defer span.Finish()
 
@@ -1009,12 +1105,12 @@ func (k *kataAgent) stopSandbox(sandbox *Sandbox) error {
 
 	req := &grpc.DestroySandboxRequest{}
 
-	if _, err := k.sendReq(req); err != nil {
+	if _, err := k.sendReq(ctx, req); err != nil {
 		return err
 	}
 
 	if k.dynamicTracing {
-		_, err := k.sendReq(&grpc.StopTracingRequest{})
+		_, err := k.sendReq(ctx, &grpc.StopTracingRequest{})
 		if err != nil {
 			return err
 		}
@@ -1382,7 +1478,7 @@ func (k *kataAgent) hasAgentDebugConsole(sandbox *Sandbox) bool {
 	return false
 }
 
-func (k *kataAgent) createContainer(sandbox *Sandbox, c *Container) (p *Process, err error) {
+func (k *kataAgent) createContainer(ctx context.Context, sandbox *Sandbox, c *Container) (p *Process, err error) {
 	span, _ := k.trace("createContainer")
 	defer span.Finish()
 
@@ -1403,7 +1499,16 @@ func (k *kataAgent) createContainer(sandbox *Sandbox, c *Container) (p *Process,
 		}
 	}()
 
-	if rootfs, err = k.buildContainerRootfs(sandbox, c, rootPathParent); err != nil {
+	if len(c.state.RootfsLayerDeviceIDs) > 0 {
+		// The rootfs is composed in the guest from its layers and
+		// never goes through the shared directory.
+		var layerStorages []*grpc.Storage
+		rootPath = filepath.Join(kataGuestRootfsImageDir(c.id), c.rootfsSuffix)
+		if layerStorages, err = k.buildRootfsLayerStorages(sandbox, c, rootPath); err != nil {
+			return nil, err
+		}
+		ctrStorages = append(ctrStorages, layerStorages...)
+	} else if rootfs, err = k.buildContainerRootfs(sandbox, c, rootPathParent); err != nil {
 		return nil, err
 	} else if rootfs != nil {
 		// Add rootfs to the list of container storage.
@@ -1419,13 +1524,18 @@ func (k *kataAgent) createContainer(sandbox *Sandbox, c *Container) (p *Process,
 	}
 
 	// Handle container mounts
-	newMounts, ignoredMounts, err := c.mountSharedDirMounts(getMountPath(sandbox.id), kataGuestSharedDir())
+	newMounts, ignoredMounts, err := c.mountSharedDirMounts(ctx, getMountPath(sandbox.id), kataGuestSharedDir())
 	if err != nil {
 		return nil, err
 	}
 
 	k.handleShm(ociSpec.Mounts, sandbox)
 
+	if sandbox.state.ScratchDeviceID != "" {
+		scratchStorages := k.handleScratchStorage(ociSpec.Mounts)
+		ctrStorages = append(ctrStorages, scratchStorages...)
+	}
+
 	epheStorages := k.handleEphemeralStorage(ociSpec.Mounts)
 	ctrStorages = append(ctrStorages, epheStorages...)
 
@@ -1454,6 +1564,7 @@ func (k *kataAgent) createContainer(sandbox *Sandbox, c *Container) (p *Process,
 	if err != nil {
 		return nil, err
 	}
+	volumeStorages = append(volumeStorages, k.handleVirtiofsVolumes(c)...)
 	if err := k.replaceOCIMountsForStorages(ociSpec, volumeStorages); err != nil {
 		return nil, err
 	}
@@ -1495,7 +1606,7 @@ func (k *kataAgent) createContainer(sandbox *Sandbox, c *Container) (p *Process,
 		AgentPidns:   agentPidNs,
 	}
 
-	if _, err = k.sendReq(req); err != nil {
+	if _, err = k.sendReq(ctx, req); err != nil {
 		return nil, err
 	}
 
@@ -1578,6 +1689,40 @@ func (k *kataAgent) handleLocalStorage(mounts []specs.Mount, sandboxID string, r
 	return localStorages
 }
 
+// handleScratchStorage places ephemeral and local volumes on the encrypted
+// scratch disk of the sandbox instead of guest memory or the container rootfs.
+// The /dev/shm ephemeral volume is left to handleEphemeralStorage so that it
+// remains memory backed.
+func (k *kataAgent) handleScratchStorage(mounts []specs.Mount) []*grpc.Storage {
+	var scratchStorages []*grpc.Storage
+	for idx, mnt := range mounts {
+		if mnt.Type != KataEphemeralDevType && mnt.Type != KataLocalDevType {
+			continue
+		}
+
+		if mnt.Destination == "/dev/shm" {
+			continue
+		}
+
+		// Set the mount source path to a directory of the scratch disk
+		// and let the agent bind mount it into the container.
+		mounts[idx].Source = scratchMountSource(mnt.Type, mnt.Source)
+		mounts[idx].Type = "bind"
+
+		// Create a storage struct so that the kata agent is able to create
+		// the directory on the scratch disk.
+		scratchStorage := &grpc.Storage{
+			Driver:     KataLocalDevType,
+			Source:     KataLocalDevType,
+			Fstype:     KataLocalDevType,
+			MountPoint: mounts[idx].Source,
+			Options:    localDirOptions,
+		}
+		scratchStorages = append(scratchStorages, scratchStorage)
+	}
+	return scratchStorages
+}
+
 // handleDeviceBlockVolume handles volume that is block device file
 // and DeviceBlock type.
 func (k *kataAgent) handleDeviceBlockVolume(c *Container, device api.Device) (*grpc.Storage, error) {
@@ -1683,6 +1828,13 @@ func (k *kataAgent) handleBlockVolumes(c *Container) ([]*grpc.Storage, error) {
 			vol.Options = []string{"bind"}
 		}
 
+		// Directly assigned volumes are mounted with their original
+		// file system and options.
+		if m.BlockDeviceFsType != "" {
+			vol.Fstype = m.BlockDeviceFsType
+			vol.Options = m.BlockDeviceOptions
+		}
+
 		volumeStorages = append(volumeStorages, vol)
 	}
 
@@ -1735,7 +1887,7 @@ func (k *kataAgent) checkAgentPidNs(container *Container) bool {
 	return agentPidNs
 }
 
-func (k *kataAgent) startContainer(sandbox *Sandbox, c *Container) error {
+func (k *kataAgent) startContainer(ctx context.Context, sandbox *Sandbox, c *Container) error {
 	span, _ := k.trace("startContainer")
 	defer span.Finish()
 
@@ -1743,19 +1895,19 @@ func (k *kataAgent) startContainer(sandbox *Sandbox, c *Container) error {
 		ContainerId: c.id,
 	}
 
-	_, err := k.sendReq(req)
+	_, err := k.sendReq(ctx, req)
 	return err
 }
 
-func (k *kataAgent) stopContainer(sandbox *Sandbox, c Container) error {
+func (k *kataAgent) stopContainer(ctx context.Context, sandbox *Sandbox, c Container) error {
 	span, _ := k.trace("stopContainer")
 	defer span.Finish()
 
-	_, err := k.sendReq(&grpc.RemoveContainerRequest{ContainerId: c.id})
+	_, err := k.sendReq(ctx, &grpc.RemoveContainerRequest{ContainerId: c.id})
 	return err
 }
 
-func (k *kataAgent) signalProcess(c *Container, processID string, signal syscall.Signal, all bool) error {
+func (k *kataAgent) signalProcess(ctx context.Context, c *Container, processID string, signal syscall.Signal, all bool) error {
 	execID := processID
 	if all {
 		// kata agent uses empty execId to signal all processes in a container
@@ -1767,11 +1919,11 @@ func (k *kataAgent) signalProcess(c *Container, processID string, signal syscall
 		Signal:      uint32(signal),
 	}
 
-	_, err := k.sendReq(req)
+	_, err := k.sendReq(ctx, req)
 	return err
 }
 
-func (k *kataAgent) winsizeProcess(c *Container, processID string, height, width uint32) error {
+func (k *kataAgent) winsizeProcess(ctx context.Context, c *Container, processID string, height, width uint32) error {
 	req := &grpc.TtyWinResizeRequest{
 		ContainerId: c.id,
 		ExecId:      processID,
@@ -1779,18 +1931,18 @@ func (k *kataAgent) winsizeProcess(c *Container, processID string, height, width
 		Column:      width,
 	}
 
-	_, err := k.sendReq(req)
+	_, err := k.sendReq(ctx, req)
 	return err
 }
 
-func (k *kataAgent) processListContainer(sandbox *Sandbox, c Container, options ProcessListOptions) (ProcessList, error) {
+func (k *kataAgent) processListContainer(ctx context.Context, sandbox *Sandbox, c Container, options ProcessListOptions) (ProcessList, error) {
 	req := &grpc.ListProcessesRequest{
 		ContainerId: c.id,
 		Format:      options.Format,
 		Args:        options.Args,
 	}
 
-	resp, err := k.sendReq(req)
+	resp, err := k.sendReq(ctx, req)
 	if err != nil {
 		return nil, err
 	}
@@ -1803,7 +1955,28 @@ func (k *kataAgent) processListContainer(sandbox *Sandbox, c Container, options
 	return processList.ProcessList, nil
 }
 
-func (k *kataAgent) updateContainer(sandbox *Sandbox, c Container, resources specs.LinuxResources) error {
+func (k *kataAgent) processGuestPid(ctx context.Context, c *Container, processID string) (uint32, error) {
+	if !k.state.GuestPid {
+		return 0, ErrGuestPidUnsupported
+	}
+
+	list, err := k.processListContainer(ctx, c.sandbox, *c, ProcessListOptions{
+		Format: kataGuestPidFormat,
+		Args:   []string{processID},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.ParseUint(strings.TrimSpace(string(list)), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid guest pid %q: %v", list, err)
+	}
+
+	return uint32(pid), nil
+}
+
+func (k *kataAgent) updateContainer(ctx context.Context, sandbox *Sandbox, c Container, resources specs.LinuxResources) error {
 	grpcResources, err := grpc.ResourcesOCItoGRPC(&resources)
 	if err != nil {
 		return err
@@ -1814,29 +1987,29 @@ func (k *kataAgent) updateContainer(sandbox *Sandbox, c Container, resources spe
 		Resources:   grpcResources,
 	}
 
-	_, err = k.sendReq(req)
+	_, err = k.sendReq(ctx, req)
 	return err
 }
 
-func (k *kataAgent) pauseContainer(sandbox *Sandbox, c Container) error {
+func (k *kataAgent) pauseContainer(ctx context.Context, sandbox *Sandbox, c Container) error {
 	req := &grpc.PauseContainerRequest{
 		ContainerId: c.id,
 	}
 
-	_, err := k.sendReq(req)
+	_, err := k.sendReq(ctx, req)
 	return err
 }
 
-func (k *kataAgent) resumeContainer(sandbox *Sandbox, c Container) error {
+func (k *kataAgent) resumeContainer(ctx context.Context, sandbox *Sandbox, c Container) error {
 	req := &grpc.ResumeContainerRequest{
 		ContainerId: c.id,
 	}
 
-	_, err := k.sendReq(req)
+	_, err := k.sendReq(ctx, req)
 	return err
 }
 
-func (k *kataAgent) memHotplugByProbe(addr uint64, sizeMB uint32, memorySectionSizeMB uint32) error {
+func (k *kataAgent) memHotplugByProbe(ctx context.Context, addr uint64, sizeMB uint32, memorySectionSizeMB uint32) error {
 	if memorySectionSizeMB == uint32(0) {
 		return fmt.Errorf("memorySectionSizeMB couldn't be zero")
 	}
@@ -1856,27 +2029,27 @@ func (k *kataAgent) memHotplugByProbe(addr uint64, sizeMB uint32, memorySectionS
 		MemHotplugProbeAddr: addrList,
 	}
 
-	_, err := k.sendReq(req)
+	_, err := k.sendReq(ctx, req)
 	return err
 }
 
-func (k *kataAgent) onlineCPUMem(cpus uint32, cpuOnly bool) error {
+func (k *kataAgent) onlineCPUMem(ctx context.Context, cpus uint32, cpuOnly bool) error {
 	req := &grpc.OnlineCPUMemRequest{
 		Wait:    false,
 		NbCpus:  cpus,
 		CpuOnly: cpuOnly,
 	}
 
-	_, err := k.sendReq(req)
+	_, err := k.sendReq(ctx, req)
 	return err
 }
 
-func (k *kataAgent) statsContainer(sandbox *Sandbox, c Container) (*ContainerStats, error) {
+func (k *kataAgent) statsContainer(ctx context.Context, sandbox *Sandbox, c Container) (*ContainerStats, error) {
 	req := &grpc.StatsContainerRequest{
 		ContainerId: c.id,
 	}
 
-	returnStats, err := k.sendReq(req)
+	returnStats, err := k.sendReq(ctx, req)
 
 	if err != nil {
 		return nil, err
@@ -1963,23 +2136,76 @@ func (k *kataAgent) disconnect() error {
 	return nil
 }
 
+// reconnect connects to the agent again and swaps the new client in. The
+// requests in flight on the previous client, the long waits in particular,
+// fail when it is closed and are sent again on the new one by sendReq.
+func (k *kataAgent) reconnect() error {
+	span, _ := k.trace("reconnect")
+	defer span.Finish()
+
+	if k.state.ProxyPid > 0 {
+		if err := syscall.Kill(k.state.ProxyPid, syscall.Signal(0)); err != nil {
+			return errors.New("Proxy is not running")
+		}
+	}
+
+	k.Logger().WithField("url", k.state.URL).WithField("proxy", k.state.ProxyPid).Info("Reconnecting client")
+	client, err := kataclient.NewAgentClient(k.ctx, k.state.URL, k.proxyBuiltIn)
+	if err != nil {
+		return err
+	}
+
+	k.Lock()
+	previous := k.client
+	k.installReqFunc(client)
+	k.client = client
+	k.dead = false
+	k.Unlock()
+
+	if previous != nil {
+		if err := previous.Close(); err != nil && grpcStatus.Convert(err).Code() != codes.Canceled {
+			k.Logger().WithError(err).Warn("failed to close the previous client")
+		}
+	}
+
+	return nil
+}
+
+// reqHandler returns the handler of msgName along with the client it sends
+// the request on.
+func (k *kataAgent) reqHandler(msgName string) (*kataclient.AgentClient, reqFunc) {
+	k.Lock()
+	defer k.Unlock()
+
+	return k.client, k.reqHandlers[msgName]
+}
+
+// reconnectedFrom tells whether the agent was reconnected since client was
+// the current client.
+func (k *kataAgent) reconnectedFrom(client *kataclient.AgentClient) bool {
+	k.Lock()
+	defer k.Unlock()
+
+	return k.client != nil && k.client != client
+}
+
 // check grpc server is serving
-func (k *kataAgent) check() error {
+func (k *kataAgent) check(ctx context.Context) error {
 	span, _ := k.trace("check")
 	defer span.Finish()
 
-	_, err := k.sendReq(&grpc.CheckRequest{})
+	_, err := k.sendReq(ctx, &grpc.CheckRequest{})
 	if err != nil {
 		err = fmt.Errorf("Failed to check if grpc server is working: %s", err)
 	}
 	return err
 }
 
-func (k *kataAgent) waitProcess(c *Container, processID string) (int32, error) {
+func (k *kataAgent) waitProcess(ctx context.Context, c *Container, processID string) (int32, error) {
 	span, _ := k.trace("waitProcess")
 	defer span.Finish()
 
-	resp, err := k.sendReq(&grpc.WaitProcessRequest{
+	resp, err := k.sendReq(ctx, &grpc.WaitProcessRequest{
 		ContainerId: c.id,
 		ExecId:      processID,
 	})
@@ -1990,8 +2216,8 @@ func (k *kataAgent) waitProcess(c *Container, processID string) (int32, error) {
 	return resp.(*grpc.WaitProcessResponse).Status, nil
 }
 
-func (k *kataAgent) writeProcessStdin(c *Container, ProcessID string, data []byte) (int, error) {
-	resp, err := k.sendReq(&grpc.WriteStreamRequest{
+func (k *kataAgent) writeProcessStdin(ctx context.Context, c *Container, ProcessID string, data []byte) (int, error) {
+	resp, err := k.sendReq(ctx, &grpc.WriteStreamRequest{
 		ContainerId: c.id,
 		ExecId:      ProcessID,
 		Data:        data,
@@ -2004,8 +2230,8 @@ func (k *kataAgent) writeProcessStdin(c *Container, ProcessID string, data []byt
 	return int(resp.(*grpc.WriteStreamResponse).Len), nil
 }
 
-func (k *kataAgent) closeProcessStdin(c *Container, ProcessID string) error {
-	_, err := k.sendReq(&grpc.CloseStdinRequest{
+func (k *kataAgent) closeProcessStdin(ctx context.Context, c *Container, ProcessID string) error {
+	_, err := k.sendReq(ctx, &grpc.CloseStdinRequest{
 		ContainerId: c.id,
 		ExecId:      ProcessID,
 	})
@@ -2013,8 +2239,8 @@ func (k *kataAgent) closeProcessStdin(c *Container, ProcessID string) error {
 	return err
 }
 
-func (k *kataAgent) reseedRNG(data []byte) error {
-	_, err := k.sendReq(&grpc.ReseedRandomDevRequest{
+func (k *kataAgent) reseedRNG(ctx context.Context, data []byte) error {
+	_, err := k.sendReq(ctx, &grpc.ReseedRandomDevRequest{
 		Data: data,
 	})
 
@@ -2026,115 +2252,172 @@ type reqFunc func(context.Context, interface{}, ...golangGrpc.CallOption) (inter
 func (k *kataAgent) installReqFunc(c *kataclient.AgentClient) {
 	k.reqHandlers = make(map[string]reqFunc)
 	k.reqHandlers[grpcCheckRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.Check(ctx, req.(*grpc.CheckRequest), opts...)
+		return c.Check(ctx, req.(*grpc.CheckRequest), opts...)
 	}
 	k.reqHandlers[grpcExecProcessRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.ExecProcess(ctx, req.(*grpc.ExecProcessRequest), opts...)
+		return c.ExecProcess(ctx, req.(*grpc.ExecProcessRequest), opts...)
 	}
 	k.reqHandlers[grpcCreateSandboxRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.CreateSandbox(ctx, req.(*grpc.CreateSandboxRequest), opts...)
+		return c.CreateSandbox(ctx, req.(*grpc.CreateSandboxRequest), opts...)
 	}
 	k.reqHandlers[grpcDestroySandboxRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.DestroySandbox(ctx, req.(*grpc.DestroySandboxRequest), opts...)
+		return c.DestroySandbox(ctx, req.(*grpc.DestroySandboxRequest), opts...)
 	}
 	k.reqHandlers[grpcCreateContainerRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.CreateContainer(ctx, req.(*grpc.CreateContainerRequest), opts...)
+		return c.CreateContainer(ctx, req.(*grpc.CreateContainerRequest), opts...)
 	}
 	k.reqHandlers[grpcStartContainerRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.StartContainer(ctx, req.(*grpc.StartContainerRequest), opts...)
+		return c.StartContainer(ctx, req.(*grpc.StartContainerRequest), opts...)
 	}
 	k.reqHandlers[grpcRemoveContainerRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.RemoveContainer(ctx, req.(*grpc.RemoveContainerRequest), opts...)
+		return c.RemoveContainer(ctx, req.(*grpc.RemoveContainerRequest), opts...)
 	}
 	k.reqHandlers[grpcSignalProcessRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.SignalProcess(ctx, req.(*grpc.SignalProcessRequest), opts...)
+		return c.SignalProcess(ctx, req.(*grpc.SignalProcessRequest), opts...)
 	}
 	k.reqHandlers[grpcUpdateRoutesRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.UpdateRoutes(ctx, req.(*grpc.UpdateRoutesRequest), opts...)
+		return c.UpdateRoutes(ctx, req.(*grpc.UpdateRoutesRequest), opts...)
 	}
 	k.reqHandlers[grpcUpdateInterfaceRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.UpdateInterface(ctx, req.(*grpc.UpdateInterfaceRequest), opts...)
+		return c.UpdateInterface(ctx, req.(*grpc.UpdateInterfaceRequest), opts...)
 	}
 	k.reqHandlers[grpcListInterfacesRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.ListInterfaces(ctx, req.(*grpc.ListInterfacesRequest), opts...)
+		return c.ListInterfaces(ctx, req.(*grpc.ListInterfacesRequest), opts...)
 	}
 	k.reqHandlers[grpcListRoutesRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.ListRoutes(ctx, req.(*grpc.ListRoutesRequest), opts...)
+		return c.ListRoutes(ctx, req.(*grpc.ListRoutesRequest), opts...)
 	}
 	k.reqHandlers[grpcAddARPNeighborsRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.AddARPNeighbors(ctx, req.(*grpc.AddARPNeighborsRequest), opts...)
+		return c.AddARPNeighbors(ctx, req.(*grpc.AddARPNeighborsRequest), opts...)
 	}
 	k.reqHandlers[grpcOnlineCPUMemRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.OnlineCPUMem(ctx, req.(*grpc.OnlineCPUMemRequest), opts...)
+		return c.OnlineCPUMem(ctx, req.(*grpc.OnlineCPUMemRequest), opts...)
 	}
 	k.reqHandlers[grpcListProcessesRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.ListProcesses(ctx, req.(*grpc.ListProcessesRequest), opts...)
+		return c.ListProcesses(ctx, req.(*grpc.ListProcessesRequest), opts...)
 	}
 	k.reqHandlers[grpcUpdateContainerRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.UpdateContainer(ctx, req.(*grpc.UpdateContainerRequest), opts...)
+		return c.UpdateContainer(ctx, req.(*grpc.UpdateContainerRequest), opts...)
 	}
 	k.reqHandlers[grpcWaitProcessRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.WaitProcess(ctx, req.(*grpc.WaitProcessRequest), opts...)
+		return c.WaitProcess(ctx, req.(*grpc.WaitProcessRequest), opts...)
 	}
 	k.reqHandlers[grpcTtyWinResizeRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.TtyWinResize(ctx, req.(*grpc.TtyWinResizeRequest), opts...)
+		return c.TtyWinResize(ctx, req.(*grpc.TtyWinResizeRequest), opts...)
 	}
 	k.reqHandlers[grpcWriteStreamRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.WriteStdin(ctx, req.(*grpc.WriteStreamRequest), opts...)
+		return c.WriteStdin(ctx, req.(*grpc.WriteStreamRequest), opts...)
 	}
 	k.reqHandlers[grpcCloseStdinRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.CloseStdin(ctx, req.(*grpc.CloseStdinRequest), opts...)
+		return c.CloseStdin(ctx, req.(*grpc.CloseStdinRequest), opts...)
 	}
 	k.reqHandlers[grpcStatsContainerRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.StatsContainer(ctx, req.(*grpc.StatsContainerRequest), opts...)
+		return c.StatsContainer(ctx, req.(*grpc.StatsContainerRequest), opts...)
 	}
 	k.reqHandlers[grpcPauseContainerRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.PauseContainer(ctx, req.(*grpc.PauseContainerRequest), opts...)
+		return c.PauseContainer(ctx, req.(*grpc.PauseContainerRequest), opts...)
 	}
 	k.reqHandlers[grpcResumeContainerRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.ResumeContainer(ctx, req.(*grpc.ResumeContainerRequest), opts...)
+		return c.ResumeContainer(ctx, req.(*grpc.ResumeContainerRequest), opts...)
 	}
 	k.reqHandlers[grpcReseedRandomDevRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.ReseedRandomDev(ctx, req.(*grpc.ReseedRandomDevRequest), opts...)
+		return c.ReseedRandomDev(ctx, req.(*grpc.ReseedRandomDevRequest), opts...)
 	}
 	k.reqHandlers[grpcGuestDetailsRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.GetGuestDetails(ctx, req.(*grpc.GuestDetailsRequest), opts...)
+		return c.GetGuestDetails(ctx, req.(*grpc.GuestDetailsRequest), opts...)
 	}
 	k.reqHandlers[grpcMemHotplugByProbeRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.MemHotplugByProbe(ctx, req.(*grpc.MemHotplugByProbeRequest), opts...)
+		return c.MemHotplugByProbe(ctx, req.(*grpc.MemHotplugByProbeRequest), opts...)
 	}
 	k.reqHandlers[grpcCopyFileRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.CopyFile(ctx, req.(*grpc.CopyFileRequest), opts...)
+		return c.CopyFile(ctx, req.(*grpc.CopyFileRequest), opts...)
 	}
 	k.reqHandlers[grpcSetGuestDateTimeRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.SetGuestDateTime(ctx, req.(*grpc.SetGuestDateTimeRequest), opts...)
+		return c.SetGuestDateTime(ctx, req.(*grpc.SetGuestDateTimeRequest), opts...)
 	}
 	k.reqHandlers[grpcStartTracingRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.StartTracing(ctx, req.(*grpc.StartTracingRequest), opts...)
+		return c.StartTracing(ctx, req.(*grpc.StartTracingRequest), opts...)
 	}
 	k.reqHandlers[grpcStopTracingRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.StopTracing(ctx, req.(*grpc.StopTracingRequest), opts...)
+		return c.StopTracing(ctx, req.(*grpc.StopTracingRequest), opts...)
 	}
 	k.reqHandlers[grpcGetOOMEventRequest] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.GetOOMEvent(ctx, req.(*grpc.GetOOMEventRequest), opts...)
+		return c.GetOOMEvent(ctx, req.(*grpc.GetOOMEventRequest), opts...)
 	}
 }
 
-func (k *kataAgent) getReqContext(reqName string) (ctx context.Context, cancel context.CancelFunc) {
-	ctx = context.Background()
+// agentRequestClass returns the class of a request to the agent, which
+// determines its timeout.
+func agentRequestClass(reqName string) string {
 	switch reqName {
-	case grpcWaitProcessRequest, grpcGetOOMEventRequest:
-		// Wait and GetOOMEvent have no timeout
 	case grpcCheckRequest:
-		ctx, cancel = context.WithTimeout(ctx, checkRequestTimeout)
+		return agentRequestCheck
+	case grpcWaitProcessRequest, grpcGetOOMEventRequest:
+		return agentRequestWait
+	case grpcStatsContainerRequest, grpcListProcessesRequest, grpcListInterfacesRequest,
+		grpcListRoutesRequest, grpcGuestDetailsRequest:
+		return agentRequestQuery
+	default:
+		return agentRequestDefault
+	}
+}
+
+// idempotentAgentRequests are the requests which can be sent again when
+// they timed out or did not reach the agent.
+var idempotentAgentRequests = map[string]bool{
+	grpcCheckRequest:            true,
+	grpcStatsContainerRequest:   true,
+	grpcListProcessesRequest:    true,
+	grpcListInterfacesRequest:   true,
+	grpcListRoutesRequest:       true,
+	grpcGuestDetailsRequest:     true,
+	grpcOnlineCPUMemRequest:     true,
+	grpcUpdateContainerRequest:  true,
+	grpcSetGuestDateTimeRequest: true,
+}
+
+// reconnectRetriedAgentRequests are the requests which are sent again when
+// the agent is reconnected while they are in flight: the idempotent ones and
+// the long waits, which only report an event.
+var reconnectRetriedAgentRequests = map[string]bool{
+	grpcCheckRequest:            true,
+	grpcStatsContainerRequest:   true,
+	grpcListProcessesRequest:    true,
+	grpcListInterfacesRequest:   true,
+	grpcListRoutesRequest:       true,
+	grpcGuestDetailsRequest:     true,
+	grpcOnlineCPUMemRequest:     true,
+	grpcUpdateContainerRequest:  true,
+	grpcSetGuestDateTimeRequest: true,
+	grpcWaitProcessRequest:      true,
+	grpcGetOOMEventRequest:      true,
+}
+
+// retryableAgentError tells whether a request failed before the agent could
+// handle it, or timed out.
+func retryableAgentError(err error) bool {
+	switch grpcStatus.Code(err) {
+	case codes.DeadlineExceeded, codes.Unavailable:
+		return true
 	default:
-		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		return false
 	}
+}
 
-	return ctx, cancel
+// getReqContext derives the context of a request from the context of the
+// caller, bounded by the timeout of the class of the request.
+func (k *kataAgent) getReqContext(ctx context.Context, reqName string) (context.Context, context.CancelFunc) {
+	if timeout := k.reqTimeouts.timeout(agentRequestClass(reqName)); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+
+	return context.WithCancel(ctx)
 }
 
-func (k *kataAgent) sendReq(request interface{}) (interface{}, error) {
+// sendReq sends a request to the agent, the request being cancelled with
+// ctx. Idempotent requests are retried up to the configured number of
+// retries when they time out or do not reach the agent.
+func (k *kataAgent) sendReq(ctx context.Context, request interface{}) (interface{}, error) {
 	span, _ := k.trace("sendReq")
 	span.SetTag("request", request)
 	defer span.Finish()
@@ -2147,22 +2430,52 @@ func (k *kataAgent) sendReq(request interface{}) (interface{}, error) {
 	}
 
 	msgName := proto.MessageName(request.(proto.Message))
-	handler := k.reqHandlers[msgName]
+	client, handler := k.reqHandler(msgName)
 	if msgName == "" || handler == nil {
 		return nil, errors.New("Invalid request type")
 	}
 	message := request.(proto.Message)
-	ctx, cancel := k.getReqContext(msgName)
-	if cancel != nil {
-		defer cancel()
-	}
 	k.Logger().WithField("name", msgName).WithField("req", message.String()).Debug("sending request")
 
-	return handler(ctx, request)
+	var retries uint32
+	if idempotentAgentRequests[msgName] {
+		retries = k.reqRetries
+	}
+
+	var attempt uint32
+	for {
+		reqCtx, cancel := k.getReqContext(ctx, msgName)
+		resp, err := handler(reqCtx, request)
+		cancel()
+
+		// The request was cut by a reconnection, send it again on
+		// the new client without counting it as a retry.
+		if err != nil && ctx.Err() == nil && reconnectRetriedAgentRequests[msgName] && k.reconnectedFrom(client) {
+			k.Logger().WithError(err).WithField("name", msgName).Info("sending request again after reconnection")
+			client, handler = k.reqHandler(msgName)
+			continue
+		}
+
+		if err == nil || attempt >= retries || !retryableAgentError(err) || ctx.Err() != nil {
+			return resp, err
+		}
+
+		attempt++
+		k.Logger().WithError(err).WithFields(logrus.Fields{
+			"name":    msgName,
+			"attempt": attempt,
+		}).Warn("retrying request")
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(agentRequestRetryDelay):
+		}
+	}
 }
 
 // readStdout and readStderr are special that we cannot differentiate them with the request types...
-func (k *kataAgent) readProcessStdout(c *Container, processID string, data []byte) (int, error) {
+func (k *kataAgent) readProcessStdout(ctx context.Context, c *Container, processID string, data []byte) (int, error) {
 	if err := k.connect(); err != nil {
 		return 0, err
 	}
@@ -2170,11 +2483,11 @@ func (k *kataAgent) readProcessStdout(c *Container, processID string, data []byt
 		defer k.disconnect()
 	}
 
-	return k.readProcessStream(c.id, processID, data, k.client.ReadStdout)
+	return k.readProcessStream(ctx, c.id, processID, data, k.client.ReadStdout)
 }
 
 // readStdout and readStderr are special that we cannot differentiate them with the request types...
-func (k *kataAgent) readProcessStderr(c *Container, processID string, data []byte) (int, error) {
+func (k *kataAgent) readProcessStderr(ctx context.Context, c *Container, processID string, data []byte) (int, error) {
 	if err := k.connect(); err != nil {
 		return 0, err
 	}
@@ -2182,13 +2495,13 @@ func (k *kataAgent) readProcessStderr(c *Container, processID string, data []byt
 		defer k.disconnect()
 	}
 
-	return k.readProcessStream(c.id, processID, data, k.client.ReadStderr)
+	return k.readProcessStream(ctx, c.id, processID, data, k.client.ReadStderr)
 }
 
 type readFn func(context.Context, *grpc.ReadStreamRequest, ...golangGrpc.CallOption) (*grpc.ReadStreamResponse, error)
 
-func (k *kataAgent) readProcessStream(containerID, processID string, data []byte, read readFn) (int, error) {
-	resp, err := read(k.ctx, &grpc.ReadStreamRequest{
+func (k *kataAgent) readProcessStream(ctx context.Context, containerID, processID string, data []byte, read readFn) (int, error) {
+	resp, err := read(ctx, &grpc.ReadStreamRequest{
 		ContainerId: containerID,
 		ExecId:      processID,
 		Len:         uint32(len(data))})
@@ -2200,17 +2513,119 @@ func (k *kataAgent) readProcessStream(containerID, processID string, data []byte
 	return 0, err
 }
 
-func (k *kataAgent) getGuestDetails(req *grpc.GuestDetailsRequest) (*grpc.GuestDetailsResponse, error) {
-	resp, err := k.sendReq(req)
+// readHandshakeLine reads a handshake line from conn, without reading
+// past it so that no data following it is consumed.
+func readHandshakeLine(conn net.Conn) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+
+	for {
+		if _, err := conn.Read(b); err != nil {
+			return "", err
+		}
+		if b[0] == '\n' {
+			return string(line), nil
+		}
+		line = append(line, b[0])
+	}
+}
+
+// errAgentPortUnreachable is returned when dialing a port of an agent
+// reached through a proxy, which only forwards the gRPC connection.
+var errAgentPortUnreachable = errors.New("agent port unreachable through a proxy")
+
+// dialAgentPort connects to a port of the agent other than its gRPC one.
+// Only direct vsock and hybrid vsock connections can reach them.
+func dialAgentPort(agentURL string, port uint32) (net.Conn, error) {
+	u, err := url.Parse(agentURL)
 	if err != nil {
 		return nil, err
 	}
 
-	return resp.(*grpc.GuestDetailsResponse), nil
+	switch u.Scheme {
+	case kataclient.VSockSocketScheme:
+		cid, err := strconv.ParseUint(u.Hostname(), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid vsock cid %q: %v", u.Hostname(), err)
+		}
+		return vsock.Dial(uint32(cid), port)
+	case kataclient.HybridVSockScheme:
+		hvsock := strings.Split(u.Path, ":")
+		if len(hvsock) != 2 {
+			return nil, fmt.Errorf("Invalid hybrid vsock URL %q", agentURL)
+		}
+		return dialHybridVSock(hvsock[0], port)
+	default:
+		return nil, errAgentPortUnreachable
+	}
+}
+
+// dialHybridVSock connects to port through the unix socket of a hybrid
+// vsock. Unlike the gRPC dialer, it does not retry: the agent is known to
+// be up, and one not serving the port should be detected right away.
+func dialHybridVSock(udsPath string, port uint32) (net.Conn, error) {
+	conn, err := net.DialTimeout("unix", udsPath, checkRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = conn.SetDeadline(time.Now().Add(checkRequestTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err = fmt.Fprintf(conn, "CONNECT %d\n", port); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reply, err := readHandshakeLine(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !strings.HasPrefix(reply, "OK") {
+		conn.Close()
+		return nil, fmt.Errorf("Hybrid vsock handshake failed: %q", reply)
+	}
+
+	return conn, nil
+}
+
+func (k *kataAgent) getGuestDetails(ctx context.Context, req *grpc.GuestDetailsRequest) (*grpc.GuestDetailsResponse, error) {
+	resp, err := k.sendReq(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	details := resp.(*grpc.GuestDetailsResponse)
+	if details.AgentDetails != nil {
+		k.state.GuestPid = agentHasFeature(details.AgentDetails.Version, kataGuestPidFeature)
+	}
+
+	return details, nil
+}
+
+// agentHasFeature tells whether feature is one of the build metadata
+// identifiers of the agent semantic version.
+func agentHasFeature(version, feature string) bool {
+	i := strings.Index(version, "+")
+	if i < 0 {
+		return false
+	}
+
+	for _, id := range strings.Split(version[i+1:], ".") {
+		if id == feature {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (k *kataAgent) setGuestDateTime(tv time.Time) error {
-	_, err := k.sendReq(&grpc.SetGuestDateTimeRequest{
+func (k *kataAgent) setGuestDateTime(ctx context.Context, tv time.Time) error {
+	_, err := k.sendReq(ctx, &grpc.SetGuestDateTimeRequest{
 		Sec:  tv.Unix(),
 		Usec: int64(tv.Nanosecond() / 1e3),
 	})
@@ -2381,7 +2796,7 @@ func (k *kataAgent) convertToRoutes(aRoutes []*aTypes.Route) (routes []*vcTypes.
 	return routes
 }
 
-func (k *kataAgent) copyFile(src, dst string) error {
+func (k *kataAgent) copyFile(ctx context.Context, src, dst string) error {
 	var st unix.Stat_t
 
 	err := unix.Stat(src, &st)
@@ -2412,7 +2827,7 @@ func (k *kataAgent) copyFile(src, dst string) error {
 
 	// Handle the special case where the file is empty
 	if fileSize == 0 {
-		_, err = k.sendReq(cpReq)
+		_, err = k.sendReq(ctx, cpReq)
 		return err
 	}
 
@@ -2428,7 +2843,7 @@ func (k *kataAgent) copyFile(src, dst string) error {
 		cpReq.Data = b[:bytesToCopy]
 		cpReq.Offset = offset
 
-		if _, err = k.sendReq(cpReq); err != nil {
+		if _, err = k.sendReq(ctx, cpReq); err != nil {
 			return fmt.Errorf("Could not send CopyFile request: %v", err)
 		}
 
@@ -2468,17 +2883,19 @@ func (k *kataAgent) save() persistapi.AgentState {
 	return persistapi.AgentState{
 		ProxyPid: k.state.ProxyPid,
 		URL:      k.state.URL,
+		GuestPid: k.state.GuestPid,
 	}
 }
 
 func (k *kataAgent) load(s persistapi.AgentState) {
 	k.state.ProxyPid = s.ProxyPid
 	k.state.URL = s.URL
+	k.state.GuestPid = s.GuestPid
 }
 
-func (k *kataAgent) getOOMEvent() (string, error) {
+func (k *kataAgent) getOOMEvent(ctx context.Context) (string, error) {
 	req := &grpc.GetOOMEventRequest{}
-	result, err := k.sendReq(req)
+	result, err := k.sendReq(ctx, req)
 	if err != nil {
 		return "", err
 	}
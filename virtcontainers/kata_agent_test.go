@@ -18,15 +18,20 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	vcAnnotations "github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
 
+	"github.com/gogo/protobuf/proto"
 	gpb "github.com/gogo/protobuf/types"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcStatus "google.golang.org/grpc/status"
 
 	aTypes "github.com/kata-containers/agent/pkg/types"
+	kataclient "github.com/kata-containers/agent/protocols/client"
 	pb "github.com/kata-containers/agent/protocols/grpc"
 	"github.com/kata-containers/runtime/virtcontainers/device/api"
 	"github.com/kata-containers/runtime/virtcontainers/device/config"
@@ -143,6 +148,9 @@ func (p *gRPCProxy) WaitProcess(ctx context.Context, req *pb.WaitProcessRequest)
 }
 
 func (p *gRPCProxy) ListProcesses(ctx context.Context, req *pb.ListProcessesRequest) (*pb.ListProcessesResponse, error) {
+	if req.Format == kataGuestPidFormat {
+		return &pb.ListProcessesResponse{ProcessList: []byte("42\n")}, nil
+	}
 	return &pb.ListProcessesResponse{}, nil
 }
 
@@ -308,7 +316,7 @@ func TestKataAgentSendReq(t *testing.T) {
 	}
 
 	for _, req := range reqList {
-		_, err = k.sendReq(req)
+		_, err = k.sendReq(context.Background(), req)
 		assert.Nil(err)
 	}
 
@@ -316,52 +324,61 @@ func TestKataAgentSendReq(t *testing.T) {
 	container := &Container{}
 	execid := "processFooBar"
 
-	err = k.startContainer(sandbox, container)
+	err = k.startContainer(context.Background(), sandbox, container)
 	assert.Nil(err)
 
-	err = k.signalProcess(container, execid, syscall.SIGKILL, true)
+	err = k.signalProcess(context.Background(), container, execid, syscall.SIGKILL, true)
 	assert.Nil(err)
 
-	err = k.winsizeProcess(container, execid, 100, 200)
+	err = k.winsizeProcess(context.Background(), container, execid, 100, 200)
 	assert.Nil(err)
 
-	_, err = k.processListContainer(sandbox, Container{}, ProcessListOptions{})
+	_, err = k.processListContainer(context.Background(), sandbox, Container{}, ProcessListOptions{})
 	assert.Nil(err)
 
-	err = k.updateContainer(sandbox, Container{}, specs.LinuxResources{})
+	_, err = k.processGuestPid(context.Background(), container, execid)
+	assert.Equal(ErrGuestPidUnsupported, err)
+
+	k.state.GuestPid = true
+	pid, err := k.processGuestPid(context.Background(), container, execid)
 	assert.Nil(err)
+	assert.Equal(uint32(42), pid)
+	k.state.GuestPid = false
 
-	err = k.pauseContainer(sandbox, Container{})
+	err = k.updateContainer(context.Background(), sandbox, Container{}, specs.LinuxResources{})
 	assert.Nil(err)
 
-	err = k.resumeContainer(sandbox, Container{})
+	err = k.pauseContainer(context.Background(), sandbox, Container{})
 	assert.Nil(err)
 
-	err = k.onlineCPUMem(1, true)
+	err = k.resumeContainer(context.Background(), sandbox, Container{})
 	assert.Nil(err)
 
-	_, err = k.statsContainer(sandbox, Container{})
+	err = k.onlineCPUMem(context.Background(), 1, true)
 	assert.Nil(err)
 
-	err = k.check()
+	_, err = k.statsContainer(context.Background(), sandbox, Container{})
 	assert.Nil(err)
 
-	_, err = k.waitProcess(container, execid)
+	err = k.check(context.Background())
 	assert.Nil(err)
 
-	_, err = k.writeProcessStdin(container, execid, []byte{'c'})
+	_, err = k.waitProcess(context.Background(), container, execid)
 	assert.Nil(err)
 
-	err = k.closeProcessStdin(container, execid)
+	_, err = k.writeProcessStdin(context.Background(), container, execid, []byte{'c'})
 	assert.Nil(err)
 
-	_, err = k.readProcessStdout(container, execid, []byte{})
+	err = k.closeProcessStdin(context.Background(), container, execid)
 	assert.Nil(err)
 
-	_, err = k.readProcessStderr(container, execid, []byte{})
+	_, err = k.readProcessStdout(context.Background(), container, execid, []byte{})
 	assert.Nil(err)
 
-	_, err = k.getOOMEvent()
+	_, err = k.readProcessStderr(context.Background(), container, execid, []byte{})
+	assert.Nil(err)
+
+	_, err = k.getOOMEvent(context.Background())
 	assert.Nil(err)
 }
 
@@ -384,6 +401,50 @@ func TestHandleEphemeralStorage(t *testing.T) {
 		"Ephemeral mount point didn't match: got %s, expecting %s", epheMountPoint, expected)
 }
 
+func TestHandleScratchStorage(t *testing.T) {
+	assert := assert.New(t)
+	k := kataAgent{}
+
+	ociMounts := []specs.Mount{
+		{
+			Type:        KataEphemeralDevType,
+			Source:      "/tmp/ephemeral",
+			Destination: "/data",
+		},
+		{
+			Type:        KataLocalDevType,
+			Source:      "/tmp/local",
+			Destination: "/cache",
+		},
+		{
+			Type:        KataEphemeralDevType,
+			Source:      "/tmp/shm",
+			Destination: "/dev/shm",
+		},
+		{
+			Type:        "bind",
+			Source:      "/tmp/bind",
+			Destination: "/bind",
+		},
+	}
+
+	storages := k.handleScratchStorage(ociMounts)
+	assert.Len(storages, 2)
+
+	expected := filepath.Join(kataGuestScratchDir(), KataEphemeralDevType, "ephemeral")
+	assert.Equal(expected, storages[0].MountPoint)
+	assert.Equal(expected, ociMounts[0].Source)
+	assert.Equal("bind", ociMounts[0].Type)
+
+	expected = filepath.Join(kataGuestScratchDir(), KataLocalDevType, "local")
+	assert.Equal(expected, storages[1].MountPoint)
+	assert.Equal(KataLocalDevType, storages[1].Driver)
+
+	// /dev/shm must remain memory backed
+	assert.Equal(KataEphemeralDevType, ociMounts[2].Type)
+	assert.Equal("/tmp/bind", ociMounts[3].Source)
+}
+
 func TestHandleLocalStorage(t *testing.T) {
 	k := kataAgent{}
 	var ociMounts []specs.Mount
@@ -586,6 +647,21 @@ func TestHandleBlockVolume(t *testing.T) {
 
 	assert.Equal(t, vStorage, volumeStorages[0], "Error while handle VhostUserBlk type block volume")
 	assert.Equal(t, bStorage, volumeStorages[1], "Error while handle BlockDevice type block volume")
+
+	// A directly assigned volume is mounted with its own file system
+	c.mounts = []Mount{
+		{
+			BlockDeviceID:      bDevID,
+			Destination:        bDestination,
+			BlockDeviceFsType:  "ext4",
+			BlockDeviceOptions: []string{"data=ordered", "ro"},
+		},
+	}
+	volumeStorages, err = k.handleBlockVolumes(c)
+	assert.NoError(t, err)
+	bStorage.Fstype = "ext4"
+	bStorage.Options = []string{"data=ordered", "ro"}
+	assert.Equal(t, bStorage, volumeStorages[0])
 }
 
 func TestAppendDevicesEmptyContainerDeviceList(t *testing.T) {
@@ -1028,7 +1104,7 @@ func TestAgentCreateContainer(t *testing.T) {
 	assert.Nil(err)
 
 	// We'll fail on container metadata file creation, but it helps increasing coverage...
-	_, err = k.createContainer(sandbox, container)
+	_, err = k.createContainer(context.Background(), sandbox, container)
 	assert.Error(err)
 }
 
@@ -1057,19 +1133,19 @@ func TestAgentNetworkOperation(t *testing.T) {
 		},
 	}
 
-	_, err = k.updateInterface(nil)
+	_, err = k.updateInterface(context.Background(), nil)
 	assert.Nil(err)
 
-	_, err = k.listInterfaces()
+	_, err = k.listInterfaces(context.Background())
 	assert.Nil(err)
 
-	_, err = k.updateRoutes([]*vcTypes.Route{})
+	_, err = k.updateRoutes(context.Background(), []*vcTypes.Route{})
 	assert.Nil(err)
 
-	_, err = k.listRoutes()
+	_, err = k.listRoutes(context.Background())
 	assert.Nil(err)
 
-	err = k.addARPNeighbors(nil)
+	err = k.addARPNeighbors(context.Background(), nil)
 	assert.Nil(err)
 }
 
@@ -1130,7 +1206,7 @@ func TestKataCopyFile(t *testing.T) {
 		},
 	}
 
-	err = k.copyFile("/abc/xyz/123", "/tmp")
+	err = k.copyFile(context.Background(), "/abc/xyz/123", "/tmp")
 	assert.Error(err)
 
 	src, err := ioutil.TempFile("", "src")
@@ -1153,7 +1229,7 @@ func TestKataCopyFile(t *testing.T) {
 		grpcMaxDataSize = orgGrpcMaxDataSize
 	}()
 
-	err = k.copyFile(src.Name(), dst.Name())
+	err = k.copyFile(context.Background(), src.Name(), dst.Name())
 	assert.NoError(err)
 }
 
@@ -1185,6 +1261,19 @@ func TestKataCleanupSandbox(t *testing.T) {
 	assert.False(os.IsExist(err))
 }
 
+func TestKataAgentDebugConsoleKernelParams(t *testing.T) {
+	assert := assert.New(t)
+
+	params := KataAgentKernelParams(KataAgentConfig{})
+	assert.Empty(params)
+
+	params = KataAgentKernelParams(KataAgentConfig{DebugConsoleEnabled: true})
+	assert.Equal([]Param{
+		{Key: "agent.debug_console", Value: ""},
+		{Key: "agent.debug_console_vport", Value: "1026"},
+	}, params)
+}
+
 func TestKataAgentKernelParams(t *testing.T) {
 	assert := assert.New(t)
 
@@ -1413,3 +1502,134 @@ func TestKataAgentDirs(t *testing.T) {
 		assert.Equal(ephemeralPath(), defaultEphemeralPath)
 	}
 }
+
+// newStallingKataAgent returns an agent whose requests stall until their
+// context is done, counting the attempts of each request.
+func newStallingKataAgent(timeouts AgentRequestTimeouts, retries uint32) (*kataAgent, map[string]int) {
+	attempts := make(map[string]int)
+	stall := func(ctx context.Context, req interface{}, opts ...grpc.CallOption) (interface{}, error) {
+		attempts[proto.MessageName(req.(proto.Message))]++
+		<-ctx.Done()
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, grpcStatus.Error(codes.DeadlineExceeded, ctx.Err().Error())
+		}
+		return nil, grpcStatus.Error(codes.Canceled, ctx.Err().Error())
+	}
+
+	k := &kataAgent{
+		ctx:         context.Background(),
+		client:      &kataclient.AgentClient{},
+		keepConn:    true,
+		reqTimeouts: timeouts,
+		reqRetries:  retries,
+		reqHandlers: make(map[string]reqFunc),
+	}
+
+	for _, name := range []string{grpcCheckRequest, grpcStatsContainerRequest, grpcWaitProcessRequest, grpcCreateContainerRequest} {
+		k.reqHandlers[name] = stall
+	}
+
+	return k, attempts
+}
+
+func TestKataAgentRequestTimeouts(t *testing.T) {
+	assert := assert.New(t)
+
+	k, _ := newStallingKataAgent(AgentRequestTimeouts{
+		Check:   10 * time.Millisecond,
+		Request: 20 * time.Millisecond,
+		Query:   30 * time.Millisecond,
+	}, 0)
+
+	for _, req := range []interface{}{
+		&pb.CheckRequest{},
+		&pb.CreateContainerRequest{},
+		&pb.StatsContainerRequest{},
+	} {
+		_, err := k.sendReq(context.Background(), req)
+		assert.Equal(codes.DeadlineExceeded, grpcStatus.Code(err))
+	}
+
+	// Zero timeouts select the defaults of the classes, waiting not
+	// timing out.
+	timeouts := AgentRequestTimeouts{}
+	assert.Equal(checkRequestTimeout, timeouts.timeout(agentRequestCheck))
+	assert.Equal(defaultRequestTimeout, timeouts.timeout(agentRequestQuery))
+	assert.Equal(defaultRequestTimeout, timeouts.timeout(agentRequestDefault))
+	assert.Equal(time.Duration(0), timeouts.timeout(agentRequestWait))
+}
+
+func TestKataAgentRequestCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	// A wait does not time out, but ends with its caller.
+	k, _ := newStallingKataAgent(AgentRequestTimeouts{Request: time.Millisecond}, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := k.sendReq(ctx, &pb.WaitProcessRequest{})
+	assert.Equal(codes.Canceled, grpcStatus.Code(err))
+}
+
+func TestKataAgentRequestRetries(t *testing.T) {
+	assert := assert.New(t)
+
+	savedDelay := agentRequestRetryDelay
+	agentRequestRetryDelay = time.Millisecond
+	defer func() {
+		agentRequestRetryDelay = savedDelay
+	}()
+
+	k, attempts := newStallingKataAgent(AgentRequestTimeouts{
+		Request: time.Millisecond,
+		Query:   time.Millisecond,
+	}, 2)
+
+	// Only idempotent requests are retried.
+	_, err := k.sendReq(context.Background(), &pb.StatsContainerRequest{})
+	assert.Error(err)
+	assert.Equal(3, attempts[grpcStatsContainerRequest])
+
+	_, err = k.sendReq(context.Background(), &pb.CreateContainerRequest{})
+	assert.Error(err)
+	assert.Equal(1, attempts[grpcCreateContainerRequest])
+}
+
+func TestKataAgentRequestReconnect(t *testing.T) {
+	assert := assert.New(t)
+
+	k, attempts := newStallingKataAgent(AgentRequestTimeouts{}, 0)
+
+	// The agent is reconnected while the requests are in flight, which
+	// fails them on the previous client.
+	cut := func(ctx context.Context, req interface{}, opts ...grpc.CallOption) (interface{}, error) {
+		name := proto.MessageName(req.(proto.Message))
+		attempts[name]++
+		if attempts[name] > 1 {
+			return &pb.WaitProcessResponse{Status: 3}, nil
+		}
+
+		k.Lock()
+		k.client = &kataclient.AgentClient{}
+		k.Unlock()
+
+		return nil, grpcStatus.Error(codes.Canceled, "grpc: the client connection is closing")
+	}
+	k.reqHandlers[grpcWaitProcessRequest] = cut
+	k.reqHandlers[grpcCreateContainerRequest] = cut
+
+	// A wait is sent again on the new client.
+	resp, err := k.sendReq(context.Background(), &pb.WaitProcessRequest{})
+	assert.NoError(err)
+	assert.Equal(int32(3), resp.(*pb.WaitProcessResponse).Status)
+	assert.Equal(2, attempts[grpcWaitProcessRequest])
+
+	// A request which may have been handled is not.
+	_, err = k.sendReq(context.Background(), &pb.CreateContainerRequest{})
+	assert.Equal(codes.Canceled, grpcStatus.Code(err))
+	assert.Equal(1, attempts[grpcCreateContainerRequest])
+}
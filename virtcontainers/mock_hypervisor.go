@@ -96,7 +96,7 @@ func (m *mockHypervisor) disconnect() {
 
 func (m *mockHypervisor) getThreadIDs() (vcpuThreadIDs, error) {
 	vcpus := map[int]int{0: os.Getpid()}
-	return vcpuThreadIDs{vcpus}, nil
+	return vcpuThreadIDs{vcpus: vcpus}, nil
 }
 
 func (m *mockHypervisor) cleanup() error {
@@ -125,6 +125,10 @@ func (m *mockHypervisor) check() error {
 	return nil
 }
 
+func (m *mockHypervisor) saveDiagnostics(dir string, guestMemory bool) error {
+	return nil
+}
+
 func (m *mockHypervisor) generateSocket(id string, useVsock bool) (interface{}, error) {
 	return types.Socket{HostPath: "/tmp/socket", Name: "socket"}, nil
 }
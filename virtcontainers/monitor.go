@@ -21,19 +21,40 @@ type monitor struct {
 	sync.Mutex
 
 	sandbox       *Sandbox
+	policy        HealthPolicy
 	checkInterval time.Duration
 	watchers      []chan error
+	eventWatchers []chan HealthEvent
 	wg            sync.WaitGroup
 	running       bool
 	stopCh        chan bool
+
+	// failures counts the consecutive failures of each check. It is
+	// only used by the checking goroutine.
+	failures       map[string]uint32
+	memoryPressure bool
+
+	// overhead records the overhead of the sandbox, if enabled.
+	overhead *overheadRecorder
 }
 
 func newMonitor(s *Sandbox) *monitor {
-	return &monitor{
+	m := &monitor{
 		sandbox:       s,
 		checkInterval: defaultCheckInterval,
 		stopCh:        make(chan bool, 1),
+		failures:      make(map[string]uint32),
 	}
+
+	if s.config != nil {
+		m.policy = s.config.HealthPolicy
+
+		if s.config.Overhead.Interval > 0 && s.config.Overhead.Dir != "" {
+			m.overhead = newOverheadRecorder(s, s.config.Overhead)
+		}
+	}
+
+	return m
 }
 
 func (m *monitor) newWatcher() (chan error, error) {
@@ -43,30 +64,54 @@ func (m *monitor) newWatcher() (chan error, error) {
 	watcher := make(chan error, watcherChannelSize)
 	m.watchers = append(m.watchers, watcher)
 
-	if !m.running {
-		m.running = true
-		m.wg.Add(1)
-
-		// create and start agent watcher
-		go func() {
-			tick := time.NewTicker(m.checkInterval)
-			for {
-				select {
-				case <-m.stopCh:
-					tick.Stop()
-					m.wg.Done()
-					return
-				case <-tick.C:
-					m.watchHypervisor()
-					m.watchAgent()
-				}
-			}
-		}()
-	}
+	m.start()
+
+	return watcher, nil
+}
+
+// newEventWatcher returns a channel the decisions of the monitor are
+// published on.
+func (m *monitor) newEventWatcher() (chan HealthEvent, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	watcher := make(chan HealthEvent, watcherChannelSize)
+	m.eventWatchers = append(m.eventWatchers, watcher)
+
+	m.start()
 
 	return watcher, nil
 }
 
+// start starts checking the sandbox if not running yet. It must be called
+// with the monitor lock held.
+func (m *monitor) start() {
+	if m.running {
+		return
+	}
+
+	m.running = true
+	m.wg.Add(1)
+
+	// create and start agent watcher
+	go func() {
+		tick := time.NewTicker(m.checkInterval)
+		for {
+			select {
+			case <-m.stopCh:
+				tick.Stop()
+				m.wg.Done()
+				return
+			case <-tick.C:
+				m.watchHypervisor()
+				m.watchAgent()
+				m.watchMemory()
+				m.watchOverhead()
+			}
+		}
+	}()
+}
+
 func (m *monitor) notify(err error) {
 	m.sandbox.agent.markDead()
 
@@ -111,6 +156,7 @@ func (m *monitor) stop() {
 	m.stopCh <- true
 	defer func() {
 		m.watchers = nil
+		m.eventWatchers = nil
 		m.running = false
 	}()
 
@@ -125,20 +171,181 @@ func (m *monitor) stop() {
 	for _, c := range m.watchers {
 		close(c)
 	}
+
+	for _, c := range m.eventWatchers {
+		close(c)
+	}
+}
+
+// publish logs a decision of the monitor and sends it to the event
+// watchers.
+func (m *monitor) publish(check string, decision HealthDecision, failures uint32, err error) {
+	event := HealthEvent{
+		Time:     time.Now(),
+		Check:    check,
+		Decision: decision,
+		Failures: failures,
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	m.sandbox.Logger().WithFields(event.logFields()).Info("sandbox health decision")
+
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.running {
+		return
+	}
+
+	// a watcher is not supposed to close the channel
+	// but just in case...
+	defer func() {
+		if x := recover(); x != nil {
+			virtLog.Warnf("event watcher closed channel: %v", x)
+		}
+	}()
+
+	for _, c := range m.eventWatchers {
+		select {
+		case c <- event:
+
+		default:
+			virtLog.WithField("channel-size", watcherChannelSize).Warnf("event watcher channel is full, throw health event")
+		}
+	}
+}
+
+// passed records a successful check, publishing its recovery if it
+// failed before.
+func (m *monitor) passed(check string) {
+	if failures := m.failures[check]; failures > 0 {
+		m.failures[check] = 0
+		m.publish(check, HealthDecisionRecovered, failures, nil)
+	}
+}
+
+// failed records a failed check, taking the actions of the health policy
+// once the failure threshold is reached.
+func (m *monitor) failed(check string, err error) {
+	m.failures[check]++
+	failures := m.failures[check]
+
+	if failures < m.policy.failureThreshold() {
+		m.publish(check, HealthDecisionTolerate, failures, err)
+		return
+	}
+
+	dumped := false
+	for _, action := range m.policy.actions() {
+		switch action {
+		case HealthActionReconnect:
+			if check != HealthCheckAgent {
+				continue
+			}
+
+			if m.reconnectAgent() {
+				m.failures[check] = 0
+				m.publish(check, HealthDecisionReconnected, failures, err)
+				return
+			}
+			m.publish(check, HealthDecisionReconnectFailed, failures, err)
+		case HealthActionDump:
+			m.publish(check, HealthDecisionDump, failures, err)
+			m.sandbox.dumpDiagnostics(check, err)
+			dumped = true
+		case HealthActionKill:
+			if !dumped {
+				m.sandbox.captureDiagnostics(check, err)
+			}
+			m.publish(check, HealthDecisionKill, failures, err)
+			m.notify(err)
+			return
+		}
+	}
+
+	// The sandbox is kept, the next failures are counted anew.
+	m.failures[check] = 0
+}
+
+// reconnectAgent tries to connect to the agent again, returning true if it
+// is reachable.
+func (m *monitor) reconnectAgent() bool {
+	for i := uint32(0); i < m.policy.agentReconnectAttempts(); i++ {
+		if err := m.sandbox.agent.reconnect(); err != nil {
+			m.sandbox.Logger().WithError(err).Warn("failed to reconnect to the agent")
+			continue
+		}
+
+		if err := m.sandbox.agent.check(m.sandbox.ctx); err == nil {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (m *monitor) watchAgent() {
-	err := m.sandbox.agent.check()
+	err := m.sandbox.agent.check(m.sandbox.ctx)
 	if err != nil {
 		// TODO: define and export error types
-		m.notify(errors.Wrapf(err, "failed to ping agent"))
+		m.failed(HealthCheckAgent, errors.Wrapf(err, "failed to ping agent"))
+		return
 	}
+	m.passed(HealthCheckAgent)
 }
 
 func (m *monitor) watchHypervisor() error {
 	if err := m.sandbox.hypervisor.check(); err != nil {
-		m.notify(errors.Wrapf(err, "failed to ping hypervisor process"))
+		m.failed(HealthCheckHypervisor, errors.Wrapf(err, "failed to ping hypervisor process"))
 		return err
 	}
+	m.passed(HealthCheckHypervisor)
+
+	if err := m.sandbox.checkVirtiofsVolumes(); err != nil {
+		m.failed(HealthCheckVirtiofs, errors.Wrapf(err, "virtio-fs volume daemon failure"))
+		return err
+	}
+	m.passed(HealthCheckVirtiofs)
+
 	return nil
 }
+
+// watchMemory publishes the guest memory use crossing the memory pressure
+// threshold, in both directions.
+func (m *monitor) watchMemory() {
+	if m.policy.MemoryPressureThreshold == 0 {
+		return
+	}
+
+	use, err := m.sandbox.guestMemoryUse()
+	if err != nil {
+		m.sandbox.Logger().WithError(err).Debug("failed to get guest memory use")
+		return
+	}
+
+	pressure := use >= m.policy.MemoryPressureThreshold
+	if pressure == m.memoryPressure {
+		return
+	}
+	m.memoryPressure = pressure
+
+	if pressure {
+		m.publish(HealthCheckMemory, HealthDecisionMemoryPressure, 0,
+			errors.Errorf("guest memory use %d%% above %d%%", use, m.policy.MemoryPressureThreshold))
+	} else {
+		m.publish(HealthCheckMemory, HealthDecisionRecovered, 0, nil)
+	}
+}
+
+// watchOverhead samples the overhead of the sandbox once per recording
+// interval.
+func (m *monitor) watchOverhead() {
+	if m.overhead == nil {
+		return
+	}
+
+	m.overhead.tick(time.Now())
+}
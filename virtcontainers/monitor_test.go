@@ -6,9 +6,13 @@
 package virtcontainers
 
 import (
+	"context"
 	"errors"
 	"testing"
+	"time"
 
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -58,3 +62,204 @@ func TestMonitorClosedChannel(t *testing.T) {
 
 	m.stop()
 }
+
+// failingHypervisor is a mock hypervisor failing its checks with err.
+type failingHypervisor struct {
+	mockHypervisor
+	err error
+}
+
+func (h *failingHypervisor) check() error {
+	return h.err
+}
+
+// failingAgent is a noop agent failing its checks until reconnected
+// recoverAfter times, recoverAfter being 0 for an agent never recovering.
+type failingAgent struct {
+	noopAgent
+	recoverAfter int
+	reconnects   int
+	memoryUsage  uint64
+}
+
+func (a *failingAgent) check(ctx context.Context) error {
+	if a.recoverAfter == 0 || a.reconnects < a.recoverAfter {
+		return errors.New("agent unreachable")
+	}
+	return nil
+}
+
+func (a *failingAgent) reconnect() error {
+	a.reconnects++
+	return nil
+}
+
+func (a *failingAgent) statsContainer(ctx context.Context, sandbox *Sandbox, c Container) (*ContainerStats, error) {
+	stats := &ContainerStats{
+		CgroupStats: &CgroupStats{},
+	}
+	stats.CgroupStats.MemoryStats.Usage.Usage = a.memoryUsage
+	return stats, nil
+}
+
+// newTestHealthMonitor returns a monitor of a sandbox, with its checks run
+// by the test only.
+func newTestHealthMonitor(t *testing.T, policy HealthPolicy) (*monitor, chan error, chan HealthEvent) {
+	contConfig := newTestContainerConfigNoop("505")
+
+	s, err := testCreateSandbox(t, testSandboxID, MockHypervisor, newHypervisorConfig(nil, nil), NoopAgentType, NetworkConfig{}, []ContainerConfig{contConfig}, nil)
+	assert.NoError(t, err)
+
+	s.config.HealthPolicy = policy
+	m := newMonitor(s)
+	m.checkInterval = time.Hour
+
+	ch, err := m.newWatcher()
+	assert.NoError(t, err)
+
+	events, err := m.newEventWatcher()
+	assert.NoError(t, err)
+
+	return m, ch, events
+}
+
+func assertHealthEvents(t *testing.T, events chan HealthEvent, check string, decisions ...HealthDecision) {
+	for _, d := range decisions {
+		select {
+		case e := <-events:
+			assert.Equal(t, check, e.Check)
+			assert.Equal(t, d, e.Decision)
+		default:
+			t.Fatalf("missing %s %s health event", check, d)
+		}
+	}
+
+	assert.Empty(t, events)
+}
+
+func TestMonitorFailureThreshold(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanUp()
+
+	m, ch, events := newTestHealthMonitor(t, HealthPolicy{
+		FailureThreshold: 2,
+		Actions:          []HealthAction{HealthActionReconnect, HealthActionDump, HealthActionKill},
+	})
+	defer m.stop()
+
+	h := &failingHypervisor{err: errors.New("qmp unreachable")}
+	m.sandbox.hypervisor = h
+
+	// A failure below the threshold is tolerated, and a check passing
+	// again reported.
+	assert.Error(m.watchHypervisor())
+	assertHealthEvents(t, events, HealthCheckHypervisor, HealthDecisionTolerate)
+
+	h.err = nil
+	assert.NoError(m.watchHypervisor())
+	assertHealthEvents(t, events, HealthCheckHypervisor, HealthDecisionRecovered)
+	assert.Empty(ch)
+
+	// Reaching the threshold triggers the actions, reconnecting only
+	// applying to the agent.
+	h.err = errors.New("qmp unreachable")
+	m.watchHypervisor()
+	m.watchHypervisor()
+	assertHealthEvents(t, events, HealthCheckHypervisor,
+		HealthDecisionTolerate, HealthDecisionDump, HealthDecisionKill)
+
+	err := <-ch
+	assert.Contains(err.Error(), "qmp unreachable")
+}
+
+func TestMonitorAgentReconnect(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanUp()
+
+	m, ch, events := newTestHealthMonitor(t, HealthPolicy{
+		AgentReconnectAttempts: 2,
+		Actions:                []HealthAction{HealthActionReconnect, HealthActionKill},
+	})
+	defer m.stop()
+
+	// The agent is reachable again on the second reconnection.
+	a := &failingAgent{recoverAfter: 2}
+	m.sandbox.agent = a
+
+	m.watchAgent()
+	assert.Equal(2, a.reconnects)
+	assertHealthEvents(t, events, HealthCheckAgent, HealthDecisionReconnected)
+	assert.Empty(ch)
+
+	m.watchAgent()
+	assert.Empty(events)
+
+	// The sandbox is killed once reconnecting failed.
+	a = &failingAgent{}
+	m.sandbox.agent = a
+
+	m.watchAgent()
+	assert.Equal(2, a.reconnects)
+	assertHealthEvents(t, events, HealthCheckAgent, HealthDecisionReconnectFailed, HealthDecisionKill)
+
+	err := <-ch
+	assert.Contains(err.Error(), "agent unreachable")
+}
+
+func TestMonitorDefaultPolicy(t *testing.T) {
+	defer cleanUp()
+
+	m, ch, events := newTestHealthMonitor(t, HealthPolicy{})
+	defer m.stop()
+
+	// The sandbox is killed on the first failure.
+	m.sandbox.agent = &failingAgent{}
+	m.watchAgent()
+	assertHealthEvents(t, events, HealthCheckAgent, HealthDecisionKill)
+	assert.Error(t, <-ch)
+}
+
+func TestMonitorMemoryPressure(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanUp()
+
+	m, ch, events := newTestHealthMonitor(t, HealthPolicy{
+		MemoryPressureThreshold: 90,
+	})
+	defer m.stop()
+
+	a := &failingAgent{memoryUsage: 95 << 20}
+	m.sandbox.agent = a
+
+	// Only running containers are accounted.
+	m.watchMemory()
+	assert.Empty(events)
+
+	for _, c := range m.sandbox.containers {
+		c.state.State = types.StateRunning
+		c.config.Resources.Memory = &specs.LinuxMemory{Limit: &[]int64{100 << 20}[0]}
+	}
+
+	m.watchMemory()
+	assertHealthEvents(t, events, HealthCheckMemory, HealthDecisionMemoryPressure)
+
+	// Crossing the threshold is only reported once.
+	m.watchMemory()
+	assert.Empty(events)
+
+	a.memoryUsage = 50 << 20
+	m.watchMemory()
+	assertHealthEvents(t, events, HealthCheckMemory, HealthDecisionRecovered)
+
+	// Memory pressure does not kill the sandbox.
+	assert.Empty(ch)
+}
+
+func TestHealthPolicyValid(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(HealthPolicy{}.Valid())
+	assert.NoError(HealthPolicy{Actions: []HealthAction{HealthActionReconnect, HealthActionDump, HealthActionKill}}.Valid())
+	assert.Error(HealthPolicy{Actions: []HealthAction{"restart"}}.Valid())
+	assert.Error(HealthPolicy{MemoryPressureThreshold: 101}.Valid())
+}
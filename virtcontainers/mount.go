@@ -6,9 +6,11 @@
 package virtcontainers
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -186,6 +188,178 @@ func getDeviceForPath(path string) (device, error) {
 	return dev, nil
 }
 
+var procMountInfo = "/proc/self/mountinfo"
+
+// directBlockVolumeFsTypes lists the file systems that can be mounted in
+// the guest from a directly assigned block volume.
+var directBlockVolumeFsTypes = []string{"ext2", "ext3", "ext4", "xfs", "btrfs"}
+
+func isDirectBlockVolumeFsType(fsType string) bool {
+	for _, t := range directBlockVolumeFsTypes {
+		if t == fsType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mountInfo describes a mount as found in /proc/self/mountinfo.
+type mountInfo struct {
+	// root is the directory of the file system mounted at mountPoint.
+	root       string
+	mountPoint string
+	fsType     string
+	source     string
+	// superOptions are the options of the file system superblock.
+	superOptions []string
+}
+
+// parseMountInfo returns the last mount found at mountPoint in r, i.e.
+// the one that is visible.
+func parseMountInfo(r io.Reader, mountPoint string) (*mountInfo, error) {
+	var info *mountInfo
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// ID parentID major:minor root mountPoint options [optional...] - fsType source superOptions
+		text := scanner.Text()
+		index := strings.Index(text, " - ")
+		if index < 0 {
+			return nil, fmt.Errorf("Found no separator in %q", text)
+		}
+
+		fields := strings.Fields(text[:index])
+		postFields := strings.Fields(text[index+3:])
+		if len(fields) < 6 || len(postFields) < 3 {
+			return nil, fmt.Errorf("Malformed mountinfo line %q", text)
+		}
+
+		if fields[4] != mountPoint {
+			continue
+		}
+
+		info = &mountInfo{
+			root:         fields[3],
+			mountPoint:   fields[4],
+			fsType:       postFields[0],
+			source:       postFields[1],
+			superOptions: strings.Split(postFields[2], ","),
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if info == nil {
+		return nil, errMountPointNotFound
+	}
+
+	return info, nil
+}
+
+// hostBlockMount describes a file system mounted on the host from a block
+// device.
+type hostBlockMount struct {
+	device  string
+	fsType  string
+	options []string
+	major   int
+	minor   int
+}
+
+// getBlockDeviceForMount returns the block device holding the file system
+// mounted at path, or nil if path is not the root of a file system backed by
+// a block device that the guest can mount. Bind mounts of a sub-directory
+// are rejected as the whole file system would be exposed to the guest, and
+// so are file systems with a read-write superblock, which the host may
+// write through another mount behind the back of the guest.
+func getBlockDeviceForMount(path string) (*hostBlockMount, error) {
+	dev, err := getDeviceForPath(path)
+	if err == errMountPointNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if dev.mountPoint != filepath.Clean(path) {
+		return nil, nil
+	}
+
+	f, err := os.Open(procMountInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := parseMountInfo(f, dev.mountPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.root != "/" || !isDirectBlockVolumeFsType(info.fsType) || !isReadOnlySuperblock(info.superOptions) {
+		return nil, nil
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Stat(info.source, &stat); err != nil {
+		return nil, nil
+	}
+
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFBLK || major(stat.Rdev) != dev.major || minor(stat.Rdev) != dev.minor {
+		return nil, nil
+	}
+
+	return &hostBlockMount{
+		device:  info.source,
+		fsType:  info.fsType,
+		options: guestMountOptions(info.fsType, info.superOptions),
+		major:   dev.major,
+		minor:   dev.minor,
+	}, nil
+}
+
+// isReadOnlySuperblock checks whether the superblock options of a file system
+// mount it read-only, for every mount of the file system.
+func isReadOnlySuperblock(options []string) bool {
+	for _, opt := range options {
+		if opt == "ro" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// guestMountOptions returns the options the guest mounts a directly
+// assigned file system with: the host superblock options that can be passed
+// on, and the ones mounting it read-only without replaying its journal, as
+// the device is read-only.
+func guestMountOptions(fsType string, options []string) []string {
+	guestOptions := []string{"ro"}
+
+	for _, opt := range options {
+		switch opt {
+		case "rw", "ro", "seclabel":
+			continue
+		}
+		guestOptions = append(guestOptions, opt)
+	}
+
+	switch fsType {
+	case "ext3", "ext4":
+		guestOptions = append(guestOptions, "noload")
+	case "xfs":
+		guestOptions = append(guestOptions, "norecovery")
+	case "btrfs":
+		guestOptions = append(guestOptions, "nologreplay")
+	}
+
+	return guestOptions
+}
+
 var blockFormatTemplate = "/sys/dev/block/%d:%d/dm"
 
 var checkStorageDriver = isDeviceMapper
@@ -305,6 +479,24 @@ type Mount struct {
 	// VM in case this mount is a block device file or a directory
 	// backed by a block device.
 	BlockDeviceID string
+
+	// BlockDeviceFsType is the file system of a directly assigned block
+	// volume. When set, the host mount is bypassed and the agent mounts
+	// the block device with this file system in the guest.
+	BlockDeviceFsType string
+
+	// BlockDeviceOptions are the options used by the agent to mount a
+	// directly assigned block volume.
+	BlockDeviceOptions []string
+
+	// VirtiofsTag is the tag of the dedicated virtio-fs device sharing
+	// this volume with the guest, if any.
+	VirtiofsTag string
+
+	// VirtiofsCache is the virtio-fs cache mode requested for this
+	// volume. When set, the volume is shared through a dedicated
+	// virtiofsd using this cache mode.
+	VirtiofsCache string
 }
 
 func isSymlink(path string) bool {
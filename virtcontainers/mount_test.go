@@ -206,6 +206,69 @@ func TestGetDeviceForPathBindMount(t *testing.T) {
 	assert.Equal(sourceDev, destDev)
 }
 
+func TestParseMountInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	mountInfo := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw,errors=remount-ro
+101 22 7:0 / /var/lib/kubelet/pods/p/volumes/pv rw,relatime shared:50 - ext4 /dev/loop0 rw,seclabel,data=ordered
+102 22 7:0 /sub /var/lib/kubelet/pods/q/volumes/pv rw,relatime - ext4 /dev/loop0 rw,data=ordered
+103 22 0:5 / /var/lib/kubelet/pods/q/volumes/pv rw - tmpfs tmpfs rw
+`
+
+	info, err := parseMountInfo(strings.NewReader(mountInfo), "/var/lib/kubelet/pods/p/volumes/pv")
+	assert.NoError(err)
+	assert.Equal("/", info.root)
+	assert.Equal("ext4", info.fsType)
+	assert.Equal("/dev/loop0", info.source)
+	assert.Equal([]string{"rw", "seclabel", "data=ordered"}, info.superOptions)
+
+	// the last mount is the visible one
+	info, err = parseMountInfo(strings.NewReader(mountInfo), "/var/lib/kubelet/pods/q/volumes/pv")
+	assert.NoError(err)
+	assert.Equal("tmpfs", info.fsType)
+
+	_, err = parseMountInfo(strings.NewReader(mountInfo), "/foo")
+	assert.Equal(errMountPointNotFound, err)
+
+	_, err = parseMountInfo(strings.NewReader("22 1 8:1 / / rw\n"), "/")
+	assert.Error(err)
+}
+
+func TestGuestMountOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"ro"}, guestMountOptions("ext2", []string{"rw", "seclabel"}))
+	assert.Equal([]string{"ro", "errors=remount-ro", "data=ordered", "noload"},
+		guestMountOptions("ext4", []string{"ro", "errors=remount-ro", "seclabel", "data=ordered"}))
+	assert.Equal([]string{"ro", "norecovery"}, guestMountOptions("xfs", []string{"rw"}))
+}
+
+func TestIsReadOnlySuperblock(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isReadOnlySuperblock([]string{"ro", "seclabel"}))
+	assert.False(isReadOnlySuperblock([]string{"rw", "seclabel", "data=ordered"}))
+	assert.False(isReadOnlySuperblock(nil))
+}
+
+func TestGetBlockDeviceForMount(t *testing.T) {
+	assert := assert.New(t)
+
+	// the temporary directory is not a mount point
+	dir, err := ioutil.TempDir("", "direct-volume")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	bm, err := getBlockDeviceForMount(dir)
+	assert.NoError(err)
+	assert.Nil(bm)
+
+	// /proc is not backed by a block device
+	bm, err = getBlockDeviceForMount("/proc")
+	assert.NoError(err)
+	assert.Nil(bm)
+}
+
 func TestIsDeviceMapper(t *testing.T) {
 	assert := assert.New(t)
 
@@ -37,7 +37,7 @@ func (n *noopAgent) longLiveConn() bool {
 }
 
 // createSandbox is the Noop agent sandbox creation implementation. It does nothing.
-func (n *noopAgent) createSandbox(sandbox *Sandbox) error {
+func (n *noopAgent) createSandbox(ctx context.Context, sandbox *Sandbox) error {
 	return nil
 }
 
@@ -51,128 +51,138 @@ func (n *noopAgent) disconnect() error {
 	return nil
 }
 
+// reconnect is the Noop agent reconnection implementation. It does nothing.
+func (n *noopAgent) reconnect() error {
+	return nil
+}
+
 // exec is the Noop agent command execution implementation. It does nothing.
-func (n *noopAgent) exec(sandbox *Sandbox, c Container, cmd types.Cmd) (*Process, error) {
+func (n *noopAgent) exec(ctx context.Context, sandbox *Sandbox, c Container, cmd types.Cmd) (*Process, error) {
 	return nil, nil
 }
 
 // startSandbox is the Noop agent Sandbox starting implementation. It does nothing.
-func (n *noopAgent) startSandbox(sandbox *Sandbox) error {
+func (n *noopAgent) startSandbox(ctx context.Context, sandbox *Sandbox) error {
 	return nil
 }
 
 // stopSandbox is the Noop agent Sandbox stopping implementation. It does nothing.
-func (n *noopAgent) stopSandbox(sandbox *Sandbox) error {
+func (n *noopAgent) stopSandbox(ctx context.Context, sandbox *Sandbox) error {
 	return nil
 }
 
 // createContainer is the Noop agent Container creation implementation. It does nothing.
-func (n *noopAgent) createContainer(sandbox *Sandbox, c *Container) (*Process, error) {
+func (n *noopAgent) createContainer(ctx context.Context, sandbox *Sandbox, c *Container) (*Process, error) {
 	return &Process{}, nil
 }
 
 // startContainer is the Noop agent Container starting implementation. It does nothing.
-func (n *noopAgent) startContainer(sandbox *Sandbox, c *Container) error {
+func (n *noopAgent) startContainer(ctx context.Context, sandbox *Sandbox, c *Container) error {
 	return nil
 }
 
 // stopContainer is the Noop agent Container stopping implementation. It does nothing.
-func (n *noopAgent) stopContainer(sandbox *Sandbox, c Container) error {
+func (n *noopAgent) stopContainer(ctx context.Context, sandbox *Sandbox, c Container) error {
 	return nil
 }
 
 // signalProcess is the Noop agent Container signaling implementation. It does nothing.
-func (n *noopAgent) signalProcess(c *Container, processID string, signal syscall.Signal, all bool) error {
+func (n *noopAgent) signalProcess(ctx context.Context, c *Container, processID string, signal syscall.Signal, all bool) error {
 	return nil
 }
 
 // processListContainer is the Noop agent Container ps implementation. It does nothing.
-func (n *noopAgent) processListContainer(sandbox *Sandbox, c Container, options ProcessListOptions) (ProcessList, error) {
+func (n *noopAgent) processListContainer(ctx context.Context, sandbox *Sandbox, c Container, options ProcessListOptions) (ProcessList, error) {
 	return nil, nil
 }
 
 // updateContainer is the Noop agent Container update implementation. It does nothing.
-func (n *noopAgent) updateContainer(sandbox *Sandbox, c Container, resources specs.LinuxResources) error {
+func (n *noopAgent) updateContainer(ctx context.Context, sandbox *Sandbox, c Container, resources specs.LinuxResources) error {
 	return nil
 }
 
 // memHotplugByProbe is the Noop agent notify meomory hotplug event via probe interface implementation. It does nothing.
-func (n *noopAgent) memHotplugByProbe(addr uint64, sizeMB uint32, memorySectionSizeMB uint32) error {
+func (n *noopAgent) memHotplugByProbe(ctx context.Context, addr uint64, sizeMB uint32, memorySectionSizeMB uint32) error {
 	return nil
 }
 
 // onlineCPUMem is the Noop agent Container online CPU and Memory implementation. It does nothing.
-func (n *noopAgent) onlineCPUMem(cpus uint32, cpuOnly bool) error {
+func (n *noopAgent) onlineCPUMem(ctx context.Context, cpus uint32, cpuOnly bool) error {
 	return nil
 }
 
 // updateInterface is the Noop agent Interface update implementation. It does nothing.
-func (n *noopAgent) updateInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+func (n *noopAgent) updateInterface(ctx context.Context, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
 	return nil, nil
 }
 
 // listInterfaces is the Noop agent Interfaces list implementation. It does nothing.
-func (n *noopAgent) listInterfaces() ([]*vcTypes.Interface, error) {
+func (n *noopAgent) listInterfaces(ctx context.Context) ([]*vcTypes.Interface, error) {
 	return nil, nil
 }
 
 // updateRoutes is the Noop agent Routes update implementation. It does nothing.
-func (n *noopAgent) updateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+func (n *noopAgent) updateRoutes(ctx context.Context, routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
 	return nil, nil
 }
 
 // listRoutes is the Noop agent Routes list implementation. It does nothing.
-func (n *noopAgent) listRoutes() ([]*vcTypes.Route, error) {
+func (n *noopAgent) listRoutes(ctx context.Context) ([]*vcTypes.Route, error) {
 	return nil, nil
 }
 
 // check is the Noop agent health checker. It does nothing.
-func (n *noopAgent) check() error {
+func (n *noopAgent) check(ctx context.Context) error {
 	return nil
 }
 
 // statsContainer is the Noop agent Container stats implementation. It does nothing.
-func (n *noopAgent) statsContainer(sandbox *Sandbox, c Container) (*ContainerStats, error) {
+func (n *noopAgent) statsContainer(ctx context.Context, sandbox *Sandbox, c Container) (*ContainerStats, error) {
 	return &ContainerStats{}, nil
 }
 
 // waitProcess is the Noop agent process waiter. It does nothing.
-func (n *noopAgent) waitProcess(c *Container, processID string) (int32, error) {
+func (n *noopAgent) waitProcess(ctx context.Context, c *Container, processID string) (int32, error) {
 	return 0, nil
 }
 
 // winsizeProcess is the Noop agent process tty resizer. It does nothing.
-func (n *noopAgent) winsizeProcess(c *Container, processID string, height, width uint32) error {
+func (n *noopAgent) winsizeProcess(ctx context.Context, c *Container, processID string, height, width uint32) error {
 	return nil
 }
 
 // writeProcessStdin is the Noop agent process stdin writer. It does nothing.
-func (n *noopAgent) writeProcessStdin(c *Container, ProcessID string, data []byte) (int, error) {
+func (n *noopAgent) writeProcessStdin(ctx context.Context, c *Container, ProcessID string, data []byte) (int, error) {
 	return 0, nil
 }
 
 // closeProcessStdin is the Noop agent process stdin closer. It does nothing.
-func (n *noopAgent) closeProcessStdin(c *Container, ProcessID string) error {
+func (n *noopAgent) closeProcessStdin(ctx context.Context, c *Container, ProcessID string) error {
 	return nil
 }
 
 // readProcessStdout is the Noop agent process stdout reader. It does nothing.
-func (n *noopAgent) readProcessStdout(c *Container, processID string, data []byte) (int, error) {
+func (n *noopAgent) readProcessStdout(ctx context.Context, c *Container, processID string, data []byte) (int, error) {
 	return 0, nil
 }
 
 // readProcessStderr is the Noop agent process stderr reader. It does nothing.
-func (n *noopAgent) readProcessStderr(c *Container, processID string, data []byte) (int, error) {
+func (n *noopAgent) readProcessStderr(ctx context.Context, c *Container, processID string, data []byte) (int, error) {
 	return 0, nil
 }
 
+// processGuestPid is the Noop agent guest pid getter. It does nothing.
+func (n *noopAgent) processGuestPid(ctx context.Context, c *Container, processID string) (uint32, error) {
+	return 0, ErrGuestPidUnsupported
+}
+
 // pauseContainer is the Noop agent Container pause implementation. It does nothing.
-func (n *noopAgent) pauseContainer(sandbox *Sandbox, c Container) error {
+func (n *noopAgent) pauseContainer(ctx context.Context, sandbox *Sandbox, c Container) error {
 	return nil
 }
 
 // resumeContainer is the Noop agent Container resume implementation. It does nothing.
-func (n *noopAgent) resumeContainer(sandbox *Sandbox, c Container) error {
+func (n *noopAgent) resumeContainer(ctx context.Context, sandbox *Sandbox, c Container) error {
 	return nil
 }
 
@@ -186,7 +196,7 @@ func (n *noopAgent) configureFromGrpc(h hypervisor, id string, builtin bool, con
 }
 
 // reseedRNG is the Noop agent RND reseeder. It does nothing.
-func (n *noopAgent) reseedRNG(data []byte) error {
+func (n *noopAgent) reseedRNG(ctx context.Context, data []byte) error {
 	return nil
 }
 
@@ -209,17 +219,17 @@ func (n *noopAgent) setProxyFromGrpc(proxy proxy, pid int, url string) {
 }
 
 // getGuestDetails is the Noop agent GuestDetails queryer. It does nothing.
-func (n *noopAgent) getGuestDetails(*grpc.GuestDetailsRequest) (*grpc.GuestDetailsResponse, error) {
+func (n *noopAgent) getGuestDetails(context.Context, *grpc.GuestDetailsRequest) (*grpc.GuestDetailsResponse, error) {
 	return nil, nil
 }
 
 // setGuestDateTime is the Noop agent guest time setter. It does nothing.
-func (n *noopAgent) setGuestDateTime(time.Time) error {
+func (n *noopAgent) setGuestDateTime(context.Context, time.Time) error {
 	return nil
 }
 
 // copyFile is the Noop agent copy file. It does nothing.
-func (n *noopAgent) copyFile(src, dst string) error {
+func (n *noopAgent) copyFile(ctx context.Context, src, dst string) error {
 	return nil
 }
 
@@ -237,6 +247,6 @@ func (n *noopAgent) save() (s persistapi.AgentState) {
 // load is the Noop agent state loader. It does nothing.
 func (n *noopAgent) load(s persistapi.AgentState) {}
 
-func (n *noopAgent) getOOMEvent() (string, error) {
+func (n *noopAgent) getOOMEvent(ctx context.Context) (string, error) {
 	return "", nil
 }
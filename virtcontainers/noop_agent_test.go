@@ -55,7 +55,7 @@ func TestNoopAgentExec(t *testing.T) {
 	assert.NoError(err)
 	defer cleanUp()
 
-	_, err = n.exec(sandbox, *container, cmd)
+	_, err = n.exec(context.Background(), sandbox, *container, cmd)
 	assert.NoError(err)
 }
 
@@ -64,7 +64,7 @@ func TestNoopAgentStartSandbox(t *testing.T) {
 	sandbox := &Sandbox{}
 	assert := assert.New(t)
 
-	err := n.startSandbox(sandbox)
+	err := n.startSandbox(context.Background(), sandbox)
 	assert.NoError(err)
 }
 
@@ -73,7 +73,7 @@ func TestNoopAgentStopSandbox(t *testing.T) {
 	sandbox := &Sandbox{}
 	assert := assert.New(t)
 
-	err := n.stopSandbox(sandbox)
+	err := n.stopSandbox(context.Background(), sandbox)
 	assert.NoError(err)
 }
 
@@ -84,10 +84,10 @@ func TestNoopAgentCreateContainer(t *testing.T) {
 	assert.NoError(err)
 	defer cleanUp()
 
-	err = n.startSandbox(sandbox)
+	err = n.startSandbox(context.Background(), sandbox)
 	assert.NoError(err)
 
-	_, err = n.createContainer(sandbox, container)
+	_, err = n.createContainer(context.Background(), sandbox, container)
 	assert.NoError(err)
 }
 
@@ -99,7 +99,7 @@ func TestNoopAgentStartContainer(t *testing.T) {
 	assert.NoError(err)
 	defer cleanUp()
 
-	err = n.startContainer(sandbox, container)
+	err = n.startContainer(context.Background(), sandbox, container)
 	assert.NoError(err)
 }
 
@@ -110,7 +110,7 @@ func TestNoopAgentStopContainer(t *testing.T) {
 	assert.NoError(err)
 	defer cleanUp()
 
-	err = n.stopContainer(sandbox, *container)
+	err = n.stopContainer(context.Background(), sandbox, *container)
 	assert.NoError(err)
 }
 
@@ -121,7 +121,7 @@ func TestNoopAgentStatsContainer(t *testing.T) {
 	assert.NoError(err)
 
 	defer cleanUp()
-	_, err = n.statsContainer(sandbox, *container)
+	_, err = n.statsContainer(context.Background(), sandbox, *container)
 	assert.NoError(err)
 }
 
@@ -132,7 +132,7 @@ func TestNoopAgentPauseContainer(t *testing.T) {
 	assert.NoError(err)
 
 	defer cleanUp()
-	err = n.pauseContainer(sandbox, *container)
+	err = n.pauseContainer(context.Background(), sandbox, *container)
 	assert.NoError(err)
 }
 
@@ -142,7 +142,7 @@ func TestNoopAgentResumeContainer(t *testing.T) {
 	sandbox, container, err := testCreateNoopContainer()
 	assert.NoError(err)
 	defer cleanUp()
-	err = n.resumeContainer(sandbox, *container)
+	err = n.resumeContainer(context.Background(), sandbox, *container)
 	assert.NoError(err)
 }
 
@@ -173,42 +173,42 @@ func TestNoopAgentProcessListContainer(t *testing.T) {
 	sandbox, container, err := testCreateNoopContainer()
 	assert.NoError(err)
 	defer cleanUp()
-	_, err = n.processListContainer(sandbox, *container, ProcessListOptions{})
+	_, err = n.processListContainer(context.Background(), sandbox, *container, ProcessListOptions{})
 	assert.NoError(err)
 }
 
 func TestNoopAgentReseedRNG(t *testing.T) {
 	assert := assert.New(t)
 	n := &noopAgent{}
-	err := n.reseedRNG([]byte{})
+	err := n.reseedRNG(context.Background(), []byte{})
 	assert.NoError(err)
 }
 
 func TestNoopAgentUpdateInterface(t *testing.T) {
 	assert := assert.New(t)
 	n := &noopAgent{}
-	_, err := n.updateInterface(nil)
+	_, err := n.updateInterface(context.Background(), nil)
 	assert.NoError(err)
 }
 
 func TestNoopAgentListInterfaces(t *testing.T) {
 	assert := assert.New(t)
 	n := &noopAgent{}
-	_, err := n.listInterfaces()
+	_, err := n.listInterfaces(context.Background())
 	assert.NoError(err)
 }
 
 func TestNoopAgentUpdateRoutes(t *testing.T) {
 	assert := assert.New(t)
 	n := &noopAgent{}
-	_, err := n.updateRoutes(nil)
+	_, err := n.updateRoutes(context.Background(), nil)
 	assert.NoError(err)
 }
 
 func TestNoopAgentListRoutes(t *testing.T) {
 	n := &noopAgent{}
 	assert := assert.New(t)
-	_, err := n.listRoutes()
+	_, err := n.listRoutes(context.Background())
 	assert.NoError(err)
 }
 
@@ -234,7 +234,7 @@ func TestNoopCopyFile(t *testing.T) {
 	assert := assert.New(t)
 	n := &noopAgent{}
 
-	err := n.copyFile("", "")
+	err := n.copyFile(context.Background(), "", "")
 	assert.Nil(err)
 }
 
@@ -242,7 +242,7 @@ func TestNoopGetOOMEvent(t *testing.T) {
 	assert := assert.New(t)
 	n := &noopAgent{}
 
-	containerID, err := n.getOOMEvent()
+	containerID, err := n.getOOMEvent(context.Background())
 	assert.Nil(err)
 	assert.Empty(containerID)
 }
@@ -0,0 +1,466 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/utils"
+	"github.com/pkg/errors"
+)
+
+var getRssFunc = utils.GetRss
+
+// overheadRecordSuffix is the suffix of the overhead record files, named
+// after their sandbox.
+const overheadRecordSuffix = ".json"
+
+// OverheadConfig configures the recording of the resource overhead of a
+// sandbox.
+type OverheadConfig struct {
+	// Dir is the host directory the overhead records are written to, one
+	// per sandbox. Records are kept after their sandbox is gone, until
+	// pruned.
+	Dir string
+
+	// Interval is the time between two samples of the overhead. Nothing is
+	// recorded if it is 0.
+	Interval time.Duration
+
+	// MaxRecords is the number of most recent records kept in Dir, and
+	// MaxAge the age beyond which records are removed, 0 keeping all.
+	MaxRecords uint32
+	MaxAge     time.Duration
+}
+
+// OverheadSample is the resource overhead of a sandbox at a point in time.
+// Memory sizes are in bytes.
+type OverheadSample struct {
+	Time time.Time
+
+	// VMMRss is the resident memory of the hypervisor process, guest
+	// memory included.
+	VMMRss uint64
+
+	// VirtiofsdRss is the resident memory of the virtiofsd daemons.
+	VirtiofsdRss uint64
+
+	// TemplateShared is the hypervisor memory still shared with the VM
+	// template the VM was cloned from. It is paid once for all clones.
+	TemplateShared uint64
+
+	// GuestContainers is the memory used by the containers in the guest.
+	GuestContainers uint64
+
+	// Guest is the rest of the hypervisor memory: the guest kernel, the
+	// agent and the guest caches, and the hypervisor own memory.
+	Guest uint64
+
+	// Memory is the memory overhead of the sandbox, Guest plus
+	// VirtiofsdRss.
+	Memory uint64
+
+	// CPU is the CPU time used by the sandbox on the host and not by the
+	// containers in the guest since the previous sample, in cores.
+	CPU float64
+}
+
+// OverheadHypervisor identifies the hypervisor configuration of sandboxes
+// whose overheads are comparable.
+type OverheadHypervisor struct {
+	Type       HypervisorType
+	Path       string
+	KernelPath string
+	ImagePath  string
+	InitrdPath string
+	SharedFS   string
+	NumVCPUs   uint32
+	MemorySize uint32
+	Template   bool
+}
+
+// OverheadRecord is the resource overhead of a sandbox over its lifetime.
+type OverheadRecord struct {
+	SandboxID  string
+	Hypervisor OverheadHypervisor
+	Start      time.Time
+	Samples    uint64
+
+	// Last is the last sample, Peak the highest value of each overhead
+	// component. The time of Peak is the one of the Memory peak.
+	Last OverheadSample
+	Peak OverheadSample
+}
+
+// OverheadRecommendation is the pod overhead recommended for the sandboxes
+// of a hypervisor configuration.
+type OverheadRecommendation struct {
+	Hypervisor OverheadHypervisor
+	Sandboxes  int
+	Samples    uint64
+
+	// Peak holds the highest value of each overhead component across the
+	// sandboxes.
+	Peak OverheadSample
+
+	// Memory and MilliCPU are the peak memory and CPU overheads plus the
+	// margin, rounded up to the MiB and the millicore.
+	Memory   uint64
+	MilliCPU uint64
+
+	// PodFixed is the overhead as Kubernetes resource quantities, for the
+	// overhead.podFixed field of a RuntimeClass.
+	PodFixed map[string]string
+}
+
+// overheadRecorder samples the overhead of a sandbox and keeps its record
+// up to date on disk.
+type overheadRecorder struct {
+	sandbox *Sandbox
+	config  OverheadConfig
+	record  OverheadRecord
+	next    time.Time
+
+	// CPU usage counters of the previous sample, in nanoseconds, and
+	// the time they were read at.
+	hostCPU  uint64
+	guestCPU uint64
+	cpuTime  time.Time
+}
+
+func newOverheadRecorder(s *Sandbox, config OverheadConfig) *overheadRecorder {
+	conf := s.config.HypervisorConfig
+
+	return &overheadRecorder{
+		sandbox: s,
+		config:  config,
+		record: OverheadRecord{
+			SandboxID: s.id,
+			Hypervisor: OverheadHypervisor{
+				Type:       s.config.HypervisorType,
+				Path:       conf.HypervisorPath,
+				KernelPath: conf.KernelPath,
+				ImagePath:  conf.ImagePath,
+				InitrdPath: conf.InitrdPath,
+				SharedFS:   conf.SharedFS,
+				NumVCPUs:   conf.NumVCPUs,
+				MemorySize: conf.MemorySize,
+				Template:   conf.BootFromTemplate,
+			},
+		},
+	}
+}
+
+// tick samples the overhead if the interval elapsed since the last sample.
+func (r *overheadRecorder) tick(now time.Time) {
+	if now.Before(r.next) {
+		return
+	}
+	r.next = now.Add(r.config.Interval)
+
+	sample, err := r.sample(now)
+	if err != nil {
+		r.sandbox.Logger().WithError(err).Debug("failed to sample sandbox overhead")
+		return
+	}
+
+	r.add(sample)
+
+	if err := r.save(); err != nil {
+		r.sandbox.Logger().WithError(err).Warn("failed to save sandbox overhead")
+		return
+	}
+
+	// The records of running sandboxes are kept fresh, so pruning once
+	// per sandbox is enough to only let the old ones go.
+	if r.record.Samples == 1 {
+		if err := pruneOverheadRecords(r.config.Dir, r.config.MaxRecords, r.config.MaxAge, now); err != nil {
+			r.sandbox.Logger().WithError(err).Warn("failed to prune overhead records")
+		}
+	}
+}
+
+// sample measures the overhead components of the sandbox.
+func (r *overheadRecorder) sample(now time.Time) (OverheadSample, error) {
+	s := r.sandbox
+	sample := OverheadSample{Time: now}
+
+	pids := s.hypervisor.getPids()
+	if len(pids) == 0 || pids[0] <= 0 {
+		return sample, fmt.Errorf("Invalid hypervisor PID: %+v", pids)
+	}
+
+	var err error
+	sample.VMMRss, err = getRssFunc(pids[0])
+	if err != nil {
+		return sample, err
+	}
+
+	daemons := append([]int{}, pids[1:]...)
+	for _, pid := range append(daemons, s.virtiofsVolumePids()...) {
+		if pid <= 0 {
+			continue
+		}
+
+		rss, err := getRssFunc(pid)
+		if err != nil {
+			return sample, err
+		}
+		sample.VirtiofsdRss += rss
+	}
+
+	conf := s.config.HypervisorConfig
+	if conf.BootFromTemplate && conf.MemoryPath != "" {
+		stats, err := utils.GetMappingStats(pids[0], conf.MemoryPath)
+		if err != nil {
+			return sample, err
+		}
+		for _, st := range stats {
+			sample.TemplateShared += st.Shared()
+		}
+	}
+
+	var guestCPU uint64
+	for _, c := range s.runningContainers() {
+		stats, err := s.agent.statsContainer(s.ctx, s, c)
+		if err != nil {
+			return sample, err
+		}
+
+		if stats.CgroupStats != nil {
+			sample.GuestContainers += stats.CgroupStats.MemoryStats.Usage.Usage
+			guestCPU += stats.CgroupStats.CPUStats.CPUUsage.TotalUsage
+		}
+	}
+
+	sample.Guest = subOrZero(subOrZero(sample.VMMRss, sample.TemplateShared), sample.GuestContainers)
+	sample.Memory = sample.Guest + sample.VirtiofsdRss
+
+	// The CPU overhead needs the sandbox cgroup.
+	stats, err := s.cgroupStats()
+	if err != nil {
+		s.Logger().WithError(err).Debug("failed to get sandbox CPU usage")
+		return sample, nil
+	}
+
+	hostCPU := stats.CPUStats.CPUUsage.TotalUsage
+	if !r.cpuTime.IsZero() {
+		sample.CPU = cpuOverhead(r.hostCPU, hostCPU, r.guestCPU, guestCPU, now.Sub(r.cpuTime))
+	}
+	r.hostCPU = hostCPU
+	r.guestCPU = guestCPU
+	r.cpuTime = now
+
+	return sample, nil
+}
+
+// add accounts sample in the record.
+func (r *overheadRecorder) add(sample OverheadSample) {
+	if r.record.Samples == 0 {
+		r.record.Start = sample.Time
+	}
+	r.record.Samples++
+	r.record.Last = sample
+	r.record.Peak = peakOverhead(r.record.Peak, sample)
+}
+
+// save atomically writes the record to the overhead directory.
+func (r *overheadRecorder) save() error {
+	if err := os.MkdirAll(r.config.Dir, DirMode); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(r.record)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(r.config.Dir, r.record.SandboxID+overheadRecordSuffix)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// pruneOverheadRecords removes the records of dir older than maxAge, and
+// the oldest records beyond the maxRecords most recent ones, 0 keeping all
+// of them.
+func pruneOverheadRecords(dir string, maxRecords uint32, maxAge time.Duration, now time.Time) error {
+	if maxRecords == 0 && maxAge == 0 {
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+overheadRecordSuffix))
+	if err != nil {
+		return err
+	}
+
+	var records []os.FileInfo
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if maxAge > 0 && now.Sub(fi.ModTime()) > maxAge {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+
+		records = append(records, fi)
+	}
+
+	if maxRecords == 0 || len(records) <= int(maxRecords) {
+		return nil
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ModTime().Before(records[j].ModTime())
+	})
+
+	for _, r := range records[:len(records)-int(maxRecords)] {
+		if err := os.Remove(filepath.Join(dir, r.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadOverheadRecords returns the overhead records found in dir.
+func ReadOverheadRecords(dir string) ([]OverheadRecord, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+overheadRecordSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	var records []OverheadRecord
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var record OverheadRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, errors.Wrapf(err, "Invalid overhead record %s", path)
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// RecommendOverhead aggregates the records per hypervisor configuration,
+// and recommends for each the peak overhead plus margin percent.
+func RecommendOverhead(records []OverheadRecord, margin uint32) []OverheadRecommendation {
+	byHypervisor := make(map[OverheadHypervisor]*OverheadRecommendation)
+	for _, record := range records {
+		if record.Samples == 0 {
+			continue
+		}
+
+		rec, ok := byHypervisor[record.Hypervisor]
+		if !ok {
+			rec = &OverheadRecommendation{Hypervisor: record.Hypervisor}
+			byHypervisor[record.Hypervisor] = rec
+		}
+
+		rec.Sandboxes++
+		rec.Samples += record.Samples
+		rec.Peak = peakOverhead(rec.Peak, record.Peak)
+	}
+
+	var recommendations []OverheadRecommendation
+	for _, rec := range byHypervisor {
+		memory := ceilDiv(rec.Peak.Memory*uint64(100+margin), 100)
+		memoryMiB := ceilDiv(memory, 1<<utils.MibToBytesShift)
+		rec.Memory = memoryMiB << utils.MibToBytesShift
+
+		// Work on nanocores so that the margin does not add rounding
+		// errors.
+		nanoCPU := uint64(math.Round(rec.Peak.CPU * 1e9))
+		rec.MilliCPU = ceilDiv(nanoCPU*uint64(100+margin), 100*1e6)
+		rec.PodFixed = map[string]string{
+			"memory": fmt.Sprintf("%dMi", memoryMiB),
+			"cpu":    fmt.Sprintf("%dm", rec.MilliCPU),
+		}
+
+		recommendations = append(recommendations, *rec)
+	}
+
+	sort.Slice(recommendations, func(i, j int) bool {
+		return fmt.Sprintf("%+v", recommendations[i].Hypervisor) < fmt.Sprintf("%+v", recommendations[j].Hypervisor)
+	})
+
+	return recommendations
+}
+
+// peakOverhead returns the highest value of each component of a and b.
+func peakOverhead(a, b OverheadSample) OverheadSample {
+	peak := a
+	if b.Memory > a.Memory || a.Time.IsZero() {
+		peak.Time = b.Time
+	}
+
+	peak.VMMRss = maxUint64(a.VMMRss, b.VMMRss)
+	peak.VirtiofsdRss = maxUint64(a.VirtiofsdRss, b.VirtiofsdRss)
+	peak.TemplateShared = maxUint64(a.TemplateShared, b.TemplateShared)
+	peak.GuestContainers = maxUint64(a.GuestContainers, b.GuestContainers)
+	peak.Guest = maxUint64(a.Guest, b.Guest)
+	peak.Memory = maxUint64(a.Memory, b.Memory)
+	peak.CPU = math.Max(a.CPU, b.CPU)
+
+	return peak
+}
+
+// cpuOverhead returns the CPU used on the host and not by the guest
+// containers over elapsed, in cores, from the usage counters in nanoseconds.
+func cpuOverhead(hostInit, hostFinal, guestInit, guestFinal uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 || hostFinal < hostInit || guestFinal < guestInit {
+		return 0
+	}
+
+	host := hostFinal - hostInit
+	guest := guestFinal - guestInit
+	if guest >= host {
+		return 0
+	}
+
+	return float64(host-guest) / float64(elapsed.Nanoseconds())
+}
+
+func subOrZero(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+func ceilDiv(a, b uint64) uint64 {
+	return (a + b - 1) / b
+}
+
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOverheadRecorder(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "overhead-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedGetRssFunc := getRssFunc
+	defer func() {
+		getRssFunc = savedGetRssFunc
+	}()
+	rss := map[int]uint64{
+		1000: 300 << 20,
+		1001: 20 << 20,
+	}
+	getRssFunc = func(pid int) (uint64, error) {
+		r, ok := rss[pid]
+		if !ok {
+			return 0, fmt.Errorf("no process %d", pid)
+		}
+		return r, nil
+	}
+
+	s := &Sandbox{
+		id:         testSandboxID,
+		ctx:        context.Background(),
+		hypervisor: &mockHypervisor{mockPid: 1000},
+		config: &SandboxConfig{
+			HypervisorType: MockHypervisor,
+			HypervisorConfig: HypervisorConfig{
+				NumVCPUs:   1,
+				MemorySize: 2048,
+			},
+		},
+		state: types.SandboxState{
+			VirtiofsVolumes: []types.VirtiofsVolume{{PID: 1001}},
+		},
+	}
+
+	config := OverheadConfig{Dir: dir, Interval: time.Minute}
+	r := newOverheadRecorder(s, config)
+
+	now := time.Now()
+	r.tick(now)
+	assert.Equal(uint64(1), r.record.Samples)
+	assert.Equal(uint64(300<<20), r.record.Last.VMMRss)
+	assert.Equal(uint64(20<<20), r.record.Last.VirtiofsdRss)
+	assert.Equal(uint64(320<<20), r.record.Last.Memory)
+
+	// Nothing is sampled before the interval elapsed.
+	rss[1000] = 400 << 20
+	r.tick(now.Add(time.Second))
+	assert.Equal(uint64(1), r.record.Samples)
+
+	rss[1000] = 200 << 20
+	r.tick(now.Add(2 * time.Minute))
+	assert.Equal(uint64(2), r.record.Samples)
+	assert.Equal(uint64(220<<20), r.record.Last.Memory)
+	assert.Equal(uint64(320<<20), r.record.Peak.Memory)
+	assert.Equal(now, r.record.Peak.Time)
+
+	records, err := ReadOverheadRecords(dir)
+	assert.NoError(err)
+	assert.Len(records, 1)
+	assert.Equal(testSandboxID, records[0].SandboxID)
+	assert.Equal(r.record.Hypervisor, records[0].Hypervisor)
+	assert.Equal(r.record.Peak.Memory, records[0].Peak.Memory)
+
+	// A failed sample is not recorded.
+	delete(rss, 1001)
+	r.tick(now.Add(4 * time.Minute))
+	assert.Equal(uint64(2), r.record.Samples)
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "foo"+overheadRecordSuffix), []byte("foo"), 0640))
+	_, err = ReadOverheadRecords(dir)
+	assert.Error(err)
+}
+
+func TestPruneOverheadRecords(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "overhead-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for i, age := range []time.Duration{48 * time.Hour, 3 * time.Hour, 2 * time.Hour, time.Hour} {
+		path := filepath.Join(dir, fmt.Sprintf("sandbox%d%s", i, overheadRecordSuffix))
+		assert.NoError(ioutil.WriteFile(path, []byte("{}"), 0640))
+		assert.NoError(os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("foo"), 0640))
+
+	names := func() []string {
+		entries, err := ioutil.ReadDir(dir)
+		assert.NoError(err)
+
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	// Nothing is pruned by default.
+	assert.NoError(pruneOverheadRecords(dir, 0, 0, now))
+	assert.Len(names(), 5)
+
+	// Records older than a day are removed.
+	assert.NoError(pruneOverheadRecords(dir, 0, 24*time.Hour, now))
+	assert.Equal([]string{"foo", "sandbox1.json", "sandbox2.json", "sandbox3.json"}, names())
+
+	// Only the most recent records are kept.
+	assert.NoError(pruneOverheadRecords(dir, 2, 0, now))
+	assert.Equal([]string{"foo", "sandbox2.json", "sandbox3.json"}, names())
+}
+
+func TestRecommendOverhead(t *testing.T) {
+	assert := assert.New(t)
+
+	qemu := OverheadHypervisor{Type: QemuHypervisor, NumVCPUs: 1, MemorySize: 2048}
+	fc := OverheadHypervisor{Type: FirecrackerHypervisor, NumVCPUs: 1, MemorySize: 2048}
+
+	records := []OverheadRecord{
+		{
+			SandboxID:  "a",
+			Hypervisor: qemu,
+			Samples:    3,
+			Peak:       OverheadSample{Memory: 100 << 20, CPU: 0.1},
+		},
+		{
+			SandboxID:  "b",
+			Hypervisor: qemu,
+			Samples:    2,
+			Peak:       OverheadSample{Memory: 150 << 20, CPU: 0.05},
+		},
+		{
+			SandboxID:  "c",
+			Hypervisor: fc,
+			Samples:    1,
+			Peak:       OverheadSample{Memory: 50 << 20, CPU: 0.02},
+		},
+		{
+			SandboxID:  "d",
+			Hypervisor: fc,
+		},
+	}
+
+	recs := RecommendOverhead(records, 10)
+	assert.Len(recs, 2)
+
+	assert.Equal(fc, recs[0].Hypervisor)
+	assert.Equal(1, recs[0].Sandboxes)
+	assert.Equal(uint64(55<<20), recs[0].Memory)
+	assert.Equal(uint64(22), recs[0].MilliCPU)
+	assert.Equal(map[string]string{"memory": "55Mi", "cpu": "22m"}, recs[0].PodFixed)
+
+	assert.Equal(qemu, recs[1].Hypervisor)
+	assert.Equal(2, recs[1].Sandboxes)
+	assert.Equal(uint64(5), recs[1].Samples)
+	assert.Equal(uint64(165<<20), recs[1].Memory)
+	assert.Equal(uint64(110), recs[1].MilliCPU)
+
+	assert.Empty(RecommendOverhead(nil, 10))
+}
+
+func TestCPUOverhead(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(0.5, cpuOverhead(0, 1e9, 0, 5e8, time.Second))
+	assert.Equal(0.0, cpuOverhead(0, 1e9, 0, 2e9, time.Second))
+	assert.Equal(0.0, cpuOverhead(2e9, 1e9, 0, 0, time.Second))
+	assert.Equal(0.0, cpuOverhead(0, 1e9, 0, 0, 0))
+}
@@ -38,6 +38,17 @@ func (s *Sandbox) dumpState(ss *persistapi.SandboxState, cs map[string]persistap
 	ss.State = string(s.state.State)
 	ss.CgroupPath = s.state.CgroupPath
 	ss.CgroupPaths = s.state.CgroupPaths
+	ss.ScratchDeviceID = s.state.ScratchDeviceID
+	ss.VirtiofsVolumes = nil
+	for _, vol := range s.state.VirtiofsVolumes {
+		ss.VirtiofsVolumes = append(ss.VirtiofsVolumes, persistapi.VirtiofsVolumeState{
+			Source:     vol.Source,
+			Tag:        vol.Tag,
+			Cache:      vol.Cache,
+			SocketPath: vol.SocketPath,
+			PID:        vol.PID,
+		})
+	}
 
 	for id, cont := range s.containers {
 		state := persistapi.ContainerState{}
@@ -46,8 +57,9 @@ func (s *Sandbox) dumpState(ss *persistapi.SandboxState, cs map[string]persistap
 		}
 		state.State = string(cont.state.State)
 		state.Rootfs = persistapi.RootfsState{
-			BlockDeviceID: cont.state.BlockDeviceID,
-			FsType:        cont.state.Fstype,
+			BlockDeviceID:  cont.state.BlockDeviceID,
+			FsType:         cont.state.Fstype,
+			LayerDeviceIDs: cont.state.RootfsLayerDeviceIDs,
 		}
 		state.CgroupPath = cont.state.CgroupPath
 		cs[id] = state
@@ -138,12 +150,16 @@ func (s *Sandbox) dumpMounts(cs map[string]persistapi.ContainerState) {
 
 		for _, m := range cont.mounts {
 			state.Mounts = append(state.Mounts, persistapi.Mount{
-				Source:        m.Source,
-				Destination:   m.Destination,
-				Options:       m.Options,
-				HostPath:      m.HostPath,
-				ReadOnly:      m.ReadOnly,
-				BlockDeviceID: m.BlockDeviceID,
+				Source:             m.Source,
+				Destination:        m.Destination,
+				Options:            m.Options,
+				HostPath:           m.HostPath,
+				ReadOnly:           m.ReadOnly,
+				BlockDeviceID:      m.BlockDeviceID,
+				BlockDeviceFsType:  m.BlockDeviceFsType,
+				BlockDeviceOptions: m.BlockDeviceOptions,
+				VirtiofsTag:        m.VirtiofsTag,
+				VirtiofsCache:      m.VirtiofsCache,
 			})
 		}
 
@@ -193,20 +209,55 @@ func (s *Sandbox) dumpConfig(ss *persistapi.SandboxState) {
 			InterworkingModel: int(sconfig.NetworkConfig.InterworkingModel),
 		},
 
-		ShmSize:             sconfig.ShmSize,
-		SharePidNs:          sconfig.SharePidNs,
-		Stateful:            sconfig.Stateful,
-		SystemdCgroup:       sconfig.SystemdCgroup,
-		SandboxCgroupOnly:   sconfig.SandboxCgroupOnly,
-		EnableAgentPidNs:    sconfig.EnableAgentPidNs,
-		DisableGuestSeccomp: sconfig.DisableGuestSeccomp,
-		Cgroups:             sconfig.Cgroups,
+		ShmSize:            sconfig.ShmSize,
+		SharePidNs:         sconfig.SharePidNs,
+		Stateful:           sconfig.Stateful,
+		SystemdCgroup:      sconfig.SystemdCgroup,
+		SandboxCgroupOnly:  sconfig.SandboxCgroupOnly,
+		EnableVCPUsPinning: sconfig.EnableVCPUsPinning,
+		SandboxResources: persistapi.SandboxResourceSizing{
+			WorkloadVCPUs: sconfig.SandboxResources.WorkloadVCPUs,
+			WorkloadMemMB: sconfig.SandboxResources.WorkloadMemMB,
+			ExtraVCPUs:    sconfig.SandboxResources.ExtraVCPUs,
+			ExtraMemMB:    sconfig.SandboxResources.ExtraMemMB,
+		},
+		EnableAgentPidNs:     sconfig.EnableAgentPidNs,
+		DisableGuestSeccomp:  sconfig.DisableGuestSeccomp,
+		EncryptedScratchSize: sconfig.EncryptedScratchSize,
+		EncryptedScratchDir:  sconfig.EncryptedScratchDir,
+		RootfsImageFsType:    sconfig.RootfsImageFsType,
+		RootfsImageCacheDir:  sconfig.RootfsImageCacheDir,
+		RootfsImageCacheSize: sconfig.RootfsImageCacheSize,
+		DirectBlockVolumes:   sconfig.DirectBlockVolumes,
+		GuestLogMaxSize:      sconfig.GuestLogMaxSize,
+		GuestLogDir:          sconfig.GuestLogDir,
+		HealthPolicy: persistapi.HealthPolicy{
+			FailureThreshold:        sconfig.HealthPolicy.FailureThreshold,
+			AgentReconnectAttempts:  sconfig.HealthPolicy.AgentReconnectAttempts,
+			MemoryPressureThreshold: sconfig.HealthPolicy.MemoryPressureThreshold,
+		},
+		Diagnostics: persistapi.DiagnosticsConfig{
+			Dir:         sconfig.Diagnostics.Dir,
+			MaxBundles:  sconfig.Diagnostics.MaxBundles,
+			GuestMemory: sconfig.Diagnostics.GuestMemory,
+		},
+		Overhead: persistapi.OverheadConfig{
+			Dir:        sconfig.Overhead.Dir,
+			Interval:   sconfig.Overhead.Interval,
+			MaxRecords: sconfig.Overhead.MaxRecords,
+			MaxAge:     sconfig.Overhead.MaxAge,
+		},
+		Cgroups: sconfig.Cgroups,
 	}
 
 	for _, e := range sconfig.Experimental {
 		ss.Config.Experimental = append(ss.Config.Experimental, e.Name)
 	}
 
+	for _, a := range sconfig.HealthPolicy.Actions {
+		ss.Config.HealthPolicy.Actions = append(ss.Config.HealthPolicy.Actions, string(a))
+	}
+
 	ss.Config.HypervisorConfig = persistapi.HypervisorConfig{
 		NumVCPUs:                sconfig.HypervisorConfig.NumVCPUs,
 		DefaultMaxVCPUs:         sconfig.HypervisorConfig.DefaultMaxVCPUs,
@@ -234,6 +285,7 @@ func (s *Sandbox) dumpConfig(ss *persistapi.SandboxState) {
 		SharedFS:                sconfig.HypervisorConfig.SharedFS,
 		VirtioFSDaemon:          sconfig.HypervisorConfig.VirtioFSDaemon,
 		VirtioFSCache:           sconfig.HypervisorConfig.VirtioFSCache,
+		VirtioFSVolumeCache:     sconfig.HypervisorConfig.VirtioFSVolumeCache,
 		VirtioFSExtraArgs:       sconfig.HypervisorConfig.VirtioFSExtraArgs[:],
 		BlockDeviceCacheSet:     sconfig.HypervisorConfig.BlockDeviceCacheSet,
 		BlockDeviceCacheDirect:  sconfig.HypervisorConfig.BlockDeviceCacheDirect,
@@ -243,6 +295,7 @@ func (s *Sandbox) dumpConfig(ss *persistapi.SandboxState) {
 		Debug:                   sconfig.HypervisorConfig.Debug,
 		MemPrealloc:             sconfig.HypervisorConfig.MemPrealloc,
 		HugePages:               sconfig.HypervisorConfig.HugePages,
+		EnableNUMA:              sconfig.HypervisorConfig.EnableNUMA,
 		FileBackedMemRootDir:    sconfig.HypervisorConfig.FileBackedMemRootDir,
 		Realtime:                sconfig.HypervisorConfig.Realtime,
 		Mlock:                   sconfig.HypervisorConfig.Mlock,
@@ -267,8 +320,14 @@ func (s *Sandbox) dumpConfig(ss *persistapi.SandboxState) {
 			s.Logger().WithError(err).Error("internal error: KataAgentConfig failed to decode")
 		} else {
 			ss.Config.KataAgentConfig = &persistapi.KataAgentConfig{
-				LongLiveConn: sagent.LongLiveConn,
-				UseVSock:     sagent.UseVSock,
+				LongLiveConn:        sagent.LongLiveConn,
+				UseVSock:            sagent.UseVSock,
+				DebugConsoleEnabled: sagent.DebugConsoleEnabled,
+				CheckTimeout:        sagent.RequestTimeouts.Check,
+				RequestTimeout:      sagent.RequestTimeouts.Request,
+				QueryTimeout:        sagent.RequestTimeouts.Query,
+				WaitTimeout:         sagent.RequestTimeouts.Wait,
+				RequestRetries:      sagent.RequestRetries,
 			}
 		}
 	}
@@ -327,14 +386,26 @@ func (s *Sandbox) loadState(ss persistapi.SandboxState) {
 	s.state.CgroupPath = ss.CgroupPath
 	s.state.CgroupPaths = ss.CgroupPaths
 	s.state.GuestMemoryHotplugProbe = ss.GuestMemoryHotplugProbe
+	s.state.ScratchDeviceID = ss.ScratchDeviceID
+	s.state.VirtiofsVolumes = nil
+	for _, vol := range ss.VirtiofsVolumes {
+		s.state.VirtiofsVolumes = append(s.state.VirtiofsVolumes, types.VirtiofsVolume{
+			Source:     vol.Source,
+			Tag:        vol.Tag,
+			Cache:      vol.Cache,
+			SocketPath: vol.SocketPath,
+			PID:        vol.PID,
+		})
+	}
 }
 
 func (c *Container) loadContState(cs persistapi.ContainerState) {
 	c.state = types.ContainerState{
-		State:         types.StateString(cs.State),
-		BlockDeviceID: cs.Rootfs.BlockDeviceID,
-		Fstype:        cs.Rootfs.FsType,
-		CgroupPath:    cs.CgroupPath,
+		State:                types.StateString(cs.State),
+		BlockDeviceID:        cs.Rootfs.BlockDeviceID,
+		Fstype:               cs.Rootfs.FsType,
+		RootfsLayerDeviceIDs: cs.Rootfs.LayerDeviceIDs,
+		CgroupPath:           cs.CgroupPath,
 	}
 }
 
@@ -369,12 +440,16 @@ func (c *Container) loadContMounts(cs persistapi.ContainerState) {
 	c.mounts = nil
 	for _, m := range cs.Mounts {
 		c.mounts = append(c.mounts, Mount{
-			Source:        m.Source,
-			Destination:   m.Destination,
-			Options:       m.Options,
-			HostPath:      m.HostPath,
-			ReadOnly:      m.ReadOnly,
-			BlockDeviceID: m.BlockDeviceID,
+			Source:             m.Source,
+			Destination:        m.Destination,
+			Options:            m.Options,
+			HostPath:           m.HostPath,
+			ReadOnly:           m.ReadOnly,
+			BlockDeviceID:      m.BlockDeviceID,
+			BlockDeviceFsType:  m.BlockDeviceFsType,
+			BlockDeviceOptions: m.BlockDeviceOptions,
+			VirtiofsTag:        m.VirtiofsTag,
+			VirtiofsCache:      m.VirtiofsCache,
 		})
 	}
 }
@@ -483,20 +558,55 @@ func loadSandboxConfig(id string) (*SandboxConfig, error) {
 			InterworkingModel: NetInterworkingModel(savedConf.NetworkConfig.InterworkingModel),
 		},
 
-		ShmSize:             savedConf.ShmSize,
-		SharePidNs:          savedConf.SharePidNs,
-		Stateful:            savedConf.Stateful,
-		SystemdCgroup:       savedConf.SystemdCgroup,
-		SandboxCgroupOnly:   savedConf.SandboxCgroupOnly,
-		EnableAgentPidNs:    savedConf.EnableAgentPidNs,
-		DisableGuestSeccomp: savedConf.DisableGuestSeccomp,
-		Cgroups:             savedConf.Cgroups,
+		ShmSize:            savedConf.ShmSize,
+		SharePidNs:         savedConf.SharePidNs,
+		Stateful:           savedConf.Stateful,
+		SystemdCgroup:      savedConf.SystemdCgroup,
+		SandboxCgroupOnly:  savedConf.SandboxCgroupOnly,
+		EnableVCPUsPinning: savedConf.EnableVCPUsPinning,
+		SandboxResources: SandboxResourceSizing{
+			WorkloadVCPUs: savedConf.SandboxResources.WorkloadVCPUs,
+			WorkloadMemMB: savedConf.SandboxResources.WorkloadMemMB,
+			ExtraVCPUs:    savedConf.SandboxResources.ExtraVCPUs,
+			ExtraMemMB:    savedConf.SandboxResources.ExtraMemMB,
+		},
+		EnableAgentPidNs:     savedConf.EnableAgentPidNs,
+		DisableGuestSeccomp:  savedConf.DisableGuestSeccomp,
+		EncryptedScratchSize: savedConf.EncryptedScratchSize,
+		EncryptedScratchDir:  savedConf.EncryptedScratchDir,
+		RootfsImageFsType:    savedConf.RootfsImageFsType,
+		RootfsImageCacheDir:  savedConf.RootfsImageCacheDir,
+		RootfsImageCacheSize: savedConf.RootfsImageCacheSize,
+		DirectBlockVolumes:   savedConf.DirectBlockVolumes,
+		GuestLogMaxSize:      savedConf.GuestLogMaxSize,
+		GuestLogDir:          savedConf.GuestLogDir,
+		HealthPolicy: HealthPolicy{
+			FailureThreshold:        savedConf.HealthPolicy.FailureThreshold,
+			AgentReconnectAttempts:  savedConf.HealthPolicy.AgentReconnectAttempts,
+			MemoryPressureThreshold: savedConf.HealthPolicy.MemoryPressureThreshold,
+		},
+		Diagnostics: DiagnosticsConfig{
+			Dir:         savedConf.Diagnostics.Dir,
+			MaxBundles:  savedConf.Diagnostics.MaxBundles,
+			GuestMemory: savedConf.Diagnostics.GuestMemory,
+		},
+		Overhead: OverheadConfig{
+			Dir:        savedConf.Overhead.Dir,
+			Interval:   savedConf.Overhead.Interval,
+			MaxRecords: savedConf.Overhead.MaxRecords,
+			MaxAge:     savedConf.Overhead.MaxAge,
+		},
+		Cgroups: savedConf.Cgroups,
 	}
 
 	for _, name := range savedConf.Experimental {
 		sconfig.Experimental = append(sconfig.Experimental, *exp.Get(name))
 	}
 
+	for _, a := range savedConf.HealthPolicy.Actions {
+		sconfig.HealthPolicy.Actions = append(sconfig.HealthPolicy.Actions, HealthAction(a))
+	}
+
 	hconf := savedConf.HypervisorConfig
 	sconfig.HypervisorConfig = HypervisorConfig{
 		NumVCPUs:                hconf.NumVCPUs,
@@ -525,6 +635,7 @@ func loadSandboxConfig(id string) (*SandboxConfig, error) {
 		SharedFS:                hconf.SharedFS,
 		VirtioFSDaemon:          hconf.VirtioFSDaemon,
 		VirtioFSCache:           hconf.VirtioFSCache,
+		VirtioFSVolumeCache:     hconf.VirtioFSVolumeCache,
 		VirtioFSExtraArgs:       hconf.VirtioFSExtraArgs[:],
 		BlockDeviceCacheSet:     hconf.BlockDeviceCacheSet,
 		BlockDeviceCacheDirect:  hconf.BlockDeviceCacheDirect,
@@ -534,6 +645,7 @@ func loadSandboxConfig(id string) (*SandboxConfig, error) {
 		Debug:                   hconf.Debug,
 		MemPrealloc:             hconf.MemPrealloc,
 		HugePages:               hconf.HugePages,
+		EnableNUMA:              hconf.EnableNUMA,
 		FileBackedMemRootDir:    hconf.FileBackedMemRootDir,
 		Realtime:                hconf.Realtime,
 		Mlock:                   hconf.Mlock,
@@ -553,8 +665,16 @@ func loadSandboxConfig(id string) (*SandboxConfig, error) {
 
 	if savedConf.AgentType == "kata" {
 		sconfig.AgentConfig = KataAgentConfig{
-			LongLiveConn: savedConf.KataAgentConfig.LongLiveConn,
-			UseVSock:     savedConf.KataAgentConfig.UseVSock,
+			LongLiveConn:        savedConf.KataAgentConfig.LongLiveConn,
+			UseVSock:            savedConf.KataAgentConfig.UseVSock,
+			DebugConsoleEnabled: savedConf.KataAgentConfig.DebugConsoleEnabled,
+			RequestTimeouts: AgentRequestTimeouts{
+				Check:   savedConf.KataAgentConfig.CheckTimeout,
+				Request: savedConf.KataAgentConfig.RequestTimeout,
+				Query:   savedConf.KataAgentConfig.QueryTimeout,
+				Wait:    savedConf.KataAgentConfig.WaitTimeout,
+			},
+			RequestRetries: savedConf.KataAgentConfig.RequestRetries,
 		}
 	}
 
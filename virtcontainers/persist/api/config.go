@@ -7,6 +7,8 @@
 package persistapi
 
 import (
+	"time"
+
 	"github.com/opencontainers/runc/libcontainer/configs"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
@@ -97,6 +99,11 @@ type HypervisorConfig struct {
 	// VirtioFSCache cache mode for fs version cache or "none"
 	VirtioFSCache string
 
+	// VirtioFSVolumeCache is the cache mode of the dedicated virtiofsd
+	// started for each shared volume. Volumes share the sandbox
+	// virtiofsd when it is empty.
+	VirtioFSVolumeCache string
+
 	// VirtioFSExtraArgs passes options to virtiofsd daemon
 	VirtioFSExtraArgs []string
 
@@ -131,6 +138,10 @@ type HypervisorConfig struct {
 	// HugePages specifies if the memory should be pre-allocated from huge pages
 	HugePages bool
 
+	// EnableNUMA mirrors the host NUMA nodes the sandbox runs on into the
+	// guest, binding each guest node memory and vCPUs to its host node.
+	EnableNUMA bool
+
 	// VirtioMem is used to enable/disable virtio-mem
 	VirtioMem bool
 
@@ -187,8 +198,16 @@ type HypervisorConfig struct {
 // KataAgentConfig is a structure storing information needed
 // to reach the Kata Containers agent.
 type KataAgentConfig struct {
-	LongLiveConn bool
-	UseVSock     bool
+	LongLiveConn        bool
+	UseVSock            bool
+	DebugConsoleEnabled bool
+
+	// Timeouts of the requests to the agent by class.
+	CheckTimeout   time.Duration
+	RequestTimeout time.Duration
+	QueryTimeout   time.Duration
+	WaitTimeout    time.Duration
+	RequestRetries uint32
 }
 
 // ProxyConfig is a structure storing information needed from any
@@ -198,6 +217,30 @@ type ProxyConfig struct {
 	Debug bool
 }
 
+// HealthPolicy configures how the monitor of a sandbox reacts to failed
+// checks.
+type HealthPolicy struct {
+	FailureThreshold        uint32
+	AgentReconnectAttempts  uint32
+	MemoryPressureThreshold uint32
+	Actions                 []string
+}
+
+// DiagnosticsConfig configures the diagnostics bundles of a sandbox.
+type DiagnosticsConfig struct {
+	Dir         string
+	MaxBundles  uint32
+	GuestMemory bool
+}
+
+// OverheadConfig configures the recording of the overhead of a sandbox.
+type OverheadConfig struct {
+	Dir        string
+	Interval   time.Duration
+	MaxRecords uint32
+	MaxAge     time.Duration
+}
+
 // ShimConfig is the structure providing specific configuration
 // for shim implementation.
 type ShimConfig struct {
@@ -221,6 +264,15 @@ type ContainerConfig struct {
 	Resources specs.LinuxResources
 }
 
+// SandboxResourceSizing is the part of the VM boot size added for the pod
+// workload.
+type SandboxResourceSizing struct {
+	WorkloadVCPUs uint32
+	WorkloadMemMB uint32
+	ExtraVCPUs    uint32
+	ExtraMemMB    uint32
+}
+
 // SandboxConfig is a sandbox configuration.
 // Refs: virtcontainers/sandbox.go:SandboxConfig
 type SandboxConfig struct {
@@ -254,11 +306,52 @@ type SandboxConfig struct {
 	// SandboxCgroupOnly enables cgroup only at podlevel in the host
 	SandboxCgroupOnly bool
 
+	// EnableVCPUsPinning pins each vCPU thread to its own CPU of the sandbox
+	// cpuset, and the other hypervisor threads to the remaining CPUs.
+	EnableVCPUsPinning bool
+
+	// SandboxResources is the part of the VM boot size sized for the pod
+	// workload.
+	SandboxResources SandboxResourceSizing
+
 	// Determines if containers are allowed to join the pid namespace of the kata agent
 	EnableAgentPidNs bool
 
 	DisableGuestSeccomp bool
 
+	// EncryptedScratchSize is the size in MiB of the encrypted scratch disk
+	EncryptedScratchSize uint32
+
+	// EncryptedScratchDir is the host directory holding the scratch disk backing file
+	EncryptedScratchDir string
+
+	// RootfsImageFsType is the file system of the container rootfs layer images
+	RootfsImageFsType string
+
+	// RootfsImageCacheDir is the host directory caching the rootfs layer images
+	RootfsImageCacheDir string
+
+	// RootfsImageCacheSize is the size in MiB above which unused rootfs layer images are evicted
+	RootfsImageCacheSize uint32
+
+	// DirectBlockVolumes enables passing block backed volumes to the guest
+	DirectBlockVolumes bool
+
+	// GuestLogMaxSize is the size in MiB above which the guest log is rotated
+	GuestLogMaxSize uint32
+
+	// GuestLogDir is the host directory holding the guest logs
+	GuestLogDir string
+
+	// HealthPolicy configures how the monitor reacts to failed checks
+	HealthPolicy HealthPolicy
+
+	// Diagnostics configures the diagnostics bundles of the sandbox
+	Diagnostics DiagnosticsConfig
+
+	// Overhead configures the recording of the sandbox resource overhead
+	Overhead OverheadConfig
+
 	// Experimental enables experimental features
 	Experimental []string
 
@@ -54,6 +54,18 @@ type Mount struct {
 	// VM in case this mount is a block device file or a directory
 	// backed by a block device.
 	BlockDeviceID string
+
+	// BlockDeviceFsType is the file system of a directly assigned block volume
+	BlockDeviceFsType string
+
+	// BlockDeviceOptions are the guest mount options of a directly assigned block volume
+	BlockDeviceOptions []string
+
+	// VirtiofsTag is the tag of the dedicated virtio-fs device sharing this volume
+	VirtiofsTag string
+
+	// VirtiofsCache is the virtio-fs cache mode requested for this volume
+	VirtiofsCache string
 }
 
 // RootfsState saves state of container rootfs
@@ -64,6 +76,10 @@ type RootfsState struct {
 
 	// RootFStype is file system of the rootfs incase it is block device
 	FsType string
+
+	// LayerDeviceIDs represents the read-only block devices backing the
+	// layers of the container rootfs when built from image layers
+	LayerDeviceIDs []string
 }
 
 // Process gathers data related to a container process.
@@ -45,6 +45,9 @@ type BlockDrive struct {
 	// Pmem enabled persistent memory. Use File as backing file
 	// for a nvdimm device in the guest.
 	Pmem bool
+
+	// ReadOnly sets the drive readonly
+	ReadOnly bool
 }
 
 // VFIODev represents a VFIO drive used for hotplugging
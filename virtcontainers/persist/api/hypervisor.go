@@ -26,6 +26,19 @@ type CPUDevice struct {
 	ID string
 }
 
+// NUMANode represents a guest NUMA node and the host NUMA node backing it
+type NUMANode struct {
+	// HostNode is the host NUMA node the node memory is bound to.
+	HostNode int
+
+	// HostCPUs is the list of host CPUs the node vCPUs run on.
+	HostCPUs string
+
+	// FirstVCPU and LastVCPU delimit the range of vCPUs of the node.
+	FirstVCPU uint32
+	LastVCPU  uint32
+}
+
 type HypervisorState struct {
 	Pid int
 	// Type of hypervisor, E.g. qemu/firecracker/acrn.
@@ -42,6 +55,7 @@ type HypervisorState struct {
 	VirtiofsdPid         int
 	HotplugVFIOOnRootBus bool
 	PCIeRootPort         int
+	NUMANodes            []NUMANode
 
 	// clh sepcific: refer to 'virtcontainers/clh.go:CloudHypervisorState'
 	APISocket string
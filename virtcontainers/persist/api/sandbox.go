@@ -15,6 +15,18 @@ type AgentState struct {
 
 	// URL to connect to agent
 	URL string
+
+	// GuestPid is set when the agent reports the guest pids of processes
+	GuestPid bool
+}
+
+// VirtiofsVolumeState save the state of a virtiofsd dedicated to a volume
+type VirtiofsVolumeState struct {
+	Source     string
+	Tag        string
+	Cache      string
+	SocketPath string
+	PID        int
 }
 
 // SandboxState contains state information of sandbox
@@ -47,6 +59,12 @@ type SandboxState struct {
 	// Devices plugged to sandbox(hypervisor)
 	Devices []DeviceState
 
+	// ScratchDeviceID is the ID of the encrypted scratch block device
+	ScratchDeviceID string
+
+	// VirtiofsVolumes are the virtiofsd processes dedicated to a volume
+	VirtiofsVolumes []VirtiofsVolumeState
+
 	// HypervisorState saves hypervisor specific data
 	HypervisorState HypervisorState
 
@@ -151,6 +151,9 @@ const (
 	// HugePages is a sandbox annotation to specify if the memory should be pre-allocated from huge pages
 	HugePages = kataAnnotHypervisorPrefix + "enable_hugepages"
 
+	// EnableNUMA is a sandbox annotation to mirror the host NUMA nodes the sandbox runs on into the guest
+	EnableNUMA = kataAnnotHypervisorPrefix + "enable_numa"
+
 	// Iommu is a sandbox annotation to specify if the VM should have a vIOMMU device
 	IOMMU = kataAnnotHypervisorPrefix + "enable_iommu"
 
@@ -179,6 +182,14 @@ const (
 	// VirtioFSExtraArgs is a sandbox annotation to pass options to virtiofsd daemon
 	VirtioFSExtraArgs = kataAnnotHypervisorPrefix + "virtio_fs_extra_args"
 
+	// VirtioFSVolumeCache is a sandbox annotation to specify the cache mode of the
+	// dedicated virtiofsd started for each volume
+	VirtioFSVolumeCache = kataAnnotHypervisorPrefix + "virtio_fs_volume_cache"
+
+	// VirtioFSMountCache is a container annotation to specify the cache mode of
+	// individual volumes, as a comma separated list of destination=mode pairs
+	VirtioFSMountCache = kataAnnotHypervisorPrefix + "virtio_fs_mount_cache"
+
 	//
 	//	Block Device related annotations
 	//
@@ -215,6 +226,9 @@ const (
 	// SandboxCgroupOnly is a sandbox annotation that determines if kata processes are managed only in sandbox cgroup.
 	SandboxCgroupOnly = kataAnnotRuntimePrefix + "sandbox_cgroup_only"
 
+	// EnableVCPUsPinning is a sandbox annotation that determines if vCPU threads are pinned to exclusive CPUs.
+	EnableVCPUsPinning = kataAnnotRuntimePrefix + "enable_vcpus_pinning"
+
 	// Experimental is a sandbox annotation that determines if experimental features enabled.
 	Experimental = kataAnnotRuntimePrefix + "experimental"
 
@@ -224,6 +238,18 @@ const (
 
 	// DisableNewNetNs is a sandbox annotation that determines if create a netns for hypervisor process.
 	DisableNewNetNs = kataAnnotRuntimePrefix + "disable_new_netns"
+
+	// EncryptedScratchSize is a sandbox annotation that specifies the size in MiB of the
+	// encrypted scratch disk backing the writable storage of the sandbox.
+	EncryptedScratchSize = kataAnnotRuntimePrefix + "encrypted_scratch_size"
+
+	// RootfsImageFsType is a sandbox annotation that selects the file system ("erofs" or "ext4")
+	// of the images built from the container rootfs layers and handed to the guest as block devices.
+	RootfsImageFsType = kataAnnotRuntimePrefix + "rootfs_image_fstype"
+
+	// DirectBlockVolumes is a sandbox annotation that determines if read-only volumes mounted on the host
+	// from a block device are passed to the guest as read-only block devices instead of being shared.
+	DirectBlockVolumes = kataAnnotRuntimePrefix + "direct_block_volumes"
 )
 
 const (
@@ -257,6 +283,38 @@ const (
 	ContainerPipeSizeKernelParam = "agent." + ContainerPipeSizeOption
 )
 
+// Annotations related to the shim
+const (
+	kataAnnotShimPrefix = kataConfAnnotationsPrefix + "shim."
+
+	// ShimLogMaxSize is a container annotation setting the size above
+	// which the shim log file is rotated, e.g. "10Mi".
+	ShimLogMaxSize = kataAnnotShimPrefix + "log_max_size"
+
+	// ShimLogMaxFiles is a container annotation setting the number of
+	// rotated shim log files kept.
+	ShimLogMaxFiles = kataAnnotShimPrefix + "log_max_files"
+
+	// ShimLogMaxAge is a container annotation setting the age above which
+	// the shim log file is rotated, e.g. "24h".
+	ShimLogMaxAge = kataAnnotShimPrefix + "log_max_age"
+)
+
+// Annotations set on the sandbox container by the container managers
+const (
+	// SandboxCPUPeriod is a sandbox annotation holding the CPU CFS period
+	// of the pod, in microseconds.
+	SandboxCPUPeriod = "io.kubernetes.cri.sandbox-cpu-period"
+
+	// SandboxCPUQuota is a sandbox annotation holding the CPU CFS quota
+	// of the pod, in microseconds, the sum of the quotas of its containers.
+	SandboxCPUQuota = "io.kubernetes.cri.sandbox-cpu-quota"
+
+	// SandboxMemory is a sandbox annotation holding the memory limit of
+	// the pod, in bytes, the sum of the limits of its containers.
+	SandboxMemory = "io.kubernetes.cri.sandbox-memory"
+)
+
 const (
 	// SHA512 is the SHA-512 (64) hash algorithm
 	SHA512 string = "sha512"
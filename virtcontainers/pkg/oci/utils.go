@@ -26,6 +26,7 @@ import (
 	vcAnnotations "github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
 	dockershimAnnotations "github.com/kata-containers/runtime/virtcontainers/pkg/annotations/dockershim"
 	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
 )
 
 type annotationContainerType struct {
@@ -74,6 +75,10 @@ const (
 
 const KernelModulesSeparator = ";"
 
+// virtioFSCacheOption is the bind mount option selecting the virtio-fs
+// cache mode of a volume.
+const virtioFSCacheOption = "cache="
+
 // FactoryConfig is a structure to set the VM factory configuration.
 type FactoryConfig struct {
 	// Template enables VM templating support in VM factory.
@@ -87,6 +92,63 @@ type FactoryConfig struct {
 
 	// VMCacheEndpoint specifies the endpoint of transport VM from the VM cache server to runtime.
 	VMCacheEndpoint string
+
+	// VMCacheTokenPath specifies the file holding the token authenticating
+	// the runtime to the VM cache server.
+	VMCacheTokenPath string
+
+	// VMCacheAllowedUIDs and VMCacheAllowedGIDs specify the users and the
+	// groups allowed to connect to the unix socket of the VM cache server,
+	// besides root and the server user.
+	VMCacheAllowedUIDs []uint32
+	VMCacheAllowedGIDs []uint32
+
+	// VMCacheMin specifies the number of VMs VMCache keeps when VMs are
+	// not requested, VMCacheNumber being the number it grows to. It
+	// keeps VMCacheNumber VMs if 0.
+	VMCacheMin uint
+
+	// VMCacheIdleTimeout specifies the seconds the VMs above the number
+	// of recently requested ones are kept by VMCache.
+	VMCacheIdleTimeout uint32
+
+	// VMCacheMinFreeMemory specifies the host memory, in MiB, VMCache does
+	// not grow above VMCacheMin into.
+	VMCacheMinFreeMemory uint32
+
+	// VMCacheCheckInterval specifies the seconds between the health
+	// checks of the VMs cached by VMCache, 0 disabling them.
+	VMCacheCheckInterval uint32
+
+	// VMCacheMaxAge specifies the seconds VMs are kept by VMCache before
+	// being replaced, 0 not limiting it.
+	VMCacheMaxAge uint32
+
+	// VMCachePools specifies the pools of VMs of other shapes than the
+	// hypervisor configuration cached by VMCache.
+	VMCachePools []FactoryPoolConfig
+}
+
+// FactoryPoolConfig is a structure to set a pool of VMs of VMCache.
+type FactoryPoolConfig struct {
+	// Name identifies the pool.
+	Name string
+
+	// VMCacheNumber and VMCacheMin specify the number of VMs of the
+	// pool, as for VMCache.
+	VMCacheNumber uint
+	VMCacheMin    uint
+
+	// NumVCPUs and MemorySize specify the vCPUs and memory of the VMs,
+	// the hypervisor ones if 0.
+	NumVCPUs   uint32
+	MemorySize uint32
+
+	// KernelPath, ImagePath and InitrdPath specify the assets of the
+	// VMs, the hypervisor ones if empty.
+	KernelPath string
+	ImagePath  string
+	InitrdPath string
 }
 
 // RuntimeConfig aggregates all runtime specific settings
@@ -123,9 +185,45 @@ type RuntimeConfig struct {
 	//Determines kata processes are managed only in sandbox cgroup
 	SandboxCgroupOnly bool
 
+	//Determines if vCPU threads are pinned to exclusive CPUs of the sandbox cpuset
+	EnableVCPUsPinning bool
+
 	//Determines if containers are allowed to join the pid namespace of the kata agent
 	EnableAgentPidNs bool
 
+	//Size in MiB of the per-sandbox encrypted scratch disk, 0 disables it
+	EncryptedScratchSize uint32
+
+	//Host directory holding the encrypted scratch disks backing files
+	EncryptedScratchDir string
+
+	//File system of the container rootfs layer images, empty disables them
+	RootfsImageFsType string
+
+	//Host directory caching the container rootfs layer images
+	RootfsImageCacheDir string
+
+	//Size in MiB above which unused container rootfs layer images are evicted
+	RootfsImageCacheSize uint32
+
+	//Determines if block backed volumes are passed to the guest as block devices
+	DirectBlockVolumes bool
+
+	//Size in MiB above which the guest log of a sandbox is rotated, 0 disables it
+	GuestLogMaxSize uint32
+
+	//Host directory holding the guest logs of the sandboxes
+	GuestLogDir string
+
+	//Determines how the monitor reacts to failed checks of the sandboxes
+	HealthPolicy vc.HealthPolicy
+
+	//Determines the diagnostics bundles captured when the sandboxes fail
+	Diagnostics vc.DiagnosticsConfig
+
+	//Overhead configures the recording of the sandbox resource overhead
+	Overhead vc.OverheadConfig
+
 	//Experimental features enabled
 	Experimental []exp.Feature
 }
@@ -173,6 +271,57 @@ func newMount(m specs.Mount) vc.Mount {
 	}
 }
 
+// virtioFSMountCache extracts the virtio-fs cache mode requested for each
+// bind mount of spec, indexed like spec.Mounts. The mode is taken from a
+// "cache=<mode>" mount option, which is removed from spec as it is not a
+// bind mount option, and can be overridden through the virtio_fs_mount_cache
+// annotation.
+func virtioFSMountCache(spec *specs.Spec) ([]string, error) {
+	annotCache := make(map[string]string)
+	if value, ok := spec.Annotations[vcAnnotations.VirtioFSMountCache]; ok {
+		for _, pair := range strings.Split(value, ",") {
+			fields := strings.SplitN(pair, "=", 2)
+			if len(fields) != 2 || fields[0] == "" {
+				return nil, fmt.Errorf("Error parsing annotation for virtio_fs_mount_cache: invalid entry %q, expecting destination=mode", pair)
+			}
+			if err := vc.CheckVirtioFSCacheMode(fields[1]); err != nil {
+				return nil, fmt.Errorf("Error parsing annotation for virtio_fs_mount_cache: %v", err)
+			}
+			annotCache[fields[0]] = fields[1]
+		}
+	}
+
+	caches := make([]string, len(spec.Mounts))
+	mounts := make([]specs.Mount, len(spec.Mounts))
+	for i, m := range spec.Mounts {
+		mounts[i] = m
+		if m.Type != "bind" {
+			continue
+		}
+
+		var options []string
+		for _, opt := range m.Options {
+			if strings.HasPrefix(opt, virtioFSCacheOption) {
+				mode := strings.TrimPrefix(opt, virtioFSCacheOption)
+				if err := vc.CheckVirtioFSCacheMode(mode); err != nil {
+					return nil, fmt.Errorf("Invalid option %q for mount %s: %v", opt, m.Destination, err)
+				}
+				caches[i] = mode
+				continue
+			}
+			options = append(options, opt)
+		}
+		mounts[i].Options = options
+
+		if mode, ok := annotCache[m.Destination]; ok {
+			caches[i] = mode
+		}
+	}
+	spec.Mounts = mounts
+
+	return caches, nil
+}
+
 func containerMounts(spec specs.Spec) []vc.Mount {
 	ociMounts := spec.Mounts
 
@@ -342,6 +491,10 @@ func addAnnotations(ocispec specs.Spec, config *vc.SandboxConfig) error {
 	if err := addAgentConfigOverrides(ocispec, config); err != nil {
 		return err
 	}
+
+	if err := addSandboxResources(ocispec, config); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -549,6 +702,15 @@ func addHypervisorMemoryOverrides(ocispec specs.Spec, sbConfig *vc.SandboxConfig
 		sbConfig.HypervisorConfig.HugePages = hugePages
 	}
 
+	if value, ok := ocispec.Annotations[vcAnnotations.EnableNUMA]; ok {
+		enableNUMA, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Error parsing annotation for enable_numa: Please specify boolean value 'true|false'")
+		}
+
+		sbConfig.HypervisorConfig.EnableNUMA = enableNUMA
+	}
+
 	if value, ok := ocispec.Annotations[vcAnnotations.IOMMU]; ok {
 		iommu, err := strconv.ParseBool(value)
 		if err != nil {
@@ -692,6 +854,13 @@ func addHypervisporVirtioFsOverrides(ocispec specs.Spec, sbConfig *vc.SandboxCon
 		sbConfig.HypervisorConfig.VirtioFSCache = value
 	}
 
+	if value, ok := ocispec.Annotations[vcAnnotations.VirtioFSVolumeCache]; ok {
+		if err := vc.CheckVirtioFSCacheMode(value); err != nil {
+			return fmt.Errorf("Error parsing annotation for virtio_fs_volume_cache: %v", err)
+		}
+		sbConfig.HypervisorConfig.VirtioFSVolumeCache = value
+	}
+
 	if value, ok := ocispec.Annotations[vcAnnotations.VirtioFSCacheSize]; ok {
 		cacheSize, err := strconv.ParseUint(value, 10, 32)
 		if err != nil {
@@ -732,6 +901,15 @@ func addRuntimeConfigOverrides(ocispec specs.Spec, sbConfig *vc.SandboxConfig) e
 		sbConfig.SandboxCgroupOnly = sandboxCgroupOnly
 	}
 
+	if value, ok := ocispec.Annotations[vcAnnotations.EnableVCPUsPinning]; ok {
+		enableVCPUsPinning, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Error parsing annotation for enable_vcpus_pinning: Please specify boolean value 'true|false'")
+		}
+
+		sbConfig.EnableVCPUsPinning = enableVCPUsPinning
+	}
+
 	if value, ok := ocispec.Annotations[vcAnnotations.Experimental]; ok {
 		features := strings.Split(value, " ")
 		sbConfig.Experimental = []exp.Feature{}
@@ -753,6 +931,29 @@ func addRuntimeConfigOverrides(ocispec specs.Spec, sbConfig *vc.SandboxConfig) e
 		sbConfig.NetworkConfig.DisableNewNetNs = disableNewNetNs
 	}
 
+	if value, ok := ocispec.Annotations[vcAnnotations.EncryptedScratchSize]; ok {
+		scratchSize, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return fmt.Errorf("Error parsing annotation for encrypted_scratch_size: %v, please specify positive numeric value", err)
+		}
+		sbConfig.EncryptedScratchSize = uint32(scratchSize)
+	}
+
+	if value, ok := ocispec.Annotations[vcAnnotations.RootfsImageFsType]; ok {
+		if err := vc.CheckRootfsImageFsType(value); err != nil {
+			return fmt.Errorf("Error parsing annotation for rootfs_image_fstype: %v", err)
+		}
+		sbConfig.RootfsImageFsType = value
+	}
+
+	if value, ok := ocispec.Annotations[vcAnnotations.DirectBlockVolumes]; ok {
+		directBlockVolumes, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Error parsing annotation for direct_block_volumes: Please specify boolean value 'true|false'")
+		}
+		sbConfig.DirectBlockVolumes = directBlockVolumes
+	}
+
 	if value, ok := ocispec.Annotations[vcAnnotations.InterNetworkModel]; ok {
 		runtimeConfig := RuntimeConfig{}
 		if err := runtimeConfig.InterNetworkModel.SetModel(value); err != nil {
@@ -806,6 +1007,71 @@ func addAgentConfigOverrides(ocispec specs.Spec, config *vc.SandboxConfig) error
 	return nil
 }
 
+// maxMemoryMB returns the maximum memory in MiB of a VM.
+var maxMemoryMB = vc.MaxMemoryMB
+
+// addSandboxResources grows the VM boot size by the pod resources the
+// container manager sets in the sandbox annotations, so that the containers
+// of the pod do not hot plug them one by one. They are capped to the
+// maximum vCPUs and memory of the VM.
+func addSandboxResources(ocispec specs.Spec, sbConfig *vc.SandboxConfig) error {
+	var quota int64
+	var period uint64
+	var err error
+
+	if value, ok := ocispec.Annotations[vcAnnotations.SandboxCPUQuota]; ok {
+		quota, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Error parsing annotation for %s: %v, please specify numeric value", vcAnnotations.SandboxCPUQuota, err)
+		}
+	}
+
+	if value, ok := ocispec.Annotations[vcAnnotations.SandboxCPUPeriod]; ok {
+		period, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Error parsing annotation for %s: %v, please specify positive numeric value", vcAnnotations.SandboxCPUPeriod, err)
+		}
+	}
+
+	hConfig := &sbConfig.HypervisorConfig
+
+	vcpus := utils.CalculateVCpusFromMilliCpus(utils.CalculateMilliCPUs(quota, period))
+	if max := hConfig.DefaultMaxVCPUs; max > 0 && hConfig.NumVCPUs+vcpus > max {
+		// The workload cannot get more vCPUs later either.
+		vcpus = 0
+		if hConfig.NumVCPUs < max {
+			vcpus = max - hConfig.NumVCPUs
+		}
+	}
+	hConfig.NumVCPUs += vcpus
+	sbConfig.SandboxResources.WorkloadVCPUs = vcpus
+
+	if value, ok := ocispec.Annotations[vcAnnotations.SandboxMemory]; ok {
+		memory, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Error parsing annotation for %s: %v, please specify positive numeric value", vcAnnotations.SandboxMemory, err)
+		}
+
+		memMB := uint32((memory + (1 << utils.MibToBytesShift) - 1) >> utils.MibToBytesShift)
+
+		max, err := maxMemoryMB()
+		if err != nil {
+			return err
+		}
+		if max > 0 && uint64(hConfig.MemorySize)+uint64(memMB) > uint64(max) {
+			// The VM cannot be given more memory than the host has.
+			memMB = 0
+			if hConfig.MemorySize < max {
+				memMB = max - hConfig.MemorySize
+			}
+		}
+		hConfig.MemorySize += memMB
+		sbConfig.SandboxResources.WorkloadMemMB = memMB
+	}
+
+	return nil
+}
+
 // SandboxConfig converts an OCI compatible runtime configuration file
 // to a virtcontainers sandbox configuration structure.
 func SandboxConfig(ocispec specs.Spec, runtime RuntimeConfig, bundlePath, cid, console string, detach, systemdCgroup bool) (vc.SandboxConfig, error) {
@@ -855,10 +1121,30 @@ func SandboxConfig(ocispec specs.Spec, runtime RuntimeConfig, bundlePath, cid, c
 
 		SandboxCgroupOnly: runtime.SandboxCgroupOnly,
 
+		EnableVCPUsPinning: runtime.EnableVCPUsPinning,
+
 		EnableAgentPidNs: runtime.EnableAgentPidNs,
 
 		DisableGuestSeccomp: runtime.DisableGuestSeccomp,
 
+		EncryptedScratchSize: runtime.EncryptedScratchSize,
+		EncryptedScratchDir:  runtime.EncryptedScratchDir,
+
+		RootfsImageFsType:    runtime.RootfsImageFsType,
+		RootfsImageCacheDir:  runtime.RootfsImageCacheDir,
+		RootfsImageCacheSize: runtime.RootfsImageCacheSize,
+
+		DirectBlockVolumes: runtime.DirectBlockVolumes,
+
+		GuestLogMaxSize: runtime.GuestLogMaxSize,
+		GuestLogDir:     runtime.GuestLogDir,
+
+		HealthPolicy: runtime.HealthPolicy,
+
+		Diagnostics: runtime.Diagnostics,
+
+		Overhead: runtime.Overhead,
+
 		// Q: Is this really necessary? @weizhang555
 		// Spec: &ocispec,
 
@@ -908,6 +1194,16 @@ func ContainerConfig(ocispec specs.Spec, bundlePath, cid, console string, detach
 		cmd.Capabilities = ocispec.Process.Capabilities
 	}
 
+	mountCaches, err := virtioFSMountCache(&ocispec)
+	if err != nil {
+		return vc.ContainerConfig{}, err
+	}
+
+	mounts := containerMounts(ocispec)
+	for i := range mounts {
+		mounts[i].VirtiofsCache = mountCaches[i]
+	}
+
 	containerConfig := vc.ContainerConfig{
 		ID:             cid,
 		RootFs:         rootfs,
@@ -916,7 +1212,7 @@ func ContainerConfig(ocispec specs.Spec, bundlePath, cid, console string, detach
 		Annotations: map[string]string{
 			vcAnnotations.BundlePathKey: bundlePath,
 		},
-		Mounts:      containerMounts(ocispec),
+		Mounts:      mounts,
 		DeviceInfos: deviceInfos,
 		Resources:   *ocispec.Linux.Resources,
 
@@ -771,6 +771,7 @@ func TestAddHypervisorAnnotations(t *testing.T) {
 	ocispec.Annotations[vcAnnotations.EnableSwap] = "true"
 	ocispec.Annotations[vcAnnotations.FileBackedMemRootDir] = "/dev/shm"
 	ocispec.Annotations[vcAnnotations.HugePages] = "true"
+	ocispec.Annotations[vcAnnotations.EnableNUMA] = "true"
 	ocispec.Annotations[vcAnnotations.IOMMU] = "true"
 	ocispec.Annotations[vcAnnotations.BlockDeviceDriver] = "virtio-scsi"
 	ocispec.Annotations[vcAnnotations.DisableBlockDeviceUse] = "true"
@@ -781,6 +782,7 @@ func TestAddHypervisorAnnotations(t *testing.T) {
 	ocispec.Annotations[vcAnnotations.SharedFS] = "virtio-fs"
 	ocispec.Annotations[vcAnnotations.VirtioFSDaemon] = "/home/virtiofsd"
 	ocispec.Annotations[vcAnnotations.VirtioFSCache] = "/home/cache"
+	ocispec.Annotations[vcAnnotations.VirtioFSVolumeCache] = "none"
 	ocispec.Annotations[vcAnnotations.Msize9p] = "512"
 	ocispec.Annotations[vcAnnotations.MachineType] = "q35"
 	ocispec.Annotations[vcAnnotations.MachineAccelerators] = "nofw"
@@ -804,6 +806,7 @@ func TestAddHypervisorAnnotations(t *testing.T) {
 	assert.Equal(config.HypervisorConfig.Mlock, false)
 	assert.Equal(config.HypervisorConfig.FileBackedMemRootDir, "/dev/shm")
 	assert.Equal(config.HypervisorConfig.HugePages, true)
+	assert.Equal(config.HypervisorConfig.EnableNUMA, true)
 	assert.Equal(config.HypervisorConfig.IOMMU, true)
 	assert.Equal(config.HypervisorConfig.BlockDeviceDriver, "virtio-scsi")
 	assert.Equal(config.HypervisorConfig.DisableBlockDeviceUse, true)
@@ -814,6 +817,7 @@ func TestAddHypervisorAnnotations(t *testing.T) {
 	assert.Equal(config.HypervisorConfig.SharedFS, "virtio-fs")
 	assert.Equal(config.HypervisorConfig.VirtioFSDaemon, "/home/virtiofsd")
 	assert.Equal(config.HypervisorConfig.VirtioFSCache, "/home/cache")
+	assert.Equal(config.HypervisorConfig.VirtioFSVolumeCache, "none")
 	assert.Equal(config.HypervisorConfig.Msize9p, uint32(512))
 	assert.Equal(config.HypervisorConfig.HypervisorMachineType, "q35")
 	assert.Equal(config.HypervisorConfig.MachineAccelerators, "nofw")
@@ -843,6 +847,113 @@ func TestAddHypervisorAnnotations(t *testing.T) {
 	ocispec.Annotations[vcAnnotations.DefaultMaxVCPUs] = "1"
 	ocispec.Annotations[vcAnnotations.DefaultMemory] = fmt.Sprintf("%d", vc.MinHypervisorMemory+1)
 	assert.Error(err)
+
+	ocispec.Annotations[vcAnnotations.VirtioFSVolumeCache] = "sometimes"
+	err = addAnnotations(ocispec, &config)
+	assert.Error(err)
+}
+
+func TestAddSandboxResources(t *testing.T) {
+	assert := assert.New(t)
+
+	config := vc.SandboxConfig{
+		HypervisorConfig: vc.HypervisorConfig{
+			NumVCPUs:        1,
+			DefaultMaxVCPUs: 4,
+			MemorySize:      2048,
+		},
+	}
+
+	ocispec := specs.Spec{
+		Annotations: make(map[string]string),
+	}
+
+	// Nothing is added without the sandbox annotations.
+	assert.NoError(addSandboxResources(ocispec, &config))
+	assert.Equal(uint32(1), config.HypervisorConfig.NumVCPUs)
+	assert.Equal(uint32(2048), config.HypervisorConfig.MemorySize)
+	assert.Equal(vc.SandboxResourceSizing{}, config.SandboxResources)
+
+	ocispec.Annotations[vcAnnotations.SandboxCPUQuota] = "150000"
+	ocispec.Annotations[vcAnnotations.SandboxCPUPeriod] = "100000"
+	ocispec.Annotations[vcAnnotations.SandboxMemory] = "536870913"
+
+	assert.NoError(addSandboxResources(ocispec, &config))
+	assert.Equal(uint32(3), config.HypervisorConfig.NumVCPUs)
+	assert.Equal(uint32(2048+513), config.HypervisorConfig.MemorySize)
+	assert.Equal(vc.SandboxResourceSizing{WorkloadVCPUs: 2, WorkloadMemMB: 513}, config.SandboxResources)
+
+	// The vCPUs are capped to the maximum number of vCPUs.
+	config.HypervisorConfig.NumVCPUs = 1
+	ocispec.Annotations[vcAnnotations.SandboxCPUQuota] = "800000"
+	assert.NoError(addSandboxResources(ocispec, &config))
+	assert.Equal(uint32(4), config.HypervisorConfig.NumVCPUs)
+	assert.Equal(uint32(3), config.SandboxResources.WorkloadVCPUs)
+
+	// The memory is capped to the maximum memory of the VM.
+	savedMaxMemoryMB := maxMemoryMB
+	defer func() {
+		maxMemoryMB = savedMaxMemoryMB
+	}()
+	maxMemoryMB = func() (uint32, error) {
+		return 3000, nil
+	}
+	config.HypervisorConfig.MemorySize = 2048
+	ocispec.Annotations[vcAnnotations.SandboxMemory] = "2147483648"
+	assert.NoError(addSandboxResources(ocispec, &config))
+	assert.Equal(uint32(3000), config.HypervisorConfig.MemorySize)
+	assert.Equal(uint32(952), config.SandboxResources.WorkloadMemMB)
+
+	config.HypervisorConfig.MemorySize = 4096
+	assert.NoError(addSandboxResources(ocispec, &config))
+	assert.Equal(uint32(4096), config.HypervisorConfig.MemorySize)
+	assert.Equal(uint32(0), config.SandboxResources.WorkloadMemMB)
+
+	ocispec.Annotations[vcAnnotations.SandboxMemory] = "foo"
+	assert.Error(addSandboxResources(ocispec, &config))
+
+	ocispec.Annotations[vcAnnotations.SandboxCPUPeriod] = "-1"
+	assert.Error(addSandboxResources(ocispec, &config))
+}
+
+func TestVirtioFSMountCache(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := specs.Spec{
+		Annotations: map[string]string{
+			vcAnnotations.VirtioFSMountCache: "/config=always,/logs=auto",
+		},
+		Mounts: []specs.Mount{
+			{Destination: "/db", Type: "bind", Source: "/host/db", Options: []string{"rbind", "cache=none"}},
+			{Destination: "/config", Type: "bind", Source: "/host/config", Options: []string{"rbind", "ro"}},
+			{Destination: "/logs", Type: "bind", Source: "/host/logs", Options: []string{"cache=none"}},
+			{Destination: "/data", Type: "bind", Source: "/host/data", Options: []string{"rbind"}},
+			{Destination: "/cifs", Type: "cifs", Source: "//server/share", Options: []string{"cache=strict"}},
+		},
+	}
+	origMounts := spec.Mounts
+
+	caches, err := virtioFSMountCache(&spec)
+	assert.NoError(err)
+	assert.Equal([]string{"none", "always", "auto", "", ""}, caches)
+
+	// The cache option is not passed down as a bind mount option.
+	assert.Equal([]string{"rbind"}, spec.Mounts[0].Options)
+	assert.Equal([]string{"rbind", "ro"}, spec.Mounts[1].Options)
+	assert.Empty(spec.Mounts[2].Options)
+	assert.Equal([]string{"cache=strict"}, spec.Mounts[4].Options)
+	assert.Equal([]string{"rbind", "cache=none"}, origMounts[0].Options)
+
+	spec.Mounts[0].Options = []string{"cache=sometimes"}
+	_, err = virtioFSMountCache(&spec)
+	assert.Error(err)
+
+	spec.Mounts[0].Options = nil
+	for _, value := range []string{"/db", "/db=sometimes", "=none"} {
+		spec.Annotations[vcAnnotations.VirtioFSMountCache] = value
+		_, err = virtioFSMountCache(&spec)
+		assert.Error(err, value)
+	}
 }
 
 func TestAddRuntimeAnnotations(t *testing.T) {
@@ -858,12 +969,29 @@ func TestAddRuntimeAnnotations(t *testing.T) {
 
 	ocispec.Annotations[vcAnnotations.DisableGuestSeccomp] = "true"
 	ocispec.Annotations[vcAnnotations.SandboxCgroupOnly] = "true"
+	ocispec.Annotations[vcAnnotations.EnableVCPUsPinning] = "true"
 	ocispec.Annotations[vcAnnotations.DisableNewNetNs] = "true"
 	ocispec.Annotations[vcAnnotations.InterNetworkModel] = "macvtap"
+	ocispec.Annotations[vcAnnotations.EncryptedScratchSize] = "1024"
+	ocispec.Annotations[vcAnnotations.RootfsImageFsType] = "erofs"
+	ocispec.Annotations[vcAnnotations.DirectBlockVolumes] = "true"
 
 	addAnnotations(ocispec, &config)
 	assert.Equal(config.DisableGuestSeccomp, true)
 	assert.Equal(config.SandboxCgroupOnly, true)
+	assert.Equal(config.EnableVCPUsPinning, true)
 	assert.Equal(config.NetworkConfig.DisableNewNetNs, true)
 	assert.Equal(config.NetworkConfig.InterworkingModel, vc.NetXConnectMacVtapModel)
+	assert.Equal(config.EncryptedScratchSize, uint32(1024))
+	assert.Equal(config.RootfsImageFsType, "erofs")
+	assert.Equal(config.DirectBlockVolumes, true)
+
+	ocispec.Annotations[vcAnnotations.RootfsImageFsType] = "xfs"
+	err := addAnnotations(ocispec, &config)
+	assert.Error(err)
+	delete(ocispec.Annotations, vcAnnotations.RootfsImageFsType)
+
+	ocispec.Annotations[vcAnnotations.EncryptedScratchSize] = "-1"
+	err = addAnnotations(ocispec, &config)
+	assert.Error(err)
 }
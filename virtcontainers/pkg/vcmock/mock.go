@@ -18,6 +18,7 @@ package vcmock
 import (
 	"context"
 	"fmt"
+	"net"
 	"syscall"
 
 	vc "github.com/kata-containers/runtime/virtcontainers"
@@ -296,3 +297,21 @@ func (m *VCMock) CleanupContainer(ctx context.Context, sandboxID, containerID st
 	}
 	return fmt.Errorf("%s: %s (%+v): sandboxID: %v", mockErrorPrefix, getSelf(), m, sandboxID)
 }
+
+// DialDebugConsole implements the VC function of the same name.
+func (m *VCMock) DialDebugConsole(ctx context.Context, sandboxID string) (net.Conn, error) {
+	if m.DialDebugConsoleFunc != nil {
+		return m.DialDebugConsoleFunc(ctx, sandboxID)
+	}
+
+	return nil, fmt.Errorf("%s: %s (%+v): sandboxID: %v", mockErrorPrefix, getSelf(), m, sandboxID)
+}
+
+// CollectDiagnostics implements the VC function of the same name.
+func (m *VCMock) CollectDiagnostics(ctx context.Context, sandboxID string, config vc.DiagnosticsConfig) (string, error) {
+	if m.CollectDiagnosticsFunc != nil {
+		return m.CollectDiagnosticsFunc(ctx, sandboxID, config)
+	}
+
+	return "", fmt.Errorf("%s: %s (%+v): sandboxID: %v", mockErrorPrefix, getSelf(), m, sandboxID)
+}
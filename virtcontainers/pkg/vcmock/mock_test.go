@@ -7,6 +7,7 @@ package vcmock
 
 import (
 	"context"
+	"net"
 	"reflect"
 	"syscall"
 	"testing"
@@ -817,3 +818,58 @@ func TestVCMockListRoutes(t *testing.T) {
 	assert.Error(err)
 	assert.True(IsMockError(err))
 }
+
+func TestVCMockDialDebugConsole(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &VCMock{}
+	config := &vc.SandboxConfig{}
+	assert.Nil(m.DialDebugConsoleFunc)
+
+	ctx := context.Background()
+	_, err := m.DialDebugConsole(ctx, config.ID)
+	assert.Error(err)
+	assert.True(IsMockError(err))
+
+	m.DialDebugConsoleFunc = func(ctx context.Context, sid string) (net.Conn, error) {
+		return nil, nil
+	}
+
+	_, err = m.DialDebugConsole(ctx, config.ID)
+	assert.NoError(err)
+
+	// reset
+	m.DialDebugConsoleFunc = nil
+
+	_, err = m.DialDebugConsole(ctx, config.ID)
+	assert.Error(err)
+	assert.True(IsMockError(err))
+}
+
+func TestVCMockCollectDiagnostics(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &VCMock{}
+	config := &vc.SandboxConfig{}
+	assert.Nil(m.CollectDiagnosticsFunc)
+
+	ctx := context.Background()
+	_, err := m.CollectDiagnostics(ctx, config.ID, vc.DiagnosticsConfig{})
+	assert.Error(err)
+	assert.True(IsMockError(err))
+
+	m.CollectDiagnosticsFunc = func(ctx context.Context, sid string, config vc.DiagnosticsConfig) (string, error) {
+		return "/bundle", nil
+	}
+
+	dir, err := m.CollectDiagnostics(ctx, config.ID, vc.DiagnosticsConfig{})
+	assert.NoError(err)
+	assert.Equal("/bundle", dir)
+
+	// reset
+	m.CollectDiagnosticsFunc = nil
+
+	_, err = m.CollectDiagnostics(ctx, config.ID, vc.DiagnosticsConfig{})
+	assert.Error(err)
+	assert.True(IsMockError(err))
+}
@@ -6,6 +6,7 @@
 package vcmock
 
 import (
+	"context"
 	"io"
 	"syscall"
 
@@ -69,12 +70,12 @@ func (s *Sandbox) Release() error {
 }
 
 // Start implements the VCSandbox function of the same name.
-func (s *Sandbox) Start() error {
+func (s *Sandbox) Start(ctx context.Context) error {
 	return nil
 }
 
 // Stop implements the VCSandbox function of the same name.
-func (s *Sandbox) Stop(force bool) error {
+func (s *Sandbox) Stop(ctx context.Context, force bool) error {
 	return nil
 }
 
@@ -89,32 +90,42 @@ func (s *Sandbox) Resume() error {
 }
 
 // Delete implements the VCSandbox function of the same name.
-func (s *Sandbox) Delete() error {
+func (s *Sandbox) Delete(ctx context.Context) error {
+	return nil
+}
+
+// Stats implements the VCSandbox function of the same name.
+func (s *Sandbox) Stats() (vc.SandboxStats, error) {
+	return vc.SandboxStats{}, nil
+}
+
+// ResizeVM implements the VCSandbox function of the same name.
+func (s *Sandbox) ResizeVM(ctx context.Context, extraVCPUs, extraMemMB uint32) error {
 	return nil
 }
 
 // CreateContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) CreateContainer(conf vc.ContainerConfig) (vc.VCContainer, error) {
+func (s *Sandbox) CreateContainer(ctx context.Context, conf vc.ContainerConfig) (vc.VCContainer, error) {
 	return &Container{}, nil
 }
 
 // DeleteContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) DeleteContainer(contID string) (vc.VCContainer, error) {
+func (s *Sandbox) DeleteContainer(ctx context.Context, contID string) (vc.VCContainer, error) {
 	return &Container{}, nil
 }
 
 // StartContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) StartContainer(contID string) (vc.VCContainer, error) {
+func (s *Sandbox) StartContainer(ctx context.Context, contID string) (vc.VCContainer, error) {
 	return &Container{}, nil
 }
 
 // StopContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) StopContainer(contID string, force bool) (vc.VCContainer, error) {
+func (s *Sandbox) StopContainer(ctx context.Context, contID string, force bool) (vc.VCContainer, error) {
 	return &Container{}, nil
 }
 
 // KillContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) KillContainer(contID string, signal syscall.Signal, all bool) error {
+func (s *Sandbox) KillContainer(ctx context.Context, contID string, signal syscall.Signal, all bool) error {
 	return nil
 }
 
@@ -124,17 +135,17 @@ func (s *Sandbox) StatusContainer(contID string) (vc.ContainerStatus, error) {
 }
 
 // StatsContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) StatsContainer(contID string) (vc.ContainerStats, error) {
+func (s *Sandbox) StatsContainer(ctx context.Context, contID string) (vc.ContainerStats, error) {
 	return vc.ContainerStats{}, nil
 }
 
 // PauseContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) PauseContainer(contID string) error {
+func (s *Sandbox) PauseContainer(ctx context.Context, contID string) error {
 	return nil
 }
 
 // ResumeContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) ResumeContainer(contID string) error {
+func (s *Sandbox) ResumeContainer(ctx context.Context, contID string) error {
 	return nil
 }
 
@@ -144,7 +155,7 @@ func (s *Sandbox) Status() vc.SandboxStatus {
 }
 
 // EnterContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) EnterContainer(containerID string, cmd types.Cmd) (vc.VCContainer, *vc.Process, error) {
+func (s *Sandbox) EnterContainer(ctx context.Context, containerID string, cmd types.Cmd) (vc.VCContainer, *vc.Process, error) {
 	return &Container{}, &vc.Process{}, nil
 }
 
@@ -153,28 +164,38 @@ func (s *Sandbox) Monitor() (chan error, error) {
 	return nil, nil
 }
 
+// HealthEvents implements the VCSandbox function of the same name.
+func (s *Sandbox) HealthEvents() (chan vc.HealthEvent, error) {
+	return nil, nil
+}
+
 // UpdateContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) UpdateContainer(containerID string, resources specs.LinuxResources) error {
+func (s *Sandbox) UpdateContainer(ctx context.Context, containerID string, resources specs.LinuxResources) error {
 	return nil
 }
 
 // ProcessListContainer implements the VCSandbox function of the same name.
-func (s *Sandbox) ProcessListContainer(containerID string, options vc.ProcessListOptions) (vc.ProcessList, error) {
+func (s *Sandbox) ProcessListContainer(ctx context.Context, containerID string, options vc.ProcessListOptions) (vc.ProcessList, error) {
 	return nil, nil
 }
 
+// ProcessGuestPid implements the VCSandbox function of the same name.
+func (s *Sandbox) ProcessGuestPid(ctx context.Context, containerID, processID string) (uint32, error) {
+	return 0, nil
+}
+
 // WaitProcess implements the VCSandbox function of the same name.
-func (s *Sandbox) WaitProcess(containerID, processID string) (int32, error) {
+func (s *Sandbox) WaitProcess(ctx context.Context, containerID, processID string) (int32, error) {
 	return 0, nil
 }
 
 // SignalProcess implements the VCSandbox function of the same name.
-func (s *Sandbox) SignalProcess(containerID, processID string, signal syscall.Signal, all bool) error {
+func (s *Sandbox) SignalProcess(ctx context.Context, containerID, processID string, signal syscall.Signal, all bool) error {
 	return nil
 }
 
 // WinsizeProcess implements the VCSandbox function of the same name.
-func (s *Sandbox) WinsizeProcess(containerID, processID string, height, width uint32) error {
+func (s *Sandbox) WinsizeProcess(ctx context.Context, containerID, processID string, height, width uint32) error {
 	return nil
 }
 
@@ -189,30 +210,30 @@ func (s *Sandbox) AddDevice(info config.DeviceInfo) (api.Device, error) {
 }
 
 // AddInterface implements the VCSandbox function of the same name.
-func (s *Sandbox) AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+func (s *Sandbox) AddInterface(ctx context.Context, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
 	return nil, nil
 }
 
 // RemoveInterface implements the VCSandbox function of the same name.
-func (s *Sandbox) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+func (s *Sandbox) RemoveInterface(ctx context.Context, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
 	return nil, nil
 }
 
 // ListInterfaces implements the VCSandbox function of the same name.
-func (s *Sandbox) ListInterfaces() ([]*vcTypes.Interface, error) {
+func (s *Sandbox) ListInterfaces(ctx context.Context) ([]*vcTypes.Interface, error) {
 	return nil, nil
 }
 
 // UpdateRoutes implements the VCSandbox function of the same name.
-func (s *Sandbox) UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+func (s *Sandbox) UpdateRoutes(ctx context.Context, routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
 	return nil, nil
 }
 
 // ListRoutes implements the VCSandbox function of the same name.
-func (s *Sandbox) ListRoutes() ([]*vcTypes.Route, error) {
+func (s *Sandbox) ListRoutes(ctx context.Context) ([]*vcTypes.Route, error) {
 	return nil, nil
 }
 
-func (s *Sandbox) GetOOMEvent() (string, error) {
+func (s *Sandbox) GetOOMEvent(ctx context.Context) (string, error) {
 	return "", nil
 }
@@ -7,6 +7,7 @@ package vcmock
 
 import (
 	"context"
+	"net"
 	"syscall"
 
 	vc "github.com/kata-containers/runtime/virtcontainers"
@@ -75,4 +76,7 @@ type VCMock struct {
 	UpdateRoutesFunc     func(ctx context.Context, sandboxID string, routes []*vcTypes.Route) ([]*vcTypes.Route, error)
 	ListRoutesFunc       func(ctx context.Context, sandboxID string) ([]*vcTypes.Route, error)
 	CleanupContainerFunc func(ctx context.Context, sandboxID, containerID string, force bool) error
+
+	DialDebugConsoleFunc   func(ctx context.Context, sandboxID string) (net.Conn, error)
+	CollectDiagnosticsFunc func(ctx context.Context, sandboxID string, config vc.DiagnosticsConfig) (string, error)
 }
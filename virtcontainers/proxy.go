@@ -10,8 +10,11 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	kataclient "github.com/kata-containers/agent/protocols/client"
 	"github.com/kata-containers/runtime/virtcontainers/persist"
@@ -23,6 +26,8 @@ var buildinProxyConsoleProto = consoleProtoUnix
 type proxyBuiltin struct {
 	sandboxID string
 	conn      net.Conn
+	debug     bool
+	guestLog  *guestLog
 }
 
 // ProxyConfig is a structure storing information needed from any
@@ -42,6 +47,11 @@ type proxyParams struct {
 	logger     *logrus.Entry
 	hid        int
 	debug      bool
+
+	// guestLogDir and guestLogMaxSize (MiB) configure the collection of
+	// the guest console into a log file, disabled if guestLogMaxSize is 0.
+	guestLogDir     string
+	guestLogMaxSize uint32
 }
 
 // ProxyType describes a proxy type.
@@ -67,6 +77,10 @@ const (
 
 	// pty type of console. Used mostly by kvmtools.
 	consoleProtoPty = "pty"
+
+	// hybrid vsock type of console, the agent serving its logs on a
+	// vsock port. Used by firecracker.
+	consoleProtoHybridVSock = "hvsock"
 )
 
 // Set sets a proxy type based on the input string.
@@ -192,6 +206,11 @@ func (p *proxyBuiltin) watchConsole(proto, console string, logger *logrus.Entry)
 		}
 		// TODO: please see
 		// https://github.com/kata-containers/runtime/issues/1940.
+	case consoleProtoHybridVSock:
+		conn, err = dialAgentLogs(console)
+		if err != nil {
+			return err
+		}
 	case consoleProtoPty:
 		fallthrough
 	default:
@@ -200,13 +219,30 @@ func (p *proxyBuiltin) watchConsole(proto, console string, logger *logrus.Entry)
 
 	p.conn = conn
 
+	// The watcher owns the guest log from now on, and closes it once the
+	// console connection is closed.
+	guestLog := p.guestLog
+	p.guestLog = nil
+
 	go func() {
+		if guestLog != nil {
+			defer guestLog.close()
+		}
+
 		scanner = bufio.NewScanner(conn)
 		for scanner.Scan() {
-			logger.WithFields(logrus.Fields{
-				"sandbox":   p.sandboxID,
-				"vmconsole": scanner.Text(),
-			}).Debug("reading guest console")
+			if guestLog != nil {
+				if err := guestLog.write(scanner.Text()); err != nil {
+					logger.WithError(err).Warn("failed to write guest log")
+				}
+			}
+
+			if p.debug {
+				logger.WithFields(logrus.Fields{
+					"sandbox":   p.sandboxID,
+					"vmconsole": scanner.Text(),
+				}).Debug("reading guest console")
+			}
 		}
 
 		if err := scanner.Err(); err != nil {
@@ -244,13 +280,33 @@ func (p *proxyBuiltin) start(params proxyParams) (int, string, error) {
 	params.logger.Debug("Start to watch the console")
 
 	p.sandboxID = params.id
+	p.debug = params.debug
+
+	// For cloud hypervisor, it hasn't support the console watching and
+	// it's consoleURL will be set empty.
+	if params.consoleURL != "" && (params.debug || params.guestLogMaxSize > 0) {
+		proto := buildinProxyConsoleProto
+		if strings.HasPrefix(params.consoleURL, kataclient.HybridVSockScheme) {
+			proto = consoleProtoHybridVSock
+		}
 
-	// For firecracker, it hasn't support the console watching and it's consoleURL
-	// will be set empty.
-	// TODO: add support for hybrid vsocks, see https://github.com/kata-containers/runtime/issues/2098
-	if params.debug && params.consoleURL != "" && !strings.HasPrefix(params.consoleURL, kataclient.HybridVSockScheme) {
-		err := p.watchConsole(buildinProxyConsoleProto, params.consoleURL, params.logger)
-		if err != nil {
+		if params.guestLogMaxSize > 0 {
+			l, err := openGuestLog(params.guestLogDir, params.id, int64(params.guestLogMaxSize)<<20)
+			if err != nil {
+				p.sandboxID = ""
+				return -1, "", err
+			}
+			p.guestLog = l
+		}
+
+		err := p.watchConsole(proto, params.consoleURL, params.logger)
+		if err != nil && proto == consoleProtoHybridVSock {
+			// Agents not serving their logs on vsock must not
+			// prevent the sandbox from starting.
+			params.logger.WithError(err).Warn("failed to watch the guest logs")
+			p.closeGuestLog()
+		} else if err != nil {
+			p.closeGuestLog()
 			p.sandboxID = ""
 			return -1, "", err
 		}
@@ -266,5 +322,48 @@ func (p *proxyBuiltin) stop(pid int) error {
 		p.conn = nil
 		p.sandboxID = ""
 	}
+	p.closeGuestLog()
 	return nil
 }
+
+// closeGuestLog closes the guest log not handed over to a console watcher,
+// the file being left behind for the logs to be retrieved once the sandbox
+// is gone.
+func (p *proxyBuiltin) closeGuestLog() {
+	if p.guestLog != nil {
+		p.guestLog.close()
+		p.guestLog = nil
+	}
+}
+
+// dialAgentLogs connects to the vsock port the agent serves its logs on,
+// given by the hybrid vsock console URL.
+func dialAgentLogs(console string) (net.Conn, error) {
+	u, err := url.Parse(console)
+	if err != nil {
+		return nil, err
+	}
+
+	hvsock := strings.Split(u.Path, ":")
+	if len(hvsock) != 2 {
+		return nil, fmt.Errorf("Invalid hybrid vsock console URL %q", console)
+	}
+
+	port, err := strconv.ParseUint(hvsock[1], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid hybrid vsock console port %q: %v", hvsock[1], err)
+	}
+
+	conn, err := dialHybridVSock(hvsock[0], uint32(port))
+	if err != nil {
+		return nil, err
+	}
+
+	// The logs are read for the lifetime of the sandbox.
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
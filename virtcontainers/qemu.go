@@ -11,6 +11,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"net"
@@ -30,6 +31,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 
 	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	persistapi "github.com/kata-containers/runtime/virtcontainers/persist/api"
@@ -54,14 +56,36 @@ type qmpChannel struct {
 	path    string
 	qmp     *govmmQemu.QMP
 	disconn chan struct{}
+
+	// rawPath is the path of the QMP socket of the commands govmm does
+	// not wrap, served apart from path for the govmm connection to stay
+	// up while they run. rawMu serializes them, QEMU serving one client
+	// per socket.
+	rawPath string
+	rawMu   sync.Mutex
 }
 
+var getNUMANodesFunc = utils.GetNUMANodes
+
 // CPUDevice represents a CPU device which was hot-added in a running VM
 type CPUDevice struct {
 	// ID is used to identify this CPU in the hypervisor options.
 	ID string
 }
 
+// NUMANode represents a guest NUMA node and the host NUMA node backing it
+type NUMANode struct {
+	// HostNode is the host NUMA node the node memory is bound to.
+	HostNode int
+
+	// HostCPUs is the list of host CPUs the node vCPUs run on.
+	HostCPUs string
+
+	// FirstVCPU and LastVCPU delimit the range of vCPUs of the node.
+	FirstVCPU uint32
+	LastVCPU  uint32
+}
+
 // QemuState keeps Qemu's state
 type QemuState struct {
 	Bridges []types.Bridge
@@ -72,6 +96,8 @@ type QemuState struct {
 	HotplugVFIOOnRootBus bool
 	VirtiofsdPid         int
 	PCIeRootPort         int
+	// NUMANodes is the list of guest NUMA nodes, empty unless EnableNUMA is set
+	NUMANodes []NUMANode
 }
 
 // qemu is an Hypervisor interface implementation for the Linux qemu hypervisor.
@@ -99,11 +125,16 @@ type qemu struct {
 	stopped bool
 
 	store persistapi.PersistDriver
+
+	// virtiofsd tracks the virtiofsd process of state.VirtiofsdPid, for
+	// check not to rely on a pid that may be reused.
+	virtiofsd *virtiofsd
 }
 
 const (
 	consoleSocket = "console.sock"
 	qmpSocket     = "qmp.sock"
+	qmpRawSocket  = "qmp-raw.sock"
 	vhostFSSocket = "vhost-fs.sock"
 
 	qmpCapErrMsg  = "Failed to negoatiate QMP capabilities"
@@ -184,7 +215,14 @@ func (q *qemu) capabilities() types.Capabilities {
 	span, _ := q.trace("capabilities")
 	defer span.Finish()
 
-	return q.arch.capabilities()
+	caps := q.arch.capabilities()
+
+	// Hotplugged drives are added read-only when requested.
+	if caps.IsBlockDeviceHotplugSupported() {
+		caps.SetReadOnlyBlockDeviceHotplugSupport()
+	}
+
+	return caps
 }
 
 func (q *qemu) hypervisorConfig() HypervisorConfig {
@@ -327,6 +365,166 @@ func (q *qemu) memoryTopology() (govmmQemu.Memory, error) {
 	return q.arch.memoryTopology(memMb, hostMemMb, uint8(q.config.MemSlots)), nil
 }
 
+// numaMemory is a govmm device placing the guest memory on one guest NUMA
+// node per node, each backed by its own memory bound to a host NUMA node.
+// govmm places the whole guest memory on a single node, so the device sets
+// the guest memory up in its place.
+type numaMemory struct {
+	// memory is the guest memory the nodes split.
+	memory govmmQemu.Memory
+
+	nodes []numaMemoryNode
+}
+
+type numaMemoryNode struct {
+	sizeMB   uint32
+	vcpus    string
+	hostNode int
+}
+
+// Valid returns true if there is guest memory to place on nodes.
+func (n numaMemory) Valid() bool {
+	return n.memory.Size != "" && len(n.nodes) > 0
+}
+
+// QemuParams returns the qemu parameters of the guest memory and its nodes.
+func (n numaMemory) QemuParams(config *govmmQemu.Config) []string {
+	memoryParam := n.memory.Size
+	if n.memory.Slots > 0 {
+		memoryParam += fmt.Sprintf(",slots=%d", n.memory.Slots)
+	}
+	if n.memory.MaxMem != "" {
+		memoryParam += ",maxmem=" + n.memory.MaxMem
+	}
+
+	qemuParams := []string{"-m", memoryParam}
+
+	for i, node := range n.nodes {
+		id := fmt.Sprintf("dimm%d", i+1)
+
+		var objMemParam string
+		if config.Knobs.HugePages {
+			objMemParam = fmt.Sprintf("memory-backend-file,id=%s,size=%dM,mem-path=/dev/hugepages", id, node.sizeMB)
+		} else if config.Knobs.FileBackedMem && config.Memory.Path != "" {
+			objMemParam = fmt.Sprintf("memory-backend-file,id=%s,size=%dM,mem-path=%s", id, node.sizeMB, config.Memory.Path)
+		} else {
+			objMemParam = fmt.Sprintf("memory-backend-ram,id=%s,size=%dM", id, node.sizeMB)
+		}
+
+		if config.Knobs.MemShared {
+			objMemParam += ",share=on"
+		}
+		if config.Knobs.MemPrealloc {
+			objMemParam += ",prealloc=on"
+		}
+		objMemParam += fmt.Sprintf(",host-nodes=%d,policy=bind", node.hostNode)
+
+		qemuParams = append(qemuParams, "-object", objMemParam)
+		qemuParams = append(qemuParams, "-numa", fmt.Sprintf("node,nodeid=%d,cpus=%s,memdev=%s", i, node.vcpus, id))
+	}
+
+	return qemuParams
+}
+
+// numaTopology splits the guest memory and vCPUs into one guest NUMA node per
+// host NUMA node of the sandbox cpuset, or of the host if the sandbox has no
+// cpuset. Each node memory is bound to its host node, and its vCPUs are
+// pinned to the host node CPUs once the sandbox cgroups are set up.
+func (q *qemu) numaTopology(smp govmmQemu.SMP) (*numaMemory, error) {
+	q.state.NUMANodes = nil
+	if !q.config.EnableNUMA {
+		return nil, nil
+	}
+
+	if q.config.BootToBeTemplate || q.config.BootFromTemplate {
+		return nil, errors.New("NUMA placement cannot be enabled with VM templating")
+	}
+
+	if q.config.HypervisorMachineType == QemuMicrovm {
+		return nil, fmt.Errorf("NUMA placement is not supported by machine type %s", QemuMicrovm)
+	}
+
+	hostCPUs, err := cpuset.Parse(q.config.SandboxCPUSet)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid sandbox cpuset %q: %v", q.config.SandboxCPUSet, err)
+	}
+
+	hostNodes, err := getNUMANodesFunc(hostCPUs)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read host NUMA nodes: %v", err)
+	}
+	if len(hostNodes) == 0 {
+		return nil, fmt.Errorf("No host NUMA node found for CPUs %q", q.config.SandboxCPUSet)
+	}
+
+	maxVCPUs := smp.MaxCPUs
+	if maxVCPUs < smp.CPUs {
+		maxVCPUs = smp.CPUs
+	}
+
+	// Every guest node gets at least one vCPU.
+	if uint32(len(hostNodes)) > maxVCPUs {
+		hostNodes = hostNodes[:maxVCPUs]
+	}
+
+	memMb := uint32(q.config.MemorySize)
+	nodes := uint32(len(hostNodes))
+	if memMb < nodes {
+		return nil, fmt.Errorf("Not enough memory (%dMiB) for %d NUMA nodes", memMb, nodes)
+	}
+
+	numa := &numaMemory{}
+	for i, hostNode := range hostNodes {
+		n := uint32(i)
+
+		size := memMb / nodes
+		if n == 0 {
+			size += memMb % nodes
+		}
+
+		firstVCPU := n * maxVCPUs / nodes
+		lastVCPU := (n+1)*maxVCPUs/nodes - 1
+
+		numa.nodes = append(numa.nodes, numaMemoryNode{
+			sizeMB:   size,
+			vcpus:    fmt.Sprintf("%d-%d", firstVCPU, lastVCPU),
+			hostNode: hostNode.ID,
+		})
+
+		q.state.NUMANodes = append(q.state.NUMANodes, NUMANode{
+			HostNode:  hostNode.ID,
+			HostCPUs:  hostNode.CPUs.String(),
+			FirstVCPU: firstVCPU,
+			LastVCPU:  lastVCPU,
+		})
+	}
+
+	return numa, nil
+}
+
+// vcpuAffinity returns the host CPUs of the NUMA node each of vcpus belongs to.
+func (q *qemu) vcpuAffinity(vcpus map[int]int) (map[int]cpuset.CPUSet, error) {
+	if len(q.state.NUMANodes) == 0 {
+		return nil, nil
+	}
+
+	affinity := make(map[int]cpuset.CPUSet, len(vcpus))
+	for _, node := range q.state.NUMANodes {
+		hostCPUs, err := cpuset.Parse(node.HostCPUs)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CPU list for host NUMA node %d: %v", node.HostNode, err)
+		}
+
+		for vcpu := node.FirstVCPU; vcpu <= node.LastVCPU; vcpu++ {
+			if _, ok := vcpus[int(vcpu)]; ok {
+				affinity[int(vcpu)] = hostCPUs
+			}
+		}
+	}
+
+	return affinity, nil
+}
+
 func (q *qemu) qmpSocketPath(id string) (string, error) {
 	return utils.BuildSocketPath(q.store.RunVMStoragePath(), id, qmpSocket)
 }
@@ -370,9 +568,15 @@ func (q *qemu) createQmpSocket() ([]govmmQemu.QMPSocket, error) {
 		return nil, err
 	}
 
+	rawSockPath, err := utils.BuildSocketPath(q.store.RunVMStoragePath(), q.id, qmpRawSocket)
+	if err != nil {
+		return nil, err
+	}
+
 	q.qmpMonitorCh = qmpChannel{
-		ctx:  q.ctx,
-		path: monitorSockPath,
+		ctx:     q.ctx,
+		path:    monitorSockPath,
+		rawPath: rawSockPath,
 	}
 
 	return []govmmQemu.QMPSocket{
@@ -382,6 +586,12 @@ func (q *qemu) createQmpSocket() ([]govmmQemu.QMPSocket, error) {
 			Server: true,
 			NoWait: true,
 		},
+		{
+			Type:   "unix",
+			Name:   q.qmpMonitorCh.rawPath,
+			Server: true,
+			NoWait: true,
+		},
 	}, nil
 }
 
@@ -485,6 +695,11 @@ func (q *qemu) createSandbox(ctx context.Context, id string, networkNS NetworkNa
 		return err
 	}
 
+	numa, err := q.numaTopology(smp)
+	if err != nil {
+		return err
+	}
+
 	knobs := govmmQemu.Knobs{
 		NoUserConfig: true,
 		NoDefaults:   true,
@@ -597,6 +812,13 @@ func (q *qemu) createSandbox(ctx context.Context, id string, networkNS NetworkNa
 	if ioThread != nil {
 		qemuConfig.IOThreads = []govmmQemu.IOThread{*ioThread}
 	}
+
+	// The NUMA nodes take the guest memory over from govmm.
+	if numa != nil {
+		numa.memory = qemuConfig.Memory
+		qemuConfig.Devices = append(qemuConfig.Devices, *numa)
+		qemuConfig.Memory.Size = ""
+	}
 	// Add RNG device to hypervisor
 	rngDev := config.RNGDev{
 		ID:       rngID,
@@ -632,7 +854,7 @@ func (q *qemu) virtiofsdArgs(fd uintptr) []string {
 		fmt.Sprintf("--fd=%v", fd),
 		"-o", "source=" + sourcePath,
 		"-o", "cache=" + q.config.VirtioFSCache,
-		"--syslog", "-o", "no_posix_lock"}
+		"-o", "no_posix_lock"}
 	if q.config.Debug {
 		args = append(args, "-d")
 	} else {
@@ -686,15 +908,38 @@ func (q *qemu) setupVirtiofsd() (err error) {
 	q.state.VirtiofsdPid = cmd.Process.Pid
 	fd.Close()
 
+	v := &virtiofsd{
+		PID:        cmd.Process.Pid,
+		sourcePath: getSharePath(q.id),
+		exited:     make(chan struct{}),
+	}
+	q.virtiofsd = v
+
 	// Monitor virtiofsd's stderr and stop sandbox if virtiofsd quits
 	go func() {
-		scanner := bufio.NewScanner(stderr)
+		logger := q.Logger().WithFields(logrus.Fields{
+			"source": "virtiofsd",
+			"pid":    cmd.Process.Pid,
+		})
+		var log io.ReadCloser = stderr
+		if l, err := openBoundedLog(virtiofsdLogPath(sockPath), diagnosticsLogSize); err != nil {
+			logger.WithError(err).Warn("failed to open virtiofsd log")
+		} else {
+			log = &loggedReader{ReadCloser: stderr, log: l}
+		}
+
+		scanner := bufio.NewScanner(log)
 		for scanner.Scan() {
-			q.Logger().WithField("source", "virtiofsd").Info(scanner.Text())
+			logger.Info(scanner.Text())
 		}
-		q.Logger().Info("virtiofsd quits")
+		logger.Info("virtiofsd quits")
 		// Wait to release resources of virtiofsd process
-		cmd.Process.Wait()
+		if state, err := cmd.Process.Wait(); err != nil {
+			v.exitErr = err
+		} else {
+			v.exitErr = errors.New(state.String())
+		}
+		close(v.exited)
 		q.stopSandbox()
 	}()
 	return err
@@ -794,10 +1039,9 @@ func (q *qemu) startSandbox(timeout int) error {
 	if err != nil {
 		return err
 	}
-	// append logfile only on debug
-	if q.config.Debug {
-		q.qemuConfig.LogFile = filepath.Join(vmPath, "qemu.log")
-	}
+	// The log file is kept for the diagnostics bundles, its content is
+	// only logged on debug.
+	q.qemuConfig.LogFile = filepath.Join(vmPath, "qemu.log")
 
 	defer func() {
 		if err != nil {
@@ -942,6 +1186,9 @@ func (q *qemu) stopSandbox() error {
 
 	defer func() {
 		q.cleanupVM()
+		if q.virtiofsd != nil {
+			q.virtiofsd.release()
+		}
 		q.stopped = true
 	}()
 
@@ -1103,7 +1350,9 @@ func (q *qemu) hotplugAddBlockDevice(drive *config.BlockDrive, op operation, dev
 		return nil
 	}
 
-	if q.config.BlockDeviceCacheSet {
+	if drive.ReadOnly {
+		err = q.blockdevAddReadOnly(drive)
+	} else if q.config.BlockDeviceCacheSet {
 		err = q.qmpMonitorCh.qmp.ExecuteBlockdevAddWithCache(q.qmpMonitorCh.ctx, drive.File, drive.ID, q.config.BlockDeviceCacheDirect, q.config.BlockDeviceCacheNoflush)
 	} else {
 		err = q.qmpMonitorCh.qmp.ExecuteBlockdevAdd(q.qmpMonitorCh.ctx, drive.File, drive.ID)
@@ -2066,6 +2315,12 @@ func (q *qemu) getThreadIDs() (vcpuThreadIDs, error) {
 			tid.vcpus[i.CPU] = i.ThreadID
 		}
 	}
+
+	tid.affinity, err = q.vcpuAffinity(tid.vcpus)
+	if err != nil {
+		return tid, err
+	}
+
 	return tid, nil
 }
 
@@ -2148,10 +2403,11 @@ func (q *qemu) getPids() []int {
 }
 
 type qemuGrpc struct {
-	ID             string
-	QmpChannelpath string
-	State          QemuState
-	NvdimmCount    int
+	ID                string
+	QmpChannelpath    string
+	QmpRawChannelpath string
+	State             QemuState
+	NvdimmCount       int
 
 	// Most members of q.qemuConfig are just to generate
 	// q.qemuConfig.qemuParams that is used by LaunchQemu except
@@ -2171,6 +2427,7 @@ func (q *qemu) fromGrpc(ctx context.Context, hypervisorConfig *HypervisorConfig,
 	q.config = *hypervisorConfig
 	q.qmpMonitorCh.ctx = ctx
 	q.qmpMonitorCh.path = qp.QmpChannelpath
+	q.qmpMonitorCh.rawPath = qp.QmpRawChannelpath
 	q.qemuConfig.Ctx = ctx
 	q.state = qp.State
 	q.arch = newQemuArch(q.config)
@@ -2188,10 +2445,11 @@ func (q *qemu) toGrpc() ([]byte, error) {
 
 	q.cleanup()
 	qp := qemuGrpc{
-		ID:             q.id,
-		QmpChannelpath: q.qmpMonitorCh.path,
-		State:          q.state,
-		NvdimmCount:    q.nvdimmCount,
+		ID:                q.id,
+		QmpChannelpath:    q.qmpMonitorCh.path,
+		QmpRawChannelpath: q.qmpMonitorCh.rawPath,
+		State:             q.state,
+		NvdimmCount:       q.nvdimmCount,
 
 		QemuSMP: q.qemuConfig.SMP,
 	}
@@ -2225,6 +2483,15 @@ func (q *qemu) save() (s persistapi.HypervisorState) {
 			ID: cpu.ID,
 		})
 	}
+
+	for _, node := range q.state.NUMANodes {
+		s.NUMANodes = append(s.NUMANodes, persistapi.NUMANode{
+			HostNode:  node.HostNode,
+			HostCPUs:  node.HostCPUs,
+			FirstVCPU: node.FirstVCPU,
+			LastVCPU:  node.LastVCPU,
+		})
+	}
 	return
 }
 
@@ -2244,6 +2511,15 @@ func (q *qemu) load(s persistapi.HypervisorState) {
 			ID: cpu.ID,
 		})
 	}
+
+	for _, node := range s.NUMANodes {
+		q.state.NUMANodes = append(q.state.NUMANodes, NUMANode{
+			HostNode:  node.HostNode,
+			HostCPUs:  node.HostCPUs,
+			FirstVCPU: node.FirstVCPU,
+			LastVCPU:  node.LastVCPU,
+		})
+	}
 }
 
 func (q *qemu) check() error {
@@ -2261,9 +2537,55 @@ func (q *qemu) check() error {
 		return errors.Errorf("guest failure: %s", status.Status)
 	}
 
+	if q.state.VirtiofsdPid != 0 {
+		// A virtiofsd started before the sandbox was restored is
+		// watched through a pidfd.
+		if q.virtiofsd == nil || q.virtiofsd.PID != q.state.VirtiofsdPid {
+			q.virtiofsd = &virtiofsd{
+				PID:        q.state.VirtiofsdPid,
+				sourcePath: getSharePath(q.id),
+			}
+		}
+
+		if err := q.virtiofsd.Check(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+func (q *qemu) saveDiagnostics(dir string, guestMemory bool) error {
+	err := q.qmpSetup()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(q.qmpMonitorCh.ctx, diagnosticsHypervisorTimeout)
+	defer cancel()
+
+	status, err := q.qmpMonitorCh.qmp.ExecuteQueryStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := writeDiagnostics(filepath.Join(dir, "qmp-status.json"), status); err != nil {
+		return err
+	}
+
+	if !guestMemory {
+		return nil
+	}
+
+	// The guest is paused until its memory is dumped, QEMU completing the
+	// dump on its own once ctx is done.
+	return q.qmpExecute(ctx, "dump-guest-memory", map[string]interface{}{
+		"paging":   false,
+		"protocol": "file:" + filepath.Join(dir, diagnosticsGuestMemory),
+		"format":   "elf",
+	})
+}
+
 func (q *qemu) generateSocket(id string, useVsock bool) (interface{}, error) {
 	return generateVMSocket(id, useVsock, q.store.RunVMStoragePath())
 }
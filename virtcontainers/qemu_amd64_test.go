@@ -6,9 +6,11 @@
 package virtcontainers
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
 
 	govmmQemu "github.com/intel/govmm/qemu"
@@ -273,3 +275,73 @@ func TestQemuAmd64Iommu(t *testing.T) {
 	assert.NoError(err)
 	assert.Contains(m.Options, "kernel_irqchip=split")
 }
+
+type qemuCommandLineLogger struct {
+	params []string
+}
+
+func (l *qemuCommandLineLogger) V(int32) bool {
+	return false
+}
+
+func (l *qemuCommandLineLogger) Infof(format string, v ...interface{}) {
+	if len(v) == 2 {
+		if params, ok := v[1].([]string); ok {
+			l.params = params
+		}
+	}
+}
+
+func (l *qemuCommandLineLogger) Warningf(format string, v ...interface{}) {
+}
+
+func (l *qemuCommandLineLogger) Errorf(format string, v ...interface{}) {
+}
+
+func TestQemuAmd64NUMACommandLine(t *testing.T) {
+	assert := assert.New(t)
+
+	defer mockNUMANodes()()
+
+	sandbox, err := createQemuSandboxConfig()
+	assert.NoError(err)
+
+	q := &qemu{
+		store: sandbox.newStore,
+	}
+	sandbox.config.HypervisorConfig.EnableNUMA = true
+	sandbox.config.HypervisorConfig.SandboxCPUSet = "2-5"
+	sandbox.config.HypervisorConfig.HugePages = true
+	sandbox.config.HypervisorConfig.MemPrealloc = true
+	sandbox.config.HypervisorConfig.MemorySize = 2048
+	sandbox.config.HypervisorConfig.DefaultMaxVCPUs = 4
+	err = q.createSandbox(context.Background(), sandbox.id, NetworkNamespace{}, &sandbox.config.HypervisorConfig, false)
+	assert.NoError(err)
+
+	logger := &qemuCommandLineLogger{}
+	q.qemuConfig.Path = "true"
+	_, err = govmmQemu.LaunchQemu(q.qemuConfig, logger)
+	assert.NoError(err)
+
+	cmdline := strings.Join(logger.params, " ")
+	assert.Equal(1, strings.Count(cmdline, "-m 2048M"))
+	assert.Contains(cmdline, "-object memory-backend-file,id=dimm1,size=1024M,mem-path=/dev/hugepages,prealloc=on,host-nodes=0,policy=bind -numa node,nodeid=0,cpus=0-1,memdev=dimm1")
+	assert.Contains(cmdline, "-object memory-backend-file,id=dimm2,size=1024M,mem-path=/dev/hugepages,prealloc=on,host-nodes=1,policy=bind -numa node,nodeid=1,cpus=2-3,memdev=dimm2")
+	assert.NotContains(cmdline, "dimm3")
+
+	// Without NUMA, a single node holds the whole memory.
+	q = &qemu{
+		store: sandbox.newStore,
+	}
+	sandbox.config.HypervisorConfig.EnableNUMA = false
+	err = q.createSandbox(context.Background(), sandbox.id, NetworkNamespace{}, &sandbox.config.HypervisorConfig, false)
+	assert.NoError(err)
+
+	q.qemuConfig.Path = "true"
+	_, err = govmmQemu.LaunchQemu(q.qemuConfig, logger)
+	assert.NoError(err)
+
+	cmdline = strings.Join(logger.params, " ")
+	assert.Contains(cmdline, "-object memory-backend-file,id=dimm1,size=2048M,mem-path=/dev/hugepages,prealloc=on -numa node,memdev=dimm1")
+	assert.NotContains(cmdline, "host-nodes")
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+)
+
+// qmpResponse is a message received on a QMP socket: a command result, a
+// command error or an asynchronous event.
+type qmpResponse struct {
+	Return json.RawMessage `json:"return"`
+	Error  *struct {
+		Class string `json:"class"`
+		Desc  string `json:"desc"`
+	} `json:"error"`
+	Event string `json:"event"`
+}
+
+// qmpExecute runs command with args on the QMP socket at path, for the QMP
+// commands and arguments govmm does not wrap. QEMU serves one QMP client at
+// a time, the connections to path are serialized by the caller.
+func qmpExecute(ctx context.Context, path, command string, args map[string]interface{}) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Unblock the exchange if ctx is done before it completes.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+
+	var greeting map[string]json.RawMessage
+	if err := dec.Decode(&greeting); err != nil {
+		return fmt.Errorf("Could not read QMP greeting: %v", err)
+	}
+	if _, ok := greeting["QMP"]; !ok {
+		return fmt.Errorf("Unexpected QMP greeting on %s", path)
+	}
+
+	if err := qmpCommand(dec, enc, "qmp_capabilities", nil); err != nil {
+		return err
+	}
+
+	return qmpCommand(dec, enc, command, args)
+}
+
+// qmpCommand sends command with args and waits for its result, skipping
+// the events received in between.
+func qmpCommand(dec *json.Decoder, enc *json.Encoder, command string, args map[string]interface{}) error {
+	req := map[string]interface{}{
+		"execute": command,
+	}
+	if args != nil {
+		req["arguments"] = args
+	}
+
+	if err := enc.Encode(req); err != nil {
+		return fmt.Errorf("Could not send QMP command %s: %v", command, err)
+	}
+
+	for {
+		var resp qmpResponse
+		if err := dec.Decode(&resp); err != nil {
+			return fmt.Errorf("Could not read QMP command %s result: %v", command, err)
+		}
+
+		if resp.Event != "" {
+			continue
+		}
+
+		if resp.Error != nil {
+			return fmt.Errorf("QMP command %s failed: %s: %s", command, resp.Error.Class, resp.Error.Desc)
+		}
+
+		return nil
+	}
+}
+
+// qmpExecute runs command with args on the raw QMP socket of the VM, the
+// govmm connection being left alone.
+func (q *qemu) qmpExecute(ctx context.Context, command string, args map[string]interface{}) error {
+	if q.qmpMonitorCh.rawPath == "" {
+		return fmt.Errorf("QMP command %s not supported by the VM", command)
+	}
+
+	q.qmpMonitorCh.rawMu.Lock()
+	defer q.qmpMonitorCh.rawMu.Unlock()
+
+	return qmpExecute(ctx, q.qmpMonitorCh.rawPath, command, args)
+}
+
+// blockdevAddReadOnly adds drive as a read-only block device backend, which
+// govmm's blockdev-add does not support.
+func (q *qemu) blockdevAddReadOnly(drive *config.BlockDrive) error {
+	args := map[string]interface{}{
+		"driver":    "raw",
+		"node-name": drive.ID,
+		"read-only": true,
+		"file": map[string]interface{}{
+			"driver":   "file",
+			"filename": drive.File,
+		},
+	}
+
+	if q.config.BlockDeviceCacheSet {
+		args["cache"] = map[string]interface{}{
+			"direct":   q.config.BlockDeviceCacheDirect,
+			"no-flush": q.config.BlockDeviceCacheNoflush,
+		}
+	}
+
+	return q.qmpExecute(q.qmpMonitorCh.ctx, "blockdev-add", args)
+}
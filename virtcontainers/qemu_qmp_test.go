@@ -0,0 +1,151 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeQMPServer serves one QMP client on path, answering each command with
+// reply, after an event. It sends the commands it receives on cmds.
+func fakeQMPServer(t *testing.T, path string, reply func(cmd string) string, cmds chan<- map[string]interface{}) net.Listener {
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		fmt.Fprintln(conn, `{"QMP": {"version": {"qemu": {"major": 5, "minor": 0, "micro": 0}}, "capabilities": []}}`)
+
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var cmd map[string]interface{}
+			if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+				return
+			}
+			cmds <- cmd
+
+			fmt.Fprintln(conn, `{"event": "RESUME", "timestamp": {"seconds": 1, "microseconds": 0}}`)
+			fmt.Fprintln(conn, reply(cmd["execute"].(string)))
+		}
+	}()
+
+	return l
+}
+
+func TestQMPExecute(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "qmp")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "qmp.sock")
+	cmds := make(chan map[string]interface{}, 2)
+	l := fakeQMPServer(t, path, func(cmd string) string {
+		return `{"return": {}}`
+	}, cmds)
+
+	err = qmpExecute(context.Background(), path, "blockdev-add", map[string]interface{}{"read-only": true})
+	assert.NoError(err)
+	l.Close()
+
+	assert.Equal("qmp_capabilities", (<-cmds)["execute"])
+	cmd := <-cmds
+	assert.Equal("blockdev-add", cmd["execute"])
+	assert.Equal(map[string]interface{}{"read-only": true}, cmd["arguments"])
+
+	os.Remove(path)
+	l = fakeQMPServer(t, path, func(cmd string) string {
+		if cmd == "qmp_capabilities" {
+			return `{"return": {}}`
+		}
+		return `{"error": {"class": "GenericError", "desc": "foo"}}`
+	}, cmds)
+	defer l.Close()
+
+	err = qmpExecute(context.Background(), path, "dump-guest-memory", nil)
+	assert.Error(err)
+	assert.Contains(err.Error(), "GenericError: foo")
+}
+
+func TestQemuQMPExecute(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "qmp")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	q := &qemu{}
+	err = q.qmpExecute(context.Background(), "blockdev-add", nil)
+	assert.Error(err)
+
+	// The raw commands do not go through the govmm connection.
+	q.qmpMonitorCh.path = filepath.Join(dir, "qmp.sock")
+	q.qmpMonitorCh.rawPath = filepath.Join(dir, "qmp-raw.sock")
+	cmds := make(chan map[string]interface{}, 2)
+	l := fakeQMPServer(t, q.qmpMonitorCh.rawPath, func(cmd string) string {
+		return `{"return": {}}`
+	}, cmds)
+	defer l.Close()
+
+	err = q.qmpExecute(context.Background(), "blockdev-add", nil)
+	assert.NoError(err)
+	assert.Equal("qmp_capabilities", (<-cmds)["execute"])
+	assert.Equal("blockdev-add", (<-cmds)["execute"])
+}
+
+func TestQemuCheckVirtiofsd(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "qmp")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	q := &qemu{
+		id:  testSandboxID,
+		ctx: context.Background(),
+	}
+	q.qmpMonitorCh.ctx = q.ctx
+	q.qmpMonitorCh.path = filepath.Join(dir, "qmp.sock")
+	cmds := make(chan map[string]interface{}, 8)
+	l := fakeQMPServer(t, q.qmpMonitorCh.path, func(cmd string) string {
+		if cmd == "query-status" {
+			return `{"return": {"running": true, "singlestep": false, "status": "running"}}`
+		}
+		return `{"return": {}}`
+	}, cmds)
+	defer l.Close()
+	defer q.qmpShutdown()
+
+	// A virtiofsd restored from the sandbox state is watched through its
+	// pid, not signalled.
+	cmd := exec.Command("sleep", "60")
+	assert.NoError(cmd.Start())
+	q.state.VirtiofsdPid = cmd.Process.Pid
+	assert.NoError(q.check())
+	assert.NotNil(q.virtiofsd)
+
+	assert.NoError(cmd.Process.Kill())
+	cmd.Wait()
+	assert.Error(q.check())
+	q.virtiofsd.release()
+}
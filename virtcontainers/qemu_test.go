@@ -21,6 +21,7 @@ import (
 	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 )
 
 func newQemuConfig() HypervisorConfig {
@@ -535,6 +536,129 @@ func TestQemuFileBackedMem(t *testing.T) {
 	assert.Equal(expectErr.Error(), err.Error())
 }
 
+func mockNUMANodes() func() {
+	savedGetNUMANodesFunc := getNUMANodesFunc
+
+	getNUMANodesFunc = func(cpus cpuset.CPUSet) ([]utils.NUMANode, error) {
+		return []utils.NUMANode{
+			{ID: 0, CPUs: cpus.Intersection(cpuset.MustParse("0-3"))},
+			{ID: 1, CPUs: cpus.Intersection(cpuset.MustParse("4-7"))},
+		}, nil
+	}
+
+	return func() {
+		getNUMANodesFunc = savedGetNUMANodesFunc
+	}
+}
+
+func qemuNUMANodes(q *qemu) []numaMemoryNode {
+	for _, d := range q.qemuConfig.Devices {
+		if numa, ok := d.(numaMemory); ok {
+			return numa.nodes
+		}
+	}
+	return nil
+}
+
+func TestQemuNUMATopology(t *testing.T) {
+	assert := assert.New(t)
+
+	defer mockNUMANodes()()
+
+	sandbox, err := createQemuSandboxConfig()
+	assert.NoError(err)
+
+	q := &qemu{
+		store: sandbox.newStore,
+	}
+	sandbox.config.HypervisorConfig.EnableNUMA = true
+	sandbox.config.HypervisorConfig.SandboxCPUSet = "2-5"
+	sandbox.config.HypervisorConfig.HugePages = true
+	sandbox.config.HypervisorConfig.MemorySize = 2049
+	sandbox.config.HypervisorConfig.NumVCPUs = 1
+	sandbox.config.HypervisorConfig.DefaultMaxVCPUs = 4
+	err = q.createSandbox(context.Background(), sandbox.id, NetworkNamespace{}, &sandbox.config.HypervisorConfig, false)
+	assert.NoError(err)
+
+	assert.Equal([]numaMemoryNode{
+		{sizeMB: 1025, vcpus: "0-1", hostNode: 0},
+		{sizeMB: 1024, vcpus: "2-3", hostNode: 1},
+	}, qemuNUMANodes(q))
+	assert.Empty(q.qemuConfig.Memory.Size)
+	assert.Equal([]NUMANode{
+		{HostNode: 0, HostCPUs: "2-3", FirstVCPU: 0, LastVCPU: 1},
+		{HostNode: 1, HostCPUs: "4-5", FirstVCPU: 2, LastVCPU: 3},
+	}, q.state.NUMANodes)
+
+	// Only the running vCPUs get an affinity.
+	affinity, err := q.vcpuAffinity(map[int]int{0: 100, 2: 102})
+	assert.NoError(err)
+	assert.Equal(map[int]cpuset.CPUSet{
+		0: cpuset.MustParse("2-3"),
+		2: cpuset.MustParse("4-5"),
+	}, affinity)
+
+	// Persisted placement is restored.
+	q2 := &qemu{}
+	q2.load(q.save())
+	assert.Equal(q.state.NUMANodes, q2.state.NUMANodes)
+
+	// A single vCPU only fits on the first node.
+	q = &qemu{
+		store: sandbox.newStore,
+	}
+	sandbox.config.HypervisorConfig.DefaultMaxVCPUs = 1
+	err = q.createSandbox(context.Background(), sandbox.id, NetworkNamespace{}, &sandbox.config.HypervisorConfig, false)
+	assert.NoError(err)
+	assert.Equal([]numaMemoryNode{
+		{sizeMB: 2049, vcpus: "0-0", hostNode: 0},
+	}, qemuNUMANodes(q))
+
+	// Without NUMA, nothing is placed.
+	q = &qemu{
+		store: sandbox.newStore,
+	}
+	sandbox.config.HypervisorConfig.EnableNUMA = false
+	err = q.createSandbox(context.Background(), sandbox.id, NetworkNamespace{}, &sandbox.config.HypervisorConfig, false)
+	assert.NoError(err)
+	assert.Empty(qemuNUMANodes(q))
+	assert.NotEmpty(q.qemuConfig.Memory.Size)
+	assert.Empty(q.state.NUMANodes)
+	affinity, err = q.vcpuAffinity(map[int]int{0: 100})
+	assert.NoError(err)
+	assert.Nil(affinity)
+
+	// NUMA placement does not work with VM templating.
+	q = &qemu{
+		store: sandbox.newStore,
+	}
+	sandbox.config.HypervisorConfig.EnableNUMA = true
+	sandbox.config.HypervisorConfig.BootToBeTemplate = true
+	err = q.createSandbox(context.Background(), sandbox.id, NetworkNamespace{}, &sandbox.config.HypervisorConfig, false)
+	assert.Error(err)
+
+	// The sandbox cpuset must be valid.
+	q = &qemu{
+		store: sandbox.newStore,
+	}
+	sandbox.config.HypervisorConfig.BootToBeTemplate = false
+	sandbox.config.HypervisorConfig.SandboxCPUSet = "foo"
+	err = q.createSandbox(context.Background(), sandbox.id, NetworkNamespace{}, &sandbox.config.HypervisorConfig, false)
+	assert.Error(err)
+
+	// No host node to mirror.
+	sandbox.config.HypervisorConfig.SandboxCPUSet = "2-5"
+	getNUMANodesFunc = func(cpus cpuset.CPUSet) ([]utils.NUMANode, error) {
+		return nil, nil
+	}
+	q = &qemu{
+		store: sandbox.newStore,
+	}
+	sandbox.config.HypervisorConfig.BootToBeTemplate = false
+	err = q.createSandbox(context.Background(), sandbox.id, NetworkNamespace{}, &sandbox.config.HypervisorConfig, false)
+	assert.Error(err)
+}
+
 func createQemuSandboxConfig() (*Sandbox, error) {
 
 	qemuConfig := newQemuConfig()
@@ -574,12 +698,12 @@ func TestQemuVirtiofsdArgs(t *testing.T) {
 		kataHostSharedDir = savedKataHostSharedDir
 	}()
 
-	result := "--fd=123 -o source=test-share-dir/foo/shared -o cache=none --syslog -o no_posix_lock -d"
+	result := "--fd=123 -o source=test-share-dir/foo/shared -o cache=none -o no_posix_lock -d"
 	args := q.virtiofsdArgs(123)
 	assert.Equal(strings.Join(args, " "), result)
 
 	q.config.Debug = false
-	result = "--fd=123 -o source=test-share-dir/foo/shared -o cache=none --syslog -o no_posix_lock -f"
+	result = "--fd=123 -o source=test-share-dir/foo/shared -o cache=none -o no_posix_lock -f"
 	args = q.virtiofsdArgs(123)
 	assert.Equal(strings.Join(args, " "), result)
 }
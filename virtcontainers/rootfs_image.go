@@ -0,0 +1,498 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kata-containers/agent/protocols/grpc"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/device/manager"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	rootfsImageErofs = "erofs"
+	rootfsImageExt4  = "ext4"
+
+	// rootfsLayersDir is the sandbox directory in the guest where the
+	// layer images are mounted. Layers are shared by all the containers
+	// of the sandbox using them.
+	rootfsLayersDir = "layers"
+
+	// rootfsImageDir is the sandbox directory in the guest where the
+	// container root filesystems are composed from their layers.
+	rootfsImageDir = "rootfs"
+
+	overlayFsType    = "overlay"
+	overlayLowerDir  = "lowerdir="
+	overlayUpperDir  = "upperdir="
+	overlayWorkDir   = "workdir="
+	overlayDirsSep   = ":"
+	rootfsUpperDir   = "upper"
+	rootfsWorkDir    = "work"
+	rootfsTmpSuffix  = ".tmp-"
+	loopDevicePrefix = "/dev/loop"
+
+	// ext4 images are sized from the layer content, plus some room
+	// for the file system metadata.
+	ext4ImageMinSize = 16 << 20
+	ext4InodeSize    = 4096
+
+	// rootfsImageEvictionGrace is the time an image is kept after its
+	// last use, so that it is not evicted between being looked up and
+	// being attached.
+	rootfsImageEvictionGrace = 10 * time.Minute
+)
+
+// buildRootfsLayerImage creates at image a file system of type fsType
+// populated with the content of srcDir.
+var buildRootfsLayerImage = func(fsType, srcDir, image string) error {
+	switch fsType {
+	case rootfsImageErofs:
+		return runRootfsImageCmd("mkfs.erofs", image, srcDir)
+	case rootfsImageExt4:
+		size, err := rootfsLayerSize(srcDir)
+		if err != nil {
+			return err
+		}
+		if err := os.Truncate(image, size+size/2+ext4ImageMinSize); err != nil {
+			return err
+		}
+		return runRootfsImageCmd("mkfs.ext4", "-q", "-F", "-d", srcDir, image)
+	}
+
+	return fmt.Errorf("Unsupported rootfs image file system %q", fsType)
+}
+
+// CheckRootfsImageFsType returns an error if fsType can not be used to
+// build container rootfs layer images.
+func CheckRootfsImageFsType(fsType string) error {
+	switch fsType {
+	case rootfsImageErofs, rootfsImageExt4:
+		return nil
+	}
+
+	return fmt.Errorf("Unsupported rootfs image file system %q, expecting %q or %q", fsType, rootfsImageErofs, rootfsImageExt4)
+}
+
+func runRootfsImageCmd(name string, args ...string) error {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", name, err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// rootfsLayerSize returns an estimate of the space needed to store the
+// content of dir.
+func rootfsLayerSize(dir string) (int64, error) {
+	var size int64
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		size += ext4InodeSize
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
+// overlayLowerDirs returns the lower directories found in the overlay
+// mount options, topmost layer first.
+func overlayLowerDirs(options []string) []string {
+	for _, opt := range options {
+		if strings.HasPrefix(opt, overlayLowerDir) {
+			return strings.Split(strings.TrimPrefix(opt, overlayLowerDir), overlayDirsSep)
+		}
+	}
+
+	return nil
+}
+
+func kataGuestRootfsLayerDir(devID string) string {
+	return filepath.Join(kataGuestSandboxDir(), rootfsLayersDir, devID)
+}
+
+func kataGuestRootfsImageDir(cid string) string {
+	return filepath.Join(kataGuestSandboxDir(), rootfsImageDir, cid)
+}
+
+// rootfsLayerImage returns the path of the image holding layerDir, building
+// it if it is not found in the cache. Snapshots are immutable once
+// committed, so the layer path is enough to identify its content.
+func (s *Sandbox) rootfsLayerImage(layerDir string) (string, error) {
+	fsType := s.config.RootfsImageFsType
+	sum := sha256.Sum256([]byte(filepath.Clean(layerDir)))
+	image := filepath.Join(s.config.RootfsImageCacheDir, hex.EncodeToString(sum[:])+"."+fsType)
+
+	// The modification time of the images records their last use, for
+	// the eviction of the least recently used ones.
+	now := time.Now()
+	if err := os.Chtimes(image, now, now); err == nil {
+		return image, nil
+	}
+
+	if err := os.MkdirAll(s.config.RootfsImageCacheDir, DirMode); err != nil {
+		return "", err
+	}
+
+	// Build into a temporary file so that concurrent sandboxes never
+	// see a partially written image.
+	tmp, err := ioutil.TempFile(s.config.RootfsImageCacheDir, filepath.Base(image)+rootfsTmpSuffix)
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := buildRootfsLayerImage(fsType, layerDir, tmp.Name()); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), image); err != nil {
+		return "", err
+	}
+
+	s.Logger().WithFields(logrus.Fields{
+		"layer": layerDir,
+		"image": image,
+	}).Info("Rootfs layer image built")
+
+	s.pruneRootfsImageCache()
+
+	return image, nil
+}
+
+// pruneRootfsImageCache evicts the least recently used layer images until
+// the cache fits in its maximum size. Images attached to a VM, by any
+// sandbox, are share-locked by their loop device and never evicted.
+func (s *Sandbox) pruneRootfsImageCache() {
+	maxSize := int64(s.config.RootfsImageCacheSize) << utils.MibToBytesShift
+	if maxSize == 0 {
+		return
+	}
+
+	evicted, err := pruneRootfsImageCache(s.config.RootfsImageCacheDir, maxSize, time.Now())
+	if err != nil {
+		s.Logger().WithError(err).Warn("Could not prune rootfs image cache")
+	}
+
+	for _, image := range evicted {
+		s.Logger().WithField("image", image).Info("Rootfs layer image evicted")
+	}
+}
+
+func pruneRootfsImageCache(dir string, maxSize int64, now time.Time) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var images []os.FileInfo
+	var size int64
+	for _, f := range files {
+		if !f.Mode().IsRegular() || strings.Contains(f.Name(), rootfsTmpSuffix) {
+			continue
+		}
+		images = append(images, f)
+		size += f.Size()
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].ModTime().Before(images[j].ModTime())
+	})
+
+	var evicted []string
+	for _, f := range images {
+		if size <= maxSize {
+			break
+		}
+
+		if now.Sub(f.ModTime()) < rootfsImageEvictionGrace {
+			continue
+		}
+
+		path := filepath.Join(dir, f.Name())
+		lock, err := utils.TryLockFile(path)
+		if err != nil {
+			return evicted, err
+		}
+		if lock == nil {
+			// In use by a VM
+			continue
+		}
+
+		err = os.Remove(path)
+		lock.Close()
+		if err != nil {
+			return evicted, err
+		}
+
+		size -= f.Size()
+		evicted = append(evicted, path)
+	}
+
+	return evicted, nil
+}
+
+// rootfsLayerLoopDevice returns the loop device of the sandbox already
+// backed by image, if any.
+func (s *Sandbox) rootfsLayerLoopDevice(image string) string {
+	for _, dev := range s.devManager.GetAllDevices() {
+		hostPath := dev.GetHostPath()
+		if !strings.HasPrefix(hostPath, loopDevicePrefix) {
+			continue
+		}
+
+		if backing, err := utils.LoopDeviceBackingFile(hostPath); err == nil && backing == image {
+			return hostPath
+		}
+	}
+
+	return ""
+}
+
+// attachRootfsLayer hotplugs image as a read-only block device and returns
+// the device ID. Layers shared between containers are attached once. The
+// image is shared with the other sandboxes: the loop device is read-only so
+// that no guest can write to it, and holds the image lock that keeps it
+// from being evicted.
+func (s *Sandbox) attachRootfsLayer(image string) (devID string, err error) {
+	loopPath := s.rootfsLayerLoopDevice(image)
+	if loopPath == "" {
+		if loopPath, err = utils.AttachReadOnlyLoopDevice(image); err != nil {
+			return "", err
+		}
+		defer func() {
+			if err != nil {
+				utils.DetachLoopDevice(loopPath)
+			}
+		}()
+	}
+
+	var stat unix.Stat_t
+	if err = unix.Stat(loopPath, &stat); err != nil {
+		return "", fmt.Errorf("stat %q failed: %v", loopPath, err)
+	}
+
+	// The device manager hands back the device already known for this
+	// major:minor, taking a new reference on it.
+	dev, err := s.AddDevice(config.DeviceInfo{
+		HostPath: loopPath,
+		DevType:  "b",
+		Major:    int64(unix.Major(stat.Rdev)),
+		Minor:    int64(unix.Minor(stat.Rdev)),
+		ReadOnly: true,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return dev.DeviceID(), nil
+}
+
+// detachRootfsLayer releases the container reference on the layer device
+// devID, and the loop device backing it once no container uses it anymore.
+func (s *Sandbox) detachRootfsLayer(devID string) error {
+	dev := s.devManager.GetDeviceByID(devID)
+	if dev == nil {
+		return nil
+	}
+	loopPath := dev.GetHostPath()
+
+	if err := s.devManager.DetachDevice(devID, s); err != nil && err != manager.ErrDeviceNotAttached {
+		return err
+	}
+
+	if err := s.devManager.RemoveDevice(devID); err != nil && err != manager.ErrDeviceNotExist {
+		return err
+	}
+
+	if s.devManager.GetDeviceByID(devID) != nil {
+		return nil
+	}
+
+	if err := utils.DetachLoopDevice(loopPath); err != nil {
+		return err
+	}
+
+	s.pruneRootfsImageCache()
+
+	return nil
+}
+
+func (c *Container) rootfsImageEnabled() bool {
+	if c.sandbox.config.RootfsImageFsType == "" || !c.checkBlockDeviceSupport() {
+		return false
+	}
+
+	return c.checkReadOnlyBlockDeviceSupport()
+}
+
+// rootfsLowerDirs returns the lower directories of the overlay container
+// rootfs, or nil if the rootfs is not an overlay.
+func (c *Container) rootfsLowerDirs() ([]string, error) {
+	if c.rootFs.Type == overlayFsType {
+		return overlayLowerDirs(c.rootFs.Options), nil
+	}
+
+	if !c.rootFs.Mounted {
+		return nil, nil
+	}
+
+	fsType, options, err := utils.GetMountOptions(c.rootFs.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	if fsType != overlayFsType {
+		return nil, nil
+	}
+
+	return overlayLowerDirs(options), nil
+}
+
+// hotplugRootfsLayers attaches the layers of an overlay container rootfs as
+// read-only block devices, so that the agent composes the rootfs in the
+// guest instead of going through the shared file system. The upper layer
+// lives in the guest and is lost with the container.
+// It returns false when the rootfs can not be handled this way.
+func (c *Container) hotplugRootfsLayers() (ok bool, err error) {
+	lowerDirs, err := c.rootfsLowerDirs()
+	if err != nil {
+		return false, err
+	}
+
+	if len(lowerDirs) == 0 {
+		c.Logger().Info("Rootfs is not an overlay, sharing it with the guest")
+		return false, nil
+	}
+
+	defer func() {
+		if err != nil {
+			c.removeRootfsLayers()
+		}
+	}()
+
+	for _, dir := range lowerDirs {
+		image, err := c.sandbox.rootfsLayerImage(dir)
+		if err != nil {
+			return false, err
+		}
+
+		devID, err := c.sandbox.attachRootfsLayer(image)
+		if err != nil {
+			return false, err
+		}
+
+		c.state.RootfsLayerDeviceIDs = append(c.state.RootfsLayerDeviceIDs, devID)
+	}
+
+	c.Logger().WithField("layers", len(lowerDirs)).Info("Rootfs layers attached")
+
+	return true, nil
+}
+
+func (c *Container) removeRootfsLayers() error {
+	for len(c.state.RootfsLayerDeviceIDs) > 0 {
+		devID := c.state.RootfsLayerDeviceIDs[0]
+		if err := c.sandbox.detachRootfsLayer(devID); err != nil {
+			c.Logger().WithError(err).WithField("device-id", devID).Error("Could not remove rootfs layer")
+			return err
+		}
+		c.state.RootfsLayerDeviceIDs = c.state.RootfsLayerDeviceIDs[1:]
+	}
+
+	c.state.RootfsLayerDeviceIDs = nil
+
+	return nil
+}
+
+// buildRootfsLayerStorages describes to the agent how to compose the
+// container rootfs at rootPath: one read-only mount per layer, the writable
+// directories, and the overlay on top of them. The writable directories
+// live on the encrypted scratch disk when the sandbox has one.
+func (k *kataAgent) buildRootfsLayerStorages(sandbox *Sandbox, c *Container, rootPath string) ([]*grpc.Storage, error) {
+	var storages []*grpc.Storage
+	var lowerDirs []string
+
+	for _, devID := range c.state.RootfsLayerDeviceIDs {
+		device := sandbox.devManager.GetDeviceByID(devID)
+		if device == nil {
+			return nil, fmt.Errorf("failed to find rootfs layer device by id %q", devID)
+		}
+
+		blockDrive, ok := device.GetDeviceInfo().(*config.BlockDrive)
+		if !ok || blockDrive == nil {
+			return nil, fmt.Errorf("malformed rootfs layer block drive")
+		}
+
+		storage, err := blockDriveStorage(sandbox.config.HypervisorConfig.BlockDeviceDriver, blockDrive)
+		if err != nil {
+			return nil, err
+		}
+
+		storage.MountPoint = kataGuestRootfsLayerDir(devID)
+		storage.Fstype = sandbox.config.RootfsImageFsType
+		storage.Options = []string{"ro"}
+
+		storages = append(storages, storage)
+		lowerDirs = append(lowerDirs, storage.MountPoint)
+	}
+
+	writableDir := kataGuestRootfsImageDir(c.id)
+	if sandbox.state.ScratchDeviceID != "" {
+		writableDir = filepath.Join(kataGuestScratchDir(), rootfsImageDir, c.id)
+	}
+	upperDir := filepath.Join(writableDir, rootfsUpperDir)
+	workDir := filepath.Join(writableDir, rootfsWorkDir)
+
+	for _, dir := range []string{upperDir, workDir} {
+		storages = append(storages, &grpc.Storage{
+			Driver:     KataLocalDevType,
+			Source:     KataLocalDevType,
+			Fstype:     KataLocalDevType,
+			MountPoint: dir,
+			Options:    localDirOptions,
+		})
+	}
+
+	storages = append(storages, &grpc.Storage{
+		Driver:     kataOverlayDevType,
+		Source:     overlayFsType,
+		Fstype:     overlayFsType,
+		MountPoint: rootPath,
+		Options: []string{
+			overlayLowerDir + strings.Join(lowerDirs, overlayDirsSep),
+			overlayUpperDir + upperDir,
+			overlayWorkDir + workDir,
+		},
+	})
+
+	return storages, nil
+}
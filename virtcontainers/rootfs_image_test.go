@@ -0,0 +1,204 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/device/api"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/device/drivers"
+	"github.com/kata-containers/runtime/virtcontainers/device/manager"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestCheckRootfsImageFsType(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(CheckRootfsImageFsType(rootfsImageErofs))
+	assert.NoError(CheckRootfsImageFsType(rootfsImageExt4))
+	assert.Error(CheckRootfsImageFsType(""))
+	assert.Error(CheckRootfsImageFsType("xfs"))
+}
+
+func TestOverlayLowerDirs(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(overlayLowerDirs(nil))
+	assert.Nil(overlayLowerDirs([]string{"rw", "upperdir=/u"}))
+
+	dirs := overlayLowerDirs([]string{"index=off", "workdir=/w", "upperdir=/u", "lowerdir=/l2:/l1"})
+	assert.Equal([]string{"/l2", "/l1"}, dirs)
+}
+
+func TestRootfsLayerImage(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "rootfs-images")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	builds := 0
+	savedBuild := buildRootfsLayerImage
+	buildRootfsLayerImage = func(fsType, srcDir, image string) error {
+		builds++
+		assert.Equal(rootfsImageErofs, fsType)
+		assert.Equal("/snapshots/1/fs", srcDir)
+		return ioutil.WriteFile(image, []byte(srcDir), 0600)
+	}
+	defer func() {
+		buildRootfsLayerImage = savedBuild
+	}()
+
+	s := &Sandbox{
+		config: &SandboxConfig{
+			RootfsImageFsType:   rootfsImageErofs,
+			RootfsImageCacheDir: filepath.Join(dir, "cache"),
+		},
+	}
+
+	image, err := s.rootfsLayerImage("/snapshots/1/fs")
+	assert.NoError(err)
+	assert.True(strings.HasSuffix(image, "."+rootfsImageErofs))
+	_, err = os.Stat(image)
+	assert.NoError(err)
+
+	// the cached image is reused
+	cached, err := s.rootfsLayerImage("/snapshots/1/fs/")
+	assert.NoError(err)
+	assert.Equal(image, cached)
+	assert.Equal(1, builds)
+
+	// no temporary file is left behind
+	files, err := ioutil.ReadDir(s.config.RootfsImageCacheDir)
+	assert.NoError(err)
+	assert.Len(files, 1)
+}
+
+func TestPruneRootfsImageCache(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "rootfs-images")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	for i, name := range []string{"a.erofs", "b.erofs", "c.erofs", "d.erofs", "e.erofs" + rootfsTmpSuffix + "1"} {
+		path := filepath.Join(dir, name)
+		assert.NoError(ioutil.WriteFile(path, make([]byte, 100), 0600))
+
+		// a is the least recently used, d was just used
+		used := now.Add(-time.Duration(4-i) * time.Hour)
+		if name == "d.erofs" {
+			used = now
+		}
+		assert.NoError(os.Chtimes(path, used, used))
+	}
+
+	// b is attached to a VM
+	b, err := os.Open(filepath.Join(dir, "b.erofs"))
+	assert.NoError(err)
+	defer b.Close()
+	assert.NoError(unix.Flock(int(b.Fd()), unix.LOCK_SH))
+
+	// Nothing to do below the maximum size
+	evicted, err := pruneRootfsImageCache(dir, 400, now)
+	assert.NoError(err)
+	assert.Empty(evicted)
+
+	// The unused images are evicted, least recently used first, but
+	// neither the one in use nor the one used in the grace period.
+	evicted, err = pruneRootfsImageCache(dir, 100, now)
+	assert.NoError(err)
+	assert.Equal([]string{filepath.Join(dir, "a.erofs"), filepath.Join(dir, "c.erofs")}, evicted)
+
+	for _, name := range []string{"b.erofs", "d.erofs", "e.erofs" + rootfsTmpSuffix + "1"} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		assert.NoError(err)
+	}
+
+	evicted, err = pruneRootfsImageCache(filepath.Join(dir, "missing"), 100, now)
+	assert.NoError(err)
+	assert.Empty(evicted)
+}
+
+func TestBuildRootfsLayerStorages(t *testing.T) {
+	assert := assert.New(t)
+	k := &kataAgent{}
+
+	var layers []string
+	var devices []api.Device
+	for i, id := range []string{"layer1", "layer0"} {
+		dev := drivers.NewBlockDevice(&config.DeviceInfo{ID: id})
+		dev.BlockDrive = &config.BlockDrive{
+			VirtPath: "/dev/vd" + string(rune('b'+i)),
+		}
+		devices = append(devices, dev)
+		layers = append(layers, id)
+	}
+
+	sandbox := &Sandbox{
+		devManager: manager.NewDeviceManager(manager.VirtioBlock, false, "", devices),
+		config: &SandboxConfig{
+			RootfsImageFsType: rootfsImageExt4,
+			HypervisorConfig: HypervisorConfig{
+				BlockDeviceDriver: config.VirtioBlock,
+			},
+		},
+	}
+
+	c := &Container{
+		id: "foo",
+		state: types.ContainerState{
+			RootfsLayerDeviceIDs: layers,
+		},
+	}
+
+	rootPath := filepath.Join(kataGuestRootfsImageDir(c.id), rootfsDir)
+	storages, err := k.buildRootfsLayerStorages(sandbox, c, rootPath)
+	assert.NoError(err)
+	assert.Len(storages, 5)
+
+	for i, devID := range layers {
+		assert.Equal(kataBlkDevType, storages[i].Driver)
+		assert.Equal(kataGuestRootfsLayerDir(devID), storages[i].MountPoint)
+		assert.Equal(rootfsImageExt4, storages[i].Fstype)
+		assert.Equal([]string{"ro"}, storages[i].Options)
+	}
+	assert.Equal("/dev/vdb", storages[0].Source)
+
+	upperDir := filepath.Join(kataGuestRootfsImageDir(c.id), rootfsUpperDir)
+	workDir := filepath.Join(kataGuestRootfsImageDir(c.id), rootfsWorkDir)
+	assert.Equal(KataLocalDevType, storages[2].Driver)
+	assert.Equal(upperDir, storages[2].MountPoint)
+	assert.Equal(workDir, storages[3].MountPoint)
+
+	overlay := storages[4]
+	assert.Equal(kataOverlayDevType, overlay.Driver)
+	assert.Equal(rootPath, overlay.MountPoint)
+	assert.Equal([]string{
+		"lowerdir=" + kataGuestRootfsLayerDir(layers[0]) + ":" + kataGuestRootfsLayerDir(layers[1]),
+		"upperdir=" + upperDir,
+		"workdir=" + workDir,
+	}, overlay.Options)
+
+	// with a scratch disk, the writable layer lives on it
+	sandbox.state.ScratchDeviceID = "scratch"
+	storages, err = k.buildRootfsLayerStorages(sandbox, c, rootPath)
+	assert.NoError(err)
+	assert.True(strings.HasPrefix(storages[2].MountPoint, kataGuestScratchDir()))
+
+	c.state.RootfsLayerDeviceIDs = []string{"unknown"}
+	_, err = k.buildRootfsLayerStorages(sandbox, c, rootPath)
+	assert.Error(err)
+}
@@ -13,6 +13,7 @@ import (
 	"math"
 	"net"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -63,6 +64,10 @@ type SandboxStatus struct {
 	Agent            AgentType
 	ContainersStatus []ContainerStatus
 
+	// VMMPids are the pids of the hypervisor processes of a running
+	// sandbox.
+	VMMPids []int
+
 	// Annotations allow clients to store arbitrary values,
 	// for example to add additional status values required
 	// to support particular specifications.
@@ -73,6 +78,27 @@ type SandboxStatus struct {
 type SandboxStats struct {
 	CgroupStats CgroupStats
 	Cpus        int
+
+	// VMMPid is the pid of the hypervisor process of the sandbox.
+	VMMPid int
+}
+
+// SandboxResourceSizing is the part of the VM boot size added for the pod
+// workload, when its resources are known when the sandbox is created.
+type SandboxResourceSizing struct {
+	// WorkloadVCPUs is the number of vCPUs added for the workload.
+	WorkloadVCPUs uint32
+
+	// WorkloadMemMB is the memory added for the workload, in MiB.
+	WorkloadMemMB uint32
+
+	// ExtraVCPUs is the number of vCPUs added on top of what the
+	// containers need, through ResizeVM.
+	ExtraVCPUs uint32
+
+	// ExtraMemMB is the memory added on top of what the containers need,
+	// through ResizeVM, in MiB.
+	ExtraMemMB uint32
 }
 
 // SandboxConfig is a Sandbox configuration.
@@ -123,11 +149,68 @@ type SandboxConfig struct {
 	// SandboxCgroupOnly enables cgroup only at podlevel in the host
 	SandboxCgroupOnly bool
 
+	// EnableVCPUsPinning pins each vCPU thread to its own CPU of the sandbox
+	// cpuset, and the other hypervisor threads to the remaining CPUs.
+	EnableVCPUsPinning bool
+
+	// SandboxResources is the part of the VM boot size sized for the pod
+	// workload, which the containers do not need to hot plug again.
+	SandboxResources SandboxResourceSizing
+
 	// EnableAgentPidNs allows containers to share pid namespace with the agent
 	EnableAgentPidNs bool
 
 	DisableGuestSeccomp bool
 
+	// EncryptedScratchSize is the size in MiB of the per-sandbox scratch
+	// disk that is encrypted by the guest with an ephemeral key and used
+	// for ephemeral and local volumes. A value of 0 disables it.
+	EncryptedScratchSize uint32
+
+	// EncryptedScratchDir is the host directory holding the sparse
+	// backing files of the encrypted scratch disks.
+	EncryptedScratchDir string
+
+	// RootfsImageFsType is the file system ("erofs" or "ext4") of the
+	// images built from the layers of overlay based container root
+	// filesystems. Those images are handed to the guest as read-only
+	// block devices instead of sharing the rootfs. Empty disables it.
+	RootfsImageFsType string
+
+	// RootfsImageCacheDir is the host directory caching the layer images.
+	RootfsImageCacheDir string
+
+	// RootfsImageCacheSize is the size in MiB above which the least
+	// recently used layer images not in use are evicted. 0 disables it.
+	RootfsImageCacheSize uint32
+
+	// DirectBlockVolumes passes read-only volumes that are mounted on the
+	// host from a block device to the guest as read-only block devices,
+	// through a read-only loop device, instead of sharing the mounted
+	// file system.
+	DirectBlockVolumes bool
+
+	// GuestLogMaxSize is the size in MiB above which the guest log of the
+	// sandbox is rotated. The guest console is collected into the log
+	// only if it is not zero.
+	GuestLogMaxSize uint32
+
+	// GuestLogDir is the host directory holding the guest logs. They are
+	// kept after the sandbox is gone.
+	GuestLogDir string
+
+	// HealthPolicy configures how the monitor reacts to failed checks of
+	// the sandbox.
+	HealthPolicy HealthPolicy
+
+	// Diagnostics configures the diagnostics bundles captured when the
+	// sandbox fails.
+	Diagnostics DiagnosticsConfig
+
+	// Overhead configures the recording of the sandbox resource overhead
+	// by the monitor.
+	Overhead OverheadConfig
+
 	// Experimental features enabled
 	Experimental []exp.Feature
 
@@ -209,6 +292,18 @@ type Sandbox struct {
 
 	annotationsLock *sync.RWMutex
 
+	// virtiofsVolumesLock protects state.VirtiofsVolumes and
+	// virtiofsVolumeDaemons, which the monitor checks concurrently.
+	virtiofsVolumesLock sync.Mutex
+
+	// virtiofsVolumeDaemons are the daemons dedicated to volumes, by
+	// socket path.
+	virtiofsVolumeDaemons map[string]*virtiofsd
+
+	// containersLock protects the containers map, which the monitor
+	// reads concurrently. Only its updates need to take it.
+	containersLock sync.RWMutex
+
 	wg *sync.WaitGroup
 
 	shmSize           uint64
@@ -339,27 +434,67 @@ func (s *Sandbox) Status() SandboxStatus {
 		HypervisorConfig: s.config.HypervisorConfig,
 		Agent:            s.config.AgentType,
 		ContainersStatus: contStatusList,
+		VMMPids:          s.vmmPids(),
 		Annotations:      s.config.Annotations,
 	}
 }
 
+// vmmPids returns the pids of the hypervisor processes of the sandbox if it
+// is running.
+func (s *Sandbox) vmmPids() []int {
+	if s.state.State != types.StateRunning && s.state.State != types.StatePaused {
+		return nil
+	}
+
+	var pids []int
+	for _, pid := range s.hypervisor.getPids() {
+		if pid > 0 {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
+
 // Monitor returns a error channel for watcher to watch at
 func (s *Sandbox) Monitor() (chan error, error) {
+	m, err := s.runningMonitor()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.newWatcher()
+}
+
+// HealthEvents returns a channel publishing the decisions taken by the
+// monitor of a running sandbox on its checks. It is closed when the
+// monitor stops.
+func (s *Sandbox) HealthEvents() (chan HealthEvent, error) {
+	m, err := s.runningMonitor()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.newEventWatcher()
+}
+
+func (s *Sandbox) runningMonitor() (*monitor, error) {
 	if s.state.State != types.StateRunning {
 		return nil, fmt.Errorf("Sandbox is not running")
 	}
 
 	s.Lock()
+	defer s.Unlock()
+
 	if s.monitor == nil {
 		s.monitor = newMonitor(s)
 	}
-	s.Unlock()
 
-	return s.monitor.newWatcher()
+	return s.monitor, nil
 }
 
 // WaitProcess waits on a container process and return its exit code
-func (s *Sandbox) WaitProcess(containerID, processID string) (int32, error) {
+func (s *Sandbox) WaitProcess(ctx context.Context, containerID, processID string) (int32, error) {
 	if s.state.State != types.StateRunning {
 		return 0, fmt.Errorf("Sandbox not running")
 	}
@@ -369,12 +504,12 @@ func (s *Sandbox) WaitProcess(containerID, processID string) (int32, error) {
 		return 0, err
 	}
 
-	return c.wait(processID)
+	return c.wait(ctx, processID)
 }
 
 // SignalProcess sends a signal to a process of a container when all is false.
 // When all is true, it sends the signal to all processes of a container.
-func (s *Sandbox) SignalProcess(containerID, processID string, signal syscall.Signal, all bool) error {
+func (s *Sandbox) SignalProcess(ctx context.Context, containerID, processID string, signal syscall.Signal, all bool) error {
 	if s.state.State != types.StateRunning {
 		return fmt.Errorf("Sandbox not running")
 	}
@@ -384,11 +519,11 @@ func (s *Sandbox) SignalProcess(containerID, processID string, signal syscall.Si
 		return err
 	}
 
-	return c.signalProcess(processID, signal, all)
+	return c.signalProcess(ctx, processID, signal, all)
 }
 
 // WinsizeProcess resizes the tty window of a process
-func (s *Sandbox) WinsizeProcess(containerID, processID string, height, width uint32) error {
+func (s *Sandbox) WinsizeProcess(ctx context.Context, containerID, processID string, height, width uint32) error {
 	if s.state.State != types.StateRunning {
 		return fmt.Errorf("Sandbox not running")
 	}
@@ -398,7 +533,7 @@ func (s *Sandbox) WinsizeProcess(containerID, processID string, height, width ui
 		return err
 	}
 
-	return c.winsizeProcess(processID, height, width)
+	return c.winsizeProcess(ctx, processID, height, width)
 }
 
 // IOStream returns stdin writer, stdout reader and stderr reader of a process
@@ -447,8 +582,8 @@ func createAssets(ctx context.Context, sandboxConfig *SandboxConfig) error {
 	return nil
 }
 
-func (s *Sandbox) getAndStoreGuestDetails() error {
-	guestDetailRes, err := s.agent.getGuestDetails(&grpc.GuestDetailsRequest{
+func (s *Sandbox) getAndStoreGuestDetails(ctx context.Context) error {
+	guestDetailRes, err := s.agent.getGuestDetails(ctx, &grpc.GuestDetailsRequest{
 		MemBlockSize:    true,
 		MemHotplugProbe: true,
 	})
@@ -498,7 +633,7 @@ func createSandbox(ctx context.Context, sandboxConfig SandboxConfig, factory Fac
 	}
 
 	// Below code path is called only during create, because of earlier check.
-	if err := s.agent.createSandbox(s); err != nil {
+	if err := s.agent.createSandbox(ctx, s); err != nil {
 		return nil, err
 	}
 
@@ -564,6 +699,12 @@ func newSandbox(ctx context.Context, sandboxConfig SandboxConfig, factory Factor
 		sandboxConfig.HypervisorConfig.SELinuxProcessLabel = spec.Process.SelinuxLabel
 	}
 
+	if sandboxConfig.HypervisorConfig.EnableNUMA {
+		if sandboxConfig.HypervisorConfig.SandboxCPUSet, err = s.getSandboxCPUSet(); err != nil {
+			return nil, err
+		}
+	}
+
 	if useOldStore(ctx) {
 		vcStore, err := store.NewVCSandboxStore(ctx, s.id)
 		if err != nil {
@@ -800,14 +941,16 @@ func (s *Sandbox) removeContainer(containerID string) error {
 			containerID, s.id)
 	}
 
+	s.containersLock.Lock()
 	delete(s.containers, containerID)
+	s.containersLock.Unlock()
 
 	return nil
 }
 
 // Delete deletes an already created sandbox.
 // The VM in which the sandbox is running will be shut down.
-func (s *Sandbox) Delete() error {
+func (s *Sandbox) Delete(ctx context.Context) error {
 	if s.state.State != types.StateReady &&
 		s.state.State != types.StatePaused &&
 		s.state.State != types.StateStopped {
@@ -838,6 +981,12 @@ func (s *Sandbox) Delete() error {
 
 	s.agent.cleanup(s)
 
+	if err := s.removeScratchStorage(); err != nil {
+		s.Logger().WithError(err).Error("failed to remove encrypted scratch storage")
+	}
+
+	s.stopVirtiofsVolumes()
+
 	return s.newStore.Destroy(s.id)
 }
 
@@ -958,7 +1107,7 @@ func (s *Sandbox) generateNetInfo(inf *vcTypes.Interface) (NetworkInfo, error) {
 }
 
 // AddInterface adds new nic to the sandbox.
-func (s *Sandbox) AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+func (s *Sandbox) AddInterface(ctx context.Context, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
 	netInfo, err := s.generateNetInfo(inf)
 	if err != nil {
 		return nil, err
@@ -985,11 +1134,11 @@ func (s *Sandbox) AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, erro
 
 	// Add network for vm
 	inf.PciAddr = endpoint.PciAddr()
-	return s.agent.updateInterface(inf)
+	return s.agent.updateInterface(ctx, inf)
 }
 
 // RemoveInterface removes a nic of the sandbox.
-func (s *Sandbox) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+func (s *Sandbox) RemoveInterface(ctx context.Context, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
 	for i, endpoint := range s.networkNS.Endpoints {
 		if endpoint.HardwareAddr() == inf.HwAddr {
 			s.Logger().WithField("endpoint-type", endpoint.Type()).Info("Hot detaching endpoint")
@@ -1009,22 +1158,22 @@ func (s *Sandbox) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, e
 }
 
 // ListInterfaces lists all nics and their configurations in the sandbox.
-func (s *Sandbox) ListInterfaces() ([]*vcTypes.Interface, error) {
-	return s.agent.listInterfaces()
+func (s *Sandbox) ListInterfaces(ctx context.Context) ([]*vcTypes.Interface, error) {
+	return s.agent.listInterfaces(ctx)
 }
 
 // UpdateRoutes updates the sandbox route table (e.g. for portmapping support).
-func (s *Sandbox) UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
-	return s.agent.updateRoutes(routes)
+func (s *Sandbox) UpdateRoutes(ctx context.Context, routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+	return s.agent.updateRoutes(ctx, routes)
 }
 
 // ListRoutes lists all routes and their configurations in the sandbox.
-func (s *Sandbox) ListRoutes() ([]*vcTypes.Route, error) {
-	return s.agent.listRoutes()
+func (s *Sandbox) ListRoutes(ctx context.Context) ([]*vcTypes.Route, error) {
+	return s.agent.listRoutes(ctx)
 }
 
 // startVM starts the VM.
-func (s *Sandbox) startVM() (err error) {
+func (s *Sandbox) startVM(ctx context.Context) (err error) {
 	span, ctx := s.trace("startVM")
 	defer span.Finish()
 
@@ -1055,6 +1204,12 @@ func (s *Sandbox) startVM() (err error) {
 	defer func() {
 		if err != nil {
 			s.hypervisor.stopSandbox()
+
+			// Delete is never reached when the sandbox creation
+			// fails, release the host side of the scratch disk.
+			if err := s.removeScratchStorage(); err != nil {
+				s.Logger().WithError(err).Warn("Could not remove scratch storage")
+			}
 		}
 	}()
 
@@ -1077,11 +1232,15 @@ func (s *Sandbox) startVM() (err error) {
 
 	s.Logger().Info("VM started")
 
+	if err := s.setupScratchStorage(); err != nil {
+		return err
+	}
+
 	// Once the hypervisor is done starting the sandbox,
 	// we want to guarantee that it is manageable.
 	// For that we need to ask the agent to start the
 	// sandbox inside the VM.
-	if err := s.agent.startSandbox(s); err != nil {
+	if err := s.agent.startSandbox(ctx, s); err != nil {
 		return err
 	}
 
@@ -1091,12 +1250,12 @@ func (s *Sandbox) startVM() (err error) {
 }
 
 // stopVM: stop the sandbox's VM
-func (s *Sandbox) stopVM() error {
+func (s *Sandbox) stopVM(ctx context.Context) error {
 	span, _ := s.trace("stopVM")
 	defer span.Finish()
 
 	s.Logger().Info("Stopping sandbox in the VM")
-	if err := s.agent.stopSandbox(s); err != nil {
+	if err := s.agent.stopSandbox(ctx, s); err != nil {
 		s.Logger().WithError(err).WithField("sandboxid", s.id).Warning("Agent did not stop sandbox")
 	}
 
@@ -1107,14 +1266,22 @@ func (s *Sandbox) stopVM() error {
 	}
 
 	s.Logger().Info("Stopping VM")
-	return s.hypervisor.stopSandbox()
+	if err := s.hypervisor.stopSandbox(); err != nil {
+		return err
+	}
+
+	s.stopVirtiofsVolumes()
+
+	return nil
 }
 
 func (s *Sandbox) addContainer(c *Container) error {
 	if _, ok := s.containers[c.id]; ok {
 		return fmt.Errorf("Duplicated container: %s", c.id)
 	}
+	s.containersLock.Lock()
 	s.containers[c.id] = c
+	s.containersLock.Unlock()
 
 	return nil
 }
@@ -1149,7 +1316,7 @@ func (s *Sandbox) fetchContainers() error {
 // CreateContainer creates a new container in the sandbox
 // This should be called only when the sandbox is already created.
 // It will add new container config to sandbox.config.Containers
-func (s *Sandbox) CreateContainer(contConfig ContainerConfig) (VCContainer, error) {
+func (s *Sandbox) CreateContainer(ctx context.Context, contConfig ContainerConfig) (VCContainer, error) {
 	// Create the container.
 	c, err := newContainer(s, &contConfig)
 	if err != nil {
@@ -1168,7 +1335,7 @@ func (s *Sandbox) CreateContainer(contConfig ContainerConfig) (VCContainer, erro
 		}
 	}()
 
-	err = c.create()
+	err = c.create(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1185,7 +1352,7 @@ func (s *Sandbox) CreateContainer(contConfig ContainerConfig) (VCContainer, erro
 
 			logger.Warning("Cleaning up partially created container")
 
-			if err2 := c.stop(true); err2 != nil {
+			if err2 := c.stop(ctx, true); err2 != nil {
 				logger.WithError(err2).Warning("Could not delete container")
 			}
 
@@ -1198,7 +1365,7 @@ func (s *Sandbox) CreateContainer(contConfig ContainerConfig) (VCContainer, erro
 	// Sandbox is responsible to update VM resources needed by Containers
 	// Update resources after having added containers to the sandbox, since
 	// container status is requiered to know if more resources should be added.
-	err = s.updateResources()
+	err = s.updateResources(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1215,7 +1382,7 @@ func (s *Sandbox) CreateContainer(contConfig ContainerConfig) (VCContainer, erro
 }
 
 // StartContainer starts a container in the sandbox
-func (s *Sandbox) StartContainer(containerID string) (VCContainer, error) {
+func (s *Sandbox) StartContainer(ctx context.Context, containerID string) (VCContainer, error) {
 	// Fetch the container.
 	c, err := s.findContainer(containerID)
 	if err != nil {
@@ -1223,7 +1390,7 @@ func (s *Sandbox) StartContainer(containerID string) (VCContainer, error) {
 	}
 
 	// Start it.
-	err = c.start()
+	err = c.start(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1236,7 +1403,7 @@ func (s *Sandbox) StartContainer(containerID string) (VCContainer, error) {
 
 	// Update sandbox resources in case a stopped container
 	// is started
-	err = s.updateResources()
+	err = s.updateResources(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -1245,7 +1412,7 @@ func (s *Sandbox) StartContainer(containerID string) (VCContainer, error) {
 }
 
 // StopContainer stops a container in the sandbox
-func (s *Sandbox) StopContainer(containerID string, force bool) (VCContainer, error) {
+func (s *Sandbox) StopContainer(ctx context.Context, containerID string, force bool) (VCContainer, error) {
 	// Fetch the container.
 	c, err := s.findContainer(containerID)
 	if err != nil {
@@ -1253,7 +1420,7 @@ func (s *Sandbox) StopContainer(containerID string, force bool) (VCContainer, er
 	}
 
 	// Stop it.
-	if err := c.stop(force); err != nil {
+	if err := c.stop(ctx, force); err != nil {
 		return nil, err
 	}
 
@@ -1264,7 +1431,7 @@ func (s *Sandbox) StopContainer(containerID string, force bool) (VCContainer, er
 }
 
 // KillContainer signals a container in the sandbox
-func (s *Sandbox) KillContainer(containerID string, signal syscall.Signal, all bool) error {
+func (s *Sandbox) KillContainer(ctx context.Context, containerID string, signal syscall.Signal, all bool) error {
 	// Fetch the container.
 	c, err := s.findContainer(containerID)
 	if err != nil {
@@ -1272,7 +1439,7 @@ func (s *Sandbox) KillContainer(containerID string, signal syscall.Signal, all b
 	}
 
 	// Send a signal to the process.
-	err = c.kill(signal, all)
+	err = c.kill(ctx, signal, all)
 
 	// SIGKILL should never fail otherwise it is
 	// impossible to clean things up.
@@ -1284,7 +1451,7 @@ func (s *Sandbox) KillContainer(containerID string, signal syscall.Signal, all b
 }
 
 // DeleteContainer deletes a container from the sandbox
-func (s *Sandbox) DeleteContainer(containerID string) (VCContainer, error) {
+func (s *Sandbox) DeleteContainer(ctx context.Context, containerID string) (VCContainer, error) {
 	if containerID == "" {
 		return nil, vcTypes.ErrNeedContainerID
 	}
@@ -1322,7 +1489,7 @@ func (s *Sandbox) DeleteContainer(containerID string) (VCContainer, error) {
 
 // ProcessListContainer lists every process running inside a specific
 // container in the sandbox.
-func (s *Sandbox) ProcessListContainer(containerID string, options ProcessListOptions) (ProcessList, error) {
+func (s *Sandbox) ProcessListContainer(ctx context.Context, containerID string, options ProcessListOptions) (ProcessList, error) {
 	// Fetch the container.
 	c, err := s.findContainer(containerID)
 	if err != nil {
@@ -1330,7 +1497,19 @@ func (s *Sandbox) ProcessListContainer(containerID string, options ProcessListOp
 	}
 
 	// Get the process list related to the container.
-	return c.processList(options)
+	return c.processList(ctx, options)
+}
+
+// ProcessGuestPid returns the pid of a process of a container in the guest,
+// as reported by the agent. ErrGuestPidUnsupported is returned by agents
+// that do not report it.
+func (s *Sandbox) ProcessGuestPid(ctx context.Context, containerID, processID string) (uint32, error) {
+	c, err := s.findContainer(containerID)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.agent.processGuestPid(ctx, c, processID)
 }
 
 // StatusContainer gets the status of a container
@@ -1361,7 +1540,7 @@ func (s *Sandbox) StatusContainer(containerID string) (ContainerStatus, error) {
 
 // EnterContainer is the virtcontainers container command execution entry point.
 // EnterContainer enters an already running container and runs a given command.
-func (s *Sandbox) EnterContainer(containerID string, cmd types.Cmd) (VCContainer, *Process, error) {
+func (s *Sandbox) EnterContainer(ctx context.Context, containerID string, cmd types.Cmd) (VCContainer, *Process, error) {
 	// Fetch the container.
 	c, err := s.findContainer(containerID)
 	if err != nil {
@@ -1369,7 +1548,7 @@ func (s *Sandbox) EnterContainer(containerID string, cmd types.Cmd) (VCContainer
 	}
 
 	// Enter it.
-	process, err := c.enter(cmd)
+	process, err := c.enter(ctx, cmd)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -1378,14 +1557,14 @@ func (s *Sandbox) EnterContainer(containerID string, cmd types.Cmd) (VCContainer
 }
 
 // UpdateContainer update a running container.
-func (s *Sandbox) UpdateContainer(containerID string, resources specs.LinuxResources) error {
+func (s *Sandbox) UpdateContainer(ctx context.Context, containerID string, resources specs.LinuxResources) error {
 	// Fetch the container.
 	c, err := s.findContainer(containerID)
 	if err != nil {
 		return err
 	}
 
-	err = c.update(resources)
+	err = c.update(ctx, resources)
 	if err != nil {
 		return err
 	}
@@ -1400,15 +1579,40 @@ func (s *Sandbox) UpdateContainer(containerID string, resources specs.LinuxResou
 	return nil
 }
 
+// ResizeVM resizes the VM to extraVCPUs vCPUs and extraMemMB MiB on top of
+// what the containers need. The VM keeps this extra size when the
+// containers are updated. Memory is never hot unplugged, lowering
+// extraMemMB only keeps the containers from growing the VM further.
+func (s *Sandbox) ResizeVM(ctx context.Context, extraVCPUs, extraMemMB uint32) error {
+	if s.state.State != types.StateRunning {
+		return fmt.Errorf("Sandbox not running")
+	}
+
+	previous := s.config.SandboxResources
+	s.config.SandboxResources.ExtraVCPUs = extraVCPUs
+	s.config.SandboxResources.ExtraMemMB = extraMemMB
+
+	if err := s.updateResources(ctx); err != nil {
+		s.config.SandboxResources = previous
+		return err
+	}
+
+	if err := s.cgroupsUpdate(); err != nil {
+		return err
+	}
+
+	return s.storeSandbox()
+}
+
 // StatsContainer return the stats of a running container
-func (s *Sandbox) StatsContainer(containerID string) (ContainerStats, error) {
+func (s *Sandbox) StatsContainer(ctx context.Context, containerID string) (ContainerStats, error) {
 	// Fetch the container.
 	c, err := s.findContainer(containerID)
 	if err != nil {
 		return ContainerStats{}, err
 	}
 
-	stats, err := c.stats()
+	stats, err := c.stats(ctx)
 	if err != nil {
 		return ContainerStats{}, err
 	}
@@ -1417,8 +1621,30 @@ func (s *Sandbox) StatsContainer(containerID string) (ContainerStats, error) {
 
 // Stats returns the stats of a running sandbox
 func (s *Sandbox) Stats() (SandboxStats, error) {
+	cgroupStats, err := s.cgroupStats()
+	if err != nil {
+		return SandboxStats{}, err
+	}
+
+	stats := SandboxStats{
+		CgroupStats: cgroupStats,
+	}
+
+	stats.VMMPid = getHypervisorPid(s.hypervisor)
+	tids, err := s.hypervisor.getThreadIDs()
+	if err != nil {
+		return stats, err
+	}
+	stats.Cpus = len(tids.vcpus)
+
+	return stats, nil
+}
+
+// cgroupStats returns the CPU and memory usage of the sandbox cgroup. Unlike
+// Stats, it does not query the hypervisor.
+func (s *Sandbox) cgroupStats() (CgroupStats, error) {
 	if s.state.CgroupPath == "" {
-		return SandboxStats{}, fmt.Errorf("sandbox cgroup path is empty")
+		return CgroupStats{}, fmt.Errorf("sandbox cgroup path is empty")
 	}
 
 	var path string
@@ -1434,29 +1660,23 @@ func (s *Sandbox) Stats() (SandboxStats, error) {
 
 	cgroup, err := cgroupsLoadFunc(cgroupSubsystems, cgroups.StaticPath(path))
 	if err != nil {
-		return SandboxStats{}, fmt.Errorf("Could not load sandbox cgroup in %v: %v", s.state.CgroupPath, err)
+		return CgroupStats{}, fmt.Errorf("Could not load sandbox cgroup in %v: %v", s.state.CgroupPath, err)
 	}
 
 	metrics, err := cgroup.Stat(cgroups.ErrorHandler(cgroups.IgnoreNotExist))
 	if err != nil {
-		return SandboxStats{}, err
+		return CgroupStats{}, err
 	}
 
-	stats := SandboxStats{}
-
-	stats.CgroupStats.CPUStats.CPUUsage.TotalUsage = metrics.CPU.Usage.Total
-	stats.CgroupStats.MemoryStats.Usage.Usage = metrics.Memory.Usage.Usage
-	tids, err := s.hypervisor.getThreadIDs()
-	if err != nil {
-		return stats, err
-	}
-	stats.Cpus = len(tids.vcpus)
+	var stats CgroupStats
+	stats.CPUStats.CPUUsage.TotalUsage = metrics.CPU.Usage.Total
+	stats.MemoryStats.Usage.Usage = metrics.Memory.Usage.Usage
 
 	return stats, nil
 }
 
 // PauseContainer pauses a running container.
-func (s *Sandbox) PauseContainer(containerID string) error {
+func (s *Sandbox) PauseContainer(ctx context.Context, containerID string) error {
 	// Fetch the container.
 	c, err := s.findContainer(containerID)
 	if err != nil {
@@ -1464,7 +1684,7 @@ func (s *Sandbox) PauseContainer(containerID string) error {
 	}
 
 	// Pause the container.
-	if err := c.pause(); err != nil {
+	if err := c.pause(ctx); err != nil {
 		return err
 	}
 
@@ -1475,7 +1695,7 @@ func (s *Sandbox) PauseContainer(containerID string) error {
 }
 
 // ResumeContainer resumes a paused container.
-func (s *Sandbox) ResumeContainer(containerID string) error {
+func (s *Sandbox) ResumeContainer(ctx context.Context, containerID string) error {
 	// Fetch the container.
 	c, err := s.findContainer(containerID)
 	if err != nil {
@@ -1483,7 +1703,7 @@ func (s *Sandbox) ResumeContainer(containerID string) error {
 	}
 
 	// Resume the container.
-	if err := c.resume(); err != nil {
+	if err := c.resume(ctx); err != nil {
 		return err
 	}
 
@@ -1495,7 +1715,7 @@ func (s *Sandbox) ResumeContainer(containerID string) error {
 
 // createContainers registers all containers to the proxy, create the
 // containers in the guest and starts one shim per container.
-func (s *Sandbox) createContainers() error {
+func (s *Sandbox) createContainers(ctx context.Context) error {
 	span, _ := s.trace("createContainers")
 	defer span.Finish()
 
@@ -1505,7 +1725,7 @@ func (s *Sandbox) createContainers() error {
 		if err != nil {
 			return err
 		}
-		if err := c.create(); err != nil {
+		if err := c.create(ctx); err != nil {
 			return err
 		}
 
@@ -1516,7 +1736,7 @@ func (s *Sandbox) createContainers() error {
 
 	// Update resources after having added containers to the sandbox, since
 	// container status is requiered to know if more resources should be added.
-	if err := s.updateResources(); err != nil {
+	if err := s.updateResources(ctx); err != nil {
 		return err
 	}
 
@@ -1532,7 +1752,7 @@ func (s *Sandbox) createContainers() error {
 
 // Start starts a sandbox. The containers that are making the sandbox
 // will be started.
-func (s *Sandbox) Start() error {
+func (s *Sandbox) Start(ctx context.Context) error {
 	if err := s.state.ValidTransition(s.state.State, types.StateRunning); err != nil {
 		return err
 	}
@@ -1550,7 +1770,7 @@ func (s *Sandbox) Start() error {
 		}
 	}()
 	for _, c := range s.containers {
-		if startErr = c.start(); startErr != nil {
+		if startErr = c.start(ctx); startErr != nil {
 			return startErr
 		}
 	}
@@ -1567,7 +1787,7 @@ func (s *Sandbox) Start() error {
 // Stop stops a sandbox. The containers that are making the sandbox
 // will be destroyed.
 // When force is true, ignore guest related stop failures.
-func (s *Sandbox) Stop(force bool) error {
+func (s *Sandbox) Stop(ctx context.Context, force bool) error {
 	span, _ := s.trace("stop")
 	defer span.Finish()
 
@@ -1581,12 +1801,12 @@ func (s *Sandbox) Stop(force bool) error {
 	}
 
 	for _, c := range s.containers {
-		if err := c.stop(force); err != nil {
+		if err := c.stop(ctx, force); err != nil {
 			return err
 		}
 	}
 
-	if err := s.stopVM(); err != nil && !force {
+	if err := s.stopVM(ctx); err != nil && !force {
 		return err
 	}
 
@@ -1849,7 +2069,7 @@ func (s *Sandbox) AddDevice(info config.DeviceInfo) (api.Device, error) {
 // on the sum of container requests, plus default CPUs for the VM. Similar is done for memory.
 // If changes in memory or CPU are made, the VM will be updated and the agent will online the
 // applicable CPU and memory.
-func (s *Sandbox) updateResources() error {
+func (s *Sandbox) updateResources(ctx context.Context) error {
 	if s == nil {
 		return errors.New("sandbox is nil")
 	}
@@ -1861,10 +2081,12 @@ func (s *Sandbox) updateResources() error {
 	sandboxVCPUs := s.calculateSandboxCPUs()
 	// Add default vcpus for sandbox
 	sandboxVCPUs += s.hypervisor.hypervisorConfig().NumVCPUs
+	sandboxVCPUs += s.config.SandboxResources.ExtraVCPUs
 
 	sandboxMemoryByte := s.calculateSandboxMemory()
 	// Add default / rsvd memory for sandbox.
 	sandboxMemoryByte += int64(s.hypervisor.hypervisorConfig().MemorySize) << utils.MibToBytesShift
+	sandboxMemoryByte += int64(s.config.SandboxResources.ExtraMemMB) << utils.MibToBytesShift
 
 	// Update VCPUs
 	s.Logger().WithField("cpus-sandbox", sandboxVCPUs).Debugf("Request to hypervisor to update vCPUs")
@@ -1876,7 +2098,7 @@ func (s *Sandbox) updateResources() error {
 	// If the CPUs were increased, ask agent to online them
 	if oldCPUs < newCPUs {
 		vcpusAdded := newCPUs - oldCPUs
-		if err := s.agent.onlineCPUMem(vcpusAdded, true); err != nil {
+		if err := s.agent.onlineCPUMem(ctx, vcpusAdded, true); err != nil {
 			return err
 		}
 	}
@@ -1892,16 +2114,19 @@ func (s *Sandbox) updateResources() error {
 	if s.state.GuestMemoryHotplugProbe && updatedMemoryDevice.addr != 0 {
 		// notify the guest kernel about memory hot-add event, before onlining them
 		s.Logger().Debugf("notify guest kernel memory hot-add event via probe interface, memory device located at 0x%x", updatedMemoryDevice.addr)
-		if err := s.agent.memHotplugByProbe(updatedMemoryDevice.addr, uint32(updatedMemoryDevice.sizeMB), s.state.GuestMemoryBlockSizeMB); err != nil {
+		if err := s.agent.memHotplugByProbe(ctx, updatedMemoryDevice.addr, uint32(updatedMemoryDevice.sizeMB), s.state.GuestMemoryBlockSizeMB); err != nil {
 			return err
 		}
 	}
-	if err := s.agent.onlineCPUMem(0, false); err != nil {
+	if err := s.agent.onlineCPUMem(ctx, 0, false); err != nil {
 		return err
 	}
 	return nil
 }
 
+// calculateSandboxMemory returns the memory the containers need on top of the
+// VM boot size, in bytes. The part of the boot size sized for the pod
+// workload covers the containers first.
 func (s *Sandbox) calculateSandboxMemory() int64 {
 	memorySandbox := int64(0)
 	for _, c := range s.config.Containers {
@@ -1915,9 +2140,17 @@ func (s *Sandbox) calculateSandboxMemory() int64 {
 			memorySandbox += *m.Limit
 		}
 	}
+
+	memorySandbox -= int64(s.config.SandboxResources.WorkloadMemMB) << utils.MibToBytesShift
+	if memorySandbox < 0 {
+		return 0
+	}
 	return memorySandbox
 }
 
+// calculateSandboxCPUs returns the vCPUs the containers need on top of the VM
+// boot size. The part of the boot size sized for the pod workload covers the
+// containers first.
 func (s *Sandbox) calculateSandboxCPUs() uint32 {
 	mCPU := uint32(0)
 
@@ -1935,7 +2168,12 @@ func (s *Sandbox) calculateSandboxCPUs() uint32 {
 
 		}
 	}
-	return utils.CalculateVCpusFromMilliCpus(mCPU)
+
+	vcpus := utils.CalculateVCpusFromMilliCpus(mCPU)
+	if vcpus < s.config.SandboxResources.WorkloadVCPUs {
+		return 0
+	}
+	return vcpus - s.config.SandboxResources.WorkloadVCPUs
 }
 
 // GetHypervisorType is used for getting Hypervisor name currently used.
@@ -1948,7 +2186,16 @@ func (s *Sandbox) GetHypervisorType() string {
 //  1) get the v1constraints cgroup associated with the stored cgroup path
 //  2) (re-)add hypervisor vCPU threads to the appropriate cgroup
 //  3) If we are managing sandbox cgroup, update the v1constraints cgroup size
+//  4) (re-)pin hypervisor vCPU threads, moving them to a cpuset resets their affinity
 func (s *Sandbox) cgroupsUpdate() error {
+	if err := s.cgroupsUpdateConstraints(); err != nil {
+		return err
+	}
+
+	return s.pinVCPUs()
+}
+
+func (s *Sandbox) cgroupsUpdateConstraints() error {
 
 	// If Kata is configured for SandboxCgroupOnly, the VMM and its processes are already
 	// in the Kata sandbox cgroup (inherited). Check to see if sandbox cpuset needs to be
@@ -2065,6 +2312,9 @@ func (s *Sandbox) constrainHypervisor(cgroup cgroups.Cgroup) error {
 		return fmt.Errorf("Invalid hypervisor PID: %+v", pids)
 	}
 
+	// Daemons dedicated to volumes are accounted as VMM overhead too.
+	pids = append(pids, s.virtiofsVolumePids()...)
+
 	// VMM threads are only placed into the constrained cgroup if SandboxCgroupOnly is being set.
 	// This is the "correct" behavior, but if the parent cgroup isn't set up correctly to take
 	// Kata/VMM into account, Kata may fail to boot due to being overconstrained.
@@ -2119,6 +2369,147 @@ func (s *Sandbox) constrainHypervisor(cgroup cgroups.Cgroup) error {
 	return nil
 }
 
+var setCPUAffinityFunc = utils.SetCPUAffinity
+var getThreadsFunc = utils.GetThreads
+
+// pinVCPUs pins the hypervisor vCPU threads. With EnableVCPUsPinning, each
+// vCPU gets its own CPU of the sandbox cpuset. Otherwise, the vCPUs placed on
+// a host NUMA node by the hypervisor are pinned to the CPUs of that node.
+func (s *Sandbox) pinVCPUs() error {
+	if !s.config.EnableVCPUsPinning && !s.config.HypervisorConfig.EnableNUMA {
+		return nil
+	}
+
+	tids, err := s.hypervisor.getThreadIDs()
+	if err != nil {
+		return fmt.Errorf("failed to get thread ids from hypervisor: %v", err)
+	}
+
+	if s.config.EnableVCPUsPinning {
+		pinned, err := s.pinVCPUsExclusively(tids)
+		if err != nil || pinned {
+			return err
+		}
+	}
+
+	for vcpu, cpus := range tids.affinity {
+		tid, ok := tids.vcpus[vcpu]
+		if !ok {
+			continue
+		}
+
+		if err := setCPUAffinityFunc(tid, cpus); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pinVCPUsExclusively pins each vCPU thread to its own CPU of the sandbox
+// cpuset, on the vCPU NUMA node when possible, and the other hypervisor
+// threads off those CPUs but within the cpuset. It returns false when the
+// sandbox cpuset is empty or smaller than the number of vCPUs, leaving the
+// threads untouched.
+func (s *Sandbox) pinVCPUsExclusively(tids vcpuThreadIDs) (bool, error) {
+	sandboxCPUSet, err := s.getSandboxCPUSet()
+	if err != nil {
+		return false, err
+	}
+
+	available, err := cpuset.Parse(sandboxCPUSet)
+	if err != nil {
+		return false, err
+	}
+
+	if available.IsEmpty() || len(tids.vcpus) == 0 {
+		return false, nil
+	}
+
+	// The sandbox asked for exclusive CPUs it cannot get, which defeats
+	// its latency guarantees.
+	if len(tids.vcpus) > available.Size() {
+		s.Logger().WithFields(logrus.Fields{
+			"vcpus":  len(tids.vcpus),
+			"cpuset": sandboxCPUSet,
+		}).Error("vCPUs outnumber the CPUs of the sandbox cpuset, vCPUs are NOT pinned to exclusive CPUs")
+		return false, nil
+	}
+
+	var vcpus []int
+	for vcpu := range tids.vcpus {
+		vcpus = append(vcpus, vcpu)
+	}
+	sort.Ints(vcpus)
+
+	vcpuTids := make(map[int]bool, len(vcpus))
+	vcpuCPUs := cpuset.NewCPUSet()
+	for _, vcpu := range vcpus {
+		candidates := available
+		if cpus, ok := tids.affinity[vcpu]; ok && !available.Intersection(cpus).IsEmpty() {
+			candidates = available.Intersection(cpus)
+		}
+
+		cpu := cpuset.NewCPUSet(candidates.ToSlice()[0])
+		available = available.Difference(cpu)
+		vcpuCPUs = vcpuCPUs.Union(cpu)
+
+		tid := tids.vcpus[vcpu]
+		if err := setCPUAffinityFunc(tid, cpu); err != nil {
+			return false, err
+		}
+		vcpuTids[tid] = true
+	}
+
+	// The other threads run on the CPUs of the cpuset left by the vCPUs,
+	// or else share the CPUs of the vCPUs, never leaving the cpuset.
+	if available.IsEmpty() {
+		s.Logger().WithField("cpuset", sandboxCPUSet).Warn("No CPU left in the cpuset for the hypervisor threads other than vCPUs, sharing the vCPUs CPUs")
+		available = vcpuCPUs
+	}
+
+	s.pinEmulatorThreads(available, vcpuTids)
+
+	return true, nil
+}
+
+// pinEmulatorThreads pins the hypervisor threads other than vcpuTids, i.e.
+// the emulator and I/O threads, the vhost workers and the helper daemons
+// such as virtiofsd, to cpus. Threads come and go, failures are only logged.
+func (s *Sandbox) pinEmulatorThreads(cpus cpuset.CPUSet, vcpuTids map[int]bool) {
+	pids := s.hypervisor.getPids()
+	if len(pids) > 0 && pids[0] > 0 {
+		vhostPids, err := utils.FindProcsByName(fmt.Sprintf("vhost-%d", pids[0]))
+		if err != nil {
+			s.Logger().WithError(err).Warn("Could not find hypervisor vhost threads")
+		}
+		pids = append(pids, vhostPids...)
+	}
+	pids = append(pids, s.virtiofsVolumePids()...)
+
+	for _, pid := range pids {
+		if pid <= 0 {
+			continue
+		}
+
+		threads, err := getThreadsFunc(pid)
+		if err != nil {
+			s.Logger().WithError(err).WithField("pid", pid).Warn("Could not list hypervisor threads")
+			continue
+		}
+
+		for _, tid := range threads {
+			if vcpuTids[tid] {
+				continue
+			}
+
+			if err := setCPUAffinityFunc(tid, cpus); err != nil {
+				s.Logger().WithError(err).WithField("tid", tid).Warn("Could not pin hypervisor thread")
+			}
+		}
+	}
+}
+
 func (s *Sandbox) resources() (specs.LinuxResources, error) {
 	resources := specs.LinuxResources{
 		CPU: s.cpuResources(),
@@ -2255,8 +2646,8 @@ func (s *Sandbox) GetPatchedOCISpec() *specs.Spec {
 	return nil
 }
 
-func (s *Sandbox) GetOOMEvent() (string, error) {
-	return s.agent.getOOMEvent()
+func (s *Sandbox) GetOOMEvent(ctx context.Context) (string, error) {
+	return s.agent.getOOMEvent(ctx)
 }
 
 // getSandboxCPUSet returns the union of each of the sandbox's containers' CPU sets
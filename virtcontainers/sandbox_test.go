@@ -28,6 +28,7 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/sys/unix"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
 )
 
 // dirMode is the permission bits used for creating a directory
@@ -65,11 +66,11 @@ func testCreateSandbox(t *testing.T, id string,
 		return nil, fmt.Errorf("Could not create sandbox: %s", err)
 	}
 
-	if err := sandbox.agent.startSandbox(sandbox); err != nil {
+	if err := sandbox.agent.startSandbox(context.Background(), sandbox); err != nil {
 		return nil, err
 	}
 
-	if err := sandbox.createContainers(); err != nil {
+	if err := sandbox.createContainers(context.Background()); err != nil {
 		return nil, err
 	}
 
@@ -131,6 +132,26 @@ func TestCalculateSandboxCPUs(t *testing.T) {
 			assert.Equal(t, got, tt.want)
 		})
 	}
+
+	// The vCPUs the VM booted with for the pod workload are not hot
+	// plugged again.
+	sandbox.config.SandboxResources.WorkloadVCPUs = 8
+	presized := []struct {
+		name       string
+		containers []ContainerConfig
+		want       uint32
+	}{
+		{"presized-unconstrained", []ContainerConfig{unconstrained}, 0},
+		{"presized-covered", []ContainerConfig{constrained, constrained}, 0},
+		{"presized-exceeded", []ContainerConfig{constrained, constrained, constrained}, 4},
+	}
+	for _, tt := range presized {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox.config.Containers = tt.containers
+			got := sandbox.calculateSandboxCPUs()
+			assert.Equal(t, got, tt.want)
+		})
+	}
 }
 
 func TestCalculateSandboxMem(t *testing.T) {
@@ -160,6 +181,30 @@ func TestCalculateSandboxMem(t *testing.T) {
 			assert.Equal(t, got, tt.want)
 		})
 	}
+
+	// The memory the VM booted with for the pod workload is not hot
+	// plugged again.
+	sandbox.config.SandboxResources.WorkloadMemMB = 1
+	large := newTestContainerConfigNoop("cont-00002")
+	largeLimit := int64(2 << 20)
+	large.Resources.Memory = &specs.LinuxMemory{Limit: &largeLimit}
+
+	presized := []struct {
+		name       string
+		containers []ContainerConfig
+		want       int64
+	}{
+		{"presized-unconstrained", []ContainerConfig{unconstrained}, 0},
+		{"presized-covered", []ContainerConfig{constrained, constrained}, 0},
+		{"presized-exceeded", []ContainerConfig{constrained, large}, limit + 1<<20},
+	}
+	for _, tt := range presized {
+		t.Run(tt.name, func(t *testing.T) {
+			sandbox.config.Containers = tt.containers
+			got := sandbox.calculateSandboxMemory()
+			assert.Equal(t, got, tt.want)
+		})
+	}
 }
 
 func TestCreateSandboxEmptyID(t *testing.T) {
@@ -310,7 +355,7 @@ func TestSandboxSetSandboxAndContainerState(t *testing.T) {
 	assert.NoError(err)
 
 	// clean up
-	err = p.Delete()
+	err = p.Delete(context.Background())
 	assert.NoError(err)
 }
 
@@ -745,12 +790,12 @@ func TestCreateContainer(t *testing.T) {
 
 	contID := "999"
 	contConfig := newTestContainerConfigNoop(contID)
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.Nil(t, err, "Failed to create container %+v in sandbox %+v: %v", contConfig, s, err)
 
 	assert.Equal(t, len(s.config.Containers), 1, "Container config list length from sandbox structure should be 1")
 
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.NotNil(t, err, "Should failed to create a duplicated container")
 	assert.Equal(t, len(s.config.Containers), 1, "Container config list length from sandbox structure should be 1")
 }
@@ -761,14 +806,14 @@ func TestDeleteContainer(t *testing.T) {
 	defer cleanUp()
 
 	contID := "999"
-	_, err = s.DeleteContainer(contID)
+	_, err = s.DeleteContainer(context.Background(), contID)
 	assert.NotNil(t, err, "Deletng non-existing container should fail")
 
 	contConfig := newTestContainerConfigNoop(contID)
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.Nil(t, err, "Failed to create container %+v in sandbox %+v: %v", contConfig, s, err)
 
-	_, err = s.DeleteContainer(contID)
+	_, err = s.DeleteContainer(context.Background(), contID)
 	assert.Nil(t, err, "Failed to delete container %s in sandbox %s: %v", contID, s.ID(), err)
 }
 
@@ -778,17 +823,17 @@ func TestStartContainer(t *testing.T) {
 	defer cleanUp()
 
 	contID := "999"
-	_, err = s.StartContainer(contID)
+	_, err = s.StartContainer(context.Background(), contID)
 	assert.NotNil(t, err, "Starting non-existing container should fail")
 
-	err = s.Start()
+	err = s.Start(context.Background())
 	assert.Nil(t, err, "Failed to start sandbox: %v", err)
 
 	contConfig := newTestContainerConfigNoop(contID)
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.Nil(t, err, "Failed to create container %+v in sandbox %+v: %v", contConfig, s, err)
 
-	_, err = s.StartContainer(contID)
+	_, err = s.StartContainer(context.Background(), contID)
 	assert.Nil(t, err, "Start container failed: %v", err)
 }
 
@@ -802,13 +847,13 @@ func TestStatusContainer(t *testing.T) {
 	assert.NotNil(t, err, "Status non-existing container should fail")
 
 	contConfig := newTestContainerConfigNoop(contID)
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.Nil(t, err, "Failed to create container %+v in sandbox %+v: %v", contConfig, s, err)
 
 	_, err = s.StatusContainer(contID)
 	assert.Nil(t, err, "Status container failed: %v", err)
 
-	_, err = s.DeleteContainer(contID)
+	_, err = s.DeleteContainer(context.Background(), contID)
 	assert.Nil(t, err, "Failed to delete container %s in sandbox %s: %v", contID, s.ID(), err)
 }
 
@@ -827,20 +872,20 @@ func TestEnterContainer(t *testing.T) {
 
 	contID := "999"
 	cmd := types.Cmd{}
-	_, _, err = s.EnterContainer(contID, cmd)
+	_, _, err = s.EnterContainer(context.Background(), contID, cmd)
 	assert.NotNil(t, err, "Entering non-existing container should fail")
 
 	contConfig := newTestContainerConfigNoop(contID)
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.Nil(t, err, "Failed to create container %+v in sandbox %+v: %v", contConfig, s, err)
 
-	_, _, err = s.EnterContainer(contID, cmd)
+	_, _, err = s.EnterContainer(context.Background(), contID, cmd)
 	assert.NotNil(t, err, "Entering non-running container should fail")
 
-	err = s.Start()
+	err = s.Start(context.Background())
 	assert.Nil(t, err, "Failed to start sandbox: %v", err)
 
-	_, _, err = s.EnterContainer(contID, cmd)
+	_, _, err = s.EnterContainer(context.Background(), contID, cmd)
 	assert.Nil(t, err, "Enter container failed: %v", err)
 }
 
@@ -856,7 +901,7 @@ func TestDeleteStoreWhenCreateContainerFail(t *testing.T) {
 	contConfig := newTestContainerConfigNoop(contID)
 	contConfig.RootFs = RootFs{Target: "", Mounted: true}
 	s.state.CgroupPath = filepath.Join(testDir, "bad-cgroup")
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.NotNil(t, err, "Should fail to create container due to wrong cgroup")
 }
 
@@ -891,7 +936,7 @@ func TestMonitor(t *testing.T) {
 	_, err = s.Monitor()
 	assert.NotNil(t, err, "Monitoring non-running container should fail")
 
-	err = s.Start()
+	err = s.Start(context.Background())
 	assert.Nil(t, err, "Failed to start sandbox: %v", err)
 
 	_, err = s.Monitor()
@@ -910,26 +955,26 @@ func TestWaitProcess(t *testing.T) {
 
 	contID := "foo"
 	execID := "bar"
-	_, err = s.WaitProcess(contID, execID)
+	_, err = s.WaitProcess(context.Background(), contID, execID)
 	assert.NotNil(t, err, "Wait process in stopped sandbox should fail")
 
-	err = s.Start()
+	err = s.Start(context.Background())
 	assert.Nil(t, err, "Failed to start sandbox: %v", err)
 
-	_, err = s.WaitProcess(contID, execID)
+	_, err = s.WaitProcess(context.Background(), contID, execID)
 	assert.NotNil(t, err, "Wait process in non-existing container should fail")
 
 	contConfig := newTestContainerConfigNoop(contID)
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.Nil(t, err, "Failed to create container %+v in sandbox %+v: %v", contConfig, s, err)
 
-	_, err = s.WaitProcess(contID, execID)
+	_, err = s.WaitProcess(context.Background(), contID, execID)
 	assert.Nil(t, err, "Wait process in ready container failed: %v", err)
 
-	_, err = s.StartContainer(contID)
+	_, err = s.StartContainer(context.Background(), contID)
 	assert.Nil(t, err, "Start container failed: %v", err)
 
-	_, err = s.WaitProcess(contID, execID)
+	_, err = s.WaitProcess(context.Background(), contID, execID)
 	assert.Nil(t, err, "Wait process failed: %v", err)
 }
 
@@ -940,26 +985,26 @@ func TestSignalProcess(t *testing.T) {
 
 	contID := "foo"
 	execID := "bar"
-	err = s.SignalProcess(contID, execID, syscall.SIGKILL, true)
+	err = s.SignalProcess(context.Background(), contID, execID, syscall.SIGKILL, true)
 	assert.NotNil(t, err, "Wait process in stopped sandbox should fail")
 
-	err = s.Start()
+	err = s.Start(context.Background())
 	assert.Nil(t, err, "Failed to start sandbox: %v", err)
 
-	err = s.SignalProcess(contID, execID, syscall.SIGKILL, false)
+	err = s.SignalProcess(context.Background(), contID, execID, syscall.SIGKILL, false)
 	assert.NotNil(t, err, "Wait process in non-existing container should fail")
 
 	contConfig := newTestContainerConfigNoop(contID)
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.Nil(t, err, "Failed to create container %+v in sandbox %+v: %v", contConfig, s, err)
 
-	err = s.SignalProcess(contID, execID, syscall.SIGKILL, true)
+	err = s.SignalProcess(context.Background(), contID, execID, syscall.SIGKILL, true)
 	assert.Nil(t, err, "Wait process in ready container failed: %v", err)
 
-	_, err = s.StartContainer(contID)
+	_, err = s.StartContainer(context.Background(), contID)
 	assert.Nil(t, err, "Start container failed: %v", err)
 
-	err = s.SignalProcess(contID, execID, syscall.SIGKILL, false)
+	err = s.SignalProcess(context.Background(), contID, execID, syscall.SIGKILL, false)
 	assert.Nil(t, err, "Wait process failed: %v", err)
 }
 
@@ -970,26 +1015,26 @@ func TestWinsizeProcess(t *testing.T) {
 
 	contID := "foo"
 	execID := "bar"
-	err = s.WinsizeProcess(contID, execID, 100, 200)
+	err = s.WinsizeProcess(context.Background(), contID, execID, 100, 200)
 	assert.NotNil(t, err, "Winsize process in stopped sandbox should fail")
 
-	err = s.Start()
+	err = s.Start(context.Background())
 	assert.Nil(t, err, "Failed to start sandbox: %v", err)
 
-	err = s.WinsizeProcess(contID, execID, 100, 200)
+	err = s.WinsizeProcess(context.Background(), contID, execID, 100, 200)
 	assert.NotNil(t, err, "Winsize process in non-existing container should fail")
 
 	contConfig := newTestContainerConfigNoop(contID)
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.Nil(t, err, "Failed to create container %+v in sandbox %+v: %v", contConfig, s, err)
 
-	err = s.WinsizeProcess(contID, execID, 100, 200)
+	err = s.WinsizeProcess(context.Background(), contID, execID, 100, 200)
 	assert.Nil(t, err, "Winsize process in ready container failed: %v", err)
 
-	_, err = s.StartContainer(contID)
+	_, err = s.StartContainer(context.Background(), contID)
 	assert.Nil(t, err, "Start container failed: %v", err)
 
-	err = s.WinsizeProcess(contID, execID, 100, 200)
+	err = s.WinsizeProcess(context.Background(), contID, execID, 100, 200)
 	assert.Nil(t, err, "Winsize process failed: %v", err)
 }
 
@@ -1003,20 +1048,20 @@ func TestContainerProcessIOStream(t *testing.T) {
 	_, _, _, err = s.IOStream(contID, execID)
 	assert.NotNil(t, err, "Winsize process in stopped sandbox should fail")
 
-	err = s.Start()
+	err = s.Start(context.Background())
 	assert.Nil(t, err, "Failed to start sandbox: %v", err)
 
 	_, _, _, err = s.IOStream(contID, execID)
 	assert.NotNil(t, err, "Winsize process in non-existing container should fail")
 
 	contConfig := newTestContainerConfigNoop(contID)
-	_, err = s.CreateContainer(contConfig)
+	_, err = s.CreateContainer(context.Background(), contConfig)
 	assert.Nil(t, err, "Failed to create container %+v in sandbox %+v: %v", contConfig, s, err)
 
 	_, _, _, err = s.IOStream(contID, execID)
 	assert.Nil(t, err, "Winsize process in ready container failed: %v", err)
 
-	_, err = s.StartContainer(contID)
+	_, err = s.StartContainer(context.Background(), contID)
 	assert.Nil(t, err, "Start container failed: %v", err)
 
 	_, _, _, err = s.IOStream(contID, execID)
@@ -1166,7 +1211,7 @@ func TestPreAddDevice(t *testing.T) {
 		},
 	}
 
-	mounts, ignoreMounts, err := container.mountSharedDirMounts("", "")
+	mounts, ignoreMounts, err := container.mountSharedDirMounts(context.Background(), "", "")
 	assert.Nil(t, err)
 	assert.Equal(t, len(mounts), 0,
 		"mounts should contain nothing because it only contains a block device")
@@ -1222,7 +1267,7 @@ func TestSandboxStopStopped(t *testing.T) {
 		ctx:   context.Background(),
 		state: types.SandboxState{State: types.StateStopped},
 	}
-	err := s.Stop(false)
+	err := s.Stop(context.Background(), false)
 
 	assert.Nil(t, err)
 }
@@ -1293,7 +1338,7 @@ func TestSandboxUpdateResources(t *testing.T) {
 		nil)
 
 	assert.NoError(t, err)
-	err = s.updateResources()
+	err = s.updateResources(context.Background())
 	assert.NoError(t, err)
 
 	containerMemLimit := int64(1000)
@@ -1311,7 +1356,7 @@ func TestSandboxUpdateResources(t *testing.T) {
 		c.Resources.CPU.Period = &containerCPUPeriod
 		c.Resources.CPU.Quota = &containerCPUQouta
 	}
-	err = s.updateResources()
+	err = s.updateResources(context.Background())
 	assert.NoError(t, err)
 }
 
@@ -1527,3 +1572,66 @@ func TestGetSandboxCpuSet(t *testing.T) {
 		})
 	}
 }
+
+func TestSandboxPinVCPUs(t *testing.T) {
+	assert := assert.New(t)
+
+	savedSetCPUAffinityFunc := setCPUAffinityFunc
+	savedGetThreadsFunc := getThreadsFunc
+	defer func() {
+		setCPUAffinityFunc = savedSetCPUAffinityFunc
+		getThreadsFunc = savedGetThreadsFunc
+	}()
+
+	var pinned map[int]cpuset.CPUSet
+	setCPUAffinityFunc = func(pid int, cpus cpuset.CPUSet) error {
+		pinned[pid] = cpus
+		return nil
+	}
+	vcpuTid := os.Getpid()
+	getThreadsFunc = func(pid int) ([]int, error) {
+		return []int{vcpuTid, 1000, 1001}, nil
+	}
+
+	pin := func(s *Sandbox) map[int]cpuset.CPUSet {
+		pinned = make(map[int]cpuset.CPUSet)
+		s.hypervisor = &mockHypervisor{mockPid: vcpuTid}
+		assert.NoError(s.pinVCPUs())
+		return pinned
+	}
+
+	// The vCPU gets its own CPU, the other threads the rest of the cpuset.
+	s := getSimpleSandbox("2-3", "", "")
+	s.config.EnableVCPUsPinning = true
+	assert.Equal(map[int]cpuset.CPUSet{
+		vcpuTid: cpuset.NewCPUSet(2),
+		1000:    cpuset.NewCPUSet(3),
+		1001:    cpuset.NewCPUSet(3),
+	}, pin(s))
+
+	// Without CPU left in the cpuset, the other threads share the CPU of
+	// the vCPU rather than leaving the cpuset.
+	s = getSimpleSandbox("2", "", "")
+	s.config.EnableVCPUsPinning = true
+	assert.Equal(map[int]cpuset.CPUSet{
+		vcpuTid: cpuset.NewCPUSet(2),
+		1000:    cpuset.NewCPUSet(2),
+		1001:    cpuset.NewCPUSet(2),
+	}, pin(s))
+
+	// More vCPUs than CPUs in the cpuset, nothing is pinned exclusively.
+	pinned = make(map[int]cpuset.CPUSet)
+	ok, err := s.pinVCPUsExclusively(vcpuThreadIDs{vcpus: map[int]int{0: vcpuTid, 1: 1000}})
+	assert.NoError(err)
+	assert.False(ok)
+	assert.Empty(pinned)
+
+	// No exclusive CPU, nothing to pin.
+	s = getSimpleSandbox("", "", "")
+	s.config.EnableVCPUsPinning = true
+	assert.Empty(pin(s))
+
+	// Pinning is not enabled.
+	s = getSimpleSandbox("2-3", "", "")
+	assert.Empty(pin(s))
+}
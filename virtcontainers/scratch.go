@@ -0,0 +1,247 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kata-containers/agent/protocols/grpc"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/device/manager"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// scratchDir is the sandbox directory in the guest where the
+	// encrypted scratch disk is mounted.
+	scratchDir = "scratch"
+
+	// scratchFsType is the filesystem the guest creates on top of
+	// the dm-crypt device.
+	scratchFsType = "ext4"
+
+	scratchImageSuffix = ".img"
+)
+
+var (
+	// scratchOptions ask the agent to format the scratch disk with LUKS2
+	// using a key generated inside the guest. The key never leaves the
+	// guest memory, so the data is unreadable once the sandbox is gone.
+	scratchOptions = []string{"encryption=luks2", "key=ephemeral"}
+)
+
+func kataGuestScratchDir() string {
+	return filepath.Join(kataGuestSandboxDir(), scratchDir)
+}
+
+// scratchImagePath returns the host path of the sparse file backing the
+// encrypted scratch disk of the sandbox.
+func (s *Sandbox) scratchImagePath() string {
+	return filepath.Join(s.config.EncryptedScratchDir, s.id+scratchImageSuffix)
+}
+
+func (s *Sandbox) scratchEnabled() bool {
+	return s.config.EncryptedScratchSize > 0
+}
+
+// createScratchImage creates a sparse file of sizeMB MiB at path.
+func createScratchImage(path string, sizeMB uint32) error {
+	if err := os.MkdirAll(filepath.Dir(path), DirMode); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Truncate(int64(sizeMB) << 20); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	return nil
+}
+
+// setupScratchStorage creates the encrypted scratch disk of the sandbox and
+// hotplugs it into the VM. The disk is a sparse file on the host, exposed
+// through a loop device and handed to the agent as a raw block device. The
+// agent sets up dm-crypt on top of it with an ephemeral key.
+func (s *Sandbox) setupScratchStorage() (err error) {
+	if !s.scratchEnabled() || s.state.ScratchDeviceID != "" {
+		return nil
+	}
+
+	span, _ := s.trace("setupScratchStorage")
+	defer span.Finish()
+
+	caps := s.hypervisor.capabilities()
+	if s.config.HypervisorConfig.DisableBlockDeviceUse || !caps.IsBlockDeviceHotplugSupported() {
+		return fmt.Errorf("encrypted scratch storage requires block device hotplug support")
+	}
+
+	imagePath := s.scratchImagePath()
+	if err = createScratchImage(imagePath, s.config.EncryptedScratchSize); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(imagePath)
+		}
+	}()
+
+	loopPath, err := utils.AttachLoopDevice(imagePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			utils.DetachLoopDevice(loopPath)
+		}
+	}()
+
+	var stat unix.Stat_t
+	if err = unix.Stat(loopPath, &stat); err != nil {
+		return fmt.Errorf("stat %q failed: %v", loopPath, err)
+	}
+
+	dev, err := s.AddDevice(config.DeviceInfo{
+		HostPath:      loopPath,
+		ContainerPath: kataGuestScratchDir(),
+		DevType:       "b",
+		Major:         int64(unix.Major(stat.Rdev)),
+		Minor:         int64(unix.Minor(stat.Rdev)),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.state.ScratchDeviceID = dev.DeviceID()
+
+	s.Logger().WithFields(logrus.Fields{
+		"scratch-image": imagePath,
+		"loop-device":   loopPath,
+		"size-mb":       s.config.EncryptedScratchSize,
+	}).Info("Encrypted scratch storage attached")
+
+	return nil
+}
+
+// removeScratchStorage releases the host resources backing the encrypted
+// scratch disk. The VM is expected to be stopped at this point.
+func (s *Sandbox) removeScratchStorage() error {
+	if s.state.ScratchDeviceID == "" {
+		return nil
+	}
+
+	devID := s.state.ScratchDeviceID
+	dev := s.devManager.GetDeviceByID(devID)
+	if dev != nil {
+		loopPath := dev.GetHostPath()
+
+		if err := s.devManager.DetachDevice(devID, s); err != nil && err != manager.ErrDeviceNotAttached {
+			s.Logger().WithError(err).WithField("device-id", devID).Warn("Could not detach scratch device")
+		}
+
+		if err := s.devManager.RemoveDevice(devID); err != nil && err != manager.ErrDeviceNotExist {
+			return err
+		}
+
+		if err := utils.DetachLoopDevice(loopPath); err != nil {
+			return err
+		}
+	} else {
+		// The device manager lost track of the scratch device, the
+		// loop device is then found through the image backing it.
+		loopPath, err := utils.FindLoopDevice(s.scratchImagePath())
+		if err != nil {
+			return err
+		}
+
+		if loopPath != "" {
+			if err := utils.DetachLoopDevice(loopPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.Remove(s.scratchImagePath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	s.state.ScratchDeviceID = ""
+
+	return nil
+}
+
+// scratchStorage describes to the agent how to set up the encrypted
+// scratch disk of the sandbox.
+func (k *kataAgent) scratchStorage(sandbox *Sandbox) (*grpc.Storage, error) {
+	if sandbox.state.ScratchDeviceID == "" {
+		return nil, nil
+	}
+
+	device := sandbox.devManager.GetDeviceByID(sandbox.state.ScratchDeviceID)
+	if device == nil {
+		return nil, fmt.Errorf("failed to find scratch device by id %q", sandbox.state.ScratchDeviceID)
+	}
+
+	blockDrive, ok := device.GetDeviceInfo().(*config.BlockDrive)
+	if !ok || blockDrive == nil {
+		return nil, fmt.Errorf("malformed scratch block drive")
+	}
+
+	storage, err := blockDriveStorage(sandbox.config.HypervisorConfig.BlockDeviceDriver, blockDrive)
+	if err != nil {
+		return nil, err
+	}
+
+	storage.MountPoint = kataGuestScratchDir()
+	storage.Fstype = scratchFsType
+	storage.Options = scratchOptions
+
+	return storage, nil
+}
+
+// scratchMountSource returns the location on the encrypted scratch disk
+// where a volume of type storageType should be created in the guest.
+func scratchMountSource(storageType, source string) string {
+	return filepath.Join(kataGuestScratchDir(), storageType, filepath.Base(source))
+}
+
+// blockDriveStorage returns a storage whose driver and source identify
+// blockDrive in the guest, according to the block device driver in use.
+func blockDriveStorage(blockDeviceDriver string, blockDrive *config.BlockDrive) (*grpc.Storage, error) {
+	storage := &grpc.Storage{}
+
+	switch blockDeviceDriver {
+	case config.VirtioMmio:
+		storage.Driver = kataMmioBlkDevType
+		storage.Source = blockDrive.VirtPath
+	case config.VirtioBlockCCW:
+		storage.Driver = kataBlkCCWDevType
+		storage.Source = blockDrive.DevNo
+	case config.VirtioBlock:
+		storage.Driver = kataBlkDevType
+		if blockDrive.PCIAddr == "" {
+			storage.Source = blockDrive.VirtPath
+		} else {
+			storage.Source = blockDrive.PCIAddr
+		}
+	case config.VirtioSCSI:
+		storage.Driver = kataSCSIDevType
+		storage.Source = blockDrive.SCSIAddr
+	default:
+		return nil, fmt.Errorf("Unknown block device driver: %s", blockDeviceDriver)
+	}
+
+	return storage, nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/device/manager"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateScratchImage(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "scratch")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sub", "sandbox"+scratchImageSuffix)
+	err = createScratchImage(path, 16)
+	assert.NoError(err)
+
+	var stat syscall.Stat_t
+	err = syscall.Stat(path, &stat)
+	assert.NoError(err)
+	assert.Equal(int64(16<<20), stat.Size)
+	// the image must be sparse
+	assert.True(stat.Blocks*512 < stat.Size)
+
+	// an existing image must never be reused
+	err = createScratchImage(path, 16)
+	assert.Error(err)
+}
+
+func TestBlockDriveStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	drive := &config.BlockDrive{
+		VirtPath: "/dev/vdb",
+		PCIAddr:  "02/01",
+		SCSIAddr: "0:0",
+		DevNo:    "0.0.0005",
+	}
+
+	for driver, expected := range map[string][2]string{
+		config.VirtioMmio:     {kataMmioBlkDevType, drive.VirtPath},
+		config.VirtioBlockCCW: {kataBlkCCWDevType, drive.DevNo},
+		config.VirtioBlock:    {kataBlkDevType, drive.PCIAddr},
+		config.VirtioSCSI:     {kataSCSIDevType, drive.SCSIAddr},
+	} {
+		storage, err := blockDriveStorage(driver, drive)
+		assert.NoError(err)
+		assert.Equal(expected[0], storage.Driver)
+		assert.Equal(expected[1], storage.Source)
+	}
+
+	_, err := blockDriveStorage("foo", drive)
+	assert.Error(err)
+}
+
+func TestScratchStorage(t *testing.T) {
+	assert := assert.New(t)
+	k := &kataAgent{}
+
+	sandbox := &Sandbox{
+		config: &SandboxConfig{},
+	}
+
+	// No scratch device, nothing to pass to the agent
+	storage, err := k.scratchStorage(sandbox)
+	assert.NoError(err)
+	assert.Nil(storage)
+
+	sandbox.config.EncryptedScratchDir = "/var/lib/kata"
+	sandbox.id = "foo"
+	assert.Equal("/var/lib/kata/foo.img", sandbox.scratchImagePath())
+	assert.False(sandbox.scratchEnabled())
+}
+
+func TestRemoveScratchStorage(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "scratch")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sandbox := &Sandbox{
+		id:         "foo",
+		config:     &SandboxConfig{EncryptedScratchDir: dir},
+		devManager: manager.NewDeviceManager(manager.VirtioBlock, false, "", nil),
+	}
+
+	// Nothing was set up, nothing to remove
+	assert.NoError(sandbox.removeScratchStorage())
+
+	// The image of a scratch disk whose device is gone is still removed,
+	// as after a failed sandbox creation.
+	assert.NoError(createScratchImage(sandbox.scratchImagePath(), 16))
+	sandbox.state.ScratchDeviceID = "foo"
+	assert.NoError(sandbox.removeScratchStorage())
+	assert.Empty(sandbox.state.ScratchDeviceID)
+
+	_, err = os.Stat(sandbox.scratchImagePath())
+	assert.True(os.IsNotExist(err))
+}
@@ -10,6 +10,8 @@ const (
 	blockDeviceHotplugSupport
 	multiQueueSupport
 	fsSharingSupported
+	readOnlyBlockDeviceHotplugSupport
+	fsSharingHotplugSupport
 )
 
 // Capabilities describe a virtcontainers hypervisor capabilities
@@ -57,3 +59,27 @@ func (caps *Capabilities) IsFsSharingSupported() bool {
 func (caps *Capabilities) SetFsSharingSupport() {
 	caps.flags |= fsSharingSupported
 }
+
+// IsReadOnlyBlockDeviceHotplugSupported tells if an hypervisor can hotplug
+// block devices that it only opens for reading.
+func (caps *Capabilities) IsReadOnlyBlockDeviceHotplugSupported() bool {
+	return caps.flags&readOnlyBlockDeviceHotplugSupport != 0
+}
+
+// SetReadOnlyBlockDeviceHotplugSupport sets the read-only block device
+// hotplugging capability to true.
+func (caps *Capabilities) SetReadOnlyBlockDeviceHotplugSupport() {
+	caps.flags |= readOnlyBlockDeviceHotplugSupport
+}
+
+// IsFsSharingHotplugSupported tells if an hypervisor can hotplug additional
+// shared filesystems once the VM is running.
+func (caps *Capabilities) IsFsSharingHotplugSupported() bool {
+	return caps.flags&fsSharingHotplugSupport != 0
+}
+
+// SetFsSharingHotplugSupport sets the shared filesystem hotplugging
+// capability to true.
+func (caps *Capabilities) SetFsSharingHotplugSupport() {
+	caps.flags |= fsSharingHotplugSupport
+}
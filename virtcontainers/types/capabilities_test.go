@@ -43,3 +43,21 @@ func TestMultiQueueCapability(t *testing.T) {
 	caps.SetMultiQueueSupport()
 	assert.True(caps.IsMultiQueueSupported())
 }
+
+func TestReadOnlyBlockDeviceHotplugCapability(t *testing.T) {
+	assert := assert.New(t)
+	var caps Capabilities
+
+	assert.False(caps.IsReadOnlyBlockDeviceHotplugSupported())
+	caps.SetReadOnlyBlockDeviceHotplugSupport()
+	assert.True(caps.IsReadOnlyBlockDeviceHotplugSupported())
+}
+
+func TestFsSharingHotplugCapability(t *testing.T) {
+	assert := assert.New(t)
+	var caps Capabilities
+
+	assert.False(caps.IsFsSharingHotplugSupported())
+	caps.SetFsSharingHotplugSupport()
+	assert.True(caps.IsFsSharingHotplugSupported())
+}
@@ -14,6 +14,11 @@ type ContainerState struct {
 	// File system of the rootfs incase it is block device
 	Fstype string `json:"fstype"`
 
+	// RootfsLayerDeviceIDs are the read-only block devices holding the
+	// rootfs layers, lowest layer last, when the rootfs is composed in
+	// the guest from layer images
+	RootfsLayerDeviceIDs []string `json:"rootfsLayerDeviceIDs,omitempty"`
+
 	// CgroupPath is the cgroup hierarchy where sandbox's processes
 	// including the hypervisor are placed.
 	CgroupPath string `json:"cgroupPath,omitempty"`
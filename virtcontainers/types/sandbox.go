@@ -56,12 +56,39 @@ type SandboxState struct {
 	// with the value as the path.
 	CgroupPaths map[string]string `json:"cgroupPaths"`
 
+	// ScratchDeviceID is the ID of the block device backing the
+	// encrypted scratch storage of the sandbox.
+	ScratchDeviceID string `json:"scratchDeviceID,omitempty"`
+
+	// VirtiofsVolumes are the virtiofsd processes dedicated to
+	// sharing a single volume with the guest.
+	VirtiofsVolumes []VirtiofsVolume `json:"virtiofsVolumes,omitempty"`
+
 	// PersistVersion indicates current storage api version.
 	// It's also known as ABI version of kata-runtime.
 	// Note: it won't be written to disk
 	PersistVersion uint `json:"-"`
 }
 
+// VirtiofsVolume describes a virtiofsd sharing a single host directory
+// with the guest.
+type VirtiofsVolume struct {
+	// Source is the host directory shared by the daemon.
+	Source string `json:"source"`
+
+	// Tag is the virtio-fs tag the guest mounts the volume with.
+	Tag string `json:"tag"`
+
+	// Cache is the cache mode of the daemon.
+	Cache string `json:"cache"`
+
+	// SocketPath is the vhost-user socket the daemon serves.
+	SocketPath string `json:"socketPath"`
+
+	// PID is the process ID of the daemon.
+	PID int `json:"pid"`
+}
+
 // Valid checks that the sandbox state is valid.
 func (state *SandboxState) Valid() bool {
 	return state.State.valid()
@@ -0,0 +1,107 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package utils
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+var sysNodePath = "/sys/devices/system/node"
+
+// NUMANode is a host NUMA node and the CPUs of interest it holds.
+type NUMANode struct {
+	ID   int
+	CPUs cpuset.CPUSet
+}
+
+// GetCPUAffinity returns the set of CPUs the thread pid is allowed to run on,
+// 0 being the calling thread.
+func GetCPUAffinity(pid int) (cpuset.CPUSet, error) {
+	var set unix.CPUSet
+
+	if err := unix.SchedGetaffinity(pid, &set); err != nil {
+		return cpuset.CPUSet{}, errors.Wrapf(err, "Could not get CPU affinity of %d", pid)
+	}
+
+	b := cpuset.NewBuilder()
+	for cpu := 0; cpu < len(set)*int(unsafe.Sizeof(set[0]))*8; cpu++ {
+		if set.IsSet(cpu) {
+			b.Add(cpu)
+		}
+	}
+
+	return b.Result(), nil
+}
+
+// SetCPUAffinity restricts the thread pid to the given set of CPUs.
+func SetCPUAffinity(pid int, cpus cpuset.CPUSet) error {
+	var set unix.CPUSet
+
+	for _, cpu := range cpus.ToSlice() {
+		set.Set(cpu)
+	}
+
+	if err := unix.SchedSetaffinity(pid, &set); err != nil {
+		return errors.Wrapf(err, "Could not set CPU affinity of %d to %s", pid, cpus)
+	}
+
+	return nil
+}
+
+// GetNUMANodes returns the host NUMA nodes holding at least one of cpus,
+// or all of them if cpus is empty, ordered by node ID. Each node only
+// reports the CPUs it shares with cpus.
+func GetNUMANodes(cpus cpuset.CPUSet) ([]NUMANode, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysNodePath, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []NUMANode
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+
+		nodeCPUs, err := cpuset.Parse(strings.TrimSpace(string(content)))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid CPU list for NUMA node %d", id)
+		}
+
+		if !cpus.IsEmpty() {
+			nodeCPUs = nodeCPUs.Intersection(cpus)
+		}
+		if nodeCPUs.IsEmpty() {
+			continue
+		}
+
+		nodes = append(nodes, NUMANode{
+			ID:   id,
+			CPUs: nodeCPUs,
+		})
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	return nodes, nil
+}
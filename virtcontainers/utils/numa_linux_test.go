@@ -0,0 +1,80 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/kubernetes/pkg/kubelet/cm/cpuset"
+)
+
+func TestGetNUMANodes(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "numa-nodes-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedSysNodePath := sysNodePath
+	defer func() {
+		sysNodePath = savedSysNodePath
+	}()
+	sysNodePath = dir
+
+	for node, cpulist := range map[string]string{
+		"node0":  "0-3\n",
+		"node1":  "4-7\n",
+		"node10": "\n",
+	} {
+		assert.NoError(os.MkdirAll(filepath.Join(dir, node), 0755))
+		assert.NoError(ioutil.WriteFile(filepath.Join(dir, node, "cpulist"), []byte(cpulist), 0644))
+	}
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "power"), 0755))
+
+	nodes, err := GetNUMANodes(cpuset.MustParse("2-5"))
+	assert.NoError(err)
+	assert.Equal([]NUMANode{
+		{ID: 0, CPUs: cpuset.MustParse("2-3")},
+		{ID: 1, CPUs: cpuset.MustParse("4-5")},
+	}, nodes)
+
+	nodes, err = GetNUMANodes(cpuset.MustParse("6"))
+	assert.NoError(err)
+	assert.Equal([]NUMANode{{ID: 1, CPUs: cpuset.MustParse("6")}}, nodes)
+
+	nodes, err = GetNUMANodes(cpuset.MustParse("8-9"))
+	assert.NoError(err)
+	assert.Empty(nodes)
+
+	// Without CPUs, all the nodes holding CPUs are returned.
+	nodes, err = GetNUMANodes(cpuset.NewCPUSet())
+	assert.NoError(err)
+	assert.Equal([]NUMANode{
+		{ID: 0, CPUs: cpuset.MustParse("0-3")},
+		{ID: 1, CPUs: cpuset.MustParse("4-7")},
+	}, nodes)
+
+	assert.NoError(ioutil.WriteFile(filepath.Join(dir, "node1", "cpulist"), []byte("foo"), 0644))
+	_, err = GetNUMANodes(cpuset.MustParse("2-5"))
+	assert.Error(err)
+}
+
+func TestCPUAffinity(t *testing.T) {
+	assert := assert.New(t)
+
+	cpus, err := GetCPUAffinity(0)
+	assert.NoError(err)
+	assert.False(cpus.IsEmpty())
+
+	assert.NoError(SetCPUAffinity(0, cpus))
+
+	_, err = GetCPUAffinity(-1)
+	assert.Error(err)
+}
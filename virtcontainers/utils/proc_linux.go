@@ -6,9 +6,12 @@
 package utils
 
 import (
+	"bufio"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/procfs"
@@ -55,3 +58,179 @@ func (p *Proc) Children() ([]*Proc, error) {
 
 	return children, nil
 }
+
+// GetRss returns the resident memory of the process pid, in bytes.
+func GetRss(pid int) (uint64, error) {
+	p, err := NewProc(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	stat, err := p.NewStat()
+	if err != nil {
+		return 0, errors.Wrapf(err, "Fail to read pid %v stat", pid)
+	}
+
+	return uint64(stat.ResidentMemory()), nil
+}
+
+// MappingStats is the memory usage of the mappings of a file by a process,
+// in bytes.
+type MappingStats struct {
+	Pid  int
+	Path string
+
+	// Rss is the memory of the mappings resident in RAM, Pss the share
+	// of it proportional to the number of processes mapping each page.
+	Rss uint64
+	Pss uint64
+
+	// PrivateDirty is the memory written by the process only, which for
+	// a private mapping are the pages copied on write.
+	PrivateDirty uint64
+}
+
+// Shared returns the resident memory of the mappings still backed by the
+// file, as opposed to the pages the process dirtied.
+func (s MappingStats) Shared() uint64 {
+	return s.Rss - s.PrivateDirty
+}
+
+// GetMappingStats returns the memory usage of the files mapped by the
+// process pid which are path or are under it, read from its smaps.
+func GetMappingStats(pid int, path string) ([]MappingStats, error) {
+	f, err := os.Open(filepath.Join(procfs.DefaultMountPoint, strconv.Itoa(pid), "smaps"))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var stats []MappingStats
+	var current *MappingStats
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		// Mapping header: address perms offset dev inode [pathname]
+		if !strings.HasSuffix(fields[0], ":") {
+			current = nil
+			if len(fields) < 6 {
+				continue
+			}
+
+			mapped := strings.Join(fields[5:], " ")
+			if mapped != path && !strings.HasPrefix(mapped, path+"/") {
+				continue
+			}
+
+			for i := range stats {
+				if stats[i].Path == mapped {
+					current = &stats[i]
+				}
+			}
+			if current == nil {
+				stats = append(stats, MappingStats{Pid: pid, Path: mapped})
+				current = &stats[len(stats)-1]
+			}
+			continue
+		}
+
+		if current == nil || len(fields) < 2 {
+			continue
+		}
+
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "Rss:":
+			current.Rss += kb << 10
+		case "Pss:":
+			current.Pss += kb << 10
+		case "Private_Dirty:":
+			current.PrivateDirty += kb << 10
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// FindMappingStats returns the memory usage of the file at path by each of
+// the processes pids mapping it.
+func FindMappingStats(path string, pids []int) ([]MappingStats, error) {
+	var stats []MappingStats
+	for _, pid := range pids {
+		ps, err := GetMappingStats(pid, path)
+		if err != nil {
+			// The process is gone.
+			continue
+		}
+
+		for _, s := range ps {
+			if s.Path == path {
+				stats = append(stats, s)
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// GetThreads returns the IDs of the threads of the process pid, its main
+// thread included.
+func GetThreads(pid int) ([]int, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(procfs.DefaultMountPoint, strconv.Itoa(pid), taskPath))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Fail to read pid %v proc task dir", pid)
+	}
+
+	var tids []int
+	for _, info := range infos {
+		tid, err := strconv.Atoi(info.Name())
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid thread id %v", info.Name())
+		}
+		tids = append(tids, tid)
+	}
+
+	return tids, nil
+}
+
+// FindProcsByName returns the pids of the processes named name, such as the
+// "vhost-<pid>" kernel threads serving the vhost devices of a VMM.
+func FindProcsByName(name string) ([]int, error) {
+	infos, err := ioutil.ReadDir(procfs.DefaultMountPoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, info := range infos {
+		pid, err := strconv.Atoi(info.Name())
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		comm, err := ioutil.ReadFile(filepath.Join(procfs.DefaultMountPoint, info.Name(), "comm"))
+		if err != nil {
+			// The process is gone.
+			continue
+		}
+
+		if strings.TrimSpace(string(comm)) == name {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids, nil
+}
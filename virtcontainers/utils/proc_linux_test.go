@@ -0,0 +1,99 @@
+// Copyright (c) 2019 Hyper.sh
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMappingStats(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "mapping-stats-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	pageSize := os.Getpagesize()
+	path := filepath.Join(dir, "memory")
+	assert.NoError(ioutil.WriteFile(path, make([]byte, 4*pageSize), 0600))
+
+	f, err := os.Open(path)
+	assert.NoError(err)
+	defer f.Close()
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, 4*pageSize, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE)
+	assert.NoError(err)
+	defer syscall.Munmap(data)
+
+	// Read a page, copy another one on write.
+	assert.Equal(byte(0), data[0])
+	data[pageSize] = 1
+
+	stats, err := GetMappingStats(os.Getpid(), dir)
+	assert.NoError(err)
+	assert.Len(stats, 1)
+	assert.Equal(path, stats[0].Path)
+	assert.Equal(os.Getpid(), stats[0].Pid)
+	// The kernel may map more pages than the ones accessed.
+	assert.True(stats[0].PrivateDirty >= uint64(pageSize))
+	assert.True(stats[0].Rss >= stats[0].PrivateDirty)
+	assert.Equal(stats[0].Rss-stats[0].PrivateDirty, stats[0].Shared())
+
+	stats, err = GetMappingStats(os.Getpid(), filepath.Join(dir, "other"))
+	assert.NoError(err)
+	assert.Empty(stats)
+
+	// The processes gone or not mapping the file are skipped.
+	stats, err = FindMappingStats(path, []int{os.Getppid(), os.Getpid(), -1})
+	assert.NoError(err)
+	assert.Len(stats, 1)
+	assert.Equal(os.Getpid(), stats[0].Pid)
+}
+
+func TestGetRss(t *testing.T) {
+	assert := assert.New(t)
+
+	rss, err := GetRss(os.Getpid())
+	assert.NoError(err)
+	assert.True(rss > 0)
+
+	_, err = GetRss(-1)
+	assert.Error(err)
+}
+
+func TestGetThreads(t *testing.T) {
+	assert := assert.New(t)
+
+	tids, err := GetThreads(os.Getpid())
+	assert.NoError(err)
+	assert.Contains(tids, os.Getpid())
+	assert.Contains(tids, syscall.Gettid())
+
+	_, err = GetThreads(-1)
+	assert.Error(err)
+}
+
+func TestFindProcsByName(t *testing.T) {
+	assert := assert.New(t)
+
+	comm, err := ioutil.ReadFile("/proc/self/comm")
+	assert.NoError(err)
+
+	pids, err := FindProcsByName(strings.TrimSpace(string(comm)))
+	assert.NoError(err)
+	assert.Contains(pids, os.Getpid())
+
+	pids, err = FindProcsByName("vhost--1")
+	assert.NoError(err)
+	assert.Empty(pids)
+}
@@ -10,8 +10,10 @@ import (
 	"crypto/rand"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/big"
 	"os"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"unsafe"
@@ -99,6 +101,7 @@ const (
 	procDeviceIndex = iota
 	procPathIndex
 	procTypeIndex
+	procOptionsIndex
 )
 
 // GetDevicePathAndFsType gets the device for the mount point and the file system type
@@ -141,3 +144,231 @@ func GetDevicePathAndFsType(mountPoint string) (devicePath, fsType string, err e
 		}
 	}
 }
+
+// GetMountOptions returns the file system type and the mount options of
+// the mount found at mountPoint.
+func GetMountOptions(mountPoint string) (fsType string, options []string, err error) {
+	if mountPoint == "" {
+		return "", nil, fmt.Errorf("Mount point cannot be empty")
+	}
+
+	file, err := os.Open(procMountsFile)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != fieldsPerLine {
+			continue
+		}
+
+		if mountPoint == fields[procPathIndex] {
+			return fields[procTypeIndex], strings.Split(fields[procOptionsIndex], ","), nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+
+	return "", nil, fmt.Errorf("Mount %s not found", mountPoint)
+}
+
+// sysBlockPath is where the kernel lists the block devices, loop devices
+// included.
+var sysBlockPath = "/sys/block"
+
+const (
+	loopControlPath   = "/dev/loop-control"
+	loopDevicePathFmt = "/dev/loop%d"
+	loopSysfsBacking  = "loop/backing_file"
+
+	// loopAttachRetries is the number of free loop devices tried, another
+	// process being able to bind the one found free before us.
+	loopAttachRetries = 10
+)
+
+// AttachLoopDevice binds backingFile to the first free loop device and
+// returns the path of that loop device. It is the caller's responsibility
+// to release the loop device through DetachLoopDevice.
+func AttachLoopDevice(backingFile string) (string, error) {
+	return attachLoopDevice(backingFile, false)
+}
+
+// AttachReadOnlyLoopDevice is like AttachLoopDevice, except that the loop
+// device is created read-only so that nothing can write to backingFile
+// through it. backingFile is also share-locked (flock) for as long as the
+// loop device holds it, so that TryLockFile tells it is in use.
+func AttachReadOnlyLoopDevice(backingFile string) (string, error) {
+	return attachLoopDevice(backingFile, true)
+}
+
+func attachLoopDevice(backingFile string, readOnly bool) (string, error) {
+	ctl, err := os.OpenFile(loopControlPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer ctl.Close()
+
+	flags := os.O_RDWR
+	if readOnly {
+		flags = os.O_RDONLY
+	}
+
+	backing, err := os.OpenFile(backingFile, flags, 0)
+	if err != nil {
+		return "", err
+	}
+	defer backing.Close()
+
+	// The lock belongs to the open file, which the loop device keeps a
+	// reference on until it is detached.
+	if readOnly {
+		if err := unix.Flock(int(backing.Fd()), unix.LOCK_SH); err != nil {
+			return "", fmt.Errorf("Could not lock %s: %v", backingFile, err)
+		}
+	}
+
+	for i := 0; ; i++ {
+		loopPath, err := bindFreeLoopDevice(ctl, backing)
+		if err == unix.EBUSY && i < loopAttachRetries {
+			// Somebody else bound the device between
+			// LOOP_CTL_GET_FREE and LOOP_SET_FD.
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("Could not bind %s to a loop device: %v", backingFile, err)
+		}
+
+		return loopPath, nil
+	}
+}
+
+// bindFreeLoopDevice binds backing to the loop device found free through
+// ctl.
+func bindFreeLoopDevice(ctl, backing *os.File) (string, error) {
+	index, err := unix.IoctlRetInt(int(ctl.Fd()), unix.LOOP_CTL_GET_FREE)
+	if err != nil {
+		return "", err
+	}
+
+	loopPath := fmt.Sprintf(loopDevicePathFmt, index)
+	loop, err := os.OpenFile(loopPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", err
+	}
+	defer loop.Close()
+
+	if err := unix.IoctlSetInt(int(loop.Fd()), unix.LOOP_SET_FD, int(backing.Fd())); err != nil {
+		return "", err
+	}
+
+	return loopPath, nil
+}
+
+// DetachLoopDevice releases the loop device found at loopPath from its
+// backing file.
+func DetachLoopDevice(loopPath string) error {
+	loop, err := os.OpenFile(loopPath, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer loop.Close()
+
+	if err := unix.IoctlSetInt(int(loop.Fd()), unix.LOOP_CLR_FD, 0); err != nil && err != unix.ENXIO {
+		return fmt.Errorf("Could not detach loop device %s: %v", loopPath, err)
+	}
+
+	return nil
+}
+
+// LoopDeviceBackingFile returns the path of the file backing the loop
+// device found at loopPath.
+func LoopDeviceBackingFile(loopPath string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(sysBlockPath, filepath.Base(loopPath), loopSysfsBacking))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// FindLoopDevice returns the path of the loop device backed by backingFile,
+// or an empty string if no loop device is bound to it.
+func FindLoopDevice(backingFile string) (string, error) {
+	devices, err := ioutil.ReadDir(sysBlockPath)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dev := range devices {
+		if !strings.HasPrefix(dev.Name(), "loop") {
+			continue
+		}
+
+		// Free loop devices have no backing file.
+		backing, err := LoopDeviceBackingFile(dev.Name())
+		if err != nil {
+			continue
+		}
+
+		if backing == backingFile {
+			return filepath.Join("/dev", dev.Name()), nil
+		}
+	}
+
+	return "", nil
+}
+
+// TryLockFile exclusively locks path unless a lock is already held on it,
+// by a loop device attached through AttachReadOnlyLoopDevice for instance.
+// It returns the locked file, to be closed by the caller, or nil if path is
+// in use.
+func TryLockFile(path string) (*os.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		f.Close()
+		if err == unix.EWOULDBLOCK {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// PidfdOpen returns a pidfd referring to the process pid, which keeps
+// referring to it once it exited, whatever process reuses pid. The error
+// is the raw errno, ENOSYS when the kernel does not support pidfds.
+func PidfdOpen(pid int) (*os.File, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_PIDFD_OPEN, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+
+	return os.NewFile(fd, fmt.Sprintf("pidfd:%d", pid)), nil
+}
+
+// PidfdExited tells whether the process pidfd refers to exited.
+func PidfdExited(pidfd *os.File) (bool, error) {
+	fds := []unix.PollFd{{Fd: int32(pidfd.Fd()), Events: unix.POLLIN}}
+
+	for {
+		n, err := unix.Poll(fds, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		return n > 0, nil
+	}
+}
@@ -7,9 +7,14 @@ package utils
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
 )
 
 func TestFindContextID(t *testing.T) {
@@ -40,6 +45,18 @@ func TestGetDevicePathAndFsTypeEmptyMount(t *testing.T) {
 	assert.Error(err)
 }
 
+func TestGetMountOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := GetMountOptions("")
+	assert.Error(err)
+
+	fstype, options, err := GetMountOptions("/proc")
+	assert.NoError(err)
+	assert.Equal(fstype, "proc")
+	assert.NotEmpty(options)
+}
+
 func TestGetDevicePathAndFsTypeSuccessful(t *testing.T) {
 	assert := assert.New(t)
 
@@ -49,3 +66,97 @@ func TestGetDevicePathAndFsTypeSuccessful(t *testing.T) {
 	assert.Equal(path, "proc")
 	assert.Equal(fstype, "proc")
 }
+
+func TestTryLockFile(t *testing.T) {
+	assert := assert.New(t)
+
+	f, err := ioutil.TempFile("", "lock")
+	assert.NoError(err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// A shared lock, as held by a read-only loop device
+	assert.NoError(unix.Flock(int(f.Fd()), unix.LOCK_SH))
+
+	locked, err := TryLockFile(f.Name())
+	assert.NoError(err)
+	assert.Nil(locked)
+
+	assert.NoError(unix.Flock(int(f.Fd()), unix.LOCK_UN))
+
+	locked, err = TryLockFile(f.Name())
+	assert.NoError(err)
+	assert.NotNil(locked)
+	locked.Close()
+
+	_, err = TryLockFile(f.Name() + "-missing")
+	assert.Error(err)
+}
+
+func TestFindLoopDevice(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "sys-block")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	orgSysBlockPath := sysBlockPath
+	sysBlockPath = dir
+	defer func() {
+		sysBlockPath = orgSysBlockPath
+	}()
+
+	for dev, backing := range map[string]string{
+		"loop0": "/images/foo.img",
+		"loop1": "/images/bar.img",
+		"sda":   "/images/baz.img",
+	} {
+		path := filepath.Join(dir, dev, "loop")
+		assert.NoError(os.MkdirAll(path, 0755))
+		assert.NoError(ioutil.WriteFile(filepath.Join(path, "backing_file"), []byte(backing+"\n"), 0644))
+	}
+	// a free loop device
+	assert.NoError(os.MkdirAll(filepath.Join(dir, "loop2", "loop"), 0755))
+
+	loopPath, err := FindLoopDevice("/images/bar.img")
+	assert.NoError(err)
+	assert.Equal("/dev/loop1", loopPath)
+
+	loopPath, err = FindLoopDevice("/images/baz.img")
+	assert.NoError(err)
+	assert.Empty(loopPath)
+
+	sysBlockPath = filepath.Join(dir, "missing")
+	_, err = FindLoopDevice("/images/foo.img")
+	assert.Error(err)
+}
+
+func TestPidfd(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := exec.Command("sleep", "10")
+	assert.NoError(cmd.Start())
+
+	pidfd, err := PidfdOpen(cmd.Process.Pid)
+	if err == unix.ENOSYS {
+		cmd.Process.Kill()
+		cmd.Wait()
+		t.Skip("pidfd not supported")
+	}
+	assert.NoError(err)
+	defer pidfd.Close()
+
+	exited, err := PidfdExited(pidfd)
+	assert.NoError(err)
+	assert.False(exited)
+
+	assert.NoError(cmd.Process.Kill())
+	cmd.Wait()
+
+	exited, err = PidfdExited(pidfd)
+	assert.NoError(err)
+	assert.True(exited)
+
+	_, err = PidfdOpen(cmd.Process.Pid)
+	assert.Equal(unix.ESRCH, err)
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/kata-containers/agent/protocols/grpc"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// virtiofsVolumeTagPrefix prefixes the tag of the virtio-fs devices
+	// dedicated to a volume. The tag is limited to 36 bytes.
+	virtiofsVolumeTagPrefix = "kataVolume-"
+
+	virtiofsVolumeSocketSuffix = ".sock"
+)
+
+// virtiofsVolumeTag returns the virtio-fs tag of the daemon sharing source
+// with cache mode cache.
+func virtiofsVolumeTag(source, cache string) string {
+	return fmt.Sprintf("%s%x", virtiofsVolumeTagPrefix, sha256.Sum256([]byte(cache+":"+source)))[:36]
+}
+
+// virtiofsVolumeCache returns the cache mode of the dedicated virtiofsd
+// that should share m with the guest, or an empty string if m should go
+// through the sandbox shared directory. A cache mode requested for the
+// volume itself takes precedence over the sandbox wide setting.
+func (s *Sandbox) virtiofsVolumeCache(m Mount) string {
+	if s.config.HypervisorConfig.SharedFS != config.VirtioFS {
+		return ""
+	}
+
+	if m.VirtiofsCache != "" {
+		return m.VirtiofsCache
+	}
+
+	return s.config.HypervisorConfig.VirtioFSVolumeCache
+}
+
+// virtiofsVolumeDaemon returns the virtiofsd serving vol. The same daemon
+// is handed back for vol, so that the process it started is tracked until
+// it is stopped.
+func (s *Sandbox) virtiofsVolumeDaemon(vol types.VirtiofsVolume) *virtiofsd {
+	if daemon, ok := s.virtiofsVolumeDaemons[vol.SocketPath]; ok {
+		return daemon
+	}
+
+	if s.virtiofsVolumeDaemons == nil {
+		s.virtiofsVolumeDaemons = make(map[string]*virtiofsd)
+	}
+
+	hConfig := s.config.HypervisorConfig
+
+	daemon := &virtiofsd{
+		path:       hConfig.VirtioFSDaemon,
+		socketPath: vol.SocketPath,
+		cache:      vol.Cache,
+		extraArgs:  hConfig.VirtioFSExtraArgs,
+		sourcePath: vol.Source,
+		debug:      hConfig.Debug,
+		PID:        vol.PID,
+		ctx:        s.ctx,
+	}
+	s.virtiofsVolumeDaemons[vol.SocketPath] = daemon
+
+	return daemon
+}
+
+// addVirtiofsVolume shares the host directory source with the guest
+// through a dedicated virtiofsd using cache mode cache, hotplugged as a
+// new virtio-fs device, and returns the tag the guest should mount it
+// with. Containers using the same volume with the same cache mode share
+// the same daemon.
+func (s *Sandbox) addVirtiofsVolume(source, cache string) (string, error) {
+	s.virtiofsVolumesLock.Lock()
+	defer s.virtiofsVolumesLock.Unlock()
+
+	for _, vol := range s.state.VirtiofsVolumes {
+		if vol.Source == source && vol.Cache == cache {
+			return vol.Tag, nil
+		}
+	}
+
+	caps := s.hypervisor.capabilities()
+	if !caps.IsFsSharingHotplugSupported() {
+		return "", fmt.Errorf("hypervisor does not support hotplugging shared file systems")
+	}
+
+	tag := virtiofsVolumeTag(source, cache)
+	socketPath, err := utils.BuildSocketPath(s.newStore.RunVMStoragePath(), s.id, tag+virtiofsVolumeSocketSuffix)
+	if err != nil {
+		return "", err
+	}
+
+	vol := types.VirtiofsVolume{
+		Source:     source,
+		Tag:        tag,
+		Cache:      cache,
+		SocketPath: socketPath,
+	}
+
+	daemon := s.virtiofsVolumeDaemon(vol)
+	if vol.PID, err = daemon.Start(s.ctx); err != nil {
+		delete(s.virtiofsVolumeDaemons, socketPath)
+		return "", err
+	}
+
+	fs := &config.VhostUserDeviceAttrs{
+		DevID:      tag,
+		SocketPath: socketPath,
+		Type:       config.VhostUserFS,
+		Tag:        tag,
+		Cache:      cache,
+		CacheSize:  s.config.HypervisorConfig.VirtioFSCacheSize,
+	}
+	if _, err = s.hypervisor.hotplugAddDevice(fs, fsDev); err != nil {
+		if stopErr := daemon.Stop(); stopErr != nil {
+			s.Logger().WithError(stopErr).WithField("volume", source).Warn("Could not stop virtiofsd")
+		}
+		delete(s.virtiofsVolumeDaemons, socketPath)
+		return "", err
+	}
+
+	s.state.VirtiofsVolumes = append(s.state.VirtiofsVolumes, vol)
+
+	s.Logger().WithFields(logrus.Fields{
+		"volume": source,
+		"tag":    tag,
+		"cache":  cache,
+		"pid":    vol.PID,
+	}).Info("Volume shared through a dedicated virtiofsd")
+
+	return tag, nil
+}
+
+// stopVirtiofsVolumes stops the daemons dedicated to volumes. Hypervisors
+// cannot unplug virtio-fs devices, so they only go away with the VM.
+func (s *Sandbox) stopVirtiofsVolumes() {
+	s.virtiofsVolumesLock.Lock()
+	defer s.virtiofsVolumesLock.Unlock()
+
+	for _, vol := range s.state.VirtiofsVolumes {
+		if err := s.virtiofsVolumeDaemon(vol).Stop(); err != nil {
+			s.Logger().WithError(err).WithField("volume", vol.Source).Warn("Could not stop virtiofsd")
+		}
+	}
+
+	s.state.VirtiofsVolumes = nil
+	s.virtiofsVolumeDaemons = nil
+}
+
+// checkVirtiofsVolumes returns an error if any of the daemons dedicated to
+// volumes is not running anymore.
+func (s *Sandbox) checkVirtiofsVolumes() error {
+	s.virtiofsVolumesLock.Lock()
+	defer s.virtiofsVolumesLock.Unlock()
+
+	for _, vol := range s.state.VirtiofsVolumes {
+		if err := s.virtiofsVolumeDaemon(vol).Check(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// virtiofsVolumePids returns the pids of the daemons dedicated to volumes.
+func (s *Sandbox) virtiofsVolumePids() []int {
+	s.virtiofsVolumesLock.Lock()
+	defer s.virtiofsVolumesLock.Unlock()
+
+	var pids []int
+	for _, vol := range s.state.VirtiofsVolumes {
+		pids = append(pids, vol.PID)
+	}
+
+	return pids
+}
+
+// virtiofsVolumeCacheByTag returns the cache mode of the daemon serving
+// the virtio-fs device tagged tag.
+func (s *Sandbox) virtiofsVolumeCacheByTag(tag string) string {
+	s.virtiofsVolumesLock.Lock()
+	defer s.virtiofsVolumesLock.Unlock()
+
+	for _, vol := range s.state.VirtiofsVolumes {
+		if vol.Tag == tag {
+			return vol.Cache
+		}
+	}
+
+	return ""
+}
+
+// handleVirtiofsVolumes returns the storages mounting the volumes of c
+// that are shared through a dedicated virtiofsd.
+func (k *kataAgent) handleVirtiofsVolumes(c *Container) []*grpc.Storage {
+	var storages []*grpc.Storage
+
+	for _, m := range c.mounts {
+		if m.VirtiofsTag == "" {
+			continue
+		}
+
+		options := []string{}
+		cache := c.sandbox.virtiofsVolumeCacheByTag(m.VirtiofsTag)
+		if virtiofsDaxEnabled(cache, c.sandbox.config.HypervisorConfig.VirtioFSCacheSize) {
+			options = append(options, sharedDirVirtioFSDaxOptions)
+		}
+
+		storages = append(storages, &grpc.Storage{
+			Driver:     kataVirtioFSDevType,
+			Source:     m.VirtiofsTag,
+			MountPoint: m.Destination,
+			Fstype:     typeVirtioFS,
+			Options:    options,
+		})
+	}
+
+	return storages
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2020 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVirtiofsVolumeTag(t *testing.T) {
+	assert := assert.New(t)
+
+	tag := virtiofsVolumeTag("/var/lib/volume", "auto")
+	assert.Len(tag, 36)
+	assert.Contains(tag, virtiofsVolumeTagPrefix)
+	assert.Equal(tag, virtiofsVolumeTag("/var/lib/volume", "auto"))
+	assert.NotEqual(tag, virtiofsVolumeTag("/var/lib/other", "auto"))
+	assert.NotEqual(tag, virtiofsVolumeTag("/var/lib/volume", "none"))
+}
+
+func TestVirtiofsVolumeCache(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Sandbox{
+		config: &SandboxConfig{
+			HypervisorConfig: HypervisorConfig{
+				SharedFS: config.VirtioFS,
+			},
+		},
+	}
+
+	assert.Empty(s.virtiofsVolumeCache(Mount{}))
+	assert.Equal("none", s.virtiofsVolumeCache(Mount{VirtiofsCache: "none"}))
+
+	s.config.HypervisorConfig.VirtioFSVolumeCache = "auto"
+	assert.Equal("auto", s.virtiofsVolumeCache(Mount{}))
+	assert.Equal("always", s.virtiofsVolumeCache(Mount{VirtiofsCache: "always"}))
+
+	s.config.HypervisorConfig.SharedFS = config.Virtio9P
+	assert.Empty(s.virtiofsVolumeCache(Mount{VirtiofsCache: "always"}))
+}
+
+func TestAddVirtiofsVolume(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Sandbox{
+		id:         "foo",
+		ctx:        context.Background(),
+		hypervisor: &mockHypervisor{},
+		config: &SandboxConfig{
+			HypervisorConfig: HypervisorConfig{
+				SharedFS: config.VirtioFS,
+			},
+		},
+	}
+
+	// The mock hypervisor cannot hotplug shared file systems.
+	_, err := s.addVirtiofsVolume("/var/lib/volume", "auto")
+	assert.Error(err)
+	assert.Empty(s.state.VirtiofsVolumes)
+
+	// Volumes already shared with the same cache mode are reused.
+	vol := types.VirtiofsVolume{
+		Source: "/var/lib/volume",
+		Tag:    virtiofsVolumeTag("/var/lib/volume", "auto"),
+		Cache:  "auto",
+		PID:    1234,
+	}
+	s.state.VirtiofsVolumes = []types.VirtiofsVolume{vol}
+	tag, err := s.addVirtiofsVolume("/var/lib/volume", "auto")
+	assert.NoError(err)
+	assert.Equal(vol.Tag, tag)
+	assert.Equal([]int{1234}, s.virtiofsVolumePids())
+	assert.Equal("auto", s.virtiofsVolumeCacheByTag(tag))
+
+	_, err = s.addVirtiofsVolume("/var/lib/volume", "none")
+	assert.Error(err)
+}
+
+func TestHandleVirtiofsVolumes(t *testing.T) {
+	assert := assert.New(t)
+	k := kataAgent{}
+
+	sandbox := &Sandbox{
+		config: &SandboxConfig{
+			HypervisorConfig: HypervisorConfig{
+				VirtioFSCacheSize: 1024,
+			},
+		},
+	}
+	sandbox.state.VirtiofsVolumes = []types.VirtiofsVolume{
+		{Source: "/host/a", Tag: "kataVolume-a", Cache: "always"},
+		{Source: "/host/c", Tag: "kataVolume-c", Cache: "none"},
+	}
+
+	c := &Container{
+		sandbox: sandbox,
+		mounts: []Mount{
+			{Source: "/host/a", Destination: "/a", VirtiofsTag: "kataVolume-a"},
+			{Source: "/host/b", Destination: "/b"},
+			{Source: "/host/c", Destination: "/c", VirtiofsTag: "kataVolume-c"},
+		},
+	}
+
+	storages := k.handleVirtiofsVolumes(c)
+	assert.Len(storages, 2)
+	assert.Equal(kataVirtioFSDevType, storages[0].Driver)
+	assert.Equal("kataVolume-a", storages[0].Source)
+	assert.Equal("/a", storages[0].MountPoint)
+	assert.Equal(typeVirtioFS, storages[0].Fstype)
+	assert.Equal([]string{sharedDirVirtioFSDaxOptions}, storages[0].Options)
+
+	// No DAX without caching.
+	assert.Equal("kataVolume-c", storages[1].Source)
+	assert.Empty(storages[1].Options)
+
+	sandbox.config.HypervisorConfig.VirtioFSCacheSize = 0
+	storages = k.handleVirtiofsVolumes(c)
+	assert.Empty(storages[0].Options)
+}
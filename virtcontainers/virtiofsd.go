@@ -27,17 +27,50 @@ import (
 const (
 	//Timeout to wait in secounds
 	virtiofsdStartTimeout = 5
+
+	virtiofsCacheNone   = "none"
+	virtiofsCacheAuto   = "auto"
+	virtiofsCacheAlways = "always"
 )
 
+// CheckVirtioFSCacheMode returns an error if mode is not a cache mode
+// supported by virtiofsd.
+func CheckVirtioFSCacheMode(mode string) error {
+	switch mode {
+	case virtiofsCacheNone, virtiofsCacheAuto, virtiofsCacheAlways:
+		return nil
+	}
+
+	return fmt.Errorf("Unsupported virtio-fs cache mode %q, expecting %q, %q or %q", mode, virtiofsCacheNone, virtiofsCacheAuto, virtiofsCacheAlways)
+}
+
+// virtiofsDaxEnabled tells if a share served with cache mode cache is
+// mapped in the guest through a DAX window of cacheSize MiB. Without any
+// caching, the guest must not map host pages directly.
+func virtiofsDaxEnabled(cache string, cacheSize uint32) bool {
+	return cache != virtiofsCacheNone && cacheSize != 0
+}
+
+// virtiofsdLogPath returns the path of the log kept for the diagnostics of
+// the virtiofsd serving socketPath, next to the socket.
+func virtiofsdLogPath(socketPath string) string {
+	return strings.TrimSuffix(socketPath, filepath.Ext(socketPath)) + ".log"
+}
+
 type Virtiofsd interface {
 	// Start virtiofsd, return pid of virtiofsd process
 	Start(context.Context) (pid int, err error)
 	// Stop virtiofsd process
 	Stop() error
+	// Check returns an error if the virtiofsd process is not running
+	// anymore. The guest loses the shared file system when virtiofsd
+	// dies and the vhost-user-fs protocol does not allow reconnecting
+	// a new daemon, so the sandbox cannot be recovered.
+	Check() error
 }
 
 // Helper function to check virtiofsd is serving
-type virtiofsdWaitFunc func(runningCmd *exec.Cmd, stderr io.ReadCloser, debug bool) error
+type virtiofsdWaitFunc func(runningCmd *exec.Cmd, stderr io.ReadCloser, logger *log.Entry) error
 
 type virtiofsd struct {
 	// path to virtiofsd daemon
@@ -58,6 +91,13 @@ type virtiofsd struct {
 	ctx context.Context
 	// wait helper function to check if virtiofsd is serving
 	wait virtiofsdWaitFunc
+	// exited is closed once the process started by Start exited, with
+	// exitErr telling how
+	exited  chan struct{}
+	exitErr error
+	// pidfd refers to a process not started by this virtiofsd, e.g.
+	// when restored from the sandbox state
+	pidfd *os.File
 }
 
 // Open socket on behalf of virtiofsd
@@ -112,10 +152,45 @@ func (v *virtiofsd) Start(ctx context.Context) (int, error) {
 	v.Logger().WithField("path", v.path).Info()
 	v.Logger().WithField("args", strings.Join(args, " ")).Info()
 
+	var stderr io.ReadCloser
+	stderr, err = cmd.StderrPipe()
+	if err != nil {
+		return pid, err
+	}
+
+	if l, err := openBoundedLog(virtiofsdLogPath(v.socketPath), diagnosticsLogSize); err != nil {
+		v.Logger().WithError(err).Warn("failed to open virtiofsd log")
+	} else {
+		stderr = &loggedReader{ReadCloser: stderr, log: l}
+	}
+
 	if err = utils.StartCmd(cmd); err != nil {
 		return pid, err
 	}
 
+	pid = cmd.Process.Pid
+
+	logger := virtLog.WithFields(log.Fields{
+		"source":      "virtiofsd",
+		"pid":         pid,
+		"shared-path": v.sourcePath,
+	})
+
+	// Reap the process as soon as it exits, and keep the result for
+	// Check: the pid alone could be reused by another process.
+	exited := make(chan struct{})
+	go func() {
+		state, err := cmd.Process.Wait()
+		if err != nil {
+			logger.WithError(err).Warn("could not wait for virtiofsd")
+			v.exitErr = err
+		} else {
+			logger.WithField("exit-status", state.String()).Info("virtiofsd exited")
+			v.exitErr = errors.New(state.String())
+		}
+		close(exited)
+	}()
+
 	defer func() {
 		if err != nil {
 			cmd.Process.Kill()
@@ -126,9 +201,60 @@ func (v *virtiofsd) Start(ctx context.Context) (int, error) {
 		v.wait = waitVirtiofsReady
 	}
 
+	if err = v.wait(cmd, stderr, logger); err != nil {
+		return pid, err
+	}
+
+	v.PID = pid
+	v.exited = exited
+
 	return pid, socketFD.Close()
 }
 
+// Check returns an error if the virtiofsd process has exited. The process
+// started by Start is known to have exited once reaped. A process started
+// by someone else, e.g. before the runtime restored the sandbox, is watched
+// through a pidfd opened on the first check.
+func (v *virtiofsd) Check() error {
+	if v.PID == 0 {
+		return errors.New("virtiofsd is not running")
+	}
+
+	if v.exited != nil {
+		select {
+		case <-v.exited:
+			return errors.Wrapf(v.exitErr, "virtiofsd (pid %d) sharing %s exited", v.PID, v.sourcePath)
+		default:
+			return nil
+		}
+	}
+
+	if v.pidfd == nil {
+		pidfd, err := utils.PidfdOpen(v.PID)
+		if err == syscall.ENOSYS {
+			// No pidfd support, the pid is all there is.
+			if err := syscall.Kill(v.PID, syscall.Signal(0)); err != nil {
+				return errors.Wrapf(err, "virtiofsd (pid %d) sharing %s is not running", v.PID, v.sourcePath)
+			}
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "virtiofsd (pid %d) sharing %s is not running", v.PID, v.sourcePath)
+		}
+		v.pidfd = pidfd
+	}
+
+	exited, err := utils.PidfdExited(v.pidfd)
+	if err != nil {
+		return errors.Wrapf(err, "could not check virtiofsd (pid %d) sharing %s", v.PID, v.sourcePath)
+	}
+	if exited {
+		return errors.Errorf("virtiofsd (pid %d) sharing %s exited", v.PID, v.sourcePath)
+	}
+
+	return nil
+}
+
 func (v *virtiofsd) Stop() error {
 	if err := v.kill(); err != nil {
 		return nil
@@ -155,9 +281,8 @@ func (v *virtiofsd) args(FdSocketNumber uint) ([]string, error) {
 	}
 
 	args := []string{
-		// Send logs to syslog
-		"--syslog",
-		// foreground operation
+		// foreground operation, logs are written to stderr and
+		// forwarded to the runtime log
 		"-f",
 		// cache mode for virtiofsd
 		"-o", "cache=" + v.cache,
@@ -183,16 +308,15 @@ func (v *virtiofsd) args(FdSocketNumber uint) ([]string, error) {
 
 func (v *virtiofsd) valid() error {
 	if v.path == "" {
-		errors.New("virtiofsd path is empty")
+		return errors.New("virtiofsd path is empty")
 	}
 
 	if v.socketPath == "" {
-		errors.New("Virtiofsd socket path is empty")
+		return errors.New("Virtiofsd socket path is empty")
 	}
 
 	if v.sourcePath == "" {
-		errors.New("virtiofsd source path is empty")
-
+		return errors.New("virtiofsd source path is empty")
 	}
 
 	return nil
@@ -214,7 +338,7 @@ func (v *virtiofsd) trace(name string) (opentracing.Span, context.Context) {
 	return span, ctx
 }
 
-func waitVirtiofsReady(cmd *exec.Cmd, stderr io.ReadCloser, debug bool) error {
+func waitVirtiofsReady(cmd *exec.Cmd, stderr io.ReadCloser, logger *log.Entry) error {
 	if cmd == nil {
 		return errors.New("cmd is nil")
 	}
@@ -224,9 +348,7 @@ func waitVirtiofsReady(cmd *exec.Cmd, stderr io.ReadCloser, debug bool) error {
 		scanner := bufio.NewScanner(stderr)
 		var sent bool
 		for scanner.Scan() {
-			if debug {
-				virtLog.WithField("source", "virtiofsd").Debug(scanner.Text())
-			}
+			logger.Info(scanner.Text())
 			if !sent && strings.Contains(scanner.Text(), "Waiting for vhost-user socket connection...") {
 				sockReady <- nil
 				sent = true
@@ -243,8 +365,6 @@ func waitVirtiofsReady(cmd *exec.Cmd, stderr io.ReadCloser, debug bool) error {
 			}
 
 		}
-		// Wait to release resources of virtiofsd process
-		cmd.Process.Wait()
 	}()
 
 	var err error
@@ -266,13 +386,23 @@ func (v *virtiofsd) kill() (err error) {
 	}
 
 	err = syscall.Kill(v.PID, syscall.SIGKILL)
-	if err != nil {
+	if err == nil || err == syscall.ESRCH {
 		v.PID = 0
+		v.release()
 	}
 
 	return err
 }
 
+// release closes the pidfd watching a process not started by Start, if
+// opened by Check.
+func (v *virtiofsd) release() {
+	if v.pidfd != nil {
+		v.pidfd.Close()
+		v.pidfd = nil
+	}
+}
+
 // virtiofsdMock  mock implementation for unit test
 type virtiofsdMock struct {
 }
@@ -285,3 +415,7 @@ func (v *virtiofsdMock) Start(ctx context.Context) (int, error) {
 func (v *virtiofsdMock) Stop() error {
 	return nil
 }
+
+func (v *virtiofsdMock) Check() error {
+	return nil
+}
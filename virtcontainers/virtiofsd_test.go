@@ -7,12 +7,14 @@ package virtcontainers
 
 import (
 	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"testing"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -68,7 +70,7 @@ func TestVirtiofsdStart(t *testing.T) {
 				PID:        tt.fields.PID,
 				ctx:        tt.fields.ctx,
 				//Mock  wait function
-				wait: func(runningCmd *exec.Cmd, stderr io.ReadCloser, debug bool) error {
+				wait: func(runningCmd *exec.Cmd, stderr io.ReadCloser, logger *log.Entry) error {
 					return nil
 				},
 			}
@@ -78,6 +80,87 @@ func TestVirtiofsdStart(t *testing.T) {
 				t.Errorf("virtiofsd.Start() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if !tt.wantErr {
+				assert.NotZero(v.PID)
+			}
 		})
 	}
 }
+
+func TestVirtiofsdCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	v := &virtiofsd{}
+	assert.Error(v.Check())
+
+	v = &virtiofsd{PID: os.Getpid()}
+	assert.NoError(v.Check())
+	assert.NoError(v.Check())
+
+	// Reap a short lived process to get a pid that is not in use.
+	cmd := exec.Command("true")
+	assert.NoError(cmd.Run())
+	v = &virtiofsd{PID: cmd.Process.Pid}
+	assert.Error(v.Check())
+
+	// A process started by virtiofsd is known to have exited once reaped.
+	v = &virtiofsd{PID: os.Getpid(), exited: make(chan struct{})}
+	assert.NoError(v.Check())
+	v.exitErr = errors.New("exit status 1")
+	close(v.exited)
+	assert.Error(v.Check())
+}
+
+func TestVirtiofsdArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	sourcePath, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(sourcePath)
+
+	v := &virtiofsd{
+		cache:      "none",
+		sourcePath: sourcePath,
+	}
+
+	args, err := v.args(3)
+	assert.NoError(err)
+	assert.NotContains(args, "--syslog")
+	assert.Contains(args, "-f")
+	assert.Contains(args, "--fd=3")
+	assert.Contains(args, "source="+sourcePath)
+}
+
+func TestVirtiofsdArgsCacheMode(t *testing.T) {
+	assert := assert.New(t)
+
+	sourcePath, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(sourcePath)
+
+	for _, cache := range []string{"none", "auto", "always"} {
+		v := &virtiofsd{
+			cache:      cache,
+			sourcePath: sourcePath,
+		}
+
+		args, err := v.args(3)
+		assert.NoError(err)
+		assert.Contains(args, "cache="+cache)
+	}
+}
+
+func TestCheckVirtioFSCacheMode(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(CheckVirtioFSCacheMode("none"))
+	assert.NoError(CheckVirtioFSCacheMode("auto"))
+	assert.NoError(CheckVirtioFSCacheMode("always"))
+	assert.Error(CheckVirtioFSCacheMode(""))
+	assert.Error(CheckVirtioFSCacheMode("sometimes"))
+
+	assert.True(virtiofsDaxEnabled("auto", 1024))
+	assert.True(virtiofsDaxEnabled("always", 1024))
+	assert.False(virtiofsDaxEnabled("none", 1024))
+	assert.False(virtiofsDaxEnabled("always", 0))
+}
@@ -214,7 +214,7 @@ func NewVM(ctx context.Context, config VMConfig) (*VM, error) {
 	// VMs booted from template are paused, do not check
 	if !config.HypervisorConfig.BootFromTemplate {
 		virtLog.WithField("vm", id).Info("check agent status")
-		err = agent.check()
+		err = agent.check(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -340,6 +340,32 @@ func (v *VM) Stop() error {
 	return v.store.Destroy(v.id)
 }
 
+// Check checks that the hypervisor and the agent of a paused VM are alive.
+// The VM is resumed for the agent to answer, and paused again.
+func (v *VM) Check(ctx context.Context) error {
+	v.logger().Debug("check vm")
+
+	if err := v.hypervisor.check(); err != nil {
+		return fmt.Errorf("hypervisor check failed: %v", err)
+	}
+
+	if err := v.Resume(); err != nil {
+		return err
+	}
+
+	agentErr := v.agent.check(ctx)
+
+	if err := v.Pause(); err != nil {
+		return err
+	}
+
+	if agentErr != nil {
+		return fmt.Errorf("agent check failed: %v", agentErr)
+	}
+
+	return nil
+}
+
 // AddCPUs adds num of CPUs to the VM.
 func (v *VM) AddCPUs(num uint32) error {
 	if num > 0 {
@@ -368,9 +394,9 @@ func (v *VM) AddMemory(numMB uint32) error {
 }
 
 // OnlineCPUMemory puts the hotplugged CPU and memory online.
-func (v *VM) OnlineCPUMemory() error {
+func (v *VM) OnlineCPUMemory(ctx context.Context) error {
 	v.logger().Infof("online CPU %d and memory", v.cpuDelta)
-	err := v.agent.onlineCPUMem(v.cpuDelta, false)
+	err := v.agent.onlineCPUMem(ctx, v.cpuDelta, false)
 	if err == nil {
 		v.cpuDelta = 0
 	}
@@ -380,7 +406,7 @@ func (v *VM) OnlineCPUMemory() error {
 
 // ReseedRNG adds random entropy to guest random number generator
 // and reseeds it.
-func (v *VM) ReseedRNG() error {
+func (v *VM) ReseedRNG(ctx context.Context) error {
 	v.logger().Infof("reseed guest random number generator")
 	urandomDev := "/dev/urandom"
 	data := make([]byte, 512)
@@ -395,14 +421,14 @@ func (v *VM) ReseedRNG() error {
 		return err
 	}
 
-	return v.agent.reseedRNG(data)
+	return v.agent.reseedRNG(ctx, data)
 }
 
 // SyncTime syncs guest time with host time.
-func (v *VM) SyncTime() error {
+func (v *VM) SyncTime(ctx context.Context) error {
 	now := time.Now()
 	v.logger().WithField("time", now).Infof("sync guest time")
-	return v.agent.setGuestDateTime(now)
+	return v.agent.setGuestDateTime(ctx, now)
 }
 
 func (v *VM) assignSandbox(s *Sandbox) error {
@@ -45,6 +45,8 @@ func TestNewVM(t *testing.T) {
 	// VM operations
 	err = vm.Pause()
 	assert.Nil(err)
+	err = vm.Check(ctx)
+	assert.Nil(err)
 	err = vm.Resume()
 	assert.Nil(err)
 	err = vm.Start()
@@ -59,9 +61,9 @@ func TestNewVM(t *testing.T) {
 	assert.Nil(err)
 	err = vm.AddMemory(128)
 	assert.Nil(err)
-	err = vm.OnlineCPUMemory()
+	err = vm.OnlineCPUMemory(context.Background())
 	assert.Nil(err)
-	err = vm.ReseedRNG()
+	err = vm.ReseedRNG(context.Background())
 	assert.Nil(err)
 
 	// template VM
@@ -125,7 +127,7 @@ func TestVMConfigGrpc(t *testing.T) {
 		HypervisorType:   QemuHypervisor,
 		HypervisorConfig: newQemuConfig(),
 		AgentType:        KataContainersAgent,
-		AgentConfig:      KataAgentConfig{false, true, false, false, 0, "", "", []string{}},
+		AgentConfig:      KataAgentConfig{false, true, false, false, 0, "", "", []string{}, false, AgentRequestTimeouts{}, 0},
 		ProxyType:        NoopProxyType,
 	}
 